@@ -2,209 +2,399 @@ package RAG
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
-
+	"path/filepath"
 	"sort"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/generative-ai-go/genai"
-	"github.com/pinecone-io/go-pinecone/v4/pinecone"
 	"google.golang.org/api/option"
 )
 
 const (
 	DEFAULT_TOP_K = 5
+	DEFAULT_CHAT_NAMESPACE = "database-articles"
+	DEFAULT_AGENT_NAMESPACE = "schemas-json"
+	CHAT_FAIL_RESPONSE = "I don't have specific information about that. Could you rephrase your question?"
 )
 
 type AgentResponse struct {
+	// Response is the whole answer in markdown
 	Response      string `json:"response"`
 	SchemaChanges []Table `json:"schema_changes"`
+	DroppedTables []string `json:"dropped_tables"`
+	// SchemaDDL is the script of the DDLStatements, they are generated from the diff of the current schema
+	// and the SchemaChanges, the statements of the model are only used when the current schema is not a list of tables
 	SchemaDDL     string `json:"schema_ddl"`
+	DDLStatements []string `json:"ddl_statements"`
+	// Changes describes the diff of the current schema and the SchemaChanges, one line per change
+	Changes       []string `json:"changes"`
+	Analysis      string `json:"analysis"`
+	Risks         []string `json:"risks"`
+	Rationale     string `json:"rationale"`
+	// Attempts records every generation, the invalid ones were sent back to the model to be corrected
+	Attempts      []AgentAttempt `json:"attempts"`
 }
 
+// RAGmodel is the query surface of the RAG models
+// writing to and managing the vector index are the optional IndexWriter and IndexAdmin interfaces
 type RAGmodel interface {
 	Embed(text string) ([]float32, error)
-	Match(namespace string, query string, topK int) ([]*pinecone.ScoredVector, error)
+	Match(namespace string, query string, topK int) ([]VectorMatch, error)
 	QueryAgent(namespace string, schema string, query string, topK int) (*AgentResponse, error)
 	Report(analytics string, schema string) (string, error)
 	QueryChat(query string) (ChatbotResponse, error)
-	// Upsert(id string, vector []float32, metadata map[string]string) error
+
+	// the Context variants pass the caller's context through to embedding, vector query,
+	// resource fetching and generation so that a slow request can be canceled
+	EmbedContext(ctx context.Context, text string) ([]float32, error)
+	MatchContext(ctx context.Context, namespace string, query string, topK int) ([]VectorMatch, error)
+	QueryAgentContext(ctx context.Context, namespace string, schema string, query string, topK int) (*AgentResponse, error)
+	ReportContext(ctx context.Context, analytics string, schema string) (string, error)
+	QueryChatContext(ctx context.Context, query string) (ChatbotResponse, error)
+
+	// the Filtered variants only use the vectors whose metadata passes the filter,
+	// the filter maps to a Pinecone metadata filter and is evaluated by the local store
+	MatchFiltered(ctx context.Context, namespace string, query string, topK int, filter MetadataFilter) ([]VectorMatch, error)
+	QueryAgentFiltered(ctx context.Context, namespace string, schema string, query string, topK int, filter MetadataFilter) (*AgentResponse, error)
+	QueryChatFiltered(ctx context.Context, query string, filter MetadataFilter) (ChatbotResponse, error)
+
+	// QueryChatStream answers like QueryChatContext but emits the response as it is generated
+	// canceling ctx stops the generation and closes the channel
+	QueryChatStream(ctx context.Context, query string) (<-chan ChatStreamEvent, error)
+	// NewChatSession starts a multi-turn conversation that keeps its history
+	NewChatSession() *ChatSession
+
+	// Close releases the clients of the underlying providers
+	Close() error
+}
+
+// IndexWriter is implemented by the RAG models that can write to their vector index
+type IndexWriter interface {
+	// Upsert writes vectors to a namespace, records with an existing id are replaced
+	Upsert(namespace string, records []VectorRecord) error
+	UpsertContext(ctx context.Context, namespace string, records []VectorRecord) error
+	// Ingest chunks, embeds and upserts documents with the content and source_url metadata the queries read
+	// chunks are stored under content hashes so ingesting the same documents again only writes what changed
+	Ingest(ctx context.Context, namespace string, documents []Document) (IngestResult, error)
+}
+
+// IndexAdmin is implemented by the RAG models that can manage their vector index
+// the vector store must support the operation or ErrUnsupported is returned,
+// IndexStats and DeleteNamespace work on the stored namespaces, the other methods resolve the namespace aliases
+type IndexAdmin interface {
+	IndexStats(ctx context.Context) (IndexStats, error)
+	DeleteNamespace(ctx context.Context, namespace string) error
+	// the snapshots record the embedding model and the dimension so that they are not imported into a mismatched index
+	ExportNamespace(ctx context.Context, namespace string, w io.Writer, options SnapshotOptions) (SnapshotHeader, int, error)
+	ImportNamespace(ctx context.Context, namespace string, r io.Reader, options SnapshotOptions) (SnapshotHeader, int, error)
+	// MigrateNamespace re-embeds the content of the namespace with the current embedding model into a shadow
+	// namespace and switches the namespace alias to it once the shadow is verified
+	MigrateNamespace(ctx context.Context, namespace string) (MigrationResult, error)
 }
 
-func GetRAGTest() RAGmodel { // this is for testing purposes only
+var testOnce sync.Once
+
+// GetRAGTest returns a RAG model built from the environment and the repository .env file
+// this is for testing purposes only, it returns nil when the environment is not configured
+func GetRAGTest() RAGmodel {
+	testOnce.Do(func() {
+		envFiles := []string{}
+		if envFile := repoEnvFile(); envFile != "" {
+			if _, err := os.Stat(envFile); err == nil {
+				envFiles = append(envFiles, envFile)
+			}
+		}
+		config, err := LoadConfigFromEnv(envFiles...)
+		if err != nil {
+			log.Printf("WARNING: failed to load the test config: %v", err)
+			return
+		}
+		// the test runs share their embeddings instead of paying for them again
+		if config.EmbeddingCacheDir == "" {
+			config.EmbeddingCacheDir = filepath.Join(os.TempDir(), "rag-test-embedding-cache")
+		}
+		model, err := NewRAG(context.Background(), config)
+		if err != nil {
+			log.Printf("WARNING: failed to create the test RAG model: %v", err)
+			return
+		}
+		rag = model
+	})
 	return rag
 }
 
+// GetRAG creates the RAG model and exits the process when it fails
+//
+// Deprecated: use NewRAG which returns the error instead of calling log.Fatal
 func GetRAG(config *RAGConfig) RAGmodel {
-	// connect to gemini API
-	if config.GeminiAPIKey == "" {
-		log.Fatal("Gemini API key is required")
-	}
-
-	// Initialize Gemini client
-	geminiClient, err := genai.NewClient(context.Background(), option.WithAPIKey(config.GeminiAPIKey))
+	model, err := NewRAG(context.Background(), config)
 	if err != nil {
-		log.Fatalf("Failed to initialize Gemini client: %v", err)
+		log.Fatal(err)
 	}
+	rag = model
+	return rag
+}
 
-	// get the embedding model
-	embeddingModel := geminiClient.EmbeddingModel(config.GeminiEmbeddingModel)
+// NewRAG creates the RAG model described by the config
+// the returned errors can be checked with errors.Is against ErrMissingAPIKey, ErrModelUnreachable,
+// ErrVectorStoreUnreachable, ErrIndexNotFound, ErrDimensionMismatch and ErrInvalidConfig
+func NewRAG(ctx context.Context, config *RAGConfig) (RAGmodel, error) {
+	if config == nil {
+		return nil, fmt.Errorf("%w: config is required", ErrInvalidConfig)
+	}
+	engine := &RAGEngine{Timeouts: config.Timeouts, EmbeddingModel: config.embeddingModelName()}
+	fail := func(err error) (RAGmodel, error) {
+		engine.Close()
+		return nil, err
+	}
 
-	if res, err := embeddingModel.EmbedContent(context.Background(), genai.Text("Hi, Gemini")); err != nil || res == nil {
-		if err == nil {
-			err = errors.New("model returned a nil result")
+	// connect to gemini API when one of the providers needs it
+	var geminiClient *genai.Client
+	if config.usesGemini() {
+		if config.GeminiAPIKey == "" {
+			return nil, &ProviderError{Provider: PROVIDER_GEMINI, Kind: ErrMissingAPIKey}
 		}
-		geminiClient.Close()
-		log.Fatalf("connection error while trying to connect to gemini: %s\n ERROR: %s", config.GeminiEmbeddingModel, err.Error())
-	}
 
-	// get the generative model
-	generativeModel := geminiClient.GenerativeModel(config.GeminiModel)
-	if res, err := generativeModel.GenerateContent(context.Background(), genai.Text("Hi, Gemini")); err != nil || res == nil {
-		if err == nil {
-			err = errors.New("model returned a nil result")
+		// Initialize Gemini client
+		client, err := genai.NewClient(ctx, option.WithAPIKey(config.GeminiAPIKey))
+		if err != nil {
+			return nil, &ProviderError{Provider: PROVIDER_GEMINI, Kind: ErrModelUnreachable, Err: err}
 		}
-		geminiClient.Close()
-		log.Fatalf("connection error while trying to connect to gemini: %s\n ERROR: %s", config.GeminiModel, err.Error())
+		geminiClient = client
+		engine.closers = append(engine.closers, geminiClient.Close)
 	}
-
-	// connect to the Vector database
-	if config.PineconeAPIKey == "" {
-		geminiClient.Close()
-		log.Fatal("Pinecone API key is required")
+	if config.usesOpenAI() && config.OpenAIBaseURL == "" && config.OpenAIAPIKey == "" {
+		return fail(&ProviderError{Provider: PROVIDER_OPENAI, Kind: ErrMissingAPIKey})
 	}
 
-	// Initialize Pinecone client
-	pineconeClient, err := pinecone.NewClient(pinecone.NewClientParams{
-		ApiKey: config.PineconeAPIKey,
-	})
-
+	// get the embedding and the generative models
+	embedder, err := newEmbedder(config, geminiClient)
 	if err != nil {
-		geminiClient.Close()
-		log.Fatalf("Failed to initialize Pinecone client: %v", err)
+		return fail(err)
 	}
-
-	if _, err := pineconeClient.ListIndexes(context.Background()); err != nil {
-		geminiClient.Close()
-		log.Fatalf("connection error while trying to connect to pinecone ERROR: %s", err.Error())
+	llm, err := newLLM(config, geminiClient)
+	if err != nil {
+		return fail(err)
+	}
+	reranker, err := newReranker(config, llm)
+	if err != nil {
+		return fail(err)
 	}
 
-	// Get index name from environment variable or use default
-	if config.PineconeIndexName == "" {
-		config.PineconeIndexName = "knowledge-index" // default index name
-		log.Printf("Using default index name: %s\n", config.PineconeIndexName)
+	// connect to the Vector database
+	store, err := newVectorStore(ctx, config)
+	if err != nil {
+		return fail(err)
+	}
+	if closer, ok := store.(interface{ Close() error }); ok {
+		engine.closers = append(engine.closers, closer.Close)
 	}
 
-	// Get index host from environment variable
-	if config.PineconeIndexHost == "" {
-		// Alternatively, you can describe the index to get the host
-		idx, err := pineconeClient.DescribeIndex(context.Background(), config.PineconeIndexName)
+	engine.Embedder = embedder
+	if config.EmbeddingCacheSize >= 0 {
+		cache := NewCachedEmbedder(embedder, engine.EmbeddingModel, config.EmbeddingCacheSize)
+		if config.EmbeddingCacheDir != "" {
+			if _, err := cache.WithDisk(config.EmbeddingCacheDir); err != nil {
+				return fail(fmt.Errorf("%w: %v", ErrInvalidConfig, err))
+			}
+		}
+		engine.Embedder = cache
+	}
+	engine.LLM = llm
+	engine.Reranker = reranker
+	engine.RerankMinScore = config.RerankMinScore
+	engine.MMRLambda = config.MMRLambda
+	engine.MaxPerSource = config.MaxPerSource
+	engine.AgentRepairAttempts = config.AgentRepairAttempts
+	engine.Store = store
+	engine.KeywordWeights = config.KeywordWeights
+	if config.KeywordIndexPath != "" {
+		keywords, err := OpenKeywordIndex(config.KeywordIndexPath)
+		if err != nil {
+			return fail(fmt.Errorf("%w: %v", ErrInvalidConfig, err))
+		}
+		engine.Keywords = keywords
+	} else if len(config.KeywordWeights) > 0 {
+		log.Printf("WARNING: The keyword index is not saved, only what this process ingests is searched by keyword")
+		engine.Keywords = NewKeywordIndex()
+	}
+	if config.ResponseCache != nil {
+		engine.ResponseCache = NewResponseCache(*config.ResponseCache)
+	}
+	if config.NamespaceAliasesPath != "" {
+		aliases, err := OpenNamespaceAliases(config.NamespaceAliasesPath)
 		if err != nil {
-			geminiClient.Close()
-			log.Fatalf("Failed to describe index or PINECONE_INDEX_HOST not set: %v", err)
+			return fail(fmt.Errorf("%w: %v", ErrInvalidConfig, err))
 		}
-		config.PineconeIndexHost = idx.Host
-		log.Printf("Retrieved index host: %s\n", config.PineconeIndexHost)
-		log.Printf("Index dimension: %d\n", idx.Dimension)
+		engine.Aliases = aliases
 	}
 
-	// Connect to the index without specifying a namespace (will be set in Match function)
-	indexConn, err := pineconeClient.Index(pinecone.NewIndexConnParams{
-		Host: config.PineconeIndexHost,
-	})
-	if err != nil {
-		log.Printf("ERROR: Failed to connect to index: %v", err)
-		geminiClient.Close()
-		log.Fatalf("Failed to connect to index: %v", err)
+	if config.Lazy {
+		return engine, nil
 	}
 
-	// check the index stats
-	_, err = indexConn.DescribeIndexStats(context.Background()) // this would take some time to complete handshake and stuff XD
+	// warm up the models so that configuration problems surface right away,
+	// the embedder is called directly since a cached warm-up would not reach the model
+	embedding, err := embedder.Embed(ctx, "Hi, Gemini")
 	if err != nil {
-		geminiClient.Close()
-		log.Fatalf("Failed to describe index stats: %v", err)
+		return fail(&ProviderError{Provider: providerName(config.EmbeddingProvider), Kind: ErrModelUnreachable, Err: err})
+	}
+	if _, err := llm.Generate(ctx, "Hi, Gemini"); err != nil {
+		return fail(&ProviderError{Provider: providerName(config.LLMProvider), Kind: ErrModelUnreachable, Err: err})
+	}
+
+	// make sure the index was built with the same embedding dimension
+	if reporter, ok := store.(DimensionReporter); ok {
+		dimension, err := reporter.Dimension(ctx)
+		if err != nil {
+			return fail(err)
+		}
+		if dimension != 0 && dimension != len(embedding) {
+			return fail(&DimensionMismatchError{Embedding: len(embedding), Index: dimension})
+		}
+		log.Printf("INFO: The index and the embedding model both use %d dimensions", len(embedding))
 	}
+	engine.checkAliases(len(embedding))
+
+	return engine, nil
+}
 
-	rag = &RAGPineconeGemini{
-		GeminiClient:    geminiClient,
-		DbClient:        pineconeClient,
-		IndexConn:       indexConn,
-		IndexHost:       config.PineconeIndexHost,
-		EmbeddingModel:  embeddingModel,
-		GenerativeModel: generativeModel,
+// Close releases the clients the engine was built with
+func (r *RAGEngine) Close() error {
+	if stats, ok := r.EmbeddingCacheStats(); ok && stats.Hits+stats.Misses > 0 {
+		log.Printf("INFO: Embedding cache: %d hits (%d from disk), %d misses, %.0f%% hit rate", stats.Hits, stats.DiskHits, stats.Misses, stats.HitRate()*100)
+	}
+	var errs []error
+	for _, closer := range r.closers {
+		if err := closer(); err != nil {
+			errs = append(errs, err)
+		}
 	}
+	r.closers = nil
+	return errors.Join(errs...)
+}
 
-	return rag
+// implement the RAGmodel interface for the RAGEngine
+func (r *RAGEngine) Embed(text string) ([]float32, error) {
+	return r.EmbedContext(context.Background(), text)
 }
 
-// implement the RAGmodel interface for the RAGConfig
-func (r *RAGPineconeGemini) Embed(text string) ([]float32, error) {
+func (r *RAGEngine) EmbedContext(ctx context.Context, text string) ([]float32, error) {
+	ctx, cancel := withStageTimeout(ctx, r.Timeouts.Embed)
+	defer cancel()
+
 	// start a timer
 	startTime := time.Now()
-	res, err := r.EmbeddingModel.EmbedContent(context.Background(), genai.Text(text))
+	embedding, err := r.Embedder.Embed(ctx, text)
 	if err != nil {
 		return nil, err
 	}
 	log.Printf("INFO: embedding the query took ==> %f seconds", time.Since(startTime).Seconds())
-	return res.Embedding.Values, nil
+	return embedding, nil
+}
+
+func (r *RAGEngine) Match(namespace string, query string, topK int) ([]VectorMatch, error) {
+	return r.MatchContext(context.Background(), namespace, query, topK)
 }
 
-func (r *RAGPineconeGemini) Match(namespace string, query string, topK int) ([]*pinecone.ScoredVector, error) {
+func (r *RAGEngine) MatchContext(ctx context.Context, namespace string, query string, topK int) ([]VectorMatch, error) {
+	return r.MatchFiltered(ctx, namespace, query, topK, nil)
+}
+
+// MatchFiltered only matches the vectors whose metadata passes the filter, a nil filter matches every vector
+func (r *RAGEngine) MatchFiltered(ctx context.Context, namespace string, query string, topK int, filter MetadataFilter) ([]VectorMatch, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	requested := namespace
+	requestedTopK := topK
+	namespace = r.resolveNamespace(namespace)
 	// Log which namespace we're querying
 	log.Printf("INFO: Querying namespace: %s", namespace)
 
-	// Create a connection with the specified namespace
-	indexConn := r.IndexConn.WithNamespace(namespace)
-
 	topK += 5 // add 5 to the topK to get more results to replace the missing ones
+	diversify := r.MMRLambda > 0 || r.MaxPerSource > 0
+	if diversify {
+		// the diversification needs candidates to choose from
+		topK = max(topK, requestedTopK*MMR_CANDIDATE_FACTOR)
+	}
 	// get the embedding of the query
-	queryEmbedding, err := r.Embed(query)
+	queryEmbedding, err := r.EmbedContext(ctx, query)
 	if err != nil {
 		log.Printf("ERROR: Failed to generate embedding: %v", err)
 		return nil, err
 	}
 
+	queryCtx, cancel := withStageTimeout(ctx, r.Timeouts.Query)
+	defer cancel()
+
 	// start a timer
 	startTime := time.Now()
 	// query the vector store with the correct namespace
-	results, err := indexConn.QueryByVectorValues(context.Background(), &pinecone.QueryByVectorValuesRequest{
-		Vector:          queryEmbedding,
-		TopK:            uint32(topK),
-		IncludeMetadata: true,
-		IncludeValues:   false,
+	matches, err := r.Store.Query(queryCtx, VectorQuery{
+		Namespace:     namespace,
+		Vector:        queryEmbedding,
+		TopK:          topK,
+		IncludeValues: r.MMRLambda > 0,
+		Filter:        filter,
 	})
 	if err != nil {
-		log.Printf("ERROR: Pinecone query failed: %v", err)
+		log.Printf("ERROR: vector store query failed: %v", err)
 		return nil, err
 	}
 	log.Printf("INFO: querying the vector store took ==> %f seconds", time.Since(startTime).Seconds())
+	// merge the exact keyword matches when the namespace uses the hybrid retrieval
+	if weight := r.keywordWeight(requested, namespace); weight > 0 {
+		matches = r.hybridMatches(namespace, query, matches, topK, weight, filter)
+	}
+	// score the candidates against the query and keep the best ones,
+	// all of them when the diversification chooses next
+	if r.Reranker != nil {
+		limit := requestedTopK
+		if diversify {
+			limit = len(matches)
+		}
+		matches = r.rerank(ctx, query, matches, limit)
+	}
+	// prefer the matches that add something to the ones already picked
+	if diversify {
+		matches = r.diversify(ctx, namespace, matches, requestedTopK)
+	}
 	// return the results
-	return results.Matches, nil
+	return matches, nil
 }
 
 // QueryAgent queries the agent with the given namespace, schema, query, and topK
 // this is the main function that will be used to query in agent mode and get the response
-func (r *RAGPineconeGemini) QueryAgent(namespace string, schema string, query string, topK int) (*AgentResponse, error) {
+func (r *RAGEngine) QueryAgent(namespace string, schema string, query string, topK int) (*AgentResponse, error) {
+	return r.QueryAgentContext(context.Background(), namespace, schema, query, topK)
+}
+
+func (r *RAGEngine) QueryAgentContext(ctx context.Context, namespace string, schema string, query string, topK int) (*AgentResponse, error) {
+	return r.QueryAgentFiltered(ctx, namespace, schema, query, topK, nil)
+}
+
+// QueryAgentFiltered only uses the resources whose metadata passes the filter
+func (r *RAGEngine) QueryAgentFiltered(ctx context.Context, namespace string, schema string, query string, topK int, filter MetadataFilter) (*AgentResponse, error) {
 	if topK == 0 {
 		topK = DEFAULT_TOP_K
 	}
 
 	// if namespace is not provided, use the default namespace
 	if namespace == "" {
-		namespace = "schemas-json"
+		namespace = DEFAULT_AGENT_NAMESPACE
 		log.Printf("INFO: using default namespace: %s", namespace)
 	}
 
 	// get the matches
-	matches, err := r.Match(namespace, query, topK)
+	matches, err := r.MatchFiltered(ctx, namespace, query, topK, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -212,7 +402,7 @@ func (r *RAGPineconeGemini) QueryAgent(namespace string, schema string, query st
 	startTime := time.Now()
 	// get the resources
 	resourcesChan := make(chan string, topK)
-	r.fetchResourcesConcurrently(resourcesChan, matches, topK)
+	r.fetchResourcesConcurrently(ctx, resourcesChan, matches, topK)
 	resources := ""
 	for resource := range resourcesChan {
 		resources += "--------------------------------\n"
@@ -220,108 +410,176 @@ func (r *RAGPineconeGemini) QueryAgent(namespace string, schema string, query st
 	}
 	resources += "--------------------------------\n"
 	log.Printf("INFO: fetching the resources took ==> %f seconds", time.Since(startTime).Seconds())
+	// the known schemas are given to the model in the compact form
+	current, known := readSchema(schema)
+	promptSchema := schema
+	if known && len(current) > 0 {
+		promptSchema = CompactSchema(current)
+	} else if !known {
+		log.Printf("WARNING: The current schema is neither a list of tables nor DDL, the DDL of the model is used as is")
+	}
 	// get the prompt
-	prompt := fmt.Sprintf(AGENT_PROMPT_TEMPLATE, resources, schema, query)
+	prompt := fmt.Sprintf(AGENT_PROMPT_TEMPLATE, resources, promptSchema, query)
 
-	// get the model
-	model := r.GenerativeModel
 	// start a timer
 	startTime = time.Now()
-	// get the response
-	response, err := model.GenerateContent(context.Background(), genai.Text(prompt))
+	// get the response as a single JSON object, the invalid ones are sent back to be corrected
+	output, attempts, err := r.generateAgentOutput(ctx, prompt, schema, current)
 	if err != nil {
 		return nil, err
 	}
-	log.Printf("INFO: generating the response took ==> %f seconds", time.Since(startTime).Seconds())
-	// concatenate the response
-	responseText := ""
-	for _, part := range response.Candidates[0].Content.Parts {
-		if textPart, ok := part.(genai.Text); ok {
-			responseText += string(textPart)
-		}
-	}
-
-	// extract the schema changes by looking for the keyword "SCHEMA CHANGES" from the responseText
-	// Regex patterns to match code blocks
-	// jsonRe := regexp.MustCompile("```json\\s*\n([\\s\\S]*?)\n```")
-	// sqlRe := regexp.MustCompile("```sql\\s*\n([\\s\\S]*?)\n```")
-	// log.Println(responseText, "\n\n\n")
-	// // Extract code blocks
-	// jsonMatch := jsonRe.FindStringSubmatch(responseText)
-	// sqlMatch := sqlRe.FindStringSubmatch(responseText)
-	// log.Println(jsonMatch, "\n\n\n")
-	// log.Println(sqlMatch, "\n\n\n")
-	// log.Println(jsonMatch[0])
-	// // Join the extracted lines
-	// schemaChanges := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(jsonMatch[0]), "```json"), "```")
-	// schemaDDL := strings.TrimSpace(sqlMatch[0])
-	codeExtractor := NewCodeExtractor()
-	schemaChanges := codeExtractor.ExtractJSONBlocks(responseText)[0]
-	schemaDDL := codeExtractor.ExtractSQLBlocks(responseText)[0]
-	
-	// log.Println(schemaChanges.RawCode,"\n\n\n\n")
-	// log.Println(schemaDDL.Code,"\n\n\n\n")
-	var tables []Table
-	if err := json.Unmarshal([]byte(schemaChanges.RawCode), &tables); err != nil {
-		return nil, err
+	log.Printf("INFO: generating the response in %d attempts took ==> %f seconds", len(attempts), time.Since(startTime).Seconds())
+	statements := output.DDL
+	if output.statements != nil {
+		statements = output.statements
 	}
 	return &AgentResponse{
-		SchemaChanges: tables,
-		SchemaDDL: schemaDDL.Code,
-		Response: responseText,
+		Response: output.Response,
+		SchemaChanges: output.SchemaChanges,
+		DroppedTables: output.DroppedTables,
+		SchemaDDL: agentDDL(statements),
+		DDLStatements: statements,
+		Changes: output.changes,
+		Analysis: output.Analysis,
+		Risks: output.Risks,
+		Rationale: output.Rationale,
+		Attempts: attempts,
 	}, nil
 }
 
 // generate a report to a project manager based on the analytics of there database
 // the report should be in a markdown format
-func (r *RAGPineconeGemini) Report(analytics string, schema string) (string, error) {
+func (r *RAGEngine) Report(analytics string, schema string) (string, error) {
+	return r.ReportContext(context.Background(), analytics, schema)
+}
+
+func (r *RAGEngine) ReportContext(ctx context.Context, analytics string, schema string) (string, error) {
 	// get the prompt
 	prompt := fmt.Sprintf(REPORT_PROMPT_TEMPLATE, "resources: none", analytics, schema)
 
-	// get the model
-	model := r.GenerativeModel
-
 	// start a timer
 	startTime := time.Now()
 	// get the response
-	response, err := model.GenerateContent(context.Background(), genai.Text(prompt))
+	responseText, err := r.generate(ctx, prompt)
 	if err != nil {
 		return "", err
 	}
 	log.Printf("INFO: generating the report took ==> %f seconds", time.Since(startTime).Seconds())
-	// concatenate the response
-	responseText := ""
-	for _, part := range response.Candidates[0].Content.Parts {
-		if textPart, ok := part.(genai.Text); ok {
-			responseText += string(textPart)
-		}
-	}
 	return responseText, nil
 }
 
 // QueryChat implements a specialized version of query for chat interactions
 // It retrieves data from the vector database using the specified namespace
 // and formats a response using the chatbot prompt template
-func (r *RAGPineconeGemini) QueryChat(query string) (ChatbotResponse, error) {
-	topK := DEFAULT_TOP_K
-	namespace := "database-articles"
+func (r *RAGEngine) QueryChat(query string) (ChatbotResponse, error) {
+	return r.QueryChatContext(context.Background(), query)
+}
 
+func (r *RAGEngine) QueryChatContext(ctx context.Context, query string) (ChatbotResponse, error) {
+	return r.QueryChatFiltered(ctx, query, nil)
+}
+
+// QueryChatFiltered answers from the articles whose metadata passes the filter,
+// the filtered answers are not cached since the response cache does not know the filters
+func (r *RAGEngine) QueryChatFiltered(ctx context.Context, query string, filter MetadataFilter) (ChatbotResponse, error) {
+	request, err := r.prepareChat(ctx, query, filter)
+	if err != nil {
+		return ChatbotResponse{}, err
+	}
+	if request.cached != nil {
+		return *request.cached, nil
+	}
+	prompt, sources := request.prompt, request.sources
+	if prompt == "" {
+		return ChatbotResponse{
+			ResponseText: CHAT_FAIL_RESPONSE,
+			Sources:      nil,
+		}, nil
+	}
+
+	// Generate response using the model
 	startTime := time.Now()
-	matches, err := r.Match(namespace, query, topK)
+	responseText, err := r.generate(ctx, prompt)
 	if err != nil {
-		log.Printf("ERROR: Failed to find relevant documents: %v", err)
+		log.Printf("ERROR: Failed to generate response: %v", err)
 		return ChatbotResponse{}, err
 	}
-	log.Printf("INFO: Vector matching took %f seconds", time.Since(startTime).Seconds())
+	log.Printf("INFO: Response generation took %f seconds", time.Since(startTime).Seconds())
+
+	var chatbotResponse ChatbotResponse
+	if responseText == "" {
+		chatbotResponse.ResponseText = CHAT_FAIL_RESPONSE
+		log.Printf("WARNING: Generated response is empty, using fallback response")
+	} else {
+		chatbotResponse.ResponseText = responseText
+	}
+	chatbotResponse.Sources = sources
+	if responseText != "" {
+		r.cacheResponse(request, query, chatbotResponse)
+	}
+
+	return chatbotResponse, nil
+}
 
-	chatFailResponse := "I don't have specific information about that. Could you rephrase your question?"
+// chatRequest is a chat query after the response cache lookup and the retrieval of its context
+type chatRequest struct {
+	namespace string
+	// embedding is set when the response is to be stored in the response cache
+	embedding []float32
+	// cached is the response of a near-identical query, nothing is retrieved then
+	cached  *ChatbotResponse
+	prompt  string
+	sources []string
+}
+
+// prepareChat answers from the response cache or retrieves the context of the query,
+// QueryChatFiltered and QueryChatStream share it so that they answer from the same namespace and topK
+func (r *RAGEngine) prepareChat(ctx context.Context, query string, filter MetadataFilter) (chatRequest, error) {
+	request := chatRequest{namespace: r.resolveNamespace(DEFAULT_CHAT_NAMESPACE)}
+	// a near-identical question that was already answered skips retrieval and generation
+	if r.ResponseCache != nil && len(filter) == 0 {
+		embedding, err := r.EmbedContext(ctx, query)
+		if err != nil {
+			return request, err
+		}
+		if response, similarity, ok := r.ResponseCache.Lookup(request.namespace, embedding); ok {
+			log.Printf("INFO: Answering from the response cache, similarity %f", similarity)
+			response.FromCache = true
+			request.cached = &response
+			return request, nil
+		}
+		request.embedding = embedding
+	}
+
+	prompt, sources, err := r.chatPrompt(ctx, DEFAULT_CHAT_NAMESPACE, DEFAULT_TOP_K, query, query, filter)
+	if err != nil {
+		return request, err
+	}
+	request.prompt, request.sources = prompt, sources
+	return request, nil
+}
+
+// cacheResponse stores the generated response of a query that missed the response cache
+func (r *RAGEngine) cacheResponse(request chatRequest, query string, response ChatbotResponse) {
+	if request.embedding != nil {
+		r.ResponseCache.Store(request.namespace, query, request.embedding, response)
+	}
+}
+
+// chatPrompt retrieves the context matching the retrieval query and formats the chatbot prompt for the question
+// it returns an empty prompt when nothing relevant was found
+func (r *RAGEngine) chatPrompt(ctx context.Context, namespace string, topK int, retrievalQuery string, question string, filter MetadataFilter) (string, []string, error) {
+	startTime := time.Now()
+	matches, err := r.MatchFiltered(ctx, namespace, retrievalQuery, topK, filter)
+	if err != nil {
+		log.Printf("ERROR: Failed to find relevant documents: %v", err)
+		return "", nil, err
+	}
+	log.Printf("INFO: Vector matching took %f seconds", time.Since(startTime).Seconds())
 
 	if len(matches) == 0 {
 		log.Printf("WARNING: No vector matches found for query in namespace %s", namespace)
-		return ChatbotResponse{
-			ResponseText: chatFailResponse,
-			Sources:      nil,
-		}, nil
+		return "", nil, nil
 	}
 
 	// Extract context from matches with focus on content and source_url
@@ -333,8 +591,8 @@ func (r *RAGPineconeGemini) QueryChat(query string) (ChatbotResponse, error) {
 		resources += "--------------------------------\n"
 
 		// Extract and track source URLs
-		if url, ok := match.Vector.Metadata.Fields["source_url"]; ok {
-			sourceURL := strings.Trim(url.GetStringValue(), "\"\n \t")
+		if _, ok := match.Metadata["source_url"]; ok {
+			sourceURL := match.MetadataString("source_url")
 			if !sourceMap[sourceURL] {
 				sourceMap[sourceURL] = true
 				sources = append(sources, sourceURL)
@@ -342,21 +600,26 @@ func (r *RAGPineconeGemini) QueryChat(query string) (ChatbotResponse, error) {
 			}
 		}
 
+		// the section of the article the chunk comes from
+		if breadcrumb := match.MetadataString("breadcrumb"); breadcrumb != "" {
+			resources += fmt.Sprintf("Section: %s\n", breadcrumb)
+		}
+
 		// Extract content
-		if content, ok := match.Vector.Metadata.Fields["content"]; ok {
-			contentText := strings.Trim(content.GetStringValue(), "\"\n \t")
+		if _, ok := match.Metadata["content"]; ok {
+			contentText := match.MetadataString("content")
 			if contentText != "" {
 				resources += contentText + "\n"
 			} else {
-				log.Printf("WARNING: Empty content found in match with ID: %s", match.Vector.Id)
+				log.Printf("WARNING: Empty content found in match with ID: %s", match.ID)
 			}
 		} else {
-			log.Printf("WARNING: No 'content' field found in metadata for match with ID: %s", match.Vector.Id)
+			log.Printf("WARNING: No 'content' field found in metadata for match with ID: %s", match.ID)
 
 			// Fallback: try to find any text content in other metadata fields
-			for key, value := range match.Vector.Metadata.Fields {
-				if key != "source_url" && value.GetStringValue() != "" {
-					resources += fmt.Sprintf("%s: %s\n", key, value.GetStringValue())
+			for key := range match.Metadata {
+				if value := match.MetadataString(key); key != "source_url" && key != "breadcrumb" && value != "" {
+					resources += fmt.Sprintf("%s: %s\n", key, value)
 				}
 			}
 		}
@@ -373,54 +636,33 @@ func (r *RAGPineconeGemini) QueryChat(query string) (ChatbotResponse, error) {
 	}
 
 	// Format prompt using the chatbot template
-	prompt := fmt.Sprintf(CHATBOT_PROMPT_TEMPLATE, resources, query)
-
-	// Generate response using the model
-	startTime = time.Now()
-	response, err := r.GenerativeModel.GenerateContent(context.Background(), genai.Text(prompt))
-	if err != nil {
-		log.Printf("ERROR: Failed to generate response: %v", err)
-		return ChatbotResponse{}, err
-	}
-	log.Printf("INFO: Response generation took %f seconds", time.Since(startTime).Seconds())
-
-	// Extract text from response
-	responseText := ""
-	for _, part := range response.Candidates[0].Content.Parts {
-		if textPart, ok := part.(genai.Text); ok {
-			responseText += string(textPart)
-		}
-	}
-
-	var chatbotResponse ChatbotResponse
-	if responseText == "" {
-		chatbotResponse.ResponseText = chatFailResponse
-		log.Printf("WARNING: Generated response is empty, using fallback response")
-	} else {
-		chatbotResponse.ResponseText = responseText
-	}
-	chatbotResponse.Sources = sources
-
-	return chatbotResponse, nil
+	return fmt.Sprintf(CHATBOT_PROMPT_TEMPLATE, resources, question), sources, nil
 }
 
+// generate runs the LLM under the generation timeout
+func (r *RAGEngine) generate(ctx context.Context, prompt string) (string, error) {
+	ctx, cancel := withStageTimeout(ctx, r.Timeouts.Generate)
+	defer cancel()
+	return r.LLM.Generate(ctx, prompt)
+}
 
-func (r *RAGPineconeGemini) fetchResourcesConcurrently(resources chan string, matches []*pinecone.ScoredVector, topK int) {
+func (r *RAGEngine) fetchResourcesConcurrently(ctx context.Context, resources chan string, matches []VectorMatch, topK int) {
 	// sort the matches by score
 	sort.Slice(matches, func(i, j int) bool {
 		return matches[i].Score > matches[j].Score
 	})
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := withStageTimeout(ctx, r.Timeouts.fetch())
 	defer cancel()
 
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 	var fetchedCount int
+	var closed bool
 
 	// Create HTTP client with timeout
 	client := &http.Client{
-		Timeout: 5 * time.Second,
+		Timeout: r.Timeouts.fetchRequest(),
 	}
 
 	for _, match := range matches {
@@ -433,7 +675,7 @@ func (r *RAGPineconeGemini) fetchResourcesConcurrently(resources chan string, ma
 		mu.Unlock()
 
 		wg.Add(1)
-		go func(match *pinecone.ScoredVector) {
+		go func(match VectorMatch) {
 			defer wg.Done()
 
 			select {
@@ -449,8 +691,13 @@ func (r *RAGPineconeGemini) fetchResourcesConcurrently(resources chan string, ma
 				mu.Unlock()
 
 				// fetch the resource by making a get request to the source_url in the metadata
-				url := strings.Trim(match.Vector.Metadata.Fields["source_url"].GetStringValue(), "\"\n \t")
-				response, err := client.Get(url)
+				url := match.MetadataString("source_url")
+				request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+				if err != nil {
+					log.Printf("Warning: Invalid resource url %s: %v", url, err)
+					return
+				}
+				response, err := client.Do(request)
 				if err != nil {
 					log.Printf("Warning: Failed to fetch resource from %s: %v", url, err)
 					return
@@ -469,14 +716,12 @@ func (r *RAGPineconeGemini) fetchResourcesConcurrently(resources chan string, ma
 				}
 
 				// Try to send the resource, but check count first
+				// the channel holds topK resources so the send never blocks
 				mu.Lock()
-				if fetchedCount < topK {
-					select {
-					case resources <- string(body):
-						fetchedCount++
-						log.Printf("INFO: Successfully fetched resource %d/%d", fetchedCount, topK)
-					case <-ctx.Done():
-					}
+				if !closed && fetchedCount < topK {
+					resources <- string(body)
+					fetchedCount++
+					log.Printf("INFO: Successfully fetched resource %d/%d", fetchedCount, topK)
 				}
 				mu.Unlock()
 			}
@@ -498,66 +743,9 @@ func (r *RAGPineconeGemini) fetchResourcesConcurrently(resources chan string, ma
 	}
 
 	// Close the resources channel to signal completion
+	// late goroutines see the closed flag and drop their resource
+	mu.Lock()
+	closed = true
 	close(resources)
-}
-
-// CheckIndexStats checks the statistics of the Pinecone index
-func (r *RAGPineconeGemini) checkIndexStats(namespace string) error {
-	log.Printf("=== CHECKING INDEX STATISTICS ===")
-
-	// Get index description
-	indexName := os.Getenv("PINECONE_INDEX_NAME")
-	if indexName == "" {
-		indexName = "knowledge-index"
-	}
-
-	idx, err := r.DbClient.DescribeIndex(context.Background(), indexName)
-	if err != nil {
-		log.Printf("ERROR: Failed to describe index: %v", err)
-		return err
-	}
-
-	log.Printf("Index name: %s", idx.Name)
-	log.Printf("Index dimension: %d", idx.Dimension)
-	log.Printf("Index metric: %s", idx.Metric)
-	log.Printf("Index host: %s", idx.Host)
-	log.Printf("Index status: %s", idx.Status.State)
-
-	// Connect to index to get stats
-	indexConn, err := r.DbClient.Index(pinecone.NewIndexConnParams{
-		Host:      r.IndexHost,
-		Namespace: namespace,
-	})
-	if err != nil {
-		log.Printf("ERROR: Failed to connect to index for stats: %v", err)
-		return err
-	}
-	defer indexConn.Close()
-
-	// Get index statistics
-	stats, err := indexConn.DescribeIndexStats(context.Background())
-	if err != nil {
-		log.Printf("ERROR: Failed to get index stats: %v", err)
-		return err
-	}
-
-	log.Printf("Total vector count: %d", stats.TotalVectorCount)
-	log.Printf("Index fullness: %f", stats.IndexFullness)
-
-	if stats.Namespaces != nil {
-		log.Printf("Available namespaces:")
-		for ns, nsStats := range stats.Namespaces {
-			log.Printf("  Namespace '%s': %d vectors", ns, nsStats.VectorCount)
-		}
-
-		// Check if our specific namespace exists
-		if nsStats, exists := stats.Namespaces[namespace]; exists {
-			log.Printf("Target namespace '%s' has %d vectors", namespace, nsStats.VectorCount)
-		} else {
-			log.Printf("WARNING: Target namespace '%s' does not exist in index!", namespace)
-		}
-	}
-
-	log.Printf("=== END INDEX STATISTICS ===")
-	return nil
+	mu.Unlock()
 }
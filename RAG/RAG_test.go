@@ -28,6 +28,16 @@ func beforeAgent() {
 	os.WriteFile("testIO/query.txt", []byte(query), 0644)
 }
 
+// liveRAG returns the package level RAG model used by the integration tests
+// the tests are skipped when it was not initialized with real credentials
+func liveRAG(t *testing.T) RAG.RAGmodel {
+	rag := RAG.GetRAGTest()
+	if rag == nil {
+		t.Skip("skipping integration test: the RAG model is not initialized")
+	}
+	return rag
+}
+
 func afterAgent() {
 	// delete the files schema.json and query.txt
 	os.Remove("testIO/schema.json")
@@ -72,9 +82,9 @@ func afterReport() {
 }
 
 func TestRAG(t *testing.T) {
+	rag := liveRAG(t)
 	beforeAgent()
 	defer afterAgent()
-	rag := RAG.GetRAGTest()
 	// read the schema from the file schema.json
 	schema, err := os.ReadFile("testIO/schema.json")
 	if err != nil {
@@ -111,9 +121,9 @@ func TestRAG(t *testing.T) {
 }
 
 func TestEmbed(t *testing.T) {
+	rag := liveRAG(t)
 	beforeAgent()
 	defer afterAgent()
-	rag := RAG.GetRAGTest()
 	// read the query from the file query.txt
 	query, err := os.ReadFile("testIO/query.txt")
 	if err != nil {
@@ -134,9 +144,9 @@ func TestEmbed(t *testing.T) {
 }
 
 func TestMatch(t *testing.T) {
+	rag := liveRAG(t)
 	beforeAgent()
 	defer afterAgent()
-	rag := RAG.GetRAGTest()
 	// read the query from the file query.txt
 	query, err := os.ReadFile("testIO/query.txt")
 	if err != nil {
@@ -149,16 +159,16 @@ func TestMatch(t *testing.T) {
 	}
 	str := ""
 	for _, match := range matches {
-		str += fmt.Sprintf("Match: %s, Score: %f\n", match.Vector.Id, match.Score)
+		str += fmt.Sprintf("Match: %s, Score: %f\n", match.ID, match.Score)
 	}
 	os.WriteFile("testIO/matches.txt", []byte(str), 0644)
 
 }
 
 func TestMatchWithRest(t *testing.T) {
+	rag := liveRAG(t)
 	beforeAgent()
 	defer afterAgent()
-	rag := RAG.GetRAGTest()
 	// read the query from the file query.txt
 	query, err := os.ReadFile("testIO/query.txt")
 	if err != nil {
@@ -203,9 +213,9 @@ func TestMatchWithRest(t *testing.T) {
 }
 
 func TestReport(t *testing.T) {
+	rag := liveRAG(t)
 	beforeReport()
 	defer afterReport()
-	rag := RAG.GetRAGTest()
 	// read the analytics from the file analytics.json
 	analytics, err := os.ReadFile("testIO/analytics.json")
 	if err != nil {
@@ -226,6 +236,9 @@ func TestReport(t *testing.T) {
 }
 
 func TestReportUsingConfig(t *testing.T) {
+	if os.Getenv("GEMINI_API_KEY") == "" || os.Getenv("PINECONE_API_KEY") == "" {
+		t.Skip("skipping integration test: GEMINI_API_KEY and PINECONE_API_KEY are required")
+	}
 	beforeReport()
 	defer afterReport()
 	rag := RAG.GetRAG(&RAG.RAGConfig{
@@ -0,0 +1,111 @@
+package RAG
+
+import (
+	"strings"
+)
+
+const (
+	DEFAULT_CHUNK_SIZE    = 1000
+	DEFAULT_CHUNK_OVERLAP = 200
+)
+
+// Chunk is a part of a document that is embedded on its own
+type Chunk struct {
+	Content string
+	// Index is the position of the chunk in its document
+	Index int
+	// Metadata is stored along with the content of the chunk
+	Metadata map[string]any
+}
+
+// Chunker splits a document into chunks
+type Chunker interface {
+	Chunk(document Document) []Chunk
+}
+
+// TextChunker packs the paragraphs of a document into chunks of about Size characters
+// consecutive chunks share about Overlap characters so that no sentence loses its context
+type TextChunker struct {
+	// Size defaults to DEFAULT_CHUNK_SIZE
+	Size int
+	// Overlap defaults to DEFAULT_CHUNK_OVERLAP, a negative value disables it
+	Overlap int
+}
+
+func (c *TextChunker) Chunk(document Document) []Chunk {
+	size := c.Size
+	if size <= 0 {
+		size = DEFAULT_CHUNK_SIZE
+	}
+	overlap := c.Overlap
+	if overlap == 0 {
+		overlap = DEFAULT_CHUNK_OVERLAP
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+
+	chunks := []Chunk{}
+	current := ""
+	// pending is set while current has content that is not part of a chunk yet
+	pending := false
+	for _, paragraph := range splitParagraphs(document.Content, size-overlap) {
+		if pending && len(current)+len(paragraph)+2 > size {
+			chunks = append(chunks, Chunk{Content: current, Index: len(chunks)})
+			current = overlapTail(current, overlap)
+		}
+		if current != "" {
+			current += "\n\n"
+		}
+		current += paragraph
+		pending = true
+	}
+	if pending {
+		chunks = append(chunks, Chunk{Content: current, Index: len(chunks)})
+	}
+	return chunks
+}
+
+// splitParagraphs splits text on blank lines, paragraphs longer than size are split on whitespace
+func splitParagraphs(text string, size int) []string {
+	paragraphs := []string{}
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		for len(paragraph) > size {
+			cut := strings.LastIndexAny(paragraph[:size], " \n\t")
+			if cut <= 0 {
+				cut = size
+			}
+			paragraphs = append(paragraphs, strings.TrimSpace(paragraph[:cut]))
+			paragraph = strings.TrimSpace(paragraph[cut:])
+		}
+		if paragraph != "" {
+			paragraphs = append(paragraphs, paragraph)
+		}
+	}
+	return paragraphs
+}
+
+// overlapTail returns about the last overlap characters of text starting at a word boundary
+func overlapTail(text string, overlap int) string {
+	if overlap <= 0 {
+		return ""
+	}
+	text = strings.TrimSpace(text)
+	if len(text) <= overlap {
+		return text
+	}
+	tail := text[len(text)-overlap:]
+	if space := strings.IndexAny(tail, " \n\t"); space >= 0 {
+		tail = tail[space+1:]
+	}
+	return strings.TrimSpace(tail)
+}
+
+// estimateTokens approximates the number of tokens of a text at four characters per token
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
@@ -3,26 +3,114 @@ package RAG
 import (
 	"context"
 	"errors"
-	"log"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/generative-ai-go/genai"
 	"github.com/joho/godotenv"
-	"github.com/pinecone-io/go-pinecone/v4/pinecone"
-	"google.golang.org/api/option"
 )
 
-type RAGPineconeGemini struct {
-	DbClient        *pinecone.Client
-	IndexConn       *pinecone.IndexConnection
-	GeminiClient    *genai.Client
-	IndexHost       string
-	EmbeddingModel  *genai.EmbeddingModel
-	GenerativeModel *genai.GenerativeModel
+// RAGEngine implements the RAGmodel, IndexWriter and IndexAdmin interfaces on top of
+// whichever Embedder, VectorStore and LLM it is built from
+type RAGEngine struct {
+	Embedder Embedder
+	Store    VectorStore
+	LLM      LLM
+	Timeouts StageTimeouts
+	// EmbeddingModel names the model of the Embedder as provider/model, it is recorded in the vector snapshots
+	EmbeddingModel string
+	// Aliases maps the namespaces of the requests to the namespaces that hold the vectors, nil means no aliases
+	Aliases *NamespaceAliases
+	// ResponseCache reuses the chat responses of similar queries, nil disables it
+	ResponseCache *ResponseCache
+	// Keywords is the BM25 index filled on ingestion, nil disables the keyword search
+	Keywords *KeywordIndex
+	// KeywordWeights enables the hybrid retrieval of a namespace with the weight of its keyword matches,
+	// from 0, vector only, to 1, keyword only
+	KeywordWeights map[string]float64
+	// Reranker reorders the matches by their relevance to the query and keeps the topK best, nil keeps the retrieval order
+	Reranker Reranker
+	// RerankMinScore drops the reranked matches scored below it so that weak passages do not reach the prompt
+	RerankMinScore float64
+	// MMRLambda diversifies the matches with maximal marginal relevance, from 1, relevance only,
+	// towards 0, diversity only, 0 disables it
+	MMRLambda float64
+	// MaxPerSource caps the matches of every source so that the context covers more articles, 0 means no cap
+	MaxPerSource int
+	// AgentRepairAttempts bounds how many times an invalid agent output is sent back to be corrected,
+	// 0 means DEFAULT_AGENT_REPAIR_ATTEMPTS and a negative value disables the repairs
+	AgentRepairAttempts int
+
+	// closers release the clients the engine was built with
+	closers []func() error
+}
+
+// StageTimeouts bounds every stage of a request on top of the caller's context
+// a zero value means the stage is only bounded by the caller's context
+type StageTimeouts struct {
+	Embed    time.Duration
+	Query    time.Duration
+	Generate time.Duration
+	// Upsert bounds every write to the vector store
+	Upsert time.Duration
+	// Rerank bounds scoring the matches with the reranker
+	Rerank time.Duration
+	// Fetch bounds fetching all the resources of an agent query, defaults to 10s
+	Fetch time.Duration
+	// FetchRequest bounds every single resource request, defaults to 5s
+	FetchRequest time.Duration
+}
+
+const (
+	DEFAULT_FETCH_TIMEOUT         = 10 * time.Second
+	DEFAULT_FETCH_REQUEST_TIMEOUT = 5 * time.Second
+)
+
+func (t StageTimeouts) fetch() time.Duration {
+	if t.Fetch <= 0 {
+		return DEFAULT_FETCH_TIMEOUT
+	}
+	return t.Fetch
+}
+
+func (t StageTimeouts) fetchRequest() time.Duration {
+	if t.FetchRequest <= 0 {
+		return DEFAULT_FETCH_REQUEST_TIMEOUT
+	}
+	return t.FetchRequest
 }
 
+// withStageTimeout derives a context bounded by the stage timeout when one is set
+func withStageTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// NewRAGEngine creates a RAG engine from the given providers
+func NewRAGEngine(embedder Embedder, store VectorStore, llm LLM) *RAGEngine {
+	return &RAGEngine{
+		Embedder: embedder,
+		Store:    store,
+		LLM:      llm,
+	}
+}
+
+const (
+	VECTOR_STORE_PINECONE = "pinecone"
+	VECTOR_STORE_LOCAL    = "local"
+
+	PROVIDER_GEMINI = "gemini"
+	PROVIDER_OPENAI = "openai"
+	PROVIDER_OLLAMA = "ollama"
+)
+
 type RAGConfig struct {
 	GeminiAPIKey string
 	GeminiModel string
@@ -30,130 +118,351 @@ type RAGConfig struct {
 	PineconeAPIKey string
 	PineconeIndexName string
 	PineconeIndexHost string
+
+	// VectorStoreProvider selects the vector store backend, pinecone (default) or local
+	VectorStoreProvider string
+	// LocalStorePath is the snapshot file of the local vector store
+	LocalStorePath string
+	// LocalStoreMetric is the similarity metric of the local vector store, cosine (default) or dotproduct
+	// when empty the metric of an existing snapshot is used
+	LocalStoreMetric string
+	// LocalStoreHNSW enables the HNSW approximate index of the local vector store, nil means brute-force search
+	LocalStoreHNSW *HNSWConfig
+
+	// LLMProvider selects the generative model backend, gemini (default), openai or ollama
+	LLMProvider string
+	// EmbeddingProvider selects the embedding model backend, gemini (default), openai or ollama
+	EmbeddingProvider string
+
+	// OpenAIBaseURL points to any OpenAI compatible server, defaults to https://api.openai.com/v1
+	OpenAIBaseURL string
+	OpenAIAPIKey string
+	OpenAIModel string
+	OpenAIEmbeddingModel string
+
+	// OllamaBaseURL points to the Ollama server, defaults to http://localhost:11434
+	OllamaBaseURL string
+	OllamaModel string
+	OllamaEmbeddingModel string
+
+	// EmbedRateLimit bounds the requests per second to the gemini embedding model, 0 means no limit
+	EmbedRateLimit float64
+	// EmbedConcurrency bounds the gemini batch embedding requests in flight, defaults to DEFAULT_EMBED_CONCURRENCY
+	EmbedConcurrency int
+
+	// EmbeddingCacheSize is the number of embeddings cached in memory, 0 means DEFAULT_EMBEDDING_CACHE_SIZE
+	// and a negative value disables the cache
+	EmbeddingCacheSize int
+	// EmbeddingCacheDir also stores the cached embeddings on the disk, empty keeps them in memory only
+	EmbeddingCacheDir string
+
+	// ResponseCache enables the semantic cache of the chat responses, nil disables it
+	ResponseCache *ResponseCacheConfig
+
+	// KeywordIndexPath is the JSON file of the BM25 keyword index built on ingestion,
+	// empty keeps the index in memory when a namespace uses the hybrid retrieval
+	KeywordIndexPath string
+	// KeywordWeights is the weight of the keyword matches of the namespaces that use the hybrid retrieval
+	KeywordWeights map[string]float64
+
+	// Reranker selects the rerank stage after the retrieval, llm or cross-encoder, empty disables it
+	Reranker string
+	// RerankerURL is the base URL of the cross-encoder server
+	RerankerURL string
+	// RerankMinScore is the reranker score a match needs to be kept, in the scale of the reranker
+	RerankMinScore float64
+
+	// MMRLambda is the relevance weight of the maximal marginal relevance selection, 0 disables it
+	MMRLambda float64
+	// MaxPerSource caps the matches of every source, 0 means no cap
+	MaxPerSource int
+
+	// AgentRepairAttempts bounds the corrections of an invalid agent output, 0 means DEFAULT_AGENT_REPAIR_ATTEMPTS
+	// and a negative value disables them
+	AgentRepairAttempts int
+
+	// NamespaceAliasesPath is the JSON file of the namespace aliases switched by the re-embedding migrations,
+	// empty keeps the aliases in memory
+	NamespaceAliasesPath string
+
+	// Timeouts bounds the stages of every request
+	Timeouts StageTimeouts
+
+	// Lazy skips the warm-up calls to the models and the index handshake,
+	// connection problems then surface on the first request instead of in NewRAG
+	Lazy bool
 }
 
-var rag RAGmodel
-var deploy = true
-func init() {
-	if deploy {
-		return
-	}
-	// read the dotenv file
-	// Get the current working directory
-	_, filename, _, ok := runtime.Caller(0)
-	if !ok {
-		log.Fatalf("Failed to get file path")
-	}
-	dir := filepath.Dir(filename)
-	// get the parent directory
-	dir = filepath.Dir(dir)
-	// get the parent directory
-	targetFiledir := filepath.Join(dir, ".env")
+// usesGemini reports whether any of the selected providers needs a gemini client
+func (config *RAGConfig) usesGemini() bool {
+	return config.LLMProvider == "" || config.LLMProvider == PROVIDER_GEMINI ||
+		config.EmbeddingProvider == "" || config.EmbeddingProvider == PROVIDER_GEMINI
+}
 
-	if err := godotenv.Load(targetFiledir); err != nil {
-		log.Fatal(err)
+// usesOpenAI reports whether any of the selected providers is OpenAI
+func (config *RAGConfig) usesOpenAI() bool {
+	return config.LLMProvider == PROVIDER_OPENAI || config.EmbeddingProvider == PROVIDER_OPENAI
+}
+
+// providerName returns the name of a model provider, empty means gemini
+func providerName(provider string) string {
+	if provider == "" {
+		return PROVIDER_GEMINI
 	}
+	return provider
+}
 
-	// connect to gemini API
-	geminiAPIKey := os.Getenv("GEMINI_API_KEY")
-	if geminiAPIKey == "" {
-		log.Fatal("GEMINI_API_KEY environment variable is required")
+// embeddingModelName identifies the embedding model selected by the config as provider/model
+func (config *RAGConfig) embeddingModelName() string {
+	model := ""
+	switch config.EmbeddingProvider {
+	case "", PROVIDER_GEMINI:
+		model = config.GeminiEmbeddingModel
+	case PROVIDER_OPENAI:
+		model = config.OpenAIEmbeddingModel
+	case PROVIDER_OLLAMA:
+		model = config.OllamaEmbeddingModel
 	}
+	return providerName(config.EmbeddingProvider) + "/" + model
+}
 
-	// Initialize Gemini client
-	geminiClient, err := genai.NewClient(context.Background(), option.WithAPIKey(geminiAPIKey))
-	if err != nil {
-		log.Fatalf("Failed to initialize Gemini client: %v", err)
+// newEmbedder creates the embedder selected by the config
+func newEmbedder(config *RAGConfig, geminiClient *genai.Client) (Embedder, error) {
+	switch config.EmbeddingProvider {
+	case "", PROVIDER_GEMINI:
+		embedder := NewGeminiEmbedder(geminiClient, config.GeminiEmbeddingModel)
+		if config.EmbedConcurrency > 0 {
+			embedder.Concurrency = config.EmbedConcurrency
+		}
+		// a burst as large as the pool lets every worker start right away
+		embedder.Limiter = NewRateLimiter(config.EmbedRateLimit, embedder.Concurrency)
+		return embedder, nil
+	case PROVIDER_OPENAI:
+		return &OpenAIEmbedder{BaseURL: config.OpenAIBaseURL, APIKey: config.OpenAIAPIKey, Model: config.OpenAIEmbeddingModel}, nil
+	case PROVIDER_OLLAMA:
+		return &OllamaEmbedder{BaseURL: config.OllamaBaseURL, Model: config.OllamaEmbeddingModel}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown embedding provider: %s", ErrInvalidConfig, config.EmbeddingProvider)
 	}
+}
 
-	// get the embedding model
-	embeddingModel := geminiClient.EmbeddingModel(os.Getenv("GEMINI_EMBEDDING_MODEL"))
+// newLLM creates the generative model selected by the config
+func newLLM(config *RAGConfig, geminiClient *genai.Client) (LLM, error) {
+	switch config.LLMProvider {
+	case "", PROVIDER_GEMINI:
+		return NewGeminiLLM(geminiClient, config.GeminiModel), nil
+	case PROVIDER_OPENAI:
+		return &OpenAILLM{BaseURL: config.OpenAIBaseURL, APIKey: config.OpenAIAPIKey, Model: config.OpenAIModel}, nil
+	case PROVIDER_OLLAMA:
+		return &OllamaLLM{BaseURL: config.OllamaBaseURL, Model: config.OllamaModel}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown LLM provider: %s", ErrInvalidConfig, config.LLMProvider)
+	}
+}
 
-	if res, err := embeddingModel.EmbedContent(context.Background(), genai.Text("Hi, Gemini")); err != nil || res == nil {
-		if err == nil {
-			err = errors.New("model returned a nil result")
+// newVectorStore creates the vector store selected by the config
+func newVectorStore(ctx context.Context, config *RAGConfig) (VectorStore, error) {
+	switch config.VectorStoreProvider {
+	case "", VECTOR_STORE_PINECONE:
+		return newPineconeStore(ctx, config)
+	case VECTOR_STORE_LOCAL:
+		if config.LocalStorePath == "" {
+			return nil, fmt.Errorf("%w: local store path is required", ErrInvalidConfig)
+		}
+		store, err := OpenLocalStoreWithHNSW(config.LocalStorePath, config.LocalStoreMetric, config.LocalStoreHNSW)
+		if errors.Is(err, ErrInvalidConfig) {
+			return nil, &ProviderError{Provider: VECTOR_STORE_LOCAL, Kind: ErrInvalidConfig, Err: err}
+		}
+		if err != nil {
+			return nil, &ProviderError{Provider: VECTOR_STORE_LOCAL, Kind: ErrVectorStoreUnreachable, Err: err}
 		}
-		geminiClient.Close()
-		log.Fatalf("connection error while trying to connect to gemini: %s\n ERROR: %s", os.Getenv("GEMINI_EMBEDDING_MODEL"), err.Error())
+		return store, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown vector store provider: %s", ErrInvalidConfig, config.VectorStoreProvider)
 	}
+}
+
+var rag RAGmodel
 
-	// get the generative model
-	generativeModel := geminiClient.GenerativeModel(os.Getenv("GEMINI_MODEL"))
-	if res, err := generativeModel.GenerateContent(context.Background(), genai.Text("Hi, Gemini")); err != nil || res == nil {
-		if err == nil {
-			err = errors.New("model returned a nil result")
+// LoadConfigFromEnv builds a RAGConfig from the environment variables
+// the given .env files are loaded first, variables that are already set are not overridden
+func LoadConfigFromEnv(envFiles ...string) (*RAGConfig, error) {
+	if len(envFiles) > 0 {
+		if err := godotenv.Load(envFiles...); err != nil {
+			return nil, fmt.Errorf("failed to load env files: %w", err)
 		}
-		geminiClient.Close()
-		log.Fatalf("connection error while trying to connect to gemini: %s\n ERROR: %s", os.Getenv("GEMINI_MODEL"), err.Error())
 	}
 
-	// connect to the Vector database
-	pineconeAPIKey := os.Getenv("PINECONE_API_KEY")
-	if pineconeAPIKey == "" {
-		geminiClient.Close()
-		log.Fatal("PINECONE_API_KEY environment variable is required")
+	config := &RAGConfig{
+		GeminiAPIKey:         os.Getenv("GEMINI_API_KEY"),
+		GeminiModel:          os.Getenv("GEMINI_MODEL"),
+		GeminiEmbeddingModel: os.Getenv("GEMINI_EMBEDDING_MODEL"),
+		PineconeAPIKey:       os.Getenv("PINECONE_API_KEY"),
+		PineconeIndexName:    os.Getenv("PINECONE_INDEX_NAME"),
+		PineconeIndexHost:    os.Getenv("PINECONE_INDEX_HOST"),
+		VectorStoreProvider:  os.Getenv("VECTOR_STORE_PROVIDER"),
+		LocalStorePath:       os.Getenv("LOCAL_STORE_PATH"),
+		LocalStoreMetric:     os.Getenv("LOCAL_STORE_METRIC"),
+		LLMProvider:          os.Getenv("LLM_PROVIDER"),
+		EmbeddingProvider:    os.Getenv("EMBEDDING_PROVIDER"),
+		OpenAIBaseURL:        os.Getenv("OPENAI_BASE_URL"),
+		OpenAIAPIKey:         os.Getenv("OPENAI_API_KEY"),
+		OpenAIModel:          os.Getenv("OPENAI_MODEL"),
+		OpenAIEmbeddingModel: os.Getenv("OPENAI_EMBEDDING_MODEL"),
+		OllamaBaseURL:        os.Getenv("OLLAMA_BASE_URL"),
+		OllamaModel:          os.Getenv("OLLAMA_MODEL"),
+		OllamaEmbeddingModel: os.Getenv("OLLAMA_EMBEDDING_MODEL"),
+		NamespaceAliasesPath: os.Getenv("RAG_NAMESPACE_ALIASES"),
+		EmbeddingCacheDir:    os.Getenv("RAG_EMBEDDING_CACHE_DIR"),
+		KeywordIndexPath:     os.Getenv("RAG_KEYWORD_INDEX"),
+		Reranker:             os.Getenv("RAG_RERANKER"),
+		RerankerURL:          os.Getenv("RAG_RERANKER_URL"),
 	}
 
-	// Initialize Pinecone client
-	pineconeClient, err := pinecone.NewClient(pinecone.NewClientParams{
-		ApiKey: pineconeAPIKey,
-	})
+	var err error
+	if config.Lazy, err = envBool("RAG_LAZY"); err != nil {
+		return nil, err
+	}
+	hnsw, err := envBool("LOCAL_STORE_HNSW")
+	if err != nil {
+		return nil, err
+	}
+	if hnsw {
+		config.LocalStoreHNSW = &HNSWConfig{}
+	}
 
+	responseCache, err := envBool("RAG_RESPONSE_CACHE")
 	if err != nil {
-		geminiClient.Close()
-		log.Fatalf("Failed to initialize Pinecone client: %v", err)
+		return nil, err
+	}
+	if responseCache {
+		config.ResponseCache = &ResponseCacheConfig{}
+		if value := os.Getenv("RAG_RESPONSE_CACHE_THRESHOLD"); value != "" {
+			threshold, err := strconv.ParseFloat(value, 64)
+			if err != nil || threshold <= 0 || threshold > 1 {
+				return nil, fmt.Errorf("%w: RAG_RESPONSE_CACHE_THRESHOLD must be in (0, 1], got %s", ErrInvalidConfig, value)
+			}
+			config.ResponseCache.Threshold = threshold
+		}
+		if value := os.Getenv("RAG_RESPONSE_CACHE_TTL"); value != "" {
+			if config.ResponseCache.TTL, err = time.ParseDuration(value); err != nil {
+				return nil, fmt.Errorf("%w: RAG_RESPONSE_CACHE_TTL: %v", ErrInvalidConfig, err)
+			}
+		}
 	}
 
-	if _, err := pineconeClient.ListIndexes(context.Background()); err != nil {
-		geminiClient.Close()
-		log.Fatalf("connection error while trying to connect to pinecone ERROR: %s", err.Error())
+	if config.KeywordWeights, err = envWeights("RAG_KEYWORD_WEIGHTS"); err != nil {
+		return nil, err
 	}
 
-	// Get index name from environment variable or use default
-	indexName := os.Getenv("PINECONE_INDEX_NAME")
-	if indexName == "" {
-		indexName = "knowledge-index" // default index name
-		log.Printf("Using default index name: %s\n", indexName)
+	if value := os.Getenv("RAG_RERANK_MIN_SCORE"); value != "" {
+		if config.RerankMinScore, err = strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("%w: RAG_RERANK_MIN_SCORE: %v", ErrInvalidConfig, err)
+		}
+	}
+	if value := os.Getenv("RAG_MMR_LAMBDA"); value != "" {
+		lambda, err := strconv.ParseFloat(value, 64)
+		if err != nil || lambda < 0 || lambda > 1 {
+			return nil, fmt.Errorf("%w: RAG_MMR_LAMBDA must be between 0 and 1, got %s", ErrInvalidConfig, value)
+		}
+		config.MMRLambda = lambda
+	}
+	// 0 means no cap
+	if config.MaxPerSource, err = envIntAtLeast("RAG_MAX_PER_SOURCE", 0); err != nil {
+		return nil, err
+	}
+	if value := os.Getenv("RAG_AGENT_REPAIR_ATTEMPTS"); value != "" {
+		if config.AgentRepairAttempts, err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("%w: RAG_AGENT_REPAIR_ATTEMPTS: %v", ErrInvalidConfig, err)
+		}
+	}
+	if value := os.Getenv("RAG_EMBED_RATE_LIMIT"); value != "" {
+		if config.EmbedRateLimit, err = strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("%w: RAG_EMBED_RATE_LIMIT: %v", ErrInvalidConfig, err)
+		}
+	}
+	// -1 disables the cache and 0 means DEFAULT_EMBEDDING_CACHE_SIZE
+	if config.EmbeddingCacheSize, err = envIntAtLeast("RAG_EMBEDDING_CACHE_SIZE", -1); err != nil {
+		return nil, err
+	}
+	// 0 means DEFAULT_EMBED_CONCURRENCY
+	if config.EmbedConcurrency, err = envIntAtLeast("RAG_EMBED_CONCURRENCY", 0); err != nil {
+		return nil, err
 	}
 
-	// Get index host from environment variable
-	indexHost := os.Getenv("PINECONE_INDEX_HOST")
-	if indexHost == "" {
-		// Alternatively, you can describe the index to get the host
-		idx, err := pineconeClient.DescribeIndex(context.Background(), indexName)
-		if err != nil {
-			geminiClient.Close()
-			log.Fatalf("Failed to describe index or PINECONE_INDEX_HOST not set: %v", err)
+	timeouts := map[string]*time.Duration{
+		"RAG_EMBED_TIMEOUT":         &config.Timeouts.Embed,
+		"RAG_QUERY_TIMEOUT":         &config.Timeouts.Query,
+		"RAG_GENERATE_TIMEOUT":      &config.Timeouts.Generate,
+		"RAG_UPSERT_TIMEOUT":        &config.Timeouts.Upsert,
+		"RAG_RERANK_TIMEOUT":        &config.Timeouts.Rerank,
+		"RAG_FETCH_TIMEOUT":         &config.Timeouts.Fetch,
+		"RAG_FETCH_REQUEST_TIMEOUT": &config.Timeouts.FetchRequest,
+	}
+	for name, target := range timeouts {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		if *target, err = time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, name, err)
 		}
-		indexHost = idx.Host
-		log.Printf("Retrieved index host: %s\n", indexHost)
-		log.Printf("Index dimension: %d\n", idx.Dimension)
 	}
+	return config, nil
+}
 
-	// get the topK results from the vector store
-	indexConn, err := pineconeClient.Index(pinecone.NewIndexConnParams{
-		Host:      indexHost,
-		Namespace: "schemas-json",
-	})
-	if err != nil {
-		log.Printf("ERROR: Failed to connect to index: %v", err)
-		geminiClient.Close()
-		log.Fatalf("Failed to connect to index: %v", err)
+// envIntAtLeast parses an integer that must not be below minimum, an unset variable is 0
+func envIntAtLeast(name string, minimum int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
 	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < minimum {
+		return 0, fmt.Errorf("%w: %s must be an integer of at least %d, got %s", ErrInvalidConfig, name, minimum, value)
+	}
+	return parsed, nil
+}
 
-	// check the index stats
-	_, err = indexConn.DescribeIndexStats(context.Background()) // this would take some time to complete handshake and stuff XD
+func envBool(name string) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return false, nil
+	}
+	parsed, err := strconv.ParseBool(value)
 	if err != nil {
-		geminiClient.Close()
-		log.Fatalf("Failed to describe index stats: %v", err)
+		return false, fmt.Errorf("%w: %s: %v", ErrInvalidConfig, name, err)
 	}
+	return parsed, nil
+}
 
-	rag = &RAGPineconeGemini{
-		GeminiClient:    geminiClient,
-		DbClient:        pineconeClient,
-		IndexConn:       indexConn,
-		IndexHost:       indexHost,
-		EmbeddingModel:  embeddingModel,
-		GenerativeModel: generativeModel,
+// envWeights parses namespace=weight pairs separated by commas, the weights must be between 0 and 1
+func envWeights(name string) (map[string]float64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil, nil
+	}
+	weights := make(map[string]float64)
+	for _, pair := range strings.Split(value, ",") {
+		namespace, weight, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || namespace == "" {
+			return nil, fmt.Errorf("%w: %s: expected namespace=weight, got %q", ErrInvalidConfig, name, pair)
+		}
+		parsed, err := strconv.ParseFloat(weight, 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			return nil, fmt.Errorf("%w: %s: the weight of %s must be between 0 and 1, got %q", ErrInvalidConfig, name, namespace, weight)
+		}
+		weights[namespace] = parsed
 	}
-}
\ No newline at end of file
+	return weights, nil
+}
+
+// repoEnvFile returns the .env file at the root of the repository
+// it is used by the integration tests the same way the old package init did
+func repoEnvFile() string {
+	_, filename, _, ok := runtime.Caller(0)
+	if !ok {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(filepath.Dir(filename)), ".env")
+}
@@ -0,0 +1,172 @@
+package RAG_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+// localConfig returns a config using ollama models and a local store saved in a temporary directory
+func localConfig(t *testing.T, ollamaURL string, vectors []RAG.VectorRecord) *RAG.RAGConfig {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "vectors.json")
+	store, err := RAG.NewLocalStore(RAG.METRIC_COSINE)
+	if err != nil {
+		t.Fatalf("failed to create local store: %v", err)
+	}
+	if err := store.Upsert(context.Background(), "database-articles", vectors); err != nil {
+		t.Fatalf("upsert failed: %v", err)
+	}
+	if err := store.SaveTo(path); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	return &RAG.RAGConfig{
+		LLMProvider:          RAG.PROVIDER_OLLAMA,
+		EmbeddingProvider:    RAG.PROVIDER_OLLAMA,
+		OllamaBaseURL:        ollamaURL,
+		OllamaModel:          "llama-test",
+		OllamaEmbeddingModel: "embed-test",
+		VectorStoreProvider:  RAG.VECTOR_STORE_LOCAL,
+		LocalStorePath:       path,
+	}
+}
+
+func TestNewRAGMissingAPIKey(t *testing.T) {
+	_, err := RAG.NewRAG(context.Background(), &RAG.RAGConfig{})
+	if !errors.Is(err, RAG.ErrMissingAPIKey) {
+		t.Fatalf("expected ErrMissingAPIKey, got %v", err)
+	}
+	var providerErr *RAG.ProviderError
+	if !errors.As(err, &providerErr) || providerErr.Provider != RAG.PROVIDER_GEMINI {
+		t.Fatalf("expected a gemini ProviderError, got %v", err)
+	}
+}
+
+func TestNewRAGInvalidProvider(t *testing.T) {
+	config := &RAG.RAGConfig{LLMProvider: RAG.PROVIDER_OLLAMA, EmbeddingProvider: "unknown"}
+	if _, err := RAG.NewRAG(context.Background(), config); !errors.Is(err, RAG.ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig, got %v", err)
+	}
+}
+
+func TestNewRAGModelUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model is loading", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := RAG.NewRAG(context.Background(), localConfig(t, server.URL, []RAG.VectorRecord{{ID: "1", Values: []float32{1, 0, 0}}}))
+	if !errors.Is(err, RAG.ErrModelUnreachable) {
+		t.Fatalf("expected ErrModelUnreachable, got %v", err)
+	}
+	var statusErr *RAG.HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected the underlying HTTP error, got %v", err)
+	}
+}
+
+func TestNewRAGDimensionMismatch(t *testing.T) {
+	server := newOllamaServer(t)
+	defer server.Close()
+
+	// the stand-in server embeds into 3 dimensions
+	_, err := RAG.NewRAG(context.Background(), localConfig(t, server.URL, []RAG.VectorRecord{{ID: "1", Values: []float32{1, 0}}}))
+	var dimensionErr *RAG.DimensionMismatchError
+	if !errors.Is(err, RAG.ErrDimensionMismatch) || !errors.As(err, &dimensionErr) {
+		t.Fatalf("expected a DimensionMismatchError, got %v", err)
+	}
+	if dimensionErr.Embedding != 3 || dimensionErr.Index != 2 {
+		t.Errorf("unexpected dimensions: %+v", dimensionErr)
+	}
+}
+
+func TestNewRAGLazySkipsWarmUp(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	config := localConfig(t, server.URL, []RAG.VectorRecord{{ID: "1", Values: []float32{1, 0, 0}}})
+	config.Lazy = true
+	model, err := RAG.NewRAG(context.Background(), config)
+	if err != nil {
+		t.Fatalf("NewRAG failed: %v", err)
+	}
+	defer model.Close()
+	if calls != 0 {
+		t.Fatalf("lazy mode made %d calls to the model", calls)
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".env")
+	content := "LLM_PROVIDER=ollama\nOLLAMA_MODEL=llama-from-file\nRAG_LAZY=true\nRAG_FETCH_TIMEOUT=3s\nLOCAL_STORE_HNSW=1\n"
+	if err := os.WriteFile(envFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write env file: %v", err)
+	}
+	// godotenv does not override variables that are already set
+	t.Setenv("OLLAMA_MODEL", "llama-from-env")
+	for _, name := range []string{"LLM_PROVIDER", "RAG_LAZY", "RAG_FETCH_TIMEOUT", "LOCAL_STORE_HNSW"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+
+	config, err := RAG.LoadConfigFromEnv(envFile)
+	if err != nil {
+		t.Fatalf("LoadConfigFromEnv failed: %v", err)
+	}
+	if config.LLMProvider != RAG.PROVIDER_OLLAMA || config.OllamaModel != "llama-from-env" {
+		t.Errorf("unexpected providers: %+v", config)
+	}
+	if !config.Lazy || config.Timeouts.Fetch != 3*time.Second || config.LocalStoreHNSW == nil {
+		t.Errorf("unexpected options: %+v", config)
+	}
+
+	t.Setenv("RAG_GENERATE_TIMEOUT", "soon")
+	if _, err := RAG.LoadConfigFromEnv(); !errors.Is(err, RAG.ErrInvalidConfig) {
+		t.Fatalf("expected ErrInvalidConfig for an invalid duration, got %v", err)
+	}
+}
+
+func TestLoadConfigFromEnvRanges(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{"RAG_MAX_PER_SOURCE", "2", true},
+		{"RAG_MAX_PER_SOURCE", "0", true},
+		{"RAG_MAX_PER_SOURCE", "-1", false},
+		{"RAG_MAX_PER_SOURCE", "two", false},
+		{"RAG_EMBED_CONCURRENCY", "4", true},
+		{"RAG_EMBED_CONCURRENCY", "-2", false},
+		{"RAG_EMBEDDING_CACHE_SIZE", "1000", true},
+		{"RAG_EMBEDDING_CACHE_SIZE", "-1", true},
+		{"RAG_EMBEDDING_CACHE_SIZE", "-5", false},
+		{"RAG_MMR_LAMBDA", "0.5", true},
+		{"RAG_MMR_LAMBDA", "1.5", false},
+		{"RAG_RESPONSE_CACHE_THRESHOLD", "0", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name+"="+test.value, func(t *testing.T) {
+			t.Setenv("RAG_RESPONSE_CACHE", "true")
+			t.Setenv(test.name, test.value)
+			_, err := RAG.LoadConfigFromEnv()
+			if test.valid && err != nil {
+				t.Errorf("expected %s to be valid, got %v", test.value, err)
+			}
+			if !test.valid && !errors.Is(err, RAG.ErrInvalidConfig) {
+				t.Errorf("expected ErrInvalidConfig for %s, got %v", test.value, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,464 @@
+package RAG
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// reservedKeywords are the PostgreSQL keywords that cannot be used as unquoted identifiers
+var reservedKeywords = map[string]bool{}
+
+func init() {
+	for _, keyword := range strings.Fields(`all analyse analyze and any array as asc asymmetric authorization binary both
+		case cast check collate collation column concurrently constraint create cross current_catalog current_date
+		current_role current_schema current_time current_timestamp current_user default deferrable desc distinct do
+		else end except false fetch for foreign freeze from full grant group having ilike in initially inner intersect
+		into is isnull join lateral leading left like limit localtime localtimestamp natural not notnull null offset on
+		only or order outer overlaps placing primary references returning right select session_user similar some
+		symmetric system_user table tablesample then to trailing true union unique user using variadic verbose when
+		where window with`) {
+		reservedKeywords[keyword] = true
+	}
+}
+
+// plainIdentifier matches the identifiers PostgreSQL reads the same without quotes
+var plainIdentifier = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+
+// QuoteIdentifier quotes a name for PostgreSQL when it needs it, the names with upper case letters,
+// special characters or that are reserved keywords, a schema qualified name is quoted part by part
+// and a name that is already quoted is kept
+func QuoteIdentifier(name string) string {
+	name = strings.TrimSpace(name)
+	if strings.HasPrefix(name, `"`) && strings.HasSuffix(name, `"`) && len(name) > 1 {
+		return name
+	}
+	if schema, table, ok := strings.Cut(name, "."); ok && !strings.Contains(table, ".") && schema != "" && table != "" {
+		return QuoteIdentifier(schema) + "." + QuoteIdentifier(table)
+	}
+	if plainIdentifier.MatchString(name) && !reservedKeywords[name] {
+		return name
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteIdentifiers(names []string) string {
+	quoted := make([]string, len(names))
+	for index, name := range names {
+		quoted[index] = QuoteIdentifier(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// GenerateDDL turns the diff into PostgreSQL statements that run in order:
+// the tables and columns are renamed, the dropped and altered constraints and indexes are dropped,
+// then the dropped tables, the new tables are created with the tables they reference first, the columns
+// are altered, the constraints are added with the foreign keys last and the indexes are created
+// a diff that drops and adds tables or columns that could be renames of each other is an error
+// since their data would be lost
+func GenerateDDL(diff SchemaDiff) ([]string, error) {
+	if err := ambiguousRenames(diff); err != nil {
+		return nil, err
+	}
+	statements := []string{}
+	deferred := []string{}
+
+	// the renames go first so that every other statement uses the new names
+	for _, change := range diff.Tables {
+		if change.Action == CHANGE_RENAME {
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", QuoteIdentifier(change.Old.TableName), QuoteIdentifier(change.Table)))
+		}
+	}
+	for _, change := range diff.Columns {
+		if change.Action == CHANGE_RENAME {
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s;", QuoteIdentifier(change.Table), QuoteIdentifier(change.Old.ColumnName), QuoteIdentifier(change.Column)))
+		}
+	}
+
+	// the constraints go before the tables and columns they depend on, the foreign keys first
+	drops := append([]ConstraintChange{}, diff.Constraints...)
+	sort.SliceStable(drops, func(i, j int) bool {
+		return isForeignKey(drops[i].Old) && !isForeignKey(drops[j].Old)
+	})
+	for _, change := range drops {
+		if change.Action == CHANGE_ADD {
+			continue
+		}
+		if change.Old.Name == "" {
+			return nil, fmt.Errorf("cannot drop the unnamed %s constraint of %s", change.Old.Type, change.Table)
+		}
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s;", QuoteIdentifier(change.Table), QuoteIdentifier(change.Old.Name)))
+	}
+	droppedConstraints := make(map[string]bool, len(statements))
+	for _, statement := range statements {
+		if strings.Contains(statement, " DROP CONSTRAINT ") {
+			droppedConstraints[statement] = true
+		}
+	}
+	for _, change := range diff.Indexes {
+		if change.Action != CHANGE_ADD {
+			statements = append(statements, fmt.Sprintf("DROP INDEX %s;", QuoteIdentifier(indexName(change.Table, change.Old.Name))))
+		}
+	}
+
+	dropped, created := []*Table{}, []*Table{}
+	for _, change := range diff.Tables {
+		switch change.Action {
+		case CHANGE_DROP:
+			dropped = append(dropped, change.Old)
+		case CHANGE_ADD:
+			created = append(created, change.New)
+		}
+	}
+	// a table is dropped before the tables it references, the foreign keys of a cycle that reference
+	// a table dropped before theirs are dropped first
+	order := dependencyOrder(dropped)
+	for index := len(order) - 1; index >= 0; index-- {
+		for _, constraint := range TableConstraints(*order[index]) {
+			foreign := identifierKey(constraint.ForeignTable)
+			if !isForeignKey(&constraint) || foreign == identifierKey(order[index].TableName) ||
+				!slices.ContainsFunc(order[index+1:], func(table *Table) bool { return identifierKey(table.TableName) == foreign }) {
+				continue
+			}
+			if constraint.Name == "" {
+				return nil, fmt.Errorf("cannot drop the unnamed foreign key of %s", order[index].TableName)
+			}
+			statement := fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s;", QuoteIdentifier(order[index].TableName), QuoteIdentifier(constraint.Name))
+			if !droppedConstraints[statement] {
+				droppedConstraints[statement] = true
+				statements = append(statements, statement)
+			}
+		}
+	}
+	for index := len(order) - 1; index >= 0; index-- {
+		statements = append(statements, fmt.Sprintf("DROP TABLE %s;", QuoteIdentifier(order[index].TableName)))
+	}
+
+	exists := make(map[string]bool)
+	indexes := []string{}
+	for _, table := range dependencyOrder(created) {
+		definitions := []string{}
+		for _, index := range sortedColumns(table.Columns) {
+			definitions = append(definitions, columnDefinition(table.Columns[index]))
+		}
+		for _, constraint := range TableConstraints(*table) {
+			definition, err := constraintDefinition(constraint)
+			if err != nil {
+				return nil, fmt.Errorf("table %s: %w", table.TableName, err)
+			}
+			// a foreign key to a table that is not created before, in a cycle or that exists and may get
+			// the referenced key in this diff, is added with the other foreign keys
+			foreign := identifierKey(constraint.ForeignTable)
+			if isForeignKey(&constraint) && !exists[foreign] && foreign != identifierKey(table.TableName) {
+				deferred = append(deferred, fmt.Sprintf("ALTER TABLE %s ADD %s;", QuoteIdentifier(table.TableName), definition))
+				continue
+			}
+			definitions = append(definitions, definition)
+		}
+		statements = append(statements, fmt.Sprintf("CREATE TABLE %s (\n    %s\n);", QuoteIdentifier(table.TableName), strings.Join(definitions, ",\n    ")))
+		exists[identifierKey(table.TableName)] = true
+		for _, index := range TableIndexes(*table) {
+			indexes = append(indexes, indexDefinition(table.TableName, index))
+		}
+	}
+
+	for _, change := range diff.Columns {
+		table, column := QuoteIdentifier(change.Table), QuoteIdentifier(change.Column)
+		switch change.Action {
+		case CHANGE_ADD:
+			// a NOT NULL column is added nullable so that the existing rows can be filled first
+			nullable := *change.New
+			serial := serialTypes[strings.ToLower(strings.TrimSpace(nullable.DataType))]
+			nullable.IsNullable = nullable.IsNullable || !serial
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s;", table, columnDefinition(nullable)))
+			if change.New.IsNullable || serial {
+				break
+			}
+			if columnDefault(*change.New) == "" {
+				statements = append(statements, fmt.Sprintf("-- fill %s.%s in the existing rows, it has no default", table, column))
+			}
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET NOT NULL;", table, column))
+		case CHANGE_DROP:
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s;", table, column))
+		case CHANGE_ALTER:
+			for _, field := range change.Fields {
+				switch field {
+				case COLUMN_TYPE:
+					// the types without an implicit cast like text to integer need the USING
+					dataType := columnType(*change.New)
+					statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s::%s;", table, column, dataType, column, dataType))
+				case COLUMN_DEFAULT:
+					if value := columnDefault(*change.New); value != "" {
+						statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT %s;", table, column, value))
+					} else {
+						statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP DEFAULT;", table, column))
+					}
+				case COLUMN_NULLABILITY:
+					if change.New.IsNullable {
+						statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP NOT NULL;", table, column))
+					} else {
+						statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET NOT NULL;", table, column))
+					}
+				}
+			}
+		}
+	}
+
+	// the keys a foreign key references are added before it
+	adds := append([]ConstraintChange{}, diff.Constraints...)
+	sort.SliceStable(adds, func(i, j int) bool {
+		return !isForeignKey(adds[i].New) && isForeignKey(adds[j].New)
+	})
+	for _, change := range adds {
+		if change.Action == CHANGE_DROP {
+			continue
+		}
+		definition, err := constraintDefinition(*change.New)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", change.Table, err)
+		}
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD %s;", QuoteIdentifier(change.Table), definition))
+	}
+	statements = append(statements, deferred...)
+
+	for _, change := range diff.Indexes {
+		if change.Action != CHANGE_DROP {
+			indexes = append(indexes, indexDefinition(change.Table, *change.New))
+		}
+	}
+	return append(statements, indexes...), nil
+}
+
+// ambiguousRenames reports the tables and columns that are dropped while others are added with the same
+// definition, DiffSchemas only pairs them when a single one matches
+func ambiguousRenames(diff SchemaDiff) error {
+	dropped := make(map[string]string)
+	for _, change := range diff.Tables {
+		if change.Action == CHANGE_DROP && len(change.Old.Columns) > 0 {
+			dropped[tableSignature(*change.Old)] = change.Table
+		}
+	}
+	for _, change := range diff.Tables {
+		if name, ok := dropped[tableSignature(derefTable(change.New))]; ok && change.Action == CHANGE_ADD {
+			return fmt.Errorf("the table %s is dropped and %s is added with the same columns, it is not known which table is renamed", name, change.Table)
+		}
+	}
+	droppedColumns := make(map[string]string)
+	for _, change := range diff.Columns {
+		if change.Action == CHANGE_DROP {
+			droppedColumns[identifierKey(change.Table)+" "+describeColumn(*change.Old)] = change.Column
+		}
+	}
+	for _, change := range diff.Columns {
+		if name, ok := droppedColumns[identifierKey(change.Table)+" "+describeColumn(derefColumn(change.New))]; ok && change.Action == CHANGE_ADD {
+			return fmt.Errorf("the column %s of %s is dropped and %s is added with the same definition, it is not known which column is renamed", name, change.Table, change.Column)
+		}
+	}
+	return nil
+}
+
+func derefTable(table *Table) Table {
+	if table == nil {
+		return Table{}
+	}
+	return *table
+}
+
+func derefColumn(column *TableColumn) TableColumn {
+	if column == nil {
+		return TableColumn{}
+	}
+	return *column
+}
+
+func isForeignKey(constraint *SchemaConstraint) bool {
+	return constraint != nil && constraint.Type == "FOREIGN KEY"
+}
+
+// dependencyOrder sorts the tables so that every table comes after the tables it references,
+// the tables of a cycle keep their order
+func dependencyOrder(tables []*Table) []*Table {
+	byName := make(map[string]*Table, len(tables))
+	for _, table := range tables {
+		byName[identifierKey(table.TableName)] = table
+	}
+	ordered := make([]*Table, 0, len(tables))
+	state := make(map[string]int)
+	var visit func(table *Table)
+	visit = func(table *Table) {
+		name := identifierKey(table.TableName)
+		// 1 is being visited, a cycle, 2 is done
+		if state[name] != 0 {
+			return
+		}
+		state[name] = 1
+		for _, constraint := range TableConstraints(*table) {
+			if referenced, ok := byName[identifierKey(constraint.ForeignTable)]; ok && isForeignKey(&constraint) {
+				visit(referenced)
+			}
+		}
+		state[name] = 2
+		ordered = append(ordered, table)
+	}
+	for _, table := range tables {
+		visit(table)
+	}
+	return ordered
+}
+
+// serialTypes keep their name in the column definitions since they create the sequence of the default
+var serialTypes = map[string]bool{"serial": true, "serial4": true, "bigserial": true, "serial8": true, "smallserial": true, "serial2": true}
+
+// sequenceDefault matches the default information_schema reports for a serial column
+var sequenceDefault = regexp.MustCompile(`(?i)^nextval\('[^']*_seq'(::regclass)?\)$`)
+
+// serialOf is the serial type of an integer column whose default is a sequence, the sequence of a new
+// column does not exist yet
+var serialOf = map[string]string{"integer": "serial", "bigint": "bigserial", "smallint": "smallserial"}
+
+func columnDefinition(column TableColumn) string {
+	dataType := strings.ToLower(strings.TrimSpace(column.DataType))
+	value := columnDefault(column)
+	if serial, ok := serialOf[columnType(column)]; ok && sequenceDefault.MatchString(value) {
+		dataType, value = serial, ""
+	}
+	definition := QuoteIdentifier(column.ColumnName) + " " + columnType(column)
+	if serialTypes[dataType] {
+		definition = QuoteIdentifier(column.ColumnName) + " " + dataType
+	} else if value != "" {
+		definition += " DEFAULT " + value
+	}
+	if !column.IsNullable {
+		definition += " NOT NULL"
+	}
+	return definition
+}
+
+func constraintDefinition(constraint SchemaConstraint) (string, error) {
+	definition := ""
+	if constraint.Name != "" {
+		definition = "CONSTRAINT " + QuoteIdentifier(constraint.Name) + " "
+	}
+	switch constraint.Type {
+	case "PRIMARY KEY", "UNIQUE":
+		if len(constraint.Columns) == 0 {
+			return "", fmt.Errorf("the %s constraint %s has no columns", constraint.Type, constraint.Name)
+		}
+		definition += fmt.Sprintf("%s (%s)", constraint.Type, quoteIdentifiers(constraint.Columns))
+	case "FOREIGN KEY":
+		if len(constraint.Columns) == 0 || constraint.ForeignTable == "" {
+			return "", fmt.Errorf("the foreign key %s has no columns or no referenced table", constraint.Name)
+		}
+		definition += fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s", quoteIdentifiers(constraint.Columns), QuoteIdentifier(constraint.ForeignTable))
+		if len(constraint.ForeignColumns) > 0 {
+			definition += fmt.Sprintf(" (%s)", quoteIdentifiers(constraint.ForeignColumns))
+		}
+	case "CHECK":
+		if constraint.Check == "" {
+			return "", fmt.Errorf("the check constraint %s has no clause", constraint.Name)
+		}
+		definition += "CHECK " + parenthesized(constraint.Check)
+	default:
+		return "", fmt.Errorf("unsupported constraint type %q of %s", constraint.Type, constraint.Name)
+	}
+	return definition, nil
+}
+
+// parenthesized wraps the expression in parentheses unless they already enclose all of it
+func parenthesized(expression string) string {
+	expression = strings.TrimSpace(expression)
+	if strings.HasPrefix(expression, "(") && strings.HasSuffix(expression, ")") {
+		depth := 0
+		for index, char := range expression {
+			switch char {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			if depth == 0 && index < len(expression)-1 {
+				return "(" + expression + ")"
+			}
+		}
+		return expression
+	}
+	return "(" + expression + ")"
+}
+
+func indexDefinition(table string, index SchemaIndex) string {
+	statement := "CREATE "
+	if index.Unique {
+		statement += "UNIQUE "
+	}
+	statement += "INDEX "
+	if index.Name != "" {
+		statement += QuoteIdentifier(index.Name) + " "
+	}
+	statement += "ON " + QuoteIdentifier(table)
+	if index.Type != "" && index.Type != "btree" {
+		statement += " USING " + index.Type
+	}
+	columns := make([]string, len(index.Columns))
+	for position, column := range index.Columns {
+		// the expressions of the expression indexes are kept as they are
+		if strings.ContainsAny(column, "( ") {
+			columns[position] = parenthesized(column)
+		} else {
+			columns[position] = QuoteIdentifier(column)
+		}
+	}
+	statement += " (" + strings.Join(columns, ", ") + ")"
+	if len(index.Include) > 0 {
+		statement += " INCLUDE (" + quoteIdentifiers(index.Include) + ")"
+	}
+	if index.Where != "" {
+		statement += " WHERE " + index.Where
+	}
+	return statement + ";"
+}
+
+// indexName qualifies the index with the schema of its table, they live in the same schema
+func indexName(table string, index string) string {
+	if schema, _, ok := strings.Cut(table, "."); ok && !strings.Contains(index, ".") {
+		return schema + "." + index
+	}
+	return index
+}
+
+// CompactSchema renders the tables in a short SQL like form for the prompts, a table per block with a line
+// per column, constraint and index, the comments follow --
+func CompactSchema(tables []Table) string {
+	var schema strings.Builder
+	for position, table := range tables {
+		if position > 0 {
+			schema.WriteString("\n")
+		}
+		schema.WriteString("TABLE " + QuoteIdentifier(table.TableName) + compactComment(table.Comment) + "\n")
+		for _, index := range sortedColumns(table.Columns) {
+			column := table.Columns[index]
+			schema.WriteString("  " + columnDefinition(column) + compactComment(column.Comment) + "\n")
+		}
+		for _, constraint := range TableConstraints(table) {
+			definition, err := constraintDefinition(constraint)
+			if err != nil {
+				definition = "CONSTRAINT " + QuoteIdentifier(constraint.Name) + " " + constraint.Type
+			}
+			schema.WriteString("  " + definition + "\n")
+		}
+		for _, index := range TableIndexes(table) {
+			definition := strings.TrimSuffix(indexDefinition(table.TableName, index), ";")
+			definition = strings.Replace(strings.TrimPrefix(definition, "CREATE "), " ON "+QuoteIdentifier(table.TableName), "", 1)
+			schema.WriteString("  " + definition + "\n")
+		}
+	}
+	return schema.String()
+}
+
+func compactComment(comment string) string {
+	if comment = normalizeExpression(comment); comment == "" {
+		return ""
+	}
+	return " -- " + comment
+}
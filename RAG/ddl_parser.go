@@ -0,0 +1,1214 @@
+package RAG
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// the kinds of the SQL tokens
+const (
+	sqlWord = iota
+	sqlQuoted
+	sqlString
+	sqlNumber
+	sqlSymbol
+)
+
+// sqlToken is a token of a SQL script, the text of a word is in lower case, the text of a quoted
+// identifier or of a string is its unescaped content and start and end are its offsets in the script
+type sqlToken struct {
+	kind  int
+	text  string
+	start int
+	end   int
+	line  int
+}
+
+// sqlTokens splits a SQL script into tokens, the comments are skipped and the strings may be
+// standard, escaped (E'...') or dollar quoted
+func sqlTokens(script string) ([]sqlToken, error) {
+	tokens := []sqlToken{}
+	line := 1
+	for position := 0; position < len(script); {
+		char := script[position]
+		start := position
+		switch {
+		case char == '\n':
+			line++
+			position++
+		case char == ' ' || char == '\t' || char == '\r' || char == '\f':
+			position++
+		case strings.HasPrefix(script[position:], "--"):
+			end := strings.IndexByte(script[position:], '\n')
+			if end < 0 {
+				end = len(script) - position
+			}
+			position += end
+		case strings.HasPrefix(script[position:], "/*"):
+			// the block comments of PostgreSQL nest
+			depth := 0
+			for position < len(script) {
+				if strings.HasPrefix(script[position:], "/*") {
+					depth++
+					position += 2
+				} else if strings.HasPrefix(script[position:], "*/") {
+					depth--
+					position += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					if script[position] == '\n' {
+						line++
+					}
+					position++
+				}
+			}
+			if depth > 0 {
+				return nil, fmt.Errorf("%w: line %d: unterminated comment", ErrInvalidDDL, line)
+			}
+		case char == '\'' || ((char == 'e' || char == 'E') && position+1 < len(script) && script[position+1] == '\''):
+			escaped := char != '\''
+			if escaped {
+				position++
+			}
+			text, end, ok := scanString(script, position+1, escaped)
+			if !ok {
+				return nil, fmt.Errorf("%w: line %d: unterminated string", ErrInvalidDDL, line)
+			}
+			tokens = append(tokens, sqlToken{kind: sqlString, text: text, start: start, end: end, line: line})
+			line += strings.Count(script[start:end], "\n")
+			position = end
+		case char == '"':
+			end := position + 1
+			var text strings.Builder
+			for ; end < len(script); end++ {
+				if script[end] == '"' {
+					if end+1 < len(script) && script[end+1] == '"' {
+						text.WriteByte('"')
+						end++
+						continue
+					}
+					break
+				}
+				text.WriteByte(script[end])
+			}
+			if end >= len(script) {
+				return nil, fmt.Errorf("%w: line %d: unterminated quoted identifier", ErrInvalidDDL, line)
+			}
+			tokens = append(tokens, sqlToken{kind: sqlQuoted, text: text.String(), start: start, end: end + 1, line: line})
+			line += strings.Count(script[start:end], "\n")
+			position = end + 1
+		case char == '$' && dollarTag.MatchString(script[position:]):
+			tag := dollarTag.FindString(script[position:])
+			end := strings.Index(script[position+len(tag):], tag)
+			if end < 0 {
+				return nil, fmt.Errorf("%w: line %d: unterminated dollar quoted string", ErrInvalidDDL, line)
+			}
+			end += position + len(tag)
+			tokens = append(tokens, sqlToken{kind: sqlString, text: script[position+len(tag) : end], start: start, end: end + len(tag), line: line})
+			line += strings.Count(script[start:end], "\n")
+			position = end + len(tag)
+		case isWordStart(char):
+			for position < len(script) && (isWordStart(script[position]) || isDigit(script[position]) || script[position] == '$') {
+				position++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlWord, text: strings.ToLower(script[start:position]), start: start, end: position, line: line})
+		case isDigit(char) || (char == '.' && position+1 < len(script) && isDigit(script[position+1])):
+			for position < len(script) && (isDigit(script[position]) || script[position] == '.' || script[position] == 'e' || script[position] == 'E') {
+				position++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlNumber, text: script[start:position], start: start, end: position, line: line})
+		default:
+			position++
+			if char == ':' && position < len(script) && script[position] == ':' {
+				position++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlSymbol, text: script[start:position], start: start, end: position, line: line})
+		}
+	}
+	return tokens, nil
+}
+
+// dollarTag matches the opening of a dollar quoted string like $$ or $body$
+var dollarTag = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// scanString reads a string from after its opening quote, it returns the unescaped content and the end offset
+func scanString(script string, position int, escaped bool) (string, int, bool) {
+	var text strings.Builder
+	for ; position < len(script); position++ {
+		char := script[position]
+		switch {
+		case char == '\'' && position+1 < len(script) && script[position+1] == '\'':
+			text.WriteByte('\'')
+			position++
+		case char == '\'':
+			return text.String(), position + 1, true
+		case char == '\\' && escaped && position+1 < len(script):
+			position++
+			switch script[position] {
+			case 'n':
+				text.WriteByte('\n')
+			case 't':
+				text.WriteByte('\t')
+			default:
+				text.WriteByte(script[position])
+			}
+		default:
+			text.WriteByte(char)
+		}
+	}
+	return "", position, false
+}
+
+func isWordStart(char byte) bool {
+	return char == '_' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || char >= 0x80
+}
+
+func isDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
+
+// ParseDDL reads the tables of a PostgreSQL schema script like the output of pg_dump --schema-only,
+// it understands CREATE TABLE, ALTER TABLE, CREATE INDEX and COMMENT ON and skips the other statements
+// the tables of the public schema are named without it, the unquoted names are folded to lower case
+// and the constraints without a name get the name PostgreSQL would give them
+func ParseDDL(script string) ([]Table, error) {
+	tokens, err := sqlTokens(script)
+	if err != nil {
+		return nil, err
+	}
+	schema := &ddlSchema{tables: []Table{}, positions: make(map[string]int), others: make(map[string]bool)}
+	start := 0
+	for index := 0; index <= len(tokens); index++ {
+		if index < len(tokens) && !(tokens[index].kind == sqlSymbol && tokens[index].text == ";") {
+			continue
+		}
+		if index > start {
+			parser := &ddlParser{script: script, tokens: tokens[start:index], schema: schema}
+			if err := parser.statement(); err != nil {
+				return nil, err
+			}
+		}
+		start = index + 1
+	}
+	return schema.tables, nil
+}
+
+// ddlSchema is the schema a script builds, others are the relations that are not tables of the model like
+// the views, the sequences and the partitions, the statements on them are skipped
+type ddlSchema struct {
+	tables    []Table
+	positions map[string]int
+	others    map[string]bool
+}
+
+func (s *ddlSchema) table(name string) *Table {
+	if position, ok := s.positions[identifierKey(name)]; ok {
+		return &s.tables[position]
+	}
+	return nil
+}
+
+// ddlParser parses a single statement
+type ddlParser struct {
+	script   string
+	tokens   []sqlToken
+	position int
+	schema   *ddlSchema
+}
+
+func (p *ddlParser) peek() (sqlToken, bool) {
+	if p.position >= len(p.tokens) {
+		return sqlToken{}, false
+	}
+	return p.tokens[p.position], true
+}
+
+// errorf reports an error at the current token
+func (p *ddlParser) errorf(format string, args ...any) error {
+	line := 0
+	if token, ok := p.peek(); ok {
+		line = token.line
+	} else if len(p.tokens) > 0 {
+		line = p.tokens[len(p.tokens)-1].line
+	}
+	return fmt.Errorf("%w: line %d: %s", ErrInvalidDDL, line, fmt.Sprintf(format, args...))
+}
+
+// isWord reports whether the tokens from the current one are the given words
+func (p *ddlParser) isWord(words ...string) bool {
+	for offset, word := range words {
+		if p.position+offset >= len(p.tokens) {
+			return false
+		}
+		token := p.tokens[p.position+offset]
+		if token.kind != sqlWord || token.text != word {
+			return false
+		}
+	}
+	return true
+}
+
+// acceptWord consumes the given words when they come next
+func (p *ddlParser) acceptWord(words ...string) bool {
+	if !p.isWord(words...) {
+		return false
+	}
+	p.position += len(words)
+	return true
+}
+
+func (p *ddlParser) isSymbol(symbol string) bool {
+	token, ok := p.peek()
+	return ok && token.kind == sqlSymbol && token.text == symbol
+}
+
+func (p *ddlParser) acceptSymbol(symbol string) bool {
+	if !p.isSymbol(symbol) {
+		return false
+	}
+	p.position++
+	return true
+}
+
+func (p *ddlParser) expectSymbol(symbol string) error {
+	if !p.acceptSymbol(symbol) {
+		return p.errorf("expected %q", symbol)
+	}
+	return nil
+}
+
+// atElementEnd reports whether the statement or the current element of a list ends at the current token
+func (p *ddlParser) atElementEnd() bool {
+	token, ok := p.peek()
+	return !ok || (token.kind == sqlSymbol && (token.text == "," || token.text == ")"))
+}
+
+// identifier reads a name, a word or a quoted identifier
+func (p *ddlParser) identifier() (string, error) {
+	token, ok := p.peek()
+	if !ok || (token.kind != sqlWord && token.kind != sqlQuoted) {
+		return "", p.errorf("expected a name")
+	}
+	p.position++
+	if token.kind == sqlQuoted {
+		return modelIdentifier(token.text), nil
+	}
+	return token.text, nil
+}
+
+// modelIdentifier is the name of the Table model for an identifier, quoted when the case of the name matters
+func modelIdentifier(name string) string {
+	if name != strings.ToLower(name) {
+		return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+	}
+	return name
+}
+
+// qualifiedName reads a name with its schema, the public schema is left out
+func (p *ddlParser) qualifiedName() ([]string, error) {
+	name, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	parts := []string{name}
+	for p.acceptSymbol(".") {
+		if name, err = p.identifier(); err != nil {
+			return nil, err
+		}
+		parts = append(parts, name)
+	}
+	if len(parts) > 1 && parts[0] == "public" {
+		parts = parts[1:]
+	}
+	return parts, nil
+}
+
+// tableName reads the name of an existing table, the table is nil when the relation is not one of the model
+func (p *ddlParser) tableName() (*Table, error) {
+	parts, err := p.qualifiedName()
+	if err != nil {
+		return nil, err
+	}
+	return p.lookup(parts)
+}
+
+func (p *ddlParser) lookup(parts []string) (*Table, error) {
+	name := strings.Join(parts, ".")
+	if p.schema.others[identifierKey(name)] {
+		return nil, nil
+	}
+	table := p.schema.table(name)
+	if table == nil {
+		return nil, p.errorf("unknown table %s", name)
+	}
+	return table, nil
+}
+
+// identifierList reads a parenthesized list of names
+func (p *ddlParser) identifierList() ([]string, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for {
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		if p.acceptSymbol(")") {
+			return names, nil
+		}
+		if err := p.expectSymbol(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// skip moves to the next comma or closing parenthesis outside of parentheses, or to one of the stop words
+// it returns the offset of the first token skipped
+func (p *ddlParser) skip(stopWords map[string]bool) int {
+	start := p.position
+	depth := 0
+	for ; p.position < len(p.tokens); p.position++ {
+		token := p.tokens[p.position]
+		if token.kind == sqlSymbol {
+			switch token.text {
+			case "(", "[":
+				depth++
+				continue
+			case ")", "]":
+				if depth == 0 {
+					return start
+				}
+				depth--
+				continue
+			case ",":
+				if depth == 0 {
+					return start
+				}
+			}
+		}
+		if depth == 0 && token.kind == sqlWord && stopWords[token.text] {
+			return start
+		}
+	}
+	return start
+}
+
+// source is the text of the tokens from start to the current one, with the whitespace collapsed
+func (p *ddlParser) source(start int) string {
+	if start >= p.position {
+		return ""
+	}
+	return normalizeExpression(p.script[p.tokens[start].start:p.tokens[p.position-1].end])
+}
+
+// parenthesized reads an expression in parentheses and returns it without them
+func (p *ddlParser) parenthesized() (string, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return "", err
+	}
+	start := p.skip(nil)
+	expression := p.source(start)
+	if err := p.expectSymbol(")"); err != nil {
+		return "", err
+	}
+	return expression, nil
+}
+
+func (p *ddlParser) statement() error {
+	switch {
+	case p.acceptWord("create"):
+		p.acceptWord("or", "replace")
+		for p.acceptWord("global") || p.acceptWord("local") || p.acceptWord("temporary") || p.acceptWord("temp") || p.acceptWord("unlogged") {
+		}
+		switch {
+		case p.acceptWord("table"):
+			return p.createTable()
+		case p.acceptWord("foreign", "table"), p.acceptWord("materialized", "view"), p.acceptWord("recursive", "view"), p.acceptWord("view"), p.acceptWord("sequence"):
+			p.acceptWord("if", "not", "exists")
+			parts, err := p.qualifiedName()
+			if err != nil {
+				return err
+			}
+			p.schema.others[identifierKey(strings.Join(parts, "."))] = true
+			return nil
+		}
+		unique := p.acceptWord("unique")
+		if p.acceptWord("index") {
+			return p.createIndex(unique)
+		}
+	case p.acceptWord("alter", "table"):
+		return p.alterTable()
+	case p.acceptWord("comment", "on"):
+		return p.comment()
+	}
+	return nil
+}
+
+func (p *ddlParser) createTable() error {
+	p.acceptWord("if", "not", "exists")
+	parts, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	name := strings.Join(parts, ".")
+	// the partitions, the typed tables and CREATE TABLE AS have no column list
+	if !p.isSymbol("(") {
+		p.schema.others[identifierKey(name)] = true
+		return nil
+	}
+	if p.schema.table(name) != nil {
+		return p.errorf("table %s is created twice", name)
+	}
+	p.schema.positions[identifierKey(name)] = len(p.schema.tables)
+	p.schema.tables = append(p.schema.tables, Table{TableName: name, Columns: []TableColumn{}, Constraints: []ConstraintInfo{}, Indexes: []IndexInfo{}})
+	table := &p.schema.tables[len(p.schema.tables)-1]
+
+	p.acceptSymbol("(")
+	for !p.acceptSymbol(")") {
+		if err := p.tableElement(table); err != nil {
+			return err
+		}
+		if !p.isSymbol(")") {
+			if err := p.expectSymbol(","); err != nil {
+				return err
+			}
+		}
+		if _, ok := p.peek(); !ok {
+			return p.errorf("expected \")\"")
+		}
+	}
+	return nil
+}
+
+// tableElement reads a column or a table constraint of CREATE TABLE
+func (p *ddlParser) tableElement(table *Table) error {
+	if p.acceptWord("like") {
+		p.skip(nil)
+		return nil
+	}
+	if p.isWord("constraint") || p.isWord("primary", "key") || p.isWord("unique") || p.isWord("foreign", "key") || p.isWord("check") || p.isWord("exclude") {
+		return p.tableConstraint(table)
+	}
+	return p.columnDefinition(table)
+}
+
+// columnConstraintWords end the type and the default of a column
+var columnConstraintWords = map[string]bool{
+	"constraint": true, "not": true, "null": true, "default": true, "primary": true, "unique": true,
+	"check": true, "references": true, "collate": true, "generated": true, "deferrable": true, "initially": true,
+}
+
+func (p *ddlParser) columnDefinition(table *Table) error {
+	name, err := p.identifier()
+	if err != nil {
+		return err
+	}
+	if table.column(name) != nil {
+		return p.errorf("column %s of %s is defined twice", name, table.TableName)
+	}
+	start := p.skip(columnConstraintWords)
+	if start == p.position {
+		return p.errorf("column %s has no type", name)
+	}
+	column := TableColumn{TableName: table.TableName, ColumnName: name, IsNullable: true, OrdinalPosition: len(table.Columns) + 1}
+	setColumnType(&column, p.tokens[start:p.position])
+	table.Columns = append(table.Columns, column)
+	return p.columnConstraints(table, name)
+}
+
+func (p *ddlParser) columnConstraints(table *Table, columnName string) error {
+	for {
+		if p.atElementEnd() {
+			return nil
+		}
+		token, _ := p.peek()
+		column := table.column(columnName)
+		constraintName := ""
+		if p.acceptWord("constraint") {
+			var err error
+			if constraintName, err = p.identifier(); err != nil {
+				return err
+			}
+		}
+		switch {
+		case p.acceptWord("not", "null"):
+			column.IsNullable = false
+		case p.acceptWord("null"):
+			column.IsNullable = true
+		case p.acceptWord("default"):
+			if p.atElementEnd() {
+				return p.errorf("expected the default value")
+			}
+			// the expression may start with one of the words like in DEFAULT NULL
+			start := p.position
+			p.position++
+			p.skip(columnConstraintWords)
+			value := p.source(start)
+			column.ColumnDefault = &value
+		case p.acceptWord("primary", "key"):
+			column.IsNullable = false
+			table.addConstraint(constraintName, "PRIMARY KEY", []string{columnName}, "", nil, "")
+			p.skip(columnConstraintWords)
+		case p.acceptWord("unique"):
+			table.addConstraint(constraintName, "UNIQUE", []string{columnName}, "", nil, "")
+			p.skip(columnConstraintWords)
+		case p.acceptWord("check"):
+			check, err := p.parenthesized()
+			if err != nil {
+				return err
+			}
+			table.addConstraint(constraintName, "CHECK", []string{columnName}, "", nil, "("+check+")")
+			p.acceptWord("no", "inherit")
+		case p.acceptWord("references"):
+			foreignTable, foreignColumns, err := p.references()
+			if err != nil {
+				return err
+			}
+			table.addConstraint(constraintName, "FOREIGN KEY", []string{columnName}, foreignTable, foreignColumns, "")
+		case p.acceptWord("collate"):
+			if _, err := p.qualifiedName(); err != nil {
+				return err
+			}
+		case p.acceptWord("generated"):
+			// the identity columns are not null, the generated ones are computed from the expression
+			p.acceptWord("always")
+			p.acceptWord("by", "default")
+			if !p.acceptWord("as") {
+				return p.errorf("expected AS")
+			}
+			if p.acceptWord("identity") {
+				column.IsNullable = false
+			}
+			p.skip(columnConstraintWords)
+		case p.acceptWord("deferrable"), p.acceptWord("not", "deferrable"), p.acceptWord("initially"):
+			p.skip(columnConstraintWords)
+		default:
+			return p.errorf("unexpected %q in the definition of column %s", token.text, columnName)
+		}
+	}
+}
+
+// references reads the table and the columns of a foreign key and skips its options
+func (p *ddlParser) references() (string, []string, error) {
+	parts, err := p.qualifiedName()
+	if err != nil {
+		return "", nil, err
+	}
+	columns := []string{}
+	if p.isSymbol("(") {
+		if columns, err = p.identifierList(); err != nil {
+			return "", nil, err
+		}
+	}
+	for {
+		switch {
+		case p.acceptWord("on", "delete"), p.acceptWord("on", "update"):
+			if !(p.acceptWord("no", "action") || p.acceptWord("restrict") || p.acceptWord("cascade") || p.acceptWord("set", "null") || p.acceptWord("set", "default")) {
+				return "", nil, p.errorf("expected a referential action")
+			}
+			// SET NULL and SET DEFAULT may list the columns
+			if p.isSymbol("(") {
+				if _, err := p.identifierList(); err != nil {
+					return "", nil, err
+				}
+			}
+		case p.acceptWord("match"):
+			if _, err := p.identifier(); err != nil {
+				return "", nil, err
+			}
+		default:
+			return strings.Join(parts, "."), columns, nil
+		}
+	}
+}
+
+// tableConstraint reads a table constraint of CREATE TABLE or ALTER TABLE ADD
+func (p *ddlParser) tableConstraint(table *Table) error {
+	name := ""
+	if p.acceptWord("constraint") {
+		var err error
+		if name, err = p.identifier(); err != nil {
+			return err
+		}
+	}
+	switch {
+	case p.isWord("primary", "key") || p.isWord("unique"):
+		constraintType := "UNIQUE"
+		if p.acceptWord("primary", "key") {
+			constraintType = "PRIMARY KEY"
+		} else {
+			p.acceptWord("unique")
+		}
+		p.acceptWord("nulls", "not", "distinct")
+		p.acceptWord("nulls", "distinct")
+		columns, err := p.identifierList()
+		if err != nil {
+			return err
+		}
+		if err := table.checkColumns(columns); err != nil {
+			return p.errorf("%v", err)
+		}
+		if constraintType == "PRIMARY KEY" {
+			for _, name := range columns {
+				table.column(name).IsNullable = false
+			}
+		}
+		table.addConstraint(name, constraintType, columns, "", nil, "")
+	case p.acceptWord("foreign", "key"):
+		columns, err := p.identifierList()
+		if err != nil {
+			return err
+		}
+		if err := table.checkColumns(columns); err != nil {
+			return p.errorf("%v", err)
+		}
+		if !p.acceptWord("references") {
+			return p.errorf("expected REFERENCES")
+		}
+		foreignTable, foreignColumns, err := p.references()
+		if err != nil {
+			return err
+		}
+		table.addConstraint(name, "FOREIGN KEY", columns, foreignTable, foreignColumns, "")
+	case p.acceptWord("check"):
+		start := p.position
+		check, err := p.parenthesized()
+		if err != nil {
+			return err
+		}
+		// PostgreSQL names the check after the first column it references
+		if name == "" {
+			columns := []string{}
+			for _, token := range p.tokens[start:p.position] {
+				if token.kind == sqlWord || token.kind == sqlQuoted {
+					name := token.text
+					if token.kind == sqlQuoted {
+						name = modelIdentifier(name)
+					}
+					if column := table.column(name); column != nil {
+						columns = append(columns, column.ColumnName)
+						break
+					}
+				}
+			}
+			name = table.unusedName(defaultConstraintName(table.TableName, columns, "check"))
+		}
+		table.addConstraint(name, "CHECK", nil, "", nil, "("+check+")")
+	case p.acceptWord("exclude"):
+		// the exclusion constraints have no place in the Table model
+	default:
+		return p.errorf("expected a constraint")
+	}
+	p.skip(nil)
+	return nil
+}
+
+func (p *ddlParser) alterTable() error {
+	p.acceptWord("if", "exists")
+	p.acceptWord("only")
+	table, err := p.tableName()
+	if err != nil || table == nil {
+		return err
+	}
+	for {
+		if err := p.alterAction(table); err != nil {
+			return err
+		}
+		// the unknown actions like OWNER TO are skipped
+		p.skip(nil)
+		if !p.acceptSymbol(",") {
+			return nil
+		}
+	}
+}
+
+func (p *ddlParser) alterAction(table *Table) error {
+	switch {
+	case p.acceptWord("add"):
+		if p.isWord("constraint") || p.isWord("primary", "key") || p.isWord("unique") || p.isWord("foreign", "key") || p.isWord("check") || p.isWord("exclude") {
+			return p.tableConstraint(table)
+		}
+		p.acceptWord("column")
+		p.acceptWord("if", "not", "exists")
+		return p.columnDefinition(table)
+	case p.acceptWord("drop"):
+		if p.acceptWord("constraint") {
+			p.acceptWord("if", "exists")
+			name, err := p.identifier()
+			if err != nil {
+				return err
+			}
+			table.dropConstraint(name)
+			return nil
+		}
+		p.acceptWord("column")
+		p.acceptWord("if", "exists")
+		name, err := p.identifier()
+		if err != nil {
+			return err
+		}
+		table.dropColumn(name)
+		return nil
+	case p.acceptWord("alter"):
+		p.acceptWord("column")
+		name, err := p.identifier()
+		if err != nil {
+			return err
+		}
+		column := table.column(name)
+		if column == nil {
+			return p.errorf("unknown column %s of %s", name, table.TableName)
+		}
+		switch {
+		case p.acceptWord("set", "default"):
+			if p.atElementEnd() {
+				return p.errorf("expected the default value")
+			}
+			start := p.skip(nil)
+			value := p.source(start)
+			column.ColumnDefault = &value
+		case p.acceptWord("drop", "default"):
+			column.ColumnDefault = nil
+		case p.acceptWord("set", "not", "null"):
+			column.IsNullable = false
+		case p.acceptWord("drop", "not", "null"):
+			column.IsNullable = true
+		case p.acceptWord("set", "data", "type"), p.acceptWord("type"):
+			start := p.skip(map[string]bool{"collate": true, "using": true})
+			if start == p.position {
+				return p.errorf("expected the type of column %s", name)
+			}
+			column.CharacterMaximumLength, column.NumericPrecision, column.NumericScale = nil, nil, nil
+			setColumnType(column, p.tokens[start:p.position])
+		}
+	case p.acceptWord("rename", "to"):
+		name, err := p.identifier()
+		if err != nil {
+			return err
+		}
+		// the renamed table stays in its schema
+		if schema, _, ok := strings.Cut(table.TableName, "."); ok {
+			name = schema + "." + name
+		}
+		if p.schema.table(name) != nil {
+			return p.errorf("table %s already exists", name)
+		}
+		p.schema.positions[identifierKey(name)] = p.schema.positions[identifierKey(table.TableName)]
+		delete(p.schema.positions, identifierKey(table.TableName))
+		// the foreign keys follow the table
+		for position := range p.schema.tables {
+			for index, constraint := range p.schema.tables[position].Constraints {
+				if constraint.ForeignTableName != nil && identifierKey(*constraint.ForeignTableName) == identifierKey(table.TableName) {
+					p.schema.tables[position].Constraints[index].ForeignTableName = &name
+				}
+			}
+		}
+		table.rename(name)
+	case p.acceptWord("rename", "constraint"):
+		from, err := p.identifier()
+		if err != nil {
+			return err
+		}
+		if !p.acceptWord("to") {
+			return p.errorf("expected TO")
+		}
+		to, err := p.identifier()
+		if err != nil {
+			return err
+		}
+		for index := range table.Constraints {
+			if identifierKey(table.Constraints[index].ConstraintName) == identifierKey(from) {
+				table.Constraints[index].ConstraintName = to
+			}
+		}
+	case p.acceptWord("rename", "column"), p.acceptWord("rename"):
+		from, err := p.identifier()
+		if err != nil {
+			return err
+		}
+		if !p.acceptWord("to") {
+			return p.errorf("expected TO")
+		}
+		to, err := p.identifier()
+		if err != nil {
+			return err
+		}
+		table.renameColumn(from, to)
+	}
+	return nil
+}
+
+func (p *ddlParser) createIndex(unique bool) error {
+	p.acceptWord("concurrently")
+	p.acceptWord("if", "not", "exists")
+	name := ""
+	if !p.isWord("on") {
+		parts, err := p.qualifiedName()
+		if err != nil {
+			return err
+		}
+		name = parts[len(parts)-1]
+	}
+	if !p.acceptWord("on") {
+		return p.errorf("expected ON")
+	}
+	p.acceptWord("only")
+	table, err := p.tableName()
+	if err != nil || table == nil {
+		return err
+	}
+	method := "btree"
+	if p.acceptWord("using") {
+		if method, err = p.identifier(); err != nil {
+			return err
+		}
+	}
+	if err := p.expectSymbol("("); err != nil {
+		return err
+	}
+	columns := []string{}
+	for {
+		column, err := p.indexElement(table)
+		if err != nil {
+			return err
+		}
+		columns = append(columns, column)
+		if p.acceptSymbol(")") {
+			break
+		}
+		if err := p.expectSymbol(","); err != nil {
+			return err
+		}
+	}
+	// the included columns and the predicate of a partial index are part of what it means
+	include := []string{}
+	if p.acceptWord("include") {
+		if include, err = p.identifierList(); err != nil {
+			return err
+		}
+		if err := table.checkColumns(include); err != nil {
+			return p.errorf("%v", err)
+		}
+	}
+	p.acceptWord("nulls", "not", "distinct")
+	p.acceptWord("nulls", "distinct")
+	if p.acceptWord("with") {
+		if _, err := p.parenthesized(); err != nil {
+			return err
+		}
+	}
+	if p.acceptWord("tablespace") {
+		if _, err := p.identifier(); err != nil {
+			return err
+		}
+	}
+	predicate := ""
+	if p.acceptWord("where") {
+		start := p.position
+		p.position = len(p.tokens)
+		if predicate = p.source(start); predicate == "" {
+			return p.errorf("expected the predicate of the index")
+		}
+	}
+	if token, ok := p.peek(); ok {
+		return p.errorf("unexpected %q after the columns of the index", token.text)
+	}
+
+	if name == "" {
+		name = table.unusedName(defaultConstraintName(table.TableName, columns, "idx"))
+	}
+	for _, column := range columns {
+		table.Indexes = append(table.Indexes, IndexInfo{TableName: table.TableName, IndexName: name, ColumnName: column, IsUnique: unique, IndexType: method, Predicate: predicate})
+	}
+	for _, column := range include {
+		table.Indexes = append(table.Indexes, IndexInfo{TableName: table.TableName, IndexName: name, ColumnName: column, IsUnique: unique, IndexType: method, IsIncluded: true, Predicate: predicate})
+	}
+	return nil
+}
+
+// indexOptionWords end the column or the expression of an index element
+var indexOptionWords = map[string]bool{"collate": true, "asc": true, "desc": true, "nulls": true}
+
+// indexElement reads a column or an expression of an index, the options and the operator class are skipped
+func (p *ddlParser) indexElement(table *Table) (string, error) {
+	column := ""
+	switch {
+	case p.isSymbol("("):
+		expression, err := p.parenthesized()
+		if err != nil {
+			return "", err
+		}
+		column = expression
+	case p.position+1 < len(p.tokens) && p.tokens[p.position+1].kind == sqlSymbol && p.tokens[p.position+1].text == "(":
+		start := p.position
+		p.position += 2
+		p.skip(nil)
+		if err := p.expectSymbol(")"); err != nil {
+			return "", err
+		}
+		column = p.source(start)
+	default:
+		name, err := p.identifier()
+		if err != nil {
+			return "", err
+		}
+		if table.column(name) == nil {
+			return "", p.errorf("unknown column %s of %s in an index", name, table.TableName)
+		}
+		column = name
+	}
+	p.skip(indexOptionWords)
+	for p.acceptWord("collate") || p.acceptWord("asc") || p.acceptWord("desc") || p.acceptWord("nulls") {
+		p.skip(indexOptionWords)
+	}
+	return column, nil
+}
+
+func (p *ddlParser) comment() error {
+	target := ""
+	switch {
+	case p.acceptWord("table"):
+		target = "table"
+	case p.acceptWord("column"):
+		target = "column"
+	default:
+		return nil
+	}
+	parts, err := p.qualifiedName()
+	if err != nil {
+		return err
+	}
+	if !p.acceptWord("is") {
+		return p.errorf("expected IS")
+	}
+	text := ""
+	if token, ok := p.peek(); ok && token.kind == sqlString {
+		text = token.text
+	} else if !p.isWord("null") {
+		return p.errorf("expected the comment")
+	}
+
+	if target == "table" {
+		table, err := p.lookup(parts)
+		if err == nil && table != nil {
+			table.Comment = text
+		}
+		return err
+	}
+	if len(parts) < 2 {
+		return p.errorf("expected the table of the column")
+	}
+	table, err := p.lookup(parts[:len(parts)-1])
+	if err != nil || table == nil {
+		return err
+	}
+	column := table.column(parts[len(parts)-1])
+	if column == nil {
+		return p.errorf("unknown column %s of %s", parts[len(parts)-1], table.TableName)
+	}
+	column.Comment = text
+	return nil
+}
+
+// setColumnType sets the type of the column like information_schema does, the length of the character
+// types and the precision of numeric are apart from the name and the short names are expanded
+func setColumnType(column *TableColumn, tokens []sqlToken) {
+	var dataType strings.Builder
+	for index, token := range tokens {
+		text := token.text
+		if token.kind == sqlQuoted {
+			text = QuoteIdentifier(text)
+		}
+		if index > 0 && token.kind != sqlSymbol && tokens[index-1].kind != sqlSymbol {
+			dataType.WriteByte(' ')
+		}
+		dataType.WriteString(text)
+	}
+	column.DataType = strings.TrimPrefix(dataType.String(), "public.")
+
+	parts := typeModifier.FindStringSubmatch(column.DataType)
+	if parts == nil {
+		return
+	}
+	name, modifier, array := parts[1], parts[2], parts[3]
+	if alias, ok := typeAliases[name]; ok && !serialTypes[name] {
+		name = alias
+	}
+	numbers := []int{}
+	for _, value := range strings.Split(strings.Trim(modifier, "()"), ",") {
+		if number, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			numbers = append(numbers, number)
+		}
+	}
+	switch {
+	case array == "" && len(numbers) == 1 && (name == "character varying" || name == "character" || name == "bit" || name == "bit varying"):
+		column.CharacterMaximumLength = &numbers[0]
+		modifier = ""
+	case array == "" && len(numbers) > 0 && name == "numeric":
+		column.NumericPrecision = &numbers[0]
+		if len(numbers) > 1 {
+			column.NumericScale = &numbers[1]
+		}
+		modifier = ""
+	}
+	column.DataType = name + modifier + array
+}
+
+func (t *Table) column(name string) *TableColumn {
+	for index := range t.Columns {
+		if identifierKey(t.Columns[index].ColumnName) == identifierKey(name) {
+			return &t.Columns[index]
+		}
+	}
+	return nil
+}
+
+func (t *Table) checkColumns(columns []string) error {
+	for _, name := range columns {
+		if t.column(name) == nil {
+			return fmt.Errorf("unknown column %s of %s", name, t.TableName)
+		}
+	}
+	return nil
+}
+
+// addConstraint adds a row per column of the constraint, an unnamed one gets the name PostgreSQL gives it
+func (t *Table) addConstraint(name string, constraintType string, columns []string, foreignTable string, foreignColumns []string, check string) {
+	if name == "" {
+		switch constraintType {
+		case "PRIMARY KEY":
+			name = defaultConstraintName(t.TableName, nil, "pkey")
+		case "UNIQUE":
+			name = defaultConstraintName(t.TableName, columns, "key")
+		case "FOREIGN KEY":
+			name = defaultConstraintName(t.TableName, columns, "fkey")
+		case "CHECK":
+			name = defaultConstraintName(t.TableName, columns, "check")
+		}
+		name = t.unusedName(name)
+	}
+	if len(columns) == 0 {
+		t.Constraints = append(t.Constraints, ConstraintInfo{TableName: t.TableName, ConstraintName: name, ConstraintType: constraintType, CheckClause: &check})
+		return
+	}
+	for index, column := range columns {
+		row := ConstraintInfo{TableName: t.TableName, ConstraintName: name, ConstraintType: constraintType, ColumnName: &column}
+		position := index + 1
+		row.OrdinalPosition = &position
+		if foreignTable != "" {
+			row.ForeignTableName = &foreignTable
+			if index < len(foreignColumns) {
+				row.ForeignColumnName = &foreignColumns[index]
+			}
+		}
+		if check != "" {
+			row.CheckClause = &check
+		}
+		t.Constraints = append(t.Constraints, row)
+	}
+}
+
+// unusedName adds a number to the name like PostgreSQL does when a constraint or an index of the table has it
+func (t *Table) unusedName(name string) string {
+	used := make(map[string]bool)
+	for _, constraint := range t.Constraints {
+		used[identifierKey(constraint.ConstraintName)] = true
+	}
+	for _, index := range t.Indexes {
+		used[identifierKey(index.IndexName)] = true
+	}
+	base := identifierKey(name)
+	for number := 1; used[identifierKey(name)]; number++ {
+		name = modelIdentifier(base + strconv.Itoa(number))
+	}
+	return name
+}
+
+// defaultConstraintName is the name PostgreSQL gives a constraint or an index, like members_email_key
+func defaultConstraintName(table string, columns []string, suffix string) string {
+	parts := splitQualified(table)
+	names := append([]string{parts[len(parts)-1]}, columns...)
+	return modelIdentifier(strings.Join(append(identifierKeys(names), suffix), "_"))
+}
+
+func (t *Table) dropConstraint(name string) {
+	constraints := t.Constraints[:0]
+	for _, constraint := range t.Constraints {
+		if identifierKey(constraint.ConstraintName) != identifierKey(name) {
+			constraints = append(constraints, constraint)
+		}
+	}
+	t.Constraints = constraints
+}
+
+// dropColumn drops the column with its constraints and indexes like PostgreSQL does
+func (t *Table) dropColumn(name string) {
+	key := identifierKey(name)
+	columns := t.Columns[:0]
+	for _, column := range t.Columns {
+		if identifierKey(column.ColumnName) != key {
+			column.OrdinalPosition = len(columns) + 1
+			columns = append(columns, column)
+		}
+	}
+	t.Columns = columns
+	constraints := []string{}
+	for _, constraint := range t.Constraints {
+		if constraint.ColumnName != nil && identifierKey(*constraint.ColumnName) == key {
+			constraints = append(constraints, constraint.ConstraintName)
+		}
+	}
+	for _, name := range constraints {
+		t.dropConstraint(name)
+	}
+	indexes := t.Indexes[:0]
+	dropped := make(map[string]bool)
+	for _, index := range t.Indexes {
+		if identifierKey(index.ColumnName) == key {
+			dropped[identifierKey(index.IndexName)] = true
+		}
+	}
+	for _, index := range t.Indexes {
+		if !dropped[identifierKey(index.IndexName)] {
+			indexes = append(indexes, index)
+		}
+	}
+	t.Indexes = indexes
+}
+
+func (t *Table) renameColumn(from string, to string) {
+	rename := func(name *string) {
+		if name != nil && identifierKey(*name) == identifierKey(from) {
+			*name = to
+		}
+	}
+	for index := range t.Columns {
+		rename(&t.Columns[index].ColumnName)
+	}
+	for index := range t.Constraints {
+		rename(t.Constraints[index].ColumnName)
+	}
+	for index := range t.Indexes {
+		rename(&t.Indexes[index].ColumnName)
+	}
+}
+
+func (t *Table) rename(name string) {
+	t.TableName = name
+	for index := range t.Columns {
+		t.Columns[index].TableName = name
+	}
+	for index := range t.Constraints {
+		t.Constraints[index].TableName = name
+	}
+	for index := range t.Indexes {
+		t.Indexes[index].TableName = name
+	}
+}
@@ -0,0 +1,352 @@
+package RAG_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+// gymDump is the pg_dump --schema-only output of gymSchema
+const gymDump = `--
+-- PostgreSQL database dump
+--
+
+SET statement_timeout = 0;
+SET client_encoding = 'UTF8';
+SELECT pg_catalog.set_config('search_path', '', false);
+
+CREATE FUNCTION public.touch() RETURNS trigger
+    LANGUAGE plpgsql
+    AS $$
+BEGIN
+    NEW.updated_at := now(); -- a semicolon in the body
+    RETURN NEW;
+END;
+$$;
+
+SET default_tablespace = '';
+
+/* the gym members */
+CREATE TABLE public.members (
+    id integer NOT NULL,
+    email character varying(100) NOT NULL,
+    name text
+);
+
+ALTER TABLE public.members OWNER TO gym;
+
+COMMENT ON TABLE public.members IS 'the gym members, they''re billed monthly';
+COMMENT ON COLUMN public.members.name IS 'the display name';
+
+CREATE SEQUENCE public.members_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+ALTER SEQUENCE public.members_id_seq OWNED BY public.members.id;
+
+CREATE TABLE public.visits (
+    member_id integer,
+    visited_at timestamp with time zone DEFAULT now()
+);
+
+ALTER TABLE ONLY public.members ALTER COLUMN id SET DEFAULT nextval('public.members_id_seq'::regclass);
+
+ALTER TABLE ONLY public.members
+    ADD CONSTRAINT members_email_key UNIQUE (email);
+
+ALTER TABLE ONLY public.members
+    ADD CONSTRAINT members_pkey PRIMARY KEY (id);
+
+CREATE INDEX members_name_idx ON public.members USING btree (name);
+
+ALTER TABLE ONLY public.visits
+    ADD CONSTRAINT visits_member_id_fkey FOREIGN KEY (member_id) REFERENCES public.members(id) ON DELETE CASCADE;
+
+--
+-- PostgreSQL database dump complete
+--
+`
+
+func TestParseDDLDump(t *testing.T) {
+	tables, err := RAG.ParseDDL(gymDump)
+	if err != nil {
+		t.Fatalf("ParseDDL failed: %v", err)
+	}
+	if len(tables) != 2 || tables[0].TableName != "members" || tables[1].TableName != "visits" {
+		t.Fatalf("unexpected tables: %+v", tables)
+	}
+	// the sequence of pg_dump is qualified, information_schema is not
+	expected := gymSchema()
+	expected[0].Columns[0].ColumnDefault = ptr("nextval('public.members_id_seq'::regclass)")
+	expected[1].Columns[0].IsNullable = true
+	expected[1].Columns[1].IsNullable = true
+	if diff := RAG.DiffSchemas(expected, tables); !diff.Empty() {
+		t.Errorf("expected the schema of the dump, got %v", diff.Describe())
+	}
+	members := tables[0]
+	if members.Comment != "the gym members, they're billed monthly" || members.Columns[2].Comment != "the display name" {
+		t.Errorf("unexpected comments: %q, %q", members.Comment, members.Columns[2].Comment)
+	}
+	email := members.Columns[1]
+	if email.DataType != "character varying" || email.CharacterMaximumLength == nil || *email.CharacterMaximumLength != 100 || email.IsNullable {
+		t.Errorf("unexpected email column: %+v", email)
+	}
+}
+
+func TestParseDDLInline(t *testing.T) {
+	script := `
+	CREATE TABLE IF NOT EXISTS gyms (id SERIAL PRIMARY KEY, "Name" VARCHAR(50) UNIQUE NOT NULL);
+	CREATE TABLE sales.memberships (
+		id bigint GENERATED BY DEFAULT AS IDENTITY,
+		gym_id int NOT NULL REFERENCES gyms ON DELETE SET NULL,
+		price numeric(10, 2) DEFAULT 0 CHECK (price >= 0),
+		tags text[],
+		starts_at timestamptz NOT NULL, ends_at timestamptz,
+		CONSTRAINT memberships_period CHECK (ends_at > starts_at),
+		UNIQUE (gym_id, starts_at)
+	);
+	CREATE UNIQUE INDEX ON sales.memberships USING gin (tags, lower("tags"::text) DESC);
+	ALTER TABLE sales.memberships ADD COLUMN note text DEFAULT NULL, DROP COLUMN tags, ALTER COLUMN price SET NOT NULL;
+	CREATE VIEW sales.active AS SELECT * FROM sales.memberships WHERE ends_at > now();
+	COMMENT ON COLUMN sales.active.gym_id IS 'the gym';
+	ALTER TABLE gyms RENAME TO clubs;
+	`
+	tables, err := RAG.ParseDDL(script)
+	if err != nil {
+		t.Fatalf("ParseDDL failed: %v", err)
+	}
+	gyms, memberships := tables[0], tables[1]
+	if gyms.TableName != "clubs" || gyms.Columns[1].TableName != "clubs" {
+		t.Errorf("expected the renamed table, got %+v", gyms)
+	}
+	if gyms.Columns[0].DataType != "serial" || gyms.Columns[0].IsNullable || gyms.Columns[1].ColumnName != `"Name"` {
+		t.Errorf("unexpected gyms columns: %+v", gyms.Columns)
+	}
+	expected := []RAG.SchemaConstraint{
+		{Name: "gyms_pkey", Type: "PRIMARY KEY", Columns: []string{"id"}},
+		{Name: `"gyms_Name_key"`, Type: "UNIQUE", Columns: []string{`"Name"`}},
+	}
+	if constraints := RAG.TableConstraints(gyms); !reflect.DeepEqual(constraints, expected) {
+		t.Errorf("unexpected gyms constraints: %+v", constraints)
+	}
+
+	if memberships.TableName != "sales.memberships" {
+		t.Errorf("unexpected table name %s", memberships.TableName)
+	}
+	columns := []string{}
+	for _, column := range memberships.Columns {
+		columns = append(columns, column.ColumnName)
+	}
+	if !reflect.DeepEqual(columns, []string{"id", "gym_id", "price", "starts_at", "ends_at", "note"}) {
+		t.Errorf("unexpected columns: %v", columns)
+	}
+	// the identity is not null and the referential action is not a NULL constraint
+	if id, gym := memberships.Columns[0], memberships.Columns[1]; id.IsNullable || id.ColumnDefault != nil || gym.IsNullable {
+		t.Errorf("unexpected id and gym_id columns: %+v, %+v", id, gym)
+	}
+	if note := memberships.Columns[5]; note.ColumnDefault == nil || *note.ColumnDefault != "NULL" {
+		t.Errorf("unexpected note column: %+v", note)
+	}
+	price := memberships.Columns[2]
+	if price.DataType != "numeric" || *price.NumericPrecision != 10 || *price.NumericScale != 2 || *price.ColumnDefault != "0" || price.IsNullable {
+		t.Errorf("unexpected price column: %+v", price)
+	}
+	expected = []RAG.SchemaConstraint{
+		{Name: "memberships_gym_id_fkey", Type: "FOREIGN KEY", Columns: []string{"gym_id"}, ForeignTable: "clubs"},
+		{Name: "memberships_price_check", Type: "CHECK", Columns: []string{"price"}, Check: "(price >= 0)"},
+		{Name: "memberships_period", Type: "CHECK", Check: "(ends_at > starts_at)"},
+		{Name: "memberships_gym_id_starts_at_key", Type: "UNIQUE", Columns: []string{"gym_id", "starts_at"}},
+	}
+	if constraints := RAG.TableConstraints(memberships); !reflect.DeepEqual(constraints, expected) {
+		t.Errorf("unexpected memberships constraints:\n%+v", constraints)
+	}
+	// dropping tags dropped its index
+	if len(memberships.Indexes) != 0 {
+		t.Errorf("unexpected indexes: %+v", memberships.Indexes)
+	}
+}
+
+func TestParseDDLIndexes(t *testing.T) {
+	tables, err := RAG.ParseDDL(`CREATE TABLE members (email text, name text);
+		CREATE UNIQUE INDEX members_email_lower ON members (lower(email)) WHERE email IS NOT NULL;
+		CREATE INDEX ON members USING hash (name text_pattern_ops);`)
+	if err != nil {
+		t.Fatalf("ParseDDL failed: %v", err)
+	}
+	expected := []RAG.SchemaIndex{
+		{Name: "members_email_lower", Columns: []string{"lower(email)"}, Unique: true, Type: "btree", Where: "email IS NOT NULL"},
+		{Name: "members_name_idx", Columns: []string{"name"}, Type: "hash"},
+	}
+	if indexes := RAG.TableIndexes(tables[0]); !reflect.DeepEqual(indexes, expected) {
+		t.Errorf("unexpected indexes: %+v", indexes)
+	}
+
+	// the partial index keeps its meaning in the DDL and in the diff
+	tables, err = RAG.ParseDDL(`CREATE TABLE o (a int, b int);
+		CREATE UNIQUE INDEX o_a ON o (a) INCLUDE (b) WITH (fillfactor = 70) WHERE a > 0;`)
+	if err != nil {
+		t.Fatalf("ParseDDL failed: %v", err)
+	}
+	if schema := RAG.CompactSchema(tables); !strings.Contains(schema, "UNIQUE INDEX o_a (a) INCLUDE (b) WHERE a > 0\n") {
+		t.Errorf("unexpected compact schema:\n%s", schema)
+	}
+	full := []RAG.Table{tables[0]}
+	full[0].Indexes = []RAG.IndexInfo{{TableName: "o", IndexName: "o_a", ColumnName: "a", IsUnique: true}}
+	statements, err := RAG.GenerateDDL(RAG.DiffSchemas(full, tables))
+	if err != nil || !reflect.DeepEqual(statements, []string{"DROP INDEX o_a;", "CREATE UNIQUE INDEX o_a ON o (a) INCLUDE (b) WHERE a > 0;"}) {
+		t.Errorf("unexpected DDL: %q, %v", statements, err)
+	}
+}
+
+func TestParseDDLDefaultNames(t *testing.T) {
+	tables, err := RAG.ParseDDL(`CREATE TABLE o (a int, "B" int, CHECK (a > 0), CHECK ("B" > a), CHECK (a < 10), CHECK (now() > '2000-01-01'));
+		CREATE INDEX ON o (a); CREATE INDEX ON o (a);`)
+	if err != nil {
+		t.Fatalf("ParseDDL failed: %v", err)
+	}
+	names := []string{}
+	for _, constraint := range RAG.TableConstraints(tables[0]) {
+		names = append(names, constraint.Name)
+	}
+	if expected := []string{"o_a_check", `"o_B_check"`, "o_a_check1", "o_check"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("unexpected check names: %q", names)
+	}
+	if indexes := RAG.TableIndexes(tables[0]); len(indexes) != 2 || indexes[0].Name != "o_a_idx" || indexes[1].Name != "o_a_idx1" {
+		t.Errorf("unexpected indexes: %+v", indexes)
+	}
+}
+
+func TestParseDDLErrors(t *testing.T) {
+	tests := map[string]string{
+		"unterminated string": "CREATE TABLE members (name text DEFAULT 'x);",
+		"unterminated body":   "CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $$;",
+		"unknown table":       "CREATE TABLE members (id int);\nALTER TABLE ONLY visits ADD CONSTRAINT visits_pkey PRIMARY KEY (id);",
+		"unknown column":      "CREATE TABLE members (id int);\nCREATE INDEX members_name_idx ON members (name);",
+		"unknown key column":  "CREATE TABLE members (id int, PRIMARY KEY (member_id));",
+		"duplicate column":    "CREATE TABLE members (id int, id text);",
+		"duplicate table":     "CREATE TABLE members (id int);\nCREATE TABLE Members (id int);",
+		"no type":             "CREATE TABLE members (id);",
+		"unclosed table":      "CREATE TABLE members (id int",
+		"no default":          "CREATE TABLE members (id int);\nALTER TABLE members ADD COLUMN b int DEFAULT;",
+		"no default in list":  "CREATE TABLE members (id int DEFAULT, name text);",
+		"no predicate":        "CREATE TABLE members (id int);\nCREATE INDEX ON members (id) WHERE;",
+		"index trailer":       "CREATE TABLE members (id int);\nCREATE INDEX ON members (id) id > 0;",
+		"no new type":         "CREATE TABLE members (id int);\nALTER TABLE members ALTER COLUMN id TYPE;",
+	}
+	for name, script := range tests {
+		if _, err := RAG.ParseDDL(script); !errors.Is(err, RAG.ErrInvalidDDL) {
+			t.Errorf("%s: expected an invalid DDL error, got %v", name, err)
+		}
+	}
+	_, err := RAG.ParseDDL("CREATE TABLE members (id int);\n\nALTER TABLE visits ADD COLUMN note text;")
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected the line of the error, got %v", err)
+	}
+	// the quoted names keep their case
+	tables, err := RAG.ParseDDL(`CREATE TABLE "Users" ("Id" int PRIMARY KEY); CREATE TABLE users (id int);
+		CREATE TABLE "Sales"."Orders" (user_id int REFERENCES "Users" ("Id"));`)
+	if err != nil {
+		t.Fatalf("expected the quoted and unquoted tables to differ, got %v", err)
+	}
+	if names := []string{tables[0].TableName, tables[0].Columns[0].ColumnName, tables[2].TableName, *tables[2].Constraints[0].ForeignTableName}; !reflect.DeepEqual(names, []string{`"Users"`, `"Id"`, `"Sales"."Orders"`, `"Users"`}) {
+		t.Errorf("unexpected names: %q", names)
+	}
+	if constraints := RAG.TableConstraints(tables[0]); constraints[0].Name != `"Users_pkey"` {
+		t.Errorf("unexpected constraints: %+v", constraints)
+	}
+	if diff := RAG.DiffSchemas(tables[:1], tables[1:2]); len(diff.Tables) != 2 {
+		t.Errorf("expected Users and users to be different tables, got %v", diff.Describe())
+	}
+
+	// the other statements and plain text have no tables
+	if tables, err := RAG.ParseDDL("CREATE VIEW v AS SELECT 1; the members have an email"); err != nil || len(tables) != 0 {
+		t.Errorf("expected no tables, got %+v, %v", tables, err)
+	}
+}
+
+func TestCompactSchema(t *testing.T) {
+	tables, err := RAG.ParseDDL(gymDump)
+	if err != nil {
+		t.Fatalf("ParseDDL failed: %v", err)
+	}
+	expected := `TABLE members -- the gym members, they're billed monthly
+  id serial NOT NULL
+  email character varying(100) NOT NULL
+  name text -- the display name
+  CONSTRAINT members_email_key UNIQUE (email)
+  CONSTRAINT members_pkey PRIMARY KEY (id)
+  INDEX members_name_idx (name)
+
+TABLE visits
+  member_id integer
+  visited_at timestamp with time zone DEFAULT now()
+  CONSTRAINT visits_member_id_fkey FOREIGN KEY (member_id) REFERENCES members (id)
+`
+	if schema := RAG.CompactSchema(tables); schema != expected {
+		t.Errorf("unexpected compact schema:\n%s", schema)
+	}
+}
+
+func TestQueryAgentDumpSchema(t *testing.T) {
+	llm := &fakeLLM{response: agentJSON}
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, &fakeStore{}, llm)
+
+	response, err := engine.QueryAgent("", gymDump, "members log in with an email", 1)
+	if err != nil {
+		t.Fatalf("QueryAgent failed: %v", err)
+	}
+	// the model sees the compact schema, not the dump
+	if !strings.Contains(llm.prompts[0], "TABLE members -- the gym members") || strings.Contains(llm.prompts[0], "pg_catalog") {
+		t.Errorf("unexpected prompt: %s", llm.prompts[0])
+	}
+	// the DDL is generated from the difference with the dump
+	// visits loses its foreign key to the primary key that is dropped
+	expected := []string{
+		"ALTER TABLE visits DROP CONSTRAINT visits_member_id_fkey;",
+		"ALTER TABLE members DROP CONSTRAINT members_email_key;",
+		"ALTER TABLE members DROP CONSTRAINT members_pkey;",
+		"DROP INDEX members_name_idx;",
+		"ALTER TABLE members ALTER COLUMN email TYPE text USING email::text;",
+		"ALTER TABLE members DROP COLUMN id;",
+		"ALTER TABLE members DROP COLUMN name;",
+	}
+	if !reflect.DeepEqual(response.DDLStatements, expected) {
+		t.Errorf("unexpected DDL:\n%s", strings.Join(response.DDLStatements, "\n"))
+	}
+}
+
+func TestQueryAgentPartialIndexRoundTrip(t *testing.T) {
+	dump := `CREATE TABLE members (id integer NOT NULL, email text, deleted_at timestamp with time zone);
+CREATE UNIQUE INDEX members_email_key ON members (email) INCLUDE (id) WHERE deleted_at IS NULL;`
+	current, err := RAG.ParseDDL(dump)
+	if err != nil {
+		t.Fatalf("ParseDDL failed: %v", err)
+	}
+	// the model writes the table back as it is
+	changes, _ := json.Marshal(current)
+	output := fmt.Sprintf(`{"analysis": "", "schema_changes": %s, "dropped_tables": [], "ddl": [], "risks": [], "rationale": "", "response": "nothing to change"}`, changes)
+	llm := &structuredLLM{fakeLLM: fakeLLM{response: output}}
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, &fakeStore{}, llm)
+
+	response, err := engine.QueryAgent("", dump, "keep the members", 1)
+	if err != nil {
+		t.Fatalf("QueryAgent failed: %v", err)
+	}
+	if len(response.DDLStatements) != 0 || len(response.Changes) != 0 {
+		t.Errorf("expected no changes, got %v\n%s", response.Changes, strings.Join(response.DDLStatements, "\n"))
+	}
+	// the model can write the predicate and the included columns back
+	index := llm.schemas[0].Properties["schema_changes"].Items.Properties["Indexes"].Items
+	if index.Properties["Predicate"] == nil || index.Properties["IsIncluded"] == nil {
+		t.Errorf("expected the partial index fields in the agent schema, got %v", index.Required)
+	}
+}
@@ -0,0 +1,258 @@
+package RAG_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := map[string]string{
+		"members":        "members",
+		"Members":        `"Members"`,
+		"user":           `"user"`,
+		"order items":    `"order items"`,
+		`say "hi"`:       `"say ""hi"""`,
+		"public.Members": `public."Members"`,
+		`"Quoted"`:       `"Quoted"`,
+		"1st":            `"1st"`,
+	}
+	for name, expected := range tests {
+		if quoted := RAG.QuoteIdentifier(name); quoted != expected {
+			t.Errorf("QuoteIdentifier(%q) = %s, expected %s", name, quoted, expected)
+		}
+	}
+}
+
+func TestGenerateDDLCreate(t *testing.T) {
+	// visits references members so members is created first even though it comes second
+	schema := gymSchema()
+	schema[0], schema[1] = schema[1], schema[0]
+	statements, err := RAG.GenerateDDL(RAG.DiffSchemas(nil, schema))
+	if err != nil {
+		t.Fatalf("GenerateDDL failed: %v", err)
+	}
+	expected := []string{
+		"CREATE TABLE members (\n" +
+			"    id serial NOT NULL,\n" +
+			"    email character varying(100) NOT NULL,\n" +
+			"    name text,\n" +
+			"    CONSTRAINT members_pkey PRIMARY KEY (id),\n" +
+			"    CONSTRAINT members_email_key UNIQUE (email)\n" +
+			");",
+		"CREATE TABLE visits (\n" +
+			"    member_id integer NOT NULL,\n" +
+			"    visited_at timestamp with time zone DEFAULT now() NOT NULL,\n" +
+			"    CONSTRAINT visits_member_id_fkey FOREIGN KEY (member_id) REFERENCES members (id)\n" +
+			");",
+		"CREATE INDEX members_name_idx ON members (name);",
+	}
+	if !reflect.DeepEqual(statements, expected) {
+		t.Errorf("unexpected statements:\n%s", strings.Join(statements, "\n"))
+	}
+}
+
+func TestGenerateDDLCycle(t *testing.T) {
+	fkey := func(table, name, column, foreign string) RAG.ConstraintInfo {
+		return RAG.ConstraintInfo{TableName: table, ConstraintName: name, ConstraintType: "FOREIGN KEY", ColumnName: &column, ForeignTableName: &foreign, ForeignColumnName: ptr("id")}
+	}
+	schema := []RAG.Table{
+		{TableName: "gyms", Columns: []RAG.TableColumn{{ColumnName: "id", DataType: "bigserial"}, {ColumnName: "manager_id", DataType: "bigint", IsNullable: true}},
+			Constraints: []RAG.ConstraintInfo{fkey("gyms", "gyms_manager_fkey", "manager_id", "Staff")}},
+		{TableName: "Staff", Columns: []RAG.TableColumn{{ColumnName: "id", DataType: "bigserial"}, {ColumnName: "gym_id", DataType: "bigint"}},
+			Constraints: []RAG.ConstraintInfo{fkey("Staff", "staff_gym_fkey", "gym_id", "gyms")}},
+	}
+	statements, err := RAG.GenerateDDL(RAG.DiffSchemas(nil, schema))
+	if err != nil {
+		t.Fatalf("GenerateDDL failed: %v", err)
+	}
+	if len(statements) != 3 || !strings.HasPrefix(statements[0], `CREATE TABLE "Staff"`) || !strings.Contains(statements[1], "REFERENCES \"Staff\" (id)") {
+		t.Fatalf("unexpected statements:\n%s", strings.Join(statements, "\n"))
+	}
+	if statements[2] != `ALTER TABLE "Staff" ADD CONSTRAINT staff_gym_fkey FOREIGN KEY (gym_id) REFERENCES gyms (id);` {
+		t.Errorf("expected the foreign key of the cycle last, got %s", statements[2])
+	}
+}
+
+func TestGenerateDDLAlter(t *testing.T) {
+	old := gymSchema()
+	new := gymSchema()
+	members := &new[0]
+	members.Columns[1].CharacterMaximumLength = ptr(255)
+	members.Columns[2].IsNullable = false
+	members.Columns[2].ColumnDefault = ptr("'unknown'::text")
+	members.Columns = append(members.Columns, RAG.TableColumn{ColumnName: "gym_id", DataType: "bigint", IsNullable: true, OrdinalPosition: 4})
+	members.Constraints = append(members.Constraints, RAG.ConstraintInfo{ConstraintName: "members_gym_fkey", ConstraintType: "FOREIGN KEY", ColumnName: ptr("gym_id"), ForeignTableName: ptr("gyms"), ForeignColumnName: ptr("id")})
+	members.Indexes = append(members.Indexes[:2], RAG.IndexInfo{IndexName: "members_name_idx", ColumnName: "lower(name)", IndexType: "btree"})
+	new[1].Columns = new[1].Columns[:1]
+	new[1].Constraints[0].ConstraintName = "visits_member_fkey"
+	new = append(new, RAG.Table{TableName: "gyms", Columns: []RAG.TableColumn{{ColumnName: "id", DataType: "bigserial"}},
+		Constraints: []RAG.ConstraintInfo{{ConstraintName: "gyms_pkey", ConstraintType: "PRIMARY KEY", ColumnName: ptr("id")}},
+		Indexes:     []RAG.IndexInfo{{IndexName: "gyms_id_idx", ColumnName: "id", IndexType: "HASH"}}})
+	old = append(old, RAG.Table{TableName: "old_visits", Constraints: []RAG.ConstraintInfo{
+		{ConstraintName: "old_visits_member_fkey", ConstraintType: "FOREIGN KEY", ColumnName: ptr("member_id"), ForeignTableName: ptr("old_members"), ForeignColumnName: ptr("id")},
+	}}, RAG.Table{TableName: "old_members"})
+
+	statements, err := RAG.GenerateDDL(RAG.DiffSchemas(old, new))
+	if err != nil {
+		t.Fatalf("GenerateDDL failed: %v", err)
+	}
+	expected := []string{
+		"ALTER TABLE visits DROP CONSTRAINT visits_member_id_fkey;",
+		"DROP INDEX members_name_idx;",
+		"DROP TABLE old_visits;",
+		"DROP TABLE old_members;",
+		"CREATE TABLE gyms (\n    id bigserial NOT NULL,\n    CONSTRAINT gyms_pkey PRIMARY KEY (id)\n);",
+		"ALTER TABLE members ALTER COLUMN email TYPE character varying(255) USING email::character varying(255);",
+		"ALTER TABLE members ALTER COLUMN name SET NOT NULL;",
+		"ALTER TABLE members ALTER COLUMN name SET DEFAULT 'unknown'::text;",
+		"ALTER TABLE members ADD COLUMN gym_id bigint;",
+		"ALTER TABLE visits DROP COLUMN visited_at;",
+		"ALTER TABLE members ADD CONSTRAINT members_gym_fkey FOREIGN KEY (gym_id) REFERENCES gyms (id);",
+		"ALTER TABLE visits ADD CONSTRAINT visits_member_fkey FOREIGN KEY (member_id) REFERENCES members (id);",
+		"CREATE INDEX gyms_id_idx ON gyms USING hash (id);",
+		"CREATE INDEX members_name_idx ON members ((lower(name)));",
+	}
+	if !reflect.DeepEqual(statements, expected) {
+		t.Errorf("unexpected statements:\n%s", strings.Join(statements, "\n"))
+	}
+
+	bad := gymSchema()
+	bad[0].Constraints = append(bad[0].Constraints, RAG.ConstraintInfo{ConstraintName: "members_excl", ConstraintType: "EXCLUDE"})
+	if _, err := RAG.GenerateDDL(RAG.DiffSchemas(gymSchema(), bad)); err == nil {
+		t.Errorf("expected an error for an unsupported constraint")
+	}
+}
+
+func TestGenerateDDLDependencies(t *testing.T) {
+	// the foreign key of visits is dropped before the primary key it references and added after the new one
+	new := gymSchema()
+	new[0].Constraints[0].ConstraintName = "members_id_pkey"
+	statements, err := RAG.GenerateDDL(RAG.DiffSchemas(gymSchema(), new))
+	expected := []string{
+		"ALTER TABLE visits DROP CONSTRAINT visits_member_id_fkey;",
+		"ALTER TABLE members DROP CONSTRAINT members_pkey;",
+		"ALTER TABLE members ADD CONSTRAINT members_id_pkey PRIMARY KEY (id);",
+		"ALTER TABLE visits ADD CONSTRAINT visits_member_id_fkey FOREIGN KEY (member_id) REFERENCES members (id);",
+	}
+	if err != nil || !reflect.DeepEqual(statements, expected) {
+		t.Errorf("unexpected statements for the new primary key: %v\n%s", err, strings.Join(statements, "\n"))
+	}
+
+	// a kept table loses its foreign key to a dropped table first
+	statements, err = RAG.GenerateDDL(RAG.DiffSchemas(gymSchema(), gymSchema()[1:]))
+	expected = []string{"ALTER TABLE visits DROP CONSTRAINT visits_member_id_fkey;", "DROP TABLE members;"}
+	if err != nil || !reflect.DeepEqual(statements, expected) {
+		t.Errorf("unexpected statements for the dropped table: %v\n%s", err, strings.Join(statements, "\n"))
+	}
+
+	// the tables of a cycle are dropped after one of the foreign keys
+	fkey := func(table, name, foreign string) RAG.ConstraintInfo {
+		return RAG.ConstraintInfo{TableName: table, ConstraintName: name, ConstraintType: "FOREIGN KEY", ColumnName: ptr(foreign + "_id"), ForeignTableName: &foreign, ForeignColumnName: ptr("id")}
+	}
+	cycle := []RAG.Table{
+		{TableName: "gyms", Constraints: []RAG.ConstraintInfo{fkey("gyms", "gyms_staff_fkey", "staff")}},
+		{TableName: "staff", Constraints: []RAG.ConstraintInfo{fkey("staff", "staff_gyms_fkey", "gyms")}},
+	}
+	statements, err = RAG.GenerateDDL(RAG.DiffSchemas(cycle, nil))
+	expected = []string{"ALTER TABLE staff DROP CONSTRAINT staff_gyms_fkey;", "DROP TABLE gyms;", "DROP TABLE staff;"}
+	if err != nil || !reflect.DeepEqual(statements, expected) {
+		t.Errorf("unexpected statements for the cycle: %v\n%s", err, strings.Join(statements, "\n"))
+	}
+}
+
+func TestGenerateDDLRenames(t *testing.T) {
+	// a column that keeps its definition under a new name is renamed, its constraint and index follow it
+	new := gymSchema()
+	new[0].Columns[1].ColumnName = "email_address"
+	new[0].Constraints[1].ColumnName = ptr("email_address")
+	new[0].Indexes[1].ColumnName = "email_address"
+	diff := RAG.DiffSchemas(gymSchema(), new)
+	statements, err := RAG.GenerateDDL(diff)
+	expected := []string{"ALTER TABLE members RENAME COLUMN email TO email_address;"}
+	if err != nil || !reflect.DeepEqual(statements, expected) {
+		t.Errorf("unexpected statements for the renamed column: %v\n%s", err, strings.Join(statements, "\n"))
+	}
+	if changes := diff.Describe(); len(changes) != 1 || changes[0] != "rename column members.email to email_address" {
+		t.Errorf("unexpected changes: %v", changes)
+	}
+
+	// a table with the same columns under a new name is renamed, the foreign keys to it follow it
+	new = gymSchema()
+	new[0].TableName = "people"
+	new[1].Constraints[0].ForeignTableName = ptr("people")
+	statements, err = RAG.GenerateDDL(RAG.DiffSchemas(gymSchema(), new))
+	expected = []string{"ALTER TABLE members RENAME TO people;"}
+	if err != nil || !reflect.DeepEqual(statements, expected) {
+		t.Errorf("unexpected statements for the renamed table: %v\n%s", err, strings.Join(statements, "\n"))
+	}
+
+	// two added columns could both be the dropped one
+	new = gymSchema()
+	new[0].Columns[2].ColumnName = "nickname"
+	new[0].Columns = append(new[0].Columns, RAG.TableColumn{ColumnName: "bio", DataType: "text", IsNullable: true, OrdinalPosition: 4})
+	new[0].Indexes = new[0].Indexes[:2]
+	if _, err := RAG.GenerateDDL(RAG.DiffSchemas(gymSchema(), new)); err == nil || !strings.Contains(err.Error(), "renamed") {
+		t.Errorf("expected an error for the ambiguous rename, got %v", err)
+	}
+
+	// a NOT NULL column with a default is added nullable, filled by the default, then set NOT NULL
+	new = gymSchema()
+	new[0].Columns = append(new[0].Columns, RAG.TableColumn{ColumnName: "joined_at", DataType: "timestamp with time zone", ColumnDefault: ptr("now()"), OrdinalPosition: 4})
+	statements, err = RAG.GenerateDDL(RAG.DiffSchemas(gymSchema(), new))
+	expected = []string{
+		"ALTER TABLE members ADD COLUMN joined_at timestamp with time zone DEFAULT now();",
+		"ALTER TABLE members ALTER COLUMN joined_at SET NOT NULL;",
+	}
+	if err != nil || !reflect.DeepEqual(statements, expected) {
+		t.Errorf("unexpected statements for the NOT NULL column: %v\n%s", err, strings.Join(statements, "\n"))
+	}
+}
+
+func TestQueryAgentGeneratedDDL(t *testing.T) {
+	current, _ := json.Marshal(gymSchema())
+	// the model forgets the DDL of its own change
+	output := strings.Replace(agentJSON, `"ddl": ["ALTER TABLE members ADD COLUMN email text NOT NULL", "CREATE UNIQUE INDEX members_email_key ON members (email);"]`, `"ddl": []`, 1)
+	output = strings.Replace(output, `"ColumnName": "email", "DataType": "text"`, `"ColumnName": "phone", "DataType": "text"`, 1)
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, &fakeStore{}, &fakeLLM{response: output})
+
+	response, err := engine.QueryAgent("", string(current), "add a phone number", 1)
+	if err != nil {
+		t.Fatalf("QueryAgent failed: %v", err)
+	}
+	// the other columns, constraints and indexes of members are not in the schema changes and are dropped
+	// and the NOT NULL column is filled before it gets its NOT NULL
+	expected := "ALTER TABLE members ADD COLUMN phone text;\n\n-- fill members.phone in the existing rows, it has no default\n\nALTER TABLE members ALTER COLUMN phone SET NOT NULL;"
+	if !strings.Contains(response.SchemaDDL, expected) || !strings.Contains(response.SchemaDDL, "ALTER TABLE members DROP COLUMN email;") {
+		t.Errorf("unexpected schema DDL: %s", response.SchemaDDL)
+	}
+	if len(response.Changes) == 0 || response.Changes[0] != "add column members.phone text not null" {
+		t.Errorf("unexpected changes: %v", response.Changes)
+	}
+}
+
+func TestQueryAgentDroppedTables(t *testing.T) {
+	current, _ := json.Marshal(gymSchema())
+	dropVisits := `{"analysis": "visits are not used", "schema_changes": [], "dropped_tables": ["visits"], "ddl": [], "risks": [], "rationale": "less tables", "response": "drop visits"}`
+	dropMembers := strings.Replace(dropVisits, `["visits"]`, `["members"]`, 1)
+	llm := &sequenceLLM{responses: []string{dropMembers, dropVisits}}
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, &fakeStore{}, llm)
+
+	response, err := engine.QueryAgent("", string(current), "drop what is not used", 1)
+	if err != nil {
+		t.Fatalf("QueryAgent failed: %v", err)
+	}
+	// visits still references members, the model is asked to change it too
+	if errs := response.Attempts[0].Errors; len(errs) != 1 || !strings.Contains(errs[0], "visits_member_id_fkey") {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if !reflect.DeepEqual(response.DDLStatements, []string{"DROP TABLE visits;"}) || !reflect.DeepEqual(response.DroppedTables, []string{"visits"}) {
+		t.Errorf("unexpected DDL: %q", response.DDLStatements)
+	}
+	if !reflect.DeepEqual(response.Changes, []string{"drop table visits"}) {
+		t.Errorf("unexpected changes: %v", response.Changes)
+	}
+}
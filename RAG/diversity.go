@@ -0,0 +1,124 @@
+package RAG
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+)
+
+// MMR_CANDIDATE_FACTOR is how many candidates per result the diversification chooses from
+const MMR_CANDIDATE_FACTOR = 3
+
+// SelectMMR picks topK matches by maximal marginal relevance, every pick maximizes
+// lambda*relevance - (1-lambda)*the highest similarity to a match already picked
+// the relevance is the score of the match divided by the best score and the similarity is the cosine
+// of the vector values, a lambda of 0 or less keeps the order of the scores
+// maxPerSource caps the matches of every source_url, 0 means no cap
+func SelectMMR(matches []VectorMatch, topK int, lambda float64, maxPerSource int) []VectorMatch {
+	candidates := slices.Clone(matches)
+	sortMatches(candidates)
+	if len(candidates) == 0 || topK <= 0 {
+		return []VectorMatch{}
+	}
+
+	// the fused and reranked scores do not share the scale of the similarities
+	highest := candidates[0].Score
+	relevance := func(match VectorMatch) float64 {
+		if highest <= 0 {
+			return 1
+		}
+		return max(float64(match.Score/highest), 0)
+	}
+
+	selected := make([]VectorMatch, 0, topK)
+	perSource := make(map[string]int)
+	for len(selected) < topK && len(candidates) > 0 {
+		best, bestScore := -1, 0.0
+		for index, candidate := range candidates {
+			if source := candidate.MetadataString("source_url"); maxPerSource > 0 && source != "" && perSource[source] >= maxPerSource {
+				continue
+			}
+			score := relevance(candidate)
+			if lambda > 0 {
+				redundancy := 0.0
+				for _, picked := range selected {
+					redundancy = max(redundancy, cosineSimilarity(candidate.Values, picked.Values))
+				}
+				score = lambda*score - (1-lambda)*redundancy
+			}
+			if best < 0 || score > bestScore {
+				best, bestScore = index, score
+			}
+			if lambda <= 0 {
+				// the candidates are sorted, the first one allowed is the best
+				break
+			}
+		}
+		if best < 0 {
+			break
+		}
+		picked := candidates[best]
+		candidates = slices.Delete(candidates, best, best+1)
+		selected = append(selected, picked)
+		if source := picked.MetadataString("source_url"); source != "" {
+			perSource[source]++
+		}
+	}
+	return selected
+}
+
+// cosineSimilarity is 0 when one of the vectors is missing
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	norms := vectorNorm(a) * vectorNorm(b)
+	if norms == 0 {
+		return 0
+	}
+	return float64(dotProduct(a, b) / norms)
+}
+
+// diversify selects the topK matches with MMR and the per source cap of the engine
+// the values MMR compares are fetched for the matches that came without them and dropped afterwards
+func (r *RAGEngine) diversify(ctx context.Context, namespace string, matches []VectorMatch, topK int) []VectorMatch {
+	startTime := time.Now()
+	if r.MMRLambda > 0 {
+		r.fillValues(ctx, namespace, matches)
+	}
+	selected := SelectMMR(matches, topK, r.MMRLambda, r.MaxPerSource)
+	sources := make(map[string]bool)
+	for index := range selected {
+		sources[selected[index].MetadataString("source_url")] = true
+		selected[index].Values = nil
+	}
+	log.Printf("INFO: diversifying %d matches into %d from %d sources took ==> %f seconds", len(matches), len(selected), len(sources), time.Since(startTime).Seconds())
+	return selected
+}
+
+// fillValues fetches the vector values of the matches that have none, like the ones only the keyword search found
+func (r *RAGEngine) fillValues(ctx context.Context, namespace string, matches []VectorMatch) {
+	missing := []string{}
+	for _, match := range matches {
+		if len(match.Values) == 0 {
+			missing = append(missing, match.ID)
+		}
+	}
+	fetcher, ok := r.Store.(VectorFetcher)
+	if len(missing) == 0 || !ok {
+		return
+	}
+	ctx, cancel := withStageTimeout(ctx, r.Timeouts.Query)
+	defer cancel()
+	records, err := fetcher.Fetch(ctx, namespace, missing)
+	if err != nil {
+		log.Printf("WARNING: Failed to fetch the vectors to diversify the matches: %v", err)
+		return
+	}
+	for index := range matches {
+		if record, ok := records[matches[index].ID]; ok && len(matches[index].Values) == 0 {
+			matches[index].Values = record.Values
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package RAG_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+func matchIDs(matches []RAG.VectorMatch) []string {
+	ids := make([]string, len(matches))
+	for index, match := range matches {
+		ids[index] = match.ID
+	}
+	return ids
+}
+
+func TestSelectMMR(t *testing.T) {
+	matches := []RAG.VectorMatch{
+		{ID: "b", Score: 0.5, Values: []float32{0, 1}, Metadata: map[string]any{"source_url": "https://example.com/b"}},
+		{ID: "a1", Score: 0.9, Values: []float32{1, 0}, Metadata: map[string]any{"source_url": "https://example.com/a"}},
+		{ID: "a2", Score: 0.89, Values: []float32{1, 0.01}, Metadata: map[string]any{"source_url": "https://example.com/a"}},
+	}
+
+	if ids := matchIDs(RAG.SelectMMR(matches, 2, 0, 0)); ids[0] != "a1" || ids[1] != "a2" {
+		t.Errorf("expected the score order without MMR, got %v", ids)
+	}
+	// the adjacent chunk adds nothing to the first one
+	if ids := matchIDs(RAG.SelectMMR(matches, 2, 0.5, 0)); ids[0] != "a1" || ids[1] != "b" {
+		t.Errorf("expected the diverse match second, got %v", ids)
+	}
+	if ids := matchIDs(RAG.SelectMMR(matches, 2, 1, 0)); ids[0] != "a1" || ids[1] != "a2" {
+		t.Errorf("expected a lambda of 1 to keep the relevance order, got %v", ids)
+	}
+
+	// the cap holds even without MMR and leaves the results short rather than repeat a source
+	if ids := matchIDs(RAG.SelectMMR(matches, 3, 0, 1)); len(ids) != 2 || ids[0] != "a1" || ids[1] != "b" {
+		t.Errorf("expected one match per source, got %v", ids)
+	}
+}
+
+func TestMatchDiversity(t *testing.T) {
+	store, _ := RAG.NewLocalStore(RAG.METRIC_COSINE)
+	store.Upsert(context.Background(), "database-articles", []RAG.VectorRecord{
+		{ID: "a1", Values: []float32{3, 2, 3}, Metadata: map[string]any{"content": "chunk 1", "source_url": "https://example.com/a"}},
+		{ID: "a2", Values: []float32{3, 2, 3.1}, Metadata: map[string]any{"content": "chunk 2", "source_url": "https://example.com/a"}},
+		{ID: "b", Values: []float32{1, 2, 2}, Metadata: map[string]any{"content": "other", "source_url": "https://example.com/b"}},
+	})
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, store, &fakeLLM{})
+
+	// "how do I add an index?" embeds to [3 2 3]
+	matches, _ := engine.MatchContext(context.Background(), "database-articles", "how do I add an index?", 2)
+	if ids := matchIDs(matches); len(ids) != 3 || ids[1] != "a2" {
+		t.Fatalf("expected the vector order without diversification, got %v", ids)
+	}
+
+	engine.MMRLambda = 0.4
+	matches, err := engine.MatchContext(context.Background(), "database-articles", "how do I add an index?", 2)
+	if err != nil {
+		t.Fatalf("MatchContext failed: %v", err)
+	}
+	if ids := matchIDs(matches); len(ids) != 2 || ids[0] != "a1" || ids[1] != "b" {
+		t.Errorf("expected the second source to replace the adjacent chunk, got %v", ids)
+	}
+	if matches[0].Values != nil {
+		t.Errorf("the values fetched for MMR should not be returned")
+	}
+
+	engine.MMRLambda = 0
+	engine.MaxPerSource = 1
+	matches, _ = engine.MatchContext(context.Background(), "database-articles", "how do I add an index?", 3)
+	if ids := matchIDs(matches); len(ids) != 2 {
+		t.Errorf("expected a match per source, got %v", ids)
+	}
+}
+
+func TestLocalStoreIncludeValues(t *testing.T) {
+	store := newTestLocalStore(t, RAG.METRIC_COSINE)
+	query := RAG.VectorQuery{Namespace: "database-articles", Vector: []float32{1, 0, 0}, TopK: 1}
+	matches, _ := store.Query(context.Background(), query)
+	if matches[0].Values != nil {
+		t.Errorf("expected no values by default, got %v", matches[0].Values)
+	}
+
+	query.IncludeValues = true
+	matches, _ = store.Query(context.Background(), query)
+	if len(matches[0].Values) != 3 {
+		t.Fatalf("expected the values, got %v", matches[0].Values)
+	}
+	// the returned values are a copy
+	matches[0].Values[0] = 100
+	records, _ := store.Fetch(context.Background(), "database-articles", []string{"x"})
+	if records["x"].Values[0] != 1 {
+		t.Errorf("changing the match changed the stored vector")
+	}
+}
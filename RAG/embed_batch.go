@@ -0,0 +1,204 @@
+package RAG
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// GEMINI_BATCH_EMBED_LIMIT is the most texts a single BatchEmbedContents request accepts
+	GEMINI_BATCH_EMBED_LIMIT = 100
+	// DEFAULT_EMBED_CONCURRENCY bounds the batch requests in flight
+	DEFAULT_EMBED_CONCURRENCY = 4
+
+	DEFAULT_RETRY_MAX_RETRIES = 5
+	DEFAULT_RETRY_BASE_DELAY  = 500 * time.Millisecond
+	DEFAULT_RETRY_MAX_DELAY   = 30 * time.Second
+)
+
+// RateLimiter is a token bucket shared by the requests of a provider
+// a nil RateLimiter does not limit anything
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter allows requestsPerSecond on average and bursts of up to burst requests
+// it returns nil, no limit, when requestsPerSecond is not positive
+func NewRateLimiter(requestsPerSecond float64, burst int) *RateLimiter {
+	if requestsPerSecond <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{rate: requestsPerSecond, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Wait blocks until a request may be sent, the callers are served in the order they arrive
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	// take the token now, a negative balance is the queue of the callers that wait for one
+	l.tokens--
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// give the token back to the callers behind
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// RetryPolicy retries the requests that failed with HTTP 429 or 5xx with an exponential backoff
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt, defaults to DEFAULT_RETRY_MAX_RETRIES,
+	// a negative value disables the retries
+	MaxRetries int
+	// BaseDelay is the delay before the first retry, it doubles with every retry, defaults to DEFAULT_RETRY_BASE_DELAY
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts, defaults to DEFAULT_RETRY_MAX_DELAY
+	MaxDelay time.Duration
+}
+
+// do calls request until it succeeds, fails with an error that is not worth retrying or runs out of retries
+// every attempt waits for the limiter first
+func (p RetryPolicy) do(ctx context.Context, limiter *RateLimiter, request func(ctx context.Context) error) error {
+	maxRetries := p.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = DEFAULT_RETRY_MAX_RETRIES
+	}
+	delay := p.BaseDelay
+	if delay <= 0 {
+		delay = DEFAULT_RETRY_BASE_DELAY
+	}
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DEFAULT_RETRY_MAX_DELAY
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+		err := request(ctx)
+		if err == nil || !isRetryable(err) || attempt >= maxRetries {
+			return err
+		}
+
+		// full jitter between half and the whole delay keeps the workers from retrying in lockstep
+		wait := delay/2 + rand.N(delay/2+1)
+		log.Printf("WARNING: Request failed, retry %d/%d in %s: %v", attempt+1, maxRetries, wait, err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		delay = min(delay*2, maxDelay)
+	}
+}
+
+// isRetryable reports whether the provider asked to slow down or failed on its side
+func isRetryable(err error) bool {
+	status := 0
+	var httpErr *HTTPStatusError
+	var googleErr *googleapi.Error
+	switch {
+	case errors.As(err, &httpErr):
+		status = httpErr.StatusCode
+	case errors.As(err, &googleErr):
+		status = googleErr.Code
+	}
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// embedInBatches splits the texts into batches of batchSize and embeds them with at most concurrency requests in flight
+// the embeddings keep the order of the texts, the first failing batch cancels the others
+func embedInBatches(ctx context.Context, texts []string, batchSize int, concurrency int, embed func(ctx context.Context, batch []string) ([][]float32, error)) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	if len(texts) == 0 {
+		return embeddings, nil
+	}
+	batches := (len(texts) + batchSize - 1) / batchSize
+	workers := max(1, min(concurrency, batches))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var once sync.Once
+	var failure error
+	fail := func(err error) {
+		once.Do(func() {
+			failure = err
+			cancel()
+		})
+	}
+
+	starts := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range starts {
+				end := min(start+batchSize, len(texts))
+				batch, err := embed(ctx, texts[start:end])
+				if err == nil && len(batch) != end-start {
+					err = fmt.Errorf("model returned %d embeddings for %d texts", len(batch), end-start)
+				}
+				if err != nil {
+					fail(err)
+					continue
+				}
+				copy(embeddings[start:end], batch)
+			}
+		}()
+	}
+
+feed:
+	for start := 0; start < len(texts); start += batchSize {
+		select {
+		case starts <- start:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(starts)
+	wg.Wait()
+
+	if failure != nil {
+		return nil, failure
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return embeddings, nil
+}
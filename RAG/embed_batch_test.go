@@ -0,0 +1,194 @@
+package RAG_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/option"
+)
+
+// geminiEmbedServer stands in for the Gemini embedding endpoints
+// it fails the first failures requests with the given status and embeds every text as [len(text)]
+type geminiEmbedServer struct {
+	failures int
+	status   int
+
+	mu          sync.Mutex
+	requests    int
+	inFlight    int
+	maxInFlight int
+}
+
+func (s *geminiEmbedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	s.inFlight++
+	s.maxInFlight = max(s.maxInFlight, s.inFlight)
+	fail := s.requests <= s.failures
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	if fail {
+		w.WriteHeader(s.status)
+		json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"code": s.status, "message": http.StatusText(s.status)}})
+		return
+	}
+
+	type content struct {
+		Parts []struct {
+			Text string `json:"text"`
+		} `json:"parts"`
+	}
+	embedding := func(c content) map[string]any {
+		return map[string]any{"values": []float32{float32(len(c.Parts[0].Text))}}
+	}
+	if strings.HasSuffix(r.URL.Path, ":batchEmbedContents") {
+		var request struct {
+			Requests []struct {
+				Content content `json:"content"`
+			} `json:"requests"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		embeddings := []map[string]any{}
+		for _, item := range request.Requests {
+			embeddings = append(embeddings, embedding(item.Content))
+		}
+		json.NewEncoder(w).Encode(map[string]any{"embeddings": embeddings})
+		return
+	}
+	var request struct {
+		Content content `json:"content"`
+	}
+	json.NewDecoder(r.Body).Decode(&request)
+	json.NewEncoder(w).Encode(map[string]any{"embedding": embedding(request.Content)})
+}
+
+func newGeminiTestEmbedder(t *testing.T, server *geminiEmbedServer) *RAG.GeminiEmbedder {
+	t.Helper()
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	client, err := genai.NewClient(context.Background(), option.WithAPIKey("test"), option.WithEndpoint(httpServer.URL))
+	if err != nil {
+		t.Fatalf("failed to create the gemini client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	embedder := RAG.NewGeminiEmbedder(client, "text-embedding-004")
+	embedder.Retry = RAG.RetryPolicy{BaseDelay: time.Millisecond}
+	return embedder
+}
+
+func TestGeminiEmbedBatch(t *testing.T) {
+	server := &geminiEmbedServer{failures: 2, status: http.StatusTooManyRequests}
+	embedder := newGeminiTestEmbedder(t, server)
+	embedder.Concurrency = 2
+
+	texts := make([]string, 250)
+	for index := range texts {
+		texts[index] = strings.Repeat("a", index+1)
+	}
+	embeddings, err := embedder.EmbedBatch(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("EmbedBatch failed: %v", err)
+	}
+	for index, embedding := range embeddings {
+		if len(embedding) != 1 || embedding[0] != float32(index+1) {
+			t.Fatalf("embedding %d is out of order: %v", index, embedding)
+		}
+	}
+	// 3 batches of up to 100 texts and the 2 rate limited attempts
+	if server.requests != 5 {
+		t.Errorf("expected 5 requests, got %d", server.requests)
+	}
+	if server.maxInFlight > 2 {
+		t.Errorf("expected at most 2 requests in flight, got %d", server.maxInFlight)
+	}
+}
+
+func TestGeminiEmbedRetries(t *testing.T) {
+	server := &geminiEmbedServer{failures: 1, status: http.StatusServiceUnavailable}
+	embedder := newGeminiTestEmbedder(t, server)
+	embedding, err := embedder.Embed(context.Background(), "abc")
+	if err != nil || len(embedding) != 1 || embedding[0] != 3 {
+		t.Fatalf("expected the retry to succeed, got %v, %v", embedding, err)
+	}
+
+	// a client error is not retried
+	server = &geminiEmbedServer{failures: 10, status: http.StatusBadRequest}
+	embedder = newGeminiTestEmbedder(t, server)
+	if _, err := embedder.Embed(context.Background(), "abc"); err == nil {
+		t.Fatalf("expected the bad request to fail")
+	}
+	if server.requests != 1 {
+		t.Errorf("expected a single attempt, got %d", server.requests)
+	}
+
+	// the retries give up eventually
+	server = &geminiEmbedServer{failures: 10, status: http.StatusTooManyRequests}
+	embedder = newGeminiTestEmbedder(t, server)
+	embedder.Retry.MaxRetries = 2
+	if _, err := embedder.EmbedBatch(context.Background(), []string{"a", "b"}); err == nil {
+		t.Fatalf("expected the rate limited batch to fail")
+	}
+	if server.requests != 3 {
+		t.Errorf("expected 3 attempts, got %d", server.requests)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := RAG.NewRateLimiter(100, 2)
+	startTime := time.Now()
+	for range 6 {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatalf("Wait failed: %v", err)
+		}
+	}
+	// the burst of 2 is free, the 4 others wait 10ms each
+	if elapsed := time.Since(startTime); elapsed < 35*time.Millisecond {
+		t.Errorf("expected the limiter to wait about 40ms, waited %s", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	slow := RAG.NewRateLimiter(0.001, 1)
+	slow.Wait(context.Background())
+	if err := slow.Wait(ctx); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	if limiter := RAG.NewRateLimiter(0, 1); limiter != nil {
+		t.Errorf("a zero rate should mean no limiter")
+	}
+	var unlimited *RAG.RateLimiter
+	if err := unlimited.Wait(context.Background()); err != nil {
+		t.Errorf("a nil limiter should not wait, got %v", err)
+	}
+}
+
+func TestEmbedBatchConfig(t *testing.T) {
+	t.Setenv("RAG_EMBED_RATE_LIMIT", "2.5")
+	t.Setenv("RAG_EMBED_CONCURRENCY", "8")
+	config, err := RAG.LoadConfigFromEnv()
+	if err != nil {
+		t.Fatalf("LoadConfigFromEnv failed: %v", err)
+	}
+	if config.EmbedRateLimit != 2.5 || config.EmbedConcurrency != 8 {
+		t.Errorf("unexpected embedding limits: %v, %v", config.EmbedRateLimit, config.EmbedConcurrency)
+	}
+	t.Setenv("RAG_EMBED_CONCURRENCY", "many")
+	if _, err := RAG.LoadConfigFromEnv(); err == nil {
+		t.Errorf("expected an error for an invalid concurrency")
+	}
+}
@@ -0,0 +1,271 @@
+package RAG
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DEFAULT_EMBEDDING_CACHE_SIZE is the number of embeddings kept in memory, about 3MB of 768 dimension vectors
+const DEFAULT_EMBEDDING_CACHE_SIZE = 1024
+
+// EmbeddingCacheStats counts the lookups of a CachedEmbedder
+type EmbeddingCacheStats struct {
+	// Hits includes the DiskHits
+	Hits     int64 `json:"hits"`
+	DiskHits int64 `json:"disk_hits"`
+	Misses   int64 `json:"misses"`
+	Entries  int   `json:"entries"`
+}
+
+// HitRate is the share of the lookups that were served from the cache
+func (s EmbeddingCacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// CachedEmbedder wraps an embedder with an in-memory LRU cache and an optional on-disk store
+// the embeddings are keyed by the model name and a hash of the text with its whitespace normalized
+type CachedEmbedder struct {
+	Embedder Embedder
+	// Model is part of the key so that embeddings of different models never mix
+	Model string
+
+	capacity int
+	dir      string
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+
+	hits     atomic.Int64
+	diskHits atomic.Int64
+	misses   atomic.Int64
+}
+
+type cacheEntry struct {
+	key       string
+	embedding []float32
+}
+
+// NewCachedEmbedder caches up to capacity embeddings of the model in memory, defaults to DEFAULT_EMBEDDING_CACHE_SIZE
+func NewCachedEmbedder(embedder Embedder, model string, capacity int) *CachedEmbedder {
+	if capacity <= 0 {
+		capacity = DEFAULT_EMBEDDING_CACHE_SIZE
+	}
+	return &CachedEmbedder{
+		Embedder: embedder,
+		Model:    model,
+		capacity: capacity,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// WithDisk also stores the embeddings in dir, one file per embedding, so that they survive restarts
+func (c *CachedEmbedder) WithDisk(dir string) (*CachedEmbedder, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create the embedding cache %s: %w", dir, err)
+	}
+	c.dir = dir
+	return c, nil
+}
+
+// Stats returns the hits and misses since the embedder was created
+func (c *CachedEmbedder) Stats() EmbeddingCacheStats {
+	c.mu.Lock()
+	entries := c.lru.Len()
+	c.mu.Unlock()
+	return EmbeddingCacheStats{
+		Hits:     c.hits.Load(),
+		DiskHits: c.diskHits.Load(),
+		Misses:   c.misses.Load(),
+		Entries:  entries,
+	}
+}
+
+func (c *CachedEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	key := c.key(text)
+	if embedding, ok := c.lookup(key); ok {
+		return embedding, nil
+	}
+	c.misses.Add(1)
+	embedding, err := c.Embedder.Embed(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	c.store(key, embedding)
+	return embedding, nil
+}
+
+// EmbedBatch only sends the texts that are not cached to the wrapped embedder, each of them once
+func (c *CachedEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	keys := make([]string, len(texts))
+	pending := make(map[string][]int)
+	missing := []string{}
+	for index, text := range texts {
+		keys[index] = c.key(text)
+		if embedding, ok := c.lookup(keys[index]); ok {
+			embeddings[index] = embedding
+			continue
+		}
+		if _, ok := pending[keys[index]]; !ok {
+			c.misses.Add(1)
+			missing = append(missing, text)
+		}
+		pending[keys[index]] = append(pending[keys[index]], index)
+	}
+	if len(missing) == 0 {
+		return embeddings, nil
+	}
+
+	computed, err := embedTexts(ctx, c.Embedder, missing)
+	if err != nil {
+		return nil, err
+	}
+	if len(computed) != len(missing) {
+		return nil, fmt.Errorf("model returned %d embeddings for %d texts", len(computed), len(missing))
+	}
+	for index, text := range missing {
+		key := c.key(text)
+		c.store(key, computed[index])
+		for _, position := range pending[key] {
+			embeddings[position] = computed[index]
+		}
+	}
+	return embeddings, nil
+}
+
+// key hashes the model and the text, runs of whitespace count as a single space
+func (c *CachedEmbedder) key(text string) string {
+	normalized := strings.Join(strings.Fields(text), " ")
+	sum := sha256.Sum256([]byte(c.Model + "\x00" + normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookup returns the cached embedding from memory first and from the disk second
+func (c *CachedEmbedder) lookup(key string) ([]float32, bool) {
+	c.mu.Lock()
+	if element, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(element)
+		// a copy so that a caller changing its embedding does not change the cache
+		embedding := slices.Clone(element.Value.(*cacheEntry).embedding)
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return embedding, true
+	}
+	c.mu.Unlock()
+
+	embedding, ok := c.readDisk(key)
+	if !ok {
+		return nil, false
+	}
+	c.hits.Add(1)
+	c.diskHits.Add(1)
+	c.remember(key, embedding)
+	return embedding, true
+}
+
+// store keeps the embedding in memory and on the disk
+func (c *CachedEmbedder) store(key string, embedding []float32) {
+	c.remember(key, embedding)
+	if err := c.writeDisk(key, embedding); err != nil {
+		log.Printf("WARNING: Failed to write the embedding cache: %v", err)
+	}
+}
+
+// remember adds the embedding to the LRU and evicts the least recently used one when it is full
+func (c *CachedEmbedder) remember(key string, embedding []float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, embedding: slices.Clone(embedding)})
+	if c.lru.Len() > c.capacity {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// diskPath spreads the files over 256 directories
+func (c *CachedEmbedder) diskPath(key string) string {
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+// readDisk reads an embedding stored as little endian float32 values
+func (c *CachedEmbedder) readDisk(key string) ([]float32, bool) {
+	if c.dir == "" {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.diskPath(key))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("WARNING: Failed to read the embedding cache: %v", err)
+		}
+		return nil, false
+	}
+	if len(data) == 0 || len(data)%4 != 0 {
+		return nil, false
+	}
+	embedding := make([]float32, len(data)/4)
+	for index := range embedding {
+		embedding[index] = math.Float32frombits(binary.LittleEndian.Uint32(data[index*4:]))
+	}
+	return embedding, true
+}
+
+// writeDisk writes to a temporary file first so that a concurrent reader never sees a partial embedding
+func (c *CachedEmbedder) writeDisk(key string, embedding []float32) error {
+	if c.dir == "" {
+		return nil
+	}
+	path := c.diskPath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data := make([]byte, len(embedding)*4)
+	for index, value := range embedding {
+		binary.LittleEndian.PutUint32(data[index*4:], math.Float32bits(value))
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// EmbeddingCacheStats returns the statistics of the embedding cache, false when the engine has none
+func (r *RAGEngine) EmbeddingCacheStats() (EmbeddingCacheStats, bool) {
+	cache, ok := r.Embedder.(*CachedEmbedder)
+	if !ok {
+		return EmbeddingCacheStats{}, false
+	}
+	return cache.Stats(), true
+}
@@ -0,0 +1,93 @@
+package RAG_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+func TestCachedEmbedderLRU(t *testing.T) {
+	inner := &fakeEmbedder{}
+	cache := RAG.NewCachedEmbedder(inner, "fake/v1", 2)
+	ctx := context.Background()
+
+	for _, text := range []string{"alpha", "beta", "alpha", "gamma", "beta"} {
+		if _, err := cache.Embed(ctx, text); err != nil {
+			t.Fatalf("Embed failed: %v", err)
+		}
+	}
+	// beta was evicted by gamma since alpha was used more recently
+	if inner.calls != 4 {
+		t.Errorf("expected 4 calls to the model, got %d", inner.calls)
+	}
+	stats := cache.Stats()
+	if stats.Hits != 1 || stats.Misses != 4 || stats.Entries != 2 || stats.HitRate() != 0.2 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	// the whitespace of the text does not matter
+	cache.Embed(ctx, "  gamma\n")
+	if inner.calls != 4 {
+		t.Errorf("expected the normalized text to hit the cache")
+	}
+
+	// a changed embedding does not change the cache
+	embedding, _ := cache.Embed(ctx, "gamma")
+	embedding[0] = 100
+	again, _ := cache.Embed(ctx, "gamma")
+	if again[0] == 100 {
+		t.Errorf("the cached embedding was changed by the caller")
+	}
+}
+
+func TestCachedEmbedderDisk(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	first, err := RAG.NewCachedEmbedder(&fakeEmbedder{}, "fake/v1", 0).WithDisk(dir)
+	if err != nil {
+		t.Fatalf("failed to create the disk cache: %v", err)
+	}
+	want, _ := first.Embed(ctx, "what is an index")
+
+	// a new process reads the embedding from the disk
+	inner := &fakeEmbedder{}
+	second, _ := RAG.NewCachedEmbedder(inner, "fake/v1", 0).WithDisk(dir)
+	got, _ := second.Embed(ctx, "what is an index")
+	if inner.calls != 0 || !reflect.DeepEqual(want, got) {
+		t.Errorf("expected %v from the disk without calling the model, got %v after %d calls", want, got, inner.calls)
+	}
+	if stats := second.Stats(); stats.DiskHits != 1 || stats.Hits != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	// another model never reads the embeddings of the first one
+	other, _ := RAG.NewCachedEmbedder(inner, "fake/v2", 0).WithDisk(dir)
+	other.Embed(ctx, "what is an index")
+	if inner.calls != 1 {
+		t.Errorf("expected the other model to be called, got %d calls", inner.calls)
+	}
+}
+
+func TestCachedEmbedderBatch(t *testing.T) {
+	inner := &batchEmbedder{}
+	cache := RAG.NewCachedEmbedder(inner, "fake/v1", 0)
+	ctx := context.Background()
+	cache.Embed(ctx, "cached")
+
+	embeddings, err := cache.EmbedBatch(ctx, []string{"cached", "new", "other", "new"})
+	if err != nil {
+		t.Fatalf("EmbedBatch failed: %v", err)
+	}
+	// only the two texts that are not cached are sent, each of them once
+	if !reflect.DeepEqual(inner.batches, []int{2}) {
+		t.Errorf("expected a single batch of 2 texts, got %v", inner.batches)
+	}
+	for index, text := range []string{"cached", "new", "other", "new"} {
+		want, _ := (&fakeEmbedder{}).Embed(ctx, text)
+		if !reflect.DeepEqual(embeddings[index], want) {
+			t.Errorf("embedding %d: expected %v, got %v", index, want, embeddings[index])
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package RAG_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+// fakeEmbedder embeds text by counting a few characters so that tests
+// get deterministic vectors without calling a real model
+type fakeEmbedder struct {
+	calls int
+}
+
+func (f *fakeEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	f.calls++
+	text = strings.ToLower(text)
+	return []float32{
+		float32(strings.Count(text, "a")) + 1,
+		float32(strings.Count(text, "e")) + 1,
+		float32(strings.Count(text, "i")) + 1,
+	}, nil
+}
+
+// fakeStore returns the same matches for every query
+type fakeStore struct {
+	matches []RAG.VectorMatch
+	queries []RAG.VectorQuery
+}
+
+func (f *fakeStore) Query(ctx context.Context, query RAG.VectorQuery) ([]RAG.VectorMatch, error) {
+	f.queries = append(f.queries, query)
+	return f.matches, nil
+}
+
+// fakeLLM records the prompts it receives and answers with a fixed response
+type fakeLLM struct {
+	response string
+	prompts  []string
+}
+
+func (f *fakeLLM) Generate(ctx context.Context, prompt string) (string, error) {
+	f.prompts = append(f.prompts, prompt)
+	return f.response, nil
+}
+
+func TestQueryChatWithFakeProviders(t *testing.T) {
+	store := &fakeStore{matches: []RAG.VectorMatch{
+		{ID: "1", Score: 0.9, Metadata: map[string]any{"content": "use CREATE INDEX", "source_url": "https://example.com/a"}},
+		{ID: "2", Score: 0.8, Metadata: map[string]any{"content": "btree is the default", "source_url": "https://example.com/a"}},
+		{ID: "3", Score: 0.7, Metadata: map[string]any{"content": "brin for large tables", "source_url": "https://example.com/b"}},
+	}}
+	llm := &fakeLLM{response: "add an index"}
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, store, llm)
+
+	response, err := engine.QueryChat("how do I add an index?")
+	if err != nil {
+		t.Fatalf("QueryChat failed: %v", err)
+	}
+	if response.ResponseText != "add an index" {
+		t.Errorf("unexpected response text: %q", response.ResponseText)
+	}
+	if len(response.Sources) != 2 {
+		t.Errorf("expected 2 unique sources, got %v", response.Sources)
+	}
+	if len(store.queries) != 1 || store.queries[0].Namespace != "database-articles" {
+		t.Errorf("expected a single query on database-articles, got %+v", store.queries)
+	}
+	if !strings.Contains(llm.prompts[0], "brin for large tables") {
+		t.Errorf("prompt does not contain the retrieved content")
+	}
+}
+
+func TestQueryChatWithoutMatches(t *testing.T) {
+	llm := &fakeLLM{response: "unused"}
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, &fakeStore{}, llm)
+
+	response, err := engine.QueryChat("anything")
+	if err != nil {
+		t.Fatalf("QueryChat failed: %v", err)
+	}
+	if response.Sources != nil || len(llm.prompts) != 0 {
+		t.Errorf("expected the fallback response without calling the model, got %+v", response)
+	}
+}
+
+func TestQueryAgentWithFakeProviders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "gym schema resource")
+	}))
+	defer server.Close()
+
+	store := &fakeStore{matches: []RAG.VectorMatch{
+		{ID: "1", Score: 0.9, Metadata: map[string]any{"source_url": server.URL}},
+	}}
+	llm := &fakeLLM{response: `{
+		"analysis": "there is no members table",
+		"schema_changes": [{"TableName": "members", "Columns": [], "Constraints": [], "Indexes": []}],
+		"ddl": ["CREATE TABLE members (id serial PRIMARY KEY)"],
+		"risks": [],
+		"rationale": "members are the core of a gym app",
+		"response": "## Analysis"
+	}`}
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, store, llm)
+
+	response, err := engine.QueryAgent("", "", "make a gym app", 1)
+	if err != nil {
+		t.Fatalf("QueryAgent failed: %v", err)
+	}
+	if len(response.SchemaChanges) != 1 || response.SchemaChanges[0].TableName != "members" {
+		t.Errorf("unexpected schema changes: %+v", response.SchemaChanges)
+	}
+	if !strings.HasPrefix(response.SchemaDDL, "CREATE TABLE members") {
+		t.Errorf("unexpected schema DDL: %q", response.SchemaDDL)
+	}
+	if store.queries[0].Namespace != "schemas-json" {
+		t.Errorf("expected the default namespace, got %s", store.queries[0].Namespace)
+	}
+	if !strings.Contains(llm.prompts[0], "gym schema resource") {
+		t.Errorf("prompt does not contain the fetched resource")
+	}
+}
+
+// blockingLLM waits until the context is done
+type blockingLLM struct{}
+
+func (blockingLLM) Generate(ctx context.Context, prompt string) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestQueryChatContextCancellation(t *testing.T) {
+	store := &fakeStore{matches: []RAG.VectorMatch{
+		{ID: "1", Score: 0.9, Metadata: map[string]any{"content": "content"}},
+	}}
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, store, blockingLLM{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go cancel()
+	if _, err := engine.QueryChatContext(ctx, "question"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	engine.Timeouts.Generate = 10 * time.Millisecond
+	if _, err := engine.QueryChatContext(context.Background(), "question"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the generate timeout to fire, got %v", err)
+	}
+}
+
+func TestQueryAgentFetchTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	store := &fakeStore{matches: []RAG.VectorMatch{
+		{ID: "1", Score: 0.9, Metadata: map[string]any{"source_url": server.URL}},
+	}}
+	llm := &fakeLLM{response: `{"analysis": "", "schema_changes": [], "ddl": ["SELECT 1"], "risks": [], "rationale": "", "response": "nothing to change"}`}
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, store, llm)
+	engine.Timeouts.Fetch = 50 * time.Millisecond
+
+	startTime := time.Now()
+	if _, err := engine.QueryAgentContext(context.Background(), "", "", "query", 1); err != nil {
+		t.Fatalf("QueryAgent failed: %v", err)
+	}
+	if elapsed := time.Since(startTime); elapsed > 2*time.Second {
+		t.Fatalf("resource fetching ignored the configured timeout, took %s", elapsed)
+	}
+}
@@ -0,0 +1,73 @@
+package RAG
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errors returned by NewRAG and the engine, check them with errors.Is
+var (
+	ErrInvalidConfig          = errors.New("invalid config")
+	ErrMissingAPIKey          = errors.New("missing API key")
+	ErrModelUnreachable       = errors.New("model unreachable")
+	ErrVectorStoreUnreachable = errors.New("vector store unreachable")
+	ErrIndexNotFound          = errors.New("index not found")
+	ErrDimensionMismatch      = errors.New("embedding dimension mismatch")
+	ErrUnsupported            = errors.New("operation not supported by the provider")
+	ErrInvalidSnapshot        = errors.New("invalid vector snapshot")
+	ErrSnapshotMismatch       = errors.New("vector snapshot does not match the index")
+	ErrMigrationVerification  = errors.New("migration verification failed")
+	ErrNamespaceInUse         = errors.New("namespace in use")
+	ErrInvalidFilter          = errors.New("invalid metadata filter")
+	ErrInvalidAgentOutput     = errors.New("invalid agent output")
+	ErrInvalidDDL             = errors.New("invalid DDL")
+)
+
+// ProviderError reports which provider failed and why
+// it matches both its Kind and the underlying error with errors.Is
+type ProviderError struct {
+	Provider string
+	Kind     error
+	Err      error
+}
+
+func (e *ProviderError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%s: %v", e.Provider, e.Kind)
+	}
+	return fmt.Sprintf("%s: %v: %v", e.Provider, e.Kind, e.Err)
+}
+
+func (e *ProviderError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// DimensionMismatchError is returned when the embedding model produces vectors
+// of a different size than the ones stored in the vector index
+type DimensionMismatchError struct {
+	Embedding int
+	Index     int
+}
+
+func (e *DimensionMismatchError) Error() string {
+	return fmt.Sprintf("%v: the embedding model produces %d dimensions but the index has %d", ErrDimensionMismatch, e.Embedding, e.Index)
+}
+
+func (e *DimensionMismatchError) Is(target error) bool {
+	return target == ErrDimensionMismatch
+}
+
+// AgentOutputError is returned when the agent output is still invalid after the repair attempts
+type AgentOutputError struct {
+	Attempts []AgentAttempt
+}
+
+func (e *AgentOutputError) Error() string {
+	last := e.Attempts[len(e.Attempts)-1]
+	return fmt.Sprintf("%v after %d attempts: %s", ErrInvalidAgentOutput, len(e.Attempts), strings.Join(last.Errors, "; "))
+}
+
+func (e *AgentOutputError) Is(target error) bool {
+	return target == ErrInvalidAgentOutput
+}
@@ -0,0 +1,509 @@
+package RAG
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// MetadataFilter restricts the matches by their metadata, it uses the filter language of Pinecone
+//
+//	{"postgres_version": {"$gte": 16}, "topic": {"$in": ["indexes", "vacuum"]}}
+//
+// a field compared to a plain value means $eq, $and and $or take a list of filters
+// the operators are $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin and $exists, a list in the metadata
+// matches $eq and $in when one of its elements does, a missing field only matches $ne, $nin and $exists false
+type MetadataFilter map[string]any
+
+var filterComparisons = map[string]bool{"$gt": true, "$gte": true, "$lt": true, "$lte": true}
+
+// Validate checks the operators and their operands
+func (f MetadataFilter) Validate() error {
+	for key, condition := range f {
+		switch key {
+		case "$and", "$or":
+			filters, ok := filterList(condition)
+			if !ok || len(filters) == 0 {
+				return fmt.Errorf("%w: %s needs a list of filters", ErrInvalidFilter, key)
+			}
+			for _, filter := range filters {
+				if err := filter.Validate(); err != nil {
+					return err
+				}
+			}
+		default:
+			if strings.HasPrefix(key, "$") {
+				return fmt.Errorf("%w: unknown operator %s", ErrInvalidFilter, key)
+			}
+			if err := validateCondition(key, condition); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateCondition(field string, condition any) error {
+	operators, ok := filterOperators(condition)
+	if !ok {
+		if !isScalar(condition) {
+			return fmt.Errorf("%w: %s must be compared to a string, a number or a boolean", ErrInvalidFilter, field)
+		}
+		return nil
+	}
+	for operator, operand := range operators {
+		switch {
+		case operator == "$eq" || operator == "$ne":
+			if !isScalar(operand) {
+				return fmt.Errorf("%w: %s %s needs a string, a number or a boolean", ErrInvalidFilter, field, operator)
+			}
+		case filterComparisons[operator]:
+			if _, ok := toFloat(operand); !ok {
+				return fmt.Errorf("%w: %s %s needs a number", ErrInvalidFilter, field, operator)
+			}
+		case operator == "$in" || operator == "$nin":
+			values, ok := toList(operand)
+			if !ok {
+				return fmt.Errorf("%w: %s %s needs a list", ErrInvalidFilter, field, operator)
+			}
+			for _, value := range values {
+				if !isScalar(value) {
+					return fmt.Errorf("%w: %s %s needs a list of strings, numbers or booleans", ErrInvalidFilter, field, operator)
+				}
+			}
+		case operator == "$exists":
+			if _, ok := operand.(bool); !ok {
+				return fmt.Errorf("%w: %s $exists needs a boolean", ErrInvalidFilter, field)
+			}
+		default:
+			return fmt.Errorf("%w: unknown operator %s of %s", ErrInvalidFilter, operator, field)
+		}
+	}
+	return nil
+}
+
+// Matches evaluates the filter against the metadata of a vector, the filter must be valid
+func (f MetadataFilter) Matches(metadata map[string]any) bool {
+	for key, condition := range f {
+		switch key {
+		case "$and":
+			filters, _ := filterList(condition)
+			for _, filter := range filters {
+				if !filter.Matches(metadata) {
+					return false
+				}
+			}
+		case "$or":
+			filters, _ := filterList(condition)
+			matched := false
+			for _, filter := range filters {
+				if filter.Matches(metadata) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		default:
+			value, present := metadata[key]
+			if !conditionMatches(value, present && value != nil, condition) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func conditionMatches(value any, present bool, condition any) bool {
+	operators, ok := filterOperators(condition)
+	if !ok {
+		operators = map[string]any{"$eq": condition}
+	}
+	for operator, operand := range operators {
+		matched := false
+		switch operator {
+		case "$eq":
+			matched = present && anyElement(value, func(element any) bool { return scalarEqual(element, operand) })
+		case "$ne":
+			matched = !present || !anyElement(value, func(element any) bool { return scalarEqual(element, operand) })
+		case "$gt", "$gte", "$lt", "$lte":
+			number, ok := toFloat(value)
+			bound, _ := toFloat(operand)
+			matched = present && ok && compareFloats(operator, number, bound)
+		case "$in", "$nin":
+			values, _ := toList(operand)
+			found := present && anyElement(value, func(element any) bool {
+				for _, candidate := range values {
+					if scalarEqual(element, candidate) {
+						return true
+					}
+				}
+				return false
+			})
+			matched = found == (operator == "$in")
+		case "$exists":
+			matched = present == operand.(bool)
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func compareFloats(operator string, value float64, bound float64) bool {
+	switch operator {
+	case "$gt":
+		return value > bound
+	case "$gte":
+		return value >= bound
+	case "$lt":
+		return value < bound
+	default:
+		return value <= bound
+	}
+}
+
+// anyElement applies match to the value or to the elements of a list value
+func anyElement(value any, match func(any) bool) bool {
+	if values, ok := toList(value); ok {
+		for _, element := range values {
+			if match(element) {
+				return true
+			}
+		}
+		return false
+	}
+	return match(value)
+}
+
+func scalarEqual(a any, b any) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		return ok && x == y
+	case bool:
+		y, ok := b.(bool)
+		return ok && x == y
+	}
+	return false
+}
+
+// filterOperators returns the operators of a condition like {"$gte": 16}
+func filterOperators(condition any) (map[string]any, bool) {
+	var operators map[string]any
+	switch typed := condition.(type) {
+	case map[string]any:
+		operators = typed
+	case MetadataFilter:
+		operators = typed
+	default:
+		return nil, false
+	}
+	for operator := range operators {
+		if !strings.HasPrefix(operator, "$") {
+			return nil, false
+		}
+	}
+	return operators, true
+}
+
+func filterList(condition any) ([]MetadataFilter, bool) {
+	values, ok := toList(condition)
+	if !ok {
+		return nil, false
+	}
+	filters := make([]MetadataFilter, 0, len(values))
+	for _, value := range values {
+		switch typed := value.(type) {
+		case MetadataFilter:
+			filters = append(filters, typed)
+		case map[string]any:
+			filters = append(filters, typed)
+		default:
+			return nil, false
+		}
+	}
+	return filters, true
+}
+
+func toList(value any) ([]any, bool) {
+	if values, ok := value.([]any); ok {
+		return values, true
+	}
+	reflected := reflect.ValueOf(value)
+	if reflected.Kind() != reflect.Slice {
+		return nil, false
+	}
+	values := make([]any, reflected.Len())
+	for index := range values {
+		values[index] = reflected.Index(index).Interface()
+	}
+	return values, true
+}
+
+func toFloat(value any) (float64, bool) {
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(reflected.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(reflected.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return reflected.Float(), true
+	}
+	return 0, false
+}
+
+func isScalar(value any) bool {
+	switch value.(type) {
+	case string, bool:
+		return true
+	}
+	_, ok := toFloat(value)
+	return ok
+}
+
+// pineconeFilter converts the filter to the struct the Pinecone API expects
+func pineconeFilter(filter MetadataFilter) (*structpb.Struct, error) {
+	// a JSON round trip turns the lists and numbers into the types structpb accepts
+	data, err := json.Marshal(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+	}
+	fields := map[string]any{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+	}
+	return structpb.NewStruct(fields)
+}
+
+// ParseMetadataFilter reads a filter written as JSON in the filter language of Pinecone or as an expression like
+//
+//	postgres_version >= 16 and (topic = indexes or topic in ("vacuum", "brin")) and language != "fr"
+//
+// the comparisons are =, !=, >, >=, <, <=, in and not in, and binds tighter than or,
+// quoted values are strings, the other values are numbers, true or false when they parse as such
+func ParseMetadataFilter(expression string) (MetadataFilter, error) {
+	expression = strings.TrimSpace(expression)
+	if expression == "" {
+		return nil, nil
+	}
+	var filter MetadataFilter
+	if strings.HasPrefix(expression, "{") {
+		if err := json.Unmarshal([]byte(expression), &filter); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+		}
+	} else {
+		tokens, err := filterTokens(expression)
+		if err != nil {
+			return nil, err
+		}
+		parser := &filterParser{tokens: tokens}
+		if filter, err = parser.or(); err != nil {
+			return nil, err
+		}
+		if parser.position < len(tokens) {
+			return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidFilter, tokens[parser.position].text)
+		}
+	}
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+type filterToken struct {
+	text   string
+	quoted bool
+}
+
+// filterTokens splits the expression into words, quoted strings, operators, parentheses and commas
+func filterTokens(expression string) ([]filterToken, error) {
+	tokens := []filterToken{}
+	runes := []rune(expression)
+	for index := 0; index < len(runes); {
+		r := runes[index]
+		switch {
+		case unicode.IsSpace(r):
+			index++
+		case r == '(' || r == ')' || r == ',':
+			tokens = append(tokens, filterToken{text: string(r)})
+			index++
+		case r == '"' || r == '\'':
+			end := index + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("%w: unterminated string", ErrInvalidFilter)
+			}
+			tokens = append(tokens, filterToken{text: string(runes[index+1 : end]), quoted: true})
+			index = end + 1
+		case strings.ContainsRune("=!<>", r):
+			end := index + 1
+			if end < len(runes) && runes[end] == '=' {
+				end++
+			}
+			tokens = append(tokens, filterToken{text: string(runes[index:end])})
+			index = end
+		default:
+			end := index
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune("()=!<>,\"'", runes[end]) {
+				end++
+			}
+			tokens = append(tokens, filterToken{text: string(runes[index:end])})
+			index = end
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens   []filterToken
+	position int
+}
+
+func (p *filterParser) peek() (filterToken, bool) {
+	if p.position >= len(p.tokens) {
+		return filterToken{}, false
+	}
+	return p.tokens[p.position], true
+}
+
+func (p *filterParser) keyword(word string) bool {
+	token, ok := p.peek()
+	if ok && !token.quoted && strings.EqualFold(token.text, word) {
+		p.position++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) or() (MetadataFilter, error) {
+	return p.combine("or", "$or", p.and)
+}
+
+func (p *filterParser) and() (MetadataFilter, error) {
+	return p.combine("and", "$and", p.condition)
+}
+
+// combine parses operands separated by the keyword into a single filter
+func (p *filterParser) combine(word string, operator string, operand func() (MetadataFilter, error)) (MetadataFilter, error) {
+	filters := []any{}
+	for {
+		filter, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+		if !p.keyword(word) {
+			break
+		}
+	}
+	if len(filters) == 1 {
+		return filters[0].(MetadataFilter), nil
+	}
+	return MetadataFilter{operator: filters}, nil
+}
+
+func (p *filterParser) condition() (MetadataFilter, error) {
+	token, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected end of the expression", ErrInvalidFilter)
+	}
+	if token.text == "(" && !token.quoted {
+		p.position++
+		filter, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if closing, ok := p.peek(); !ok || closing.text != ")" {
+			return nil, fmt.Errorf("%w: missing )", ErrInvalidFilter)
+		}
+		p.position++
+		return filter, nil
+	}
+
+	field := token.text
+	p.position++
+	switch {
+	case p.keyword("in"):
+		values, err := p.list()
+		return MetadataFilter{field: map[string]any{"$in": values}}, err
+	case p.keyword("not"):
+		if !p.keyword("in") {
+			return nil, fmt.Errorf("%w: expected in after not", ErrInvalidFilter)
+		}
+		values, err := p.list()
+		return MetadataFilter{field: map[string]any{"$nin": values}}, err
+	}
+
+	operators := map[string]string{"=": "$eq", "==": "$eq", "!=": "$ne", ">": "$gt", ">=": "$gte", "<": "$lt", "<=": "$lte"}
+	comparison, ok := p.peek()
+	operator := operators[comparison.text]
+	if !ok || comparison.quoted || operator == "" {
+		return nil, fmt.Errorf("%w: expected a comparison after %s", ErrInvalidFilter, field)
+	}
+	p.position++
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	return MetadataFilter{field: map[string]any{operator: value}}, nil
+}
+
+// list parses a parenthesized list of values
+func (p *filterParser) list() ([]any, error) {
+	if token, ok := p.peek(); !ok || token.text != "(" {
+		return nil, fmt.Errorf("%w: expected a list in parentheses", ErrInvalidFilter)
+	}
+	p.position++
+	values := []any{}
+	for {
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		token, ok := p.peek()
+		if !ok {
+			return nil, fmt.Errorf("%w: missing )", ErrInvalidFilter)
+		}
+		p.position++
+		if token.text == ")" {
+			return values, nil
+		}
+		if token.text != "," {
+			return nil, fmt.Errorf("%w: expected , or ) in the list, got %q", ErrInvalidFilter, token.text)
+		}
+	}
+}
+
+func (p *filterParser) value() (any, error) {
+	token, ok := p.peek()
+	if !ok || (!token.quoted && strings.ContainsAny(token.text, "(),=!<>")) {
+		return nil, fmt.Errorf("%w: expected a value", ErrInvalidFilter)
+	}
+	p.position++
+	if token.quoted {
+		return token.text, nil
+	}
+	if number, err := strconv.ParseFloat(token.text, 64); err == nil {
+		return number, nil
+	}
+	if strings.EqualFold(token.text, "true") || strings.EqualFold(token.text, "false") {
+		return strings.EqualFold(token.text, "true"), nil
+	}
+	return token.text, nil
+}
@@ -0,0 +1,145 @@
+package RAG_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+func TestMetadataFilterMatches(t *testing.T) {
+	metadata := map[string]any{
+		"postgres_version": 16.0,
+		"topic":            []any{"indexes", "brin"},
+		"doc_type":         "reference",
+	}
+	tests := []struct {
+		name    string
+		filter  RAG.MetadataFilter
+		matches bool
+	}{
+		{"plain value", RAG.MetadataFilter{"doc_type": "reference"}, true},
+		{"element of a list", RAG.MetadataFilter{"topic": "brin"}, true},
+		{"gte", RAG.MetadataFilter{"postgres_version": map[string]any{"$gte": 16}}, true},
+		{"lt", RAG.MetadataFilter{"postgres_version": map[string]any{"$lt": 16}}, false},
+		{"in", RAG.MetadataFilter{"topic": map[string]any{"$in": []any{"vacuum", "indexes"}}}, true},
+		{"nin", RAG.MetadataFilter{"topic": map[string]any{"$nin": []string{"brin"}}}, false},
+		{"number is not a string", RAG.MetadataFilter{"postgres_version": "16"}, false},
+		{"missing field", RAG.MetadataFilter{"language": "en"}, false},
+		{"missing field ne", RAG.MetadataFilter{"language": map[string]any{"$ne": "fr"}}, true},
+		{"exists", RAG.MetadataFilter{"language": map[string]any{"$exists": false}}, true},
+		{"and", RAG.MetadataFilter{"$and": []any{
+			map[string]any{"doc_type": "reference"},
+			map[string]any{"postgres_version": map[string]any{"$gt": 16}},
+		}}, false},
+		{"or", RAG.MetadataFilter{"$or": []RAG.MetadataFilter{{"doc_type": "tutorial"}, {"topic": "indexes"}}}, true},
+	}
+	for _, test := range tests {
+		if err := test.filter.Validate(); err != nil {
+			t.Errorf("%s: unexpected validation error: %v", test.name, err)
+			continue
+		}
+		if matches := test.filter.Matches(metadata); matches != test.matches {
+			t.Errorf("%s: expected %t, got %t", test.name, test.matches, matches)
+		}
+	}
+
+	if err := (RAG.MetadataFilter{"topic": map[string]any{"$like": "b%"}}).Validate(); !errors.Is(err, RAG.ErrInvalidFilter) {
+		t.Errorf("expected an unknown operator to be invalid, got %v", err)
+	}
+}
+
+func TestParseMetadataFilter(t *testing.T) {
+	filter, err := RAG.ParseMetadataFilter(`postgres_version >= 16 and (topic = indexes or topic in ("vacuum", 'brin')) and language != "fr"`)
+	if err != nil {
+		t.Fatalf("ParseMetadataFilter failed: %v", err)
+	}
+	for metadata, expected := range map[*map[string]any]bool{
+		{"postgres_version": 16, "topic": "vacuum"}:                 true,
+		{"postgres_version": 17, "topic": "indexes"}:                true,
+		{"postgres_version": 15, "topic": "indexes"}:                false,
+		{"postgres_version": 16, "topic": "joins"}:                  false,
+		{"postgres_version": 16, "topic": "brin", "language": "fr"}: false,
+	} {
+		if filter.Matches(*metadata) != expected {
+			t.Errorf("expected %v to match %t", *metadata, expected)
+		}
+	}
+
+	// quoted numbers stay strings
+	filter, _ = RAG.ParseMetadataFilter(`postgres_version = "16"`)
+	if !reflect.DeepEqual(filter, RAG.MetadataFilter{"postgres_version": map[string]any{"$eq": "16"}}) {
+		t.Errorf("unexpected filter: %#v", filter)
+	}
+
+	filter, err = RAG.ParseMetadataFilter(`{"postgres_version": {"$gte": 16}}`)
+	if err != nil || !filter.Matches(map[string]any{"postgres_version": 16.0}) {
+		t.Errorf("expected the JSON filter to parse, got %#v, %v", filter, err)
+	}
+
+	for _, expression := range []string{"postgres_version >=", "topic in (a, b", "a = 1 or", `{"a": {"$foo": 1}}`, "a = 1 b = 2"} {
+		if _, err := RAG.ParseMetadataFilter(expression); !errors.Is(err, RAG.ErrInvalidFilter) {
+			t.Errorf("expected %q to be invalid, got %v", expression, err)
+		}
+	}
+}
+
+func TestLocalStoreFilter(t *testing.T) {
+	for _, hnsw := range []bool{false, true} {
+		store := newTestLocalStore(t, RAG.METRIC_COSINE)
+		if hnsw {
+			store.EnableHNSW(RAG.HNSWConfig{Seed: 1})
+		}
+		store.Upsert(context.Background(), "database-articles", []RAG.VectorRecord{
+			{ID: "x16", Values: []float32{1, 0.1, 0}, Metadata: map[string]any{"content": "x axis", "postgres_version": 16}},
+		})
+
+		matches, err := store.Query(context.Background(), RAG.VectorQuery{
+			Namespace: "database-articles",
+			Vector:    []float32{1, 0, 0},
+			TopK:      3,
+			Filter:    RAG.MetadataFilter{"postgres_version": map[string]any{"$gte": 16}},
+		})
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if ids := matchIDs(matches); len(ids) != 1 || ids[0] != "x16" {
+			t.Errorf("hnsw %t: expected only the filtered vector, got %v", hnsw, ids)
+		}
+
+		_, err = store.Query(context.Background(), RAG.VectorQuery{
+			Namespace: "database-articles",
+			Vector:    []float32{1, 0, 0},
+			TopK:      3,
+			Filter:    RAG.MetadataFilter{"$and": "x"},
+		})
+		if !errors.Is(err, RAG.ErrInvalidFilter) {
+			t.Errorf("expected an invalid filter error, got %v", err)
+		}
+	}
+}
+
+func TestQueryChatFiltered(t *testing.T) {
+	store, _ := RAG.NewLocalStore(RAG.METRIC_COSINE)
+	store.Upsert(context.Background(), "database-articles", []RAG.VectorRecord{
+		{ID: "pg15", Values: []float32{3, 2, 3}, Metadata: map[string]any{"content": "merge in 15", "source_url": "https://example.com/15", "postgres_version": 15}},
+		{ID: "pg16", Values: []float32{1, 2, 2}, Metadata: map[string]any{"content": "merge in 16", "source_url": "https://example.com/16", "postgres_version": 16}},
+	})
+	llm := &fakeLLM{response: "answer"}
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, store, llm)
+
+	filter, _ := RAG.ParseMetadataFilter("postgres_version = 16")
+	response, err := engine.QueryChatFiltered(context.Background(), "how do I add an index?", filter)
+	if err != nil {
+		t.Fatalf("QueryChatFiltered failed: %v", err)
+	}
+	if !reflect.DeepEqual(response.Sources, []string{"https://example.com/16"}) {
+		t.Errorf("expected only the Postgres 16 source, got %v", response.Sources)
+	}
+
+	if _, err := engine.MatchFiltered(context.Background(), "database-articles", "query", 1, RAG.MetadataFilter{"a": map[string]any{"$gt": "b"}}); !errors.Is(err, RAG.ErrInvalidFilter) {
+		t.Errorf("expected an invalid filter error, got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package RAG
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+)
+
+// GeminiEmbedder implements the Embedder and BatchEmbedder interfaces using a Gemini embedding model
+type GeminiEmbedder struct {
+	Model *genai.EmbeddingModel
+	// Limiter is shared by Embed and every request of EmbedBatch, nil means no limit
+	Limiter *RateLimiter
+	// Concurrency bounds the batch requests in flight, defaults to DEFAULT_EMBED_CONCURRENCY
+	Concurrency int
+	// Retry retries the requests that failed with HTTP 429 or 5xx
+	Retry RetryPolicy
+}
+
+// NewGeminiEmbedder creates an embedder for the given embedding model name
+func NewGeminiEmbedder(client *genai.Client, model string) *GeminiEmbedder {
+	return &GeminiEmbedder{Model: client.EmbeddingModel(model), Concurrency: DEFAULT_EMBED_CONCURRENCY}
+}
+
+func (g *GeminiEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	var embedding []float32
+	err := g.Retry.do(ctx, g.Limiter, func(ctx context.Context) error {
+		res, err := g.Model.EmbedContent(ctx, genai.Text(text))
+		if err != nil {
+			return err
+		}
+		if res == nil || res.Embedding == nil {
+			return errors.New("model returned a nil result")
+		}
+		embedding = res.Embedding.Values
+		return nil
+	})
+	return embedding, err
+}
+
+// EmbedBatch embeds the texts with BatchEmbedContents requests of up to GEMINI_BATCH_EMBED_LIMIT texts
+func (g *GeminiEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	concurrency := g.Concurrency
+	if concurrency <= 0 {
+		concurrency = DEFAULT_EMBED_CONCURRENCY
+	}
+	return embedInBatches(ctx, texts, GEMINI_BATCH_EMBED_LIMIT, concurrency, func(ctx context.Context, batch []string) ([][]float32, error) {
+		var embeddings [][]float32
+		err := g.Retry.do(ctx, g.Limiter, func(ctx context.Context) error {
+			request := g.Model.NewBatch()
+			for _, text := range batch {
+				request.AddContent(genai.Text(text))
+			}
+			res, err := g.Model.BatchEmbedContents(ctx, request)
+			if err != nil {
+				return err
+			}
+			embeddings = make([][]float32, len(res.Embeddings))
+			for index, embedding := range res.Embeddings {
+				if embedding == nil {
+					return errors.New("model returned a nil embedding")
+				}
+				embeddings[index] = embedding.Values
+			}
+			return nil
+		})
+		return embeddings, err
+	})
+}
+
+// GeminiLLM implements the LLM interface using a Gemini generative model
+type GeminiLLM struct {
+	Model *genai.GenerativeModel
+}
+
+// NewGeminiLLM creates a LLM for the given generative model name
+func NewGeminiLLM(client *genai.Client, model string) *GeminiLLM {
+	return &GeminiLLM{Model: client.GenerativeModel(model)}
+}
+
+func (g *GeminiLLM) Generate(ctx context.Context, prompt string) (string, error) {
+	response, err := g.Model.GenerateContent(ctx, genai.Text(prompt))
+	if err != nil {
+		return "", err
+	}
+	return responseText(response), nil
+}
+
+// GenerateJSON implements the StructuredLLM interface with the response schema of Gemini
+func (g *GeminiLLM) GenerateJSON(ctx context.Context, prompt string, schema *JSONSchema) (string, error) {
+	// a copy so that the concurrent text generations keep the plain text config
+	model := *g.Model
+	model.ResponseMIMEType = "application/json"
+	model.ResponseSchema = schema.gemini()
+	response, err := model.GenerateContent(ctx, genai.Text(prompt))
+	if err != nil {
+		return "", err
+	}
+	return responseText(response), nil
+}
+
+// GenerateStream implements the StreamingLLM interface using GenerateContentStream
+func (g *GeminiLLM) GenerateStream(ctx context.Context, prompt string, onDelta func(string) error) error {
+	return readGeminiStream(g.Model.GenerateContentStream(ctx, genai.Text(prompt)), onDelta)
+}
+
+// GenerateChat implements the ChatLLM interface using a chat session started from the history
+func (g *GeminiLLM) GenerateChat(ctx context.Context, history []ChatTurn, prompt string) (string, error) {
+	session := g.Model.StartChat()
+	session.History = geminiHistory(history)
+	response, err := session.SendMessage(ctx, genai.Text(prompt))
+	if err != nil {
+		return "", err
+	}
+	return responseText(response), nil
+}
+
+// GenerateChatStream implements the StreamingChatLLM interface
+func (g *GeminiLLM) GenerateChatStream(ctx context.Context, history []ChatTurn, prompt string, onDelta func(string) error) error {
+	session := g.Model.StartChat()
+	session.History = geminiHistory(history)
+	return readGeminiStream(session.SendMessageStream(ctx, genai.Text(prompt)), onDelta)
+}
+
+// readGeminiStream passes the text of every streamed response to onDelta
+func readGeminiStream(iter *genai.GenerateContentResponseIterator, onDelta func(string) error) error {
+	for {
+		response, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := onDelta(responseText(response)); err != nil {
+			return err
+		}
+	}
+}
+
+// geminiHistory converts the conversation turns to gemini contents
+func geminiHistory(history []ChatTurn) []*genai.Content {
+	contents := make([]*genai.Content, 0, len(history))
+	for _, turn := range history {
+		role := turn.Role
+		if role != ROLE_MODEL {
+			role = ROLE_USER
+		}
+		contents = append(contents, &genai.Content{Role: role, Parts: []genai.Part{genai.Text(turn.Content)}})
+	}
+	return contents
+}
+
+// responseText concatenates the text parts of the first candidate
+func responseText(response *genai.GenerateContentResponse) string {
+	if response == nil || len(response.Candidates) == 0 || response.Candidates[0].Content == nil {
+		return ""
+	}
+	text := ""
+	for _, part := range response.Candidates[0].Content.Parts {
+		if textPart, ok := part.(genai.Text); ok {
+			text += string(textPart)
+		}
+	}
+	return text
+}
@@ -0,0 +1,557 @@
+package RAG
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"sync"
+)
+
+const (
+	DEFAULT_HNSW_M               = 16
+	DEFAULT_HNSW_EF_CONSTRUCTION = 200
+	DEFAULT_HNSW_EF_SEARCH       = 64
+)
+
+// HNSWConfig holds the tuning parameters of a HNSW index
+type HNSWConfig struct {
+	// M is the number of neighbours a node keeps on every layer, layer 0 keeps 2*M
+	M int `json:"m"`
+	// EfConstruction is the size of the candidate list used while inserting
+	EfConstruction int `json:"ef_construction"`
+	// EfSearch is the size of the candidate list used while searching, higher means better recall but slower queries
+	EfSearch int `json:"ef_search"`
+	// Seed seeds the random level generator so that builds are reproducible
+	Seed int64 `json:"seed"`
+}
+
+func (c HNSWConfig) withDefaults() HNSWConfig {
+	if c.M <= 1 {
+		c.M = DEFAULT_HNSW_M
+	}
+	if c.EfConstruction <= 0 {
+		c.EfConstruction = DEFAULT_HNSW_EF_CONSTRUCTION
+	}
+	if c.EfSearch <= 0 {
+		c.EfSearch = DEFAULT_HNSW_EF_SEARCH
+	}
+	return c
+}
+
+// HNSWIndex is a hierarchical navigable small world graph for approximate nearest neighbour search
+// (Malkov & Yashunin, 2016). It supports incremental inserts and deletes.
+// The index is not safe for concurrent writes, concurrent searches are fine.
+type HNSWIndex struct {
+	config    HNSWConfig
+	metric    string
+	nodes     []*hnswNode // nil entries are free slots left by deletes
+	free      []uint32
+	ids       map[string]uint32
+	entry     int
+	maxLevel  int
+	levelMult float64
+	rng       *rand.Rand
+	visited   sync.Pool
+}
+
+type hnswNode struct {
+	id        string
+	vector    []float32
+	level     int
+	neighbors [][]uint32
+}
+
+// HNSWResult is a single search result of a HNSW index
+type HNSWResult struct {
+	ID    string
+	Score float32
+}
+
+// HNSWSnapshot is the serializable form of a HNSW index
+// vectors are not part of the snapshot, they are looked up again on restore
+type HNSWSnapshot struct {
+	Config   HNSWConfig          `json:"config"`
+	Metric   string              `json:"metric"`
+	Entry    int                 `json:"entry"`
+	MaxLevel int                 `json:"max_level"`
+	Nodes    []*HNSWNodeSnapshot `json:"nodes"`
+}
+
+// HNSWNodeSnapshot is the serializable form of a single graph node
+type HNSWNodeSnapshot struct {
+	ID        string     `json:"id"`
+	Level     int        `json:"level"`
+	Neighbors [][]uint32 `json:"neighbors"`
+}
+
+// NewHNSWIndex creates an empty index using the given similarity metric
+func NewHNSWIndex(config HNSWConfig, metric string) *HNSWIndex {
+	config = config.withDefaults()
+	if metric == "" {
+		metric = METRIC_COSINE
+	}
+	return &HNSWIndex{
+		config:    config,
+		metric:    metric,
+		ids:       make(map[string]uint32),
+		entry:     -1,
+		levelMult: 1 / math.Log(float64(config.M)),
+		rng:       rand.New(rand.NewSource(config.Seed)),
+	}
+}
+
+// Config returns the tuning parameters of the index
+func (h *HNSWIndex) Config() HNSWConfig {
+	return h.config
+}
+
+// SetEfSearch changes the size of the candidate list used while searching
+func (h *HNSWIndex) SetEfSearch(ef int) {
+	if ef > 0 {
+		h.config.EfSearch = ef
+	}
+}
+
+// Len returns the number of vectors in the index
+func (h *HNSWIndex) Len() int {
+	return len(h.ids)
+}
+
+// Insert adds the vector to the index, an existing vector with the same id is updated in place
+func (h *HNSWIndex) Insert(id string, vector []float32) {
+	if slot, ok := h.ids[id]; ok {
+		h.update(slot, vector)
+		return
+	}
+
+	level := h.randomLevel()
+	node := &hnswNode{
+		id:        id,
+		vector:    h.prepare(vector),
+		level:     level,
+		neighbors: make([][]uint32, level+1),
+	}
+	slot := h.allocate(node)
+
+	if h.entry < 0 {
+		h.entry = int(slot)
+		h.maxLevel = level
+		return
+	}
+
+	h.link(slot)
+	if level > h.maxLevel {
+		h.maxLevel = level
+		h.entry = int(slot)
+	}
+}
+
+// update replaces the vector of an existing node and relinks it without the O(n) scan of Delete,
+// links of other nodes that still point to it are left as they are, they only cost some recall
+func (h *HNSWIndex) update(slot uint32, vector []float32) {
+	node := h.nodes[slot]
+	prepared := h.prepare(vector)
+	if slices.Equal(node.vector, prepared) {
+		return
+	}
+	node.vector = prepared
+	if len(h.ids) > 1 {
+		h.link(slot)
+	}
+}
+
+// link searches the neighbours of the node on every layer up to its level and connects them both ways
+func (h *HNSWIndex) link(slot uint32) {
+	node := h.nodes[slot]
+	entryPoints := []uint32{uint32(h.entry)}
+	// greedy descent through the layers above the node
+	for l := h.maxLevel; l > node.level; l-- {
+		entryPoints = []uint32{h.searchLayer(node.vector, entryPoints, 1, l)[0].slot}
+	}
+
+	for l := min(node.level, h.maxLevel); l >= 0; l-- {
+		candidates := h.searchLayer(node.vector, entryPoints, h.config.EfConstruction, l)
+		entryPoints = entryPoints[:0]
+		others := make([]hnswCandidate, 0, len(candidates))
+		for _, candidate := range candidates {
+			entryPoints = append(entryPoints, candidate.slot)
+			if candidate.slot != slot {
+				others = append(others, candidate)
+			}
+		}
+		neighbors := h.selectNeighbors(others, h.config.M)
+		node.neighbors[l] = make([]uint32, 0, len(neighbors))
+		for _, neighbor := range neighbors {
+			node.neighbors[l] = append(node.neighbors[l], neighbor.slot)
+			if !containsSlot(h.nodes[neighbor.slot].neighbors[l], slot) {
+				h.connect(neighbor.slot, slot, l)
+			}
+		}
+	}
+}
+
+// Delete removes the vector from the index and repairs the links that pointed to it.
+// It scans every node so it costs O(n) and is meant for incremental updates, not bulk removal.
+func (h *HNSWIndex) Delete(id string) bool {
+	slot, ok := h.ids[id]
+	if !ok {
+		return false
+	}
+	deleted := h.nodes[slot]
+	delete(h.ids, id)
+	h.nodes[slot] = nil
+	h.free = append(h.free, slot)
+
+	for otherSlot, other := range h.nodes {
+		if other == nil {
+			continue
+		}
+		for l := 0; l <= min(other.level, deleted.level); l++ {
+			if !containsSlot(other.neighbors[l], slot) {
+				continue
+			}
+			// reconnect the node using its remaining neighbours and the neighbours of the deleted node
+			seen := map[uint32]bool{slot: true, uint32(otherSlot): true}
+			var candidates []hnswCandidate
+			for _, list := range [][]uint32{other.neighbors[l], deleted.neighbors[l]} {
+				for _, n := range list {
+					if seen[n] || h.nodes[n] == nil {
+						continue
+					}
+					seen[n] = true
+					candidates = append(candidates, hnswCandidate{slot: n, distance: h.distance(other.vector, h.nodes[n].vector)})
+				}
+			}
+			sortCandidates(candidates)
+			selected := h.selectNeighbors(candidates, h.maxConnections(l))
+			other.neighbors[l] = other.neighbors[l][:0]
+			for _, neighbor := range selected {
+				other.neighbors[l] = append(other.neighbors[l], neighbor.slot)
+			}
+		}
+	}
+
+	if h.entry == int(slot) {
+		h.entry = -1
+		h.maxLevel = 0
+		for otherSlot, other := range h.nodes {
+			if other != nil && (h.entry < 0 || other.level > h.maxLevel) {
+				h.entry = otherSlot
+				h.maxLevel = other.level
+			}
+		}
+	}
+	return true
+}
+
+// Search returns the approximate k nearest vectors to the query ordered by descending similarity
+func (h *HNSWIndex) Search(query []float32, k int) []HNSWResult {
+	if h.entry < 0 || k <= 0 {
+		return nil
+	}
+	vector := h.prepare(query)
+
+	entryPoints := []uint32{uint32(h.entry)}
+	for l := h.maxLevel; l > 0; l-- {
+		entryPoints = []uint32{h.searchLayer(vector, entryPoints, 1, l)[0].slot}
+	}
+	candidates := h.searchLayer(vector, entryPoints, max(h.config.EfSearch, k), 0)
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+
+	results := make([]HNSWResult, 0, len(candidates))
+	for _, candidate := range candidates {
+		results = append(results, HNSWResult{
+			ID:    h.nodes[candidate.slot].id,
+			Score: -candidate.distance,
+		})
+	}
+	return results
+}
+
+// Snapshot returns the serializable form of the graph
+func (h *HNSWIndex) Snapshot() HNSWSnapshot {
+	snapshot := HNSWSnapshot{
+		Config:   h.config,
+		Metric:   h.metric,
+		Entry:    h.entry,
+		MaxLevel: h.maxLevel,
+		Nodes:    make([]*HNSWNodeSnapshot, len(h.nodes)),
+	}
+	for i, node := range h.nodes {
+		if node == nil {
+			continue
+		}
+		neighbors := make([][]uint32, len(node.neighbors))
+		for l := range node.neighbors {
+			neighbors[l] = append([]uint32{}, node.neighbors[l]...)
+		}
+		snapshot.Nodes[i] = &HNSWNodeSnapshot{ID: node.id, Level: node.level, Neighbors: neighbors}
+	}
+	return snapshot
+}
+
+// RestoreHNSWIndex rebuilds an index from a snapshot
+// lookup returns the vector stored for an id and is called once for every node
+func RestoreHNSWIndex(snapshot HNSWSnapshot, lookup func(id string) ([]float32, bool)) (*HNSWIndex, error) {
+	h := NewHNSWIndex(snapshot.Config, snapshot.Metric)
+	h.entry = snapshot.Entry
+	h.maxLevel = snapshot.MaxLevel
+	h.nodes = make([]*hnswNode, len(snapshot.Nodes))
+	h.rng = rand.New(rand.NewSource(h.config.Seed + int64(len(snapshot.Nodes))))
+
+	for i, node := range snapshot.Nodes {
+		if node == nil {
+			h.free = append(h.free, uint32(i))
+			continue
+		}
+		vector, ok := lookup(node.ID)
+		if !ok {
+			return nil, fmt.Errorf("hnsw snapshot references unknown vector %s", node.ID)
+		}
+		if node.Level < 0 || len(node.Neighbors) != node.Level+1 {
+			return nil, fmt.Errorf("hnsw snapshot node %s has %d layers but level %d", node.ID, len(node.Neighbors), node.Level)
+		}
+		h.nodes[i] = &hnswNode{id: node.ID, vector: h.prepare(vector), level: node.Level, neighbors: node.Neighbors}
+		h.ids[node.ID] = uint32(i)
+	}
+
+	for _, node := range h.nodes {
+		if node == nil {
+			continue
+		}
+		// the searches index the neighbors of a node by the layer it is linked on
+		for level, list := range node.neighbors {
+			for _, n := range list {
+				if int(n) >= len(h.nodes) || h.nodes[n] == nil {
+					return nil, fmt.Errorf("hnsw snapshot node %s links to a missing node", node.id)
+				}
+				if h.nodes[n].level < level {
+					return nil, fmt.Errorf("hnsw snapshot node %s links to node %s on layer %d above its level", node.id, h.nodes[n].id, level)
+				}
+			}
+		}
+	}
+	if h.entry >= len(h.nodes) || (h.entry >= 0 && h.nodes[h.entry] == nil) || (h.entry < 0 && len(h.ids) > 0) {
+		return nil, errors.New("hnsw snapshot has an invalid entry point")
+	}
+	if h.entry >= 0 && (h.maxLevel < 0 || h.maxLevel > h.nodes[h.entry].level) {
+		return nil, fmt.Errorf("hnsw snapshot has a max level of %d above the level %d of its entry point", h.maxLevel, h.nodes[h.entry].level)
+	}
+	return h, nil
+}
+
+// prepare copies the vector and normalizes it for the cosine metric
+// so that similarity becomes a plain dot product
+func (h *HNSWIndex) prepare(vector []float32) []float32 {
+	prepared := append([]float32(nil), vector...)
+	if h.metric == METRIC_COSINE {
+		if norm := vectorNorm(prepared); norm > 0 {
+			for i := range prepared {
+				prepared[i] /= norm
+			}
+		}
+	}
+	return prepared
+}
+
+// distance is the negated similarity so that smaller means closer
+func (h *HNSWIndex) distance(a, b []float32) float32 {
+	return -dotProduct(a, b)
+}
+
+func (h *HNSWIndex) randomLevel() int {
+	return int(math.Floor(-math.Log(1-h.rng.Float64()) * h.levelMult))
+}
+
+func (h *HNSWIndex) maxConnections(level int) int {
+	if level == 0 {
+		return 2 * h.config.M
+	}
+	return h.config.M
+}
+
+func (h *HNSWIndex) allocate(node *hnswNode) uint32 {
+	var slot uint32
+	if n := len(h.free); n > 0 {
+		slot = h.free[n-1]
+		h.free = h.free[:n-1]
+		h.nodes[slot] = node
+	} else {
+		slot = uint32(len(h.nodes))
+		h.nodes = append(h.nodes, node)
+	}
+	h.ids[node.id] = slot
+	return slot
+}
+
+// connect adds a link from one node to another and prunes the list when it grows too long
+func (h *HNSWIndex) connect(from, to uint32, level int) {
+	node := h.nodes[from]
+	node.neighbors[level] = append(node.neighbors[level], to)
+	if len(node.neighbors[level]) <= h.maxConnections(level) {
+		return
+	}
+	candidates := make([]hnswCandidate, 0, len(node.neighbors[level]))
+	for _, n := range node.neighbors[level] {
+		candidates = append(candidates, hnswCandidate{slot: n, distance: h.distance(node.vector, h.nodes[n].vector)})
+	}
+	sortCandidates(candidates)
+	selected := h.selectNeighbors(candidates, h.maxConnections(level))
+	node.neighbors[level] = node.neighbors[level][:0]
+	for _, neighbor := range selected {
+		node.neighbors[level] = append(node.neighbors[level], neighbor.slot)
+	}
+}
+
+// selectNeighbors picks up to m neighbours from candidates sorted by distance using the
+// diversity heuristic of the paper, pruned candidates fill the list when there is room left
+func (h *HNSWIndex) selectNeighbors(candidates []hnswCandidate, m int) []hnswCandidate {
+	if len(candidates) <= m {
+		return candidates
+	}
+	selected := make([]hnswCandidate, 0, m)
+	var pruned []hnswCandidate
+	for _, candidate := range candidates {
+		if len(selected) >= m {
+			break
+		}
+		keep := true
+		for _, s := range selected {
+			if h.distance(h.nodes[candidate.slot].vector, h.nodes[s.slot].vector) < candidate.distance {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			selected = append(selected, candidate)
+		} else {
+			pruned = append(pruned, candidate)
+		}
+	}
+	for _, candidate := range pruned {
+		if len(selected) >= m {
+			break
+		}
+		selected = append(selected, candidate)
+	}
+	return selected
+}
+
+// searchLayer runs a best first search on a single layer and returns
+// up to ef candidates sorted by ascending distance
+func (h *HNSWIndex) searchLayer(query []float32, entryPoints []uint32, ef int, level int) []hnswCandidate {
+	visited := h.acquireVisited()
+	defer h.visited.Put(visited)
+
+	candidates := &candidateHeap{}
+	results := &candidateHeap{farthestFirst: true}
+	for _, ep := range entryPoints {
+		visited.mark(ep)
+		c := hnswCandidate{slot: ep, distance: h.distance(query, h.nodes[ep].vector)}
+		heap.Push(candidates, c)
+		heap.Push(results, c)
+		if results.Len() > ef {
+			heap.Pop(results)
+		}
+	}
+
+	for candidates.Len() > 0 {
+		current := heap.Pop(candidates).(hnswCandidate)
+		if results.Len() >= ef && current.distance > results.items[0].distance {
+			break
+		}
+		for _, n := range h.nodes[current.slot].neighbors[level] {
+			if visited.seen(n) {
+				continue
+			}
+			visited.mark(n)
+			d := h.distance(query, h.nodes[n].vector)
+			if results.Len() < ef || d < results.items[0].distance {
+				heap.Push(candidates, hnswCandidate{slot: n, distance: d})
+				heap.Push(results, hnswCandidate{slot: n, distance: d})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	sorted := append([]hnswCandidate(nil), results.items...)
+	sortCandidates(sorted)
+	return sorted
+}
+
+func (h *HNSWIndex) acquireVisited() *visitedSet {
+	v, _ := h.visited.Get().(*visitedSet)
+	if v == nil {
+		v = &visitedSet{}
+	}
+	v.reset(len(h.nodes))
+	return v
+}
+
+type hnswCandidate struct {
+	slot     uint32
+	distance float32
+}
+
+func sortCandidates(candidates []hnswCandidate) {
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].distance < candidates[j].distance })
+}
+
+func containsSlot(list []uint32, slot uint32) bool {
+	for _, s := range list {
+		if s == slot {
+			return true
+		}
+	}
+	return false
+}
+
+// candidateHeap is a min heap on distance, or a max heap when farthestFirst is set
+type candidateHeap struct {
+	items         []hnswCandidate
+	farthestFirst bool
+}
+
+func (c *candidateHeap) Len() int { return len(c.items) }
+func (c *candidateHeap) Less(i, j int) bool {
+	if c.farthestFirst {
+		return c.items[i].distance > c.items[j].distance
+	}
+	return c.items[i].distance < c.items[j].distance
+}
+func (c *candidateHeap) Swap(i, j int) { c.items[i], c.items[j] = c.items[j], c.items[i] }
+func (c *candidateHeap) Push(x any)    { c.items = append(c.items, x.(hnswCandidate)) }
+func (c *candidateHeap) Pop() any {
+	last := c.items[len(c.items)-1]
+	c.items = c.items[:len(c.items)-1]
+	return last
+}
+
+// visitedSet marks visited slots using a generation counter so it can be reused without clearing
+type visitedSet struct {
+	marks      []uint32
+	generation uint32
+}
+
+func (v *visitedSet) reset(size int) {
+	if len(v.marks) < size {
+		v.marks = make([]uint32, size)
+		v.generation = 0
+	}
+	v.generation++
+	if v.generation == 0 {
+		clear(v.marks)
+		v.generation = 1
+	}
+}
+
+func (v *visitedSet) mark(slot uint32)      { v.marks[slot] = v.generation }
+func (v *visitedSet) seen(slot uint32) bool { return v.marks[slot] == v.generation }
@@ -0,0 +1,327 @@
+package RAG_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+func randomVectors(n, dimension int, seed int64) [][]float32 {
+	rng := rand.New(rand.NewSource(seed))
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		vectors[i] = make([]float32, dimension)
+		for j := range vectors[i] {
+			vectors[i][j] = float32(rng.NormFloat64())
+		}
+	}
+	return vectors
+}
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i] * b[i])
+		na += float64(a[i] * a[i])
+		nb += float64(b[i] * b[i])
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// bruteForceTopK returns the ids of the k vectors with the highest cosine similarity
+func bruteForceTopK(vectors [][]float32, deleted map[int]bool, query []float32, k int) []string {
+	type scored struct {
+		id    string
+		score float64
+	}
+	var all []scored
+	for i, v := range vectors {
+		if deleted[i] {
+			continue
+		}
+		all = append(all, scored{id: fmt.Sprint(i), score: cosine(query, v)})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].score > all[j].score })
+	ids := make([]string, 0, k)
+	for i := 0; i < k && i < len(all); i++ {
+		ids = append(ids, all[i].id)
+	}
+	return ids
+}
+
+// recall is the fraction of the exact neighbours found by the index
+func recall(index *RAG.HNSWIndex, vectors [][]float32, deleted map[int]bool, queries [][]float32, k int) float64 {
+	found, total := 0, 0
+	for _, query := range queries {
+		exact := map[string]bool{}
+		for _, id := range bruteForceTopK(vectors, deleted, query, k) {
+			exact[id] = true
+		}
+		for _, result := range index.Search(query, k) {
+			if exact[result.ID] {
+				found++
+			}
+		}
+		total += len(exact)
+	}
+	return float64(found) / float64(total)
+}
+
+func buildIndex(config RAG.HNSWConfig, vectors [][]float32) *RAG.HNSWIndex {
+	index := RAG.NewHNSWIndex(config, RAG.METRIC_COSINE)
+	for i, v := range vectors {
+		index.Insert(fmt.Sprint(i), v)
+	}
+	return index
+}
+
+func TestHNSWRecall(t *testing.T) {
+	vectors := randomVectors(2000, 32, 1)
+	queries := randomVectors(50, 32, 2)
+	index := buildIndex(RAG.HNSWConfig{Seed: 1}, vectors)
+
+	if index.Len() != len(vectors) {
+		t.Fatalf("expected %d vectors, got %d", len(vectors), index.Len())
+	}
+	if r := recall(index, vectors, nil, queries, 10); r < 0.9 {
+		t.Errorf("recall@10 is too low: %f", r)
+	}
+}
+
+func TestHNSWDelete(t *testing.T) {
+	vectors := randomVectors(1000, 16, 3)
+	queries := randomVectors(30, 16, 4)
+	index := buildIndex(RAG.HNSWConfig{Seed: 1}, vectors)
+
+	deleted := map[int]bool{}
+	for i := 0; i < len(vectors); i += 3 {
+		deleted[i] = true
+		if !index.Delete(fmt.Sprint(i)) {
+			t.Fatalf("failed to delete %d", i)
+		}
+	}
+	if index.Delete("missing") {
+		t.Error("deleting an unknown id should report false")
+	}
+
+	for _, query := range queries {
+		for _, result := range index.Search(query, 10) {
+			var i int
+			fmt.Sscan(result.ID, &i)
+			if deleted[i] {
+				t.Fatalf("deleted vector %s was returned", result.ID)
+			}
+		}
+	}
+	if r := recall(index, vectors, deleted, queries, 10); r < 0.9 {
+		t.Errorf("recall@10 after deletes is too low: %f", r)
+	}
+
+	// re-inserting deleted ids reuses their slots
+	for i := range deleted {
+		index.Insert(fmt.Sprint(i), vectors[i])
+	}
+	if index.Len() != len(vectors) {
+		t.Fatalf("expected %d vectors after re-insert, got %d", len(vectors), index.Len())
+	}
+	if r := recall(index, vectors, nil, queries, 10); r < 0.9 {
+		t.Errorf("recall@10 after re-insert is too low: %f", r)
+	}
+}
+
+func TestHNSWUpdate(t *testing.T) {
+	vectors := randomVectors(1000, 16, 7)
+	queries := randomVectors(30, 16, 8)
+	index := buildIndex(RAG.HNSWConfig{Seed: 1}, vectors)
+
+	// re-inserting the same vectors keeps the graph as it is
+	for i, v := range vectors {
+		index.Insert(fmt.Sprint(i), v)
+	}
+	// moving every other vector relinks it in place
+	moved := randomVectors(len(vectors), 16, 9)
+	for i := 0; i < len(vectors); i += 2 {
+		vectors[i] = moved[i]
+		index.Insert(fmt.Sprint(i), vectors[i])
+	}
+	if index.Len() != len(vectors) {
+		t.Fatalf("expected %d vectors after the updates, got %d", len(vectors), index.Len())
+	}
+	for i := 0; i < len(vectors); i += 50 {
+		if results := index.Search(vectors[i], 1); len(results) != 1 || results[0].ID != fmt.Sprint(i) {
+			t.Errorf("expected the updated vector %d to be its own nearest neighbour, got %v", i, results)
+		}
+	}
+	if r := recall(index, vectors, nil, queries, 10); r < 0.9 {
+		t.Errorf("recall@10 after the updates is too low: %f", r)
+	}
+}
+
+func TestHNSWSnapshotRestore(t *testing.T) {
+	vectors := randomVectors(500, 16, 5)
+	index := buildIndex(RAG.HNSWConfig{Seed: 1}, vectors)
+	index.Delete("7")
+
+	restored, err := RAG.RestoreHNSWIndex(index.Snapshot(), func(id string) ([]float32, bool) {
+		var i int
+		if _, err := fmt.Sscan(id, &i); err != nil || i >= len(vectors) {
+			return nil, false
+		}
+		return vectors[i], true
+	})
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+
+	for _, query := range randomVectors(10, 16, 6) {
+		want := index.Search(query, 5)
+		got := restored.Search(query, 5)
+		if fmt.Sprint(want) != fmt.Sprint(got) {
+			t.Fatalf("restored index returned %v, want %v", got, want)
+		}
+	}
+
+	_, err = RAG.RestoreHNSWIndex(index.Snapshot(), func(id string) ([]float32, bool) { return nil, false })
+	if err == nil {
+		t.Fatal("expected an error when the vectors cannot be found")
+	}
+}
+
+func TestHNSWRestoreCorruptSnapshot(t *testing.T) {
+	lookup := func(id string) ([]float32, bool) { return []float32{1, 0}, true }
+	valid := func() RAG.HNSWSnapshot {
+		return RAG.HNSWSnapshot{
+			Metric:   RAG.METRIC_COSINE,
+			Entry:    0,
+			MaxLevel: 1,
+			Nodes: []*RAG.HNSWNodeSnapshot{
+				{ID: "a", Level: 1, Neighbors: [][]uint32{{1}, {}}},
+				{ID: "b", Level: 0, Neighbors: [][]uint32{{0}}},
+			},
+		}
+	}
+	if _, err := RAG.RestoreHNSWIndex(valid(), lookup); err != nil {
+		t.Fatalf("restore of the valid snapshot failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(snapshot *RAG.HNSWSnapshot)
+	}{
+		{"neighbor below the layer", func(snapshot *RAG.HNSWSnapshot) { snapshot.Nodes[0].Neighbors[1] = []uint32{1} }},
+		{"max level above the entry", func(snapshot *RAG.HNSWSnapshot) { snapshot.MaxLevel = 2 }},
+		{"negative level", func(snapshot *RAG.HNSWSnapshot) { snapshot.Nodes[1] = &RAG.HNSWNodeSnapshot{ID: "b", Level: -1} }},
+		{"missing neighbor", func(snapshot *RAG.HNSWSnapshot) { snapshot.Nodes[1].Neighbors[0] = []uint32{2} }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snapshot := valid()
+			test.corrupt(&snapshot)
+			if _, err := RAG.RestoreHNSWIndex(snapshot, lookup); err == nil {
+				t.Fatal("expected the corrupt snapshot to be rejected")
+			}
+		})
+	}
+}
+
+func TestLocalStoreWithHNSW(t *testing.T) {
+	vectors := randomVectors(300, 8, 7)
+	path := filepath.Join(t.TempDir(), "vectors.json")
+	store, err := RAG.OpenLocalStore(path, RAG.METRIC_COSINE)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	store.EnableHNSW(RAG.HNSWConfig{Seed: 1})
+
+	records := make([]RAG.VectorRecord, len(vectors))
+	for i, v := range vectors {
+		records[i] = RAG.VectorRecord{ID: fmt.Sprint(i), Values: v}
+	}
+	if err := store.Upsert(context.Background(), "database-articles", records); err != nil {
+		t.Fatalf("upsert failed: %v", err)
+	}
+	if err := store.Save(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	query := RAG.VectorQuery{Namespace: "database-articles", Vector: vectors[42], TopK: 3}
+	matches, err := store.Query(context.Background(), query)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(matches) != 3 || matches[0].ID != "42" {
+		t.Fatalf("unexpected matches: %+v", matches)
+	}
+
+	// the graph is restored from the snapshot together with the vectors
+	reloaded, err := RAG.OpenLocalStore(path, "")
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	reloadedMatches, err := reloaded.Query(context.Background(), query)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if fmt.Sprint(reloadedMatches) != fmt.Sprint(matches) {
+		t.Fatalf("reloaded store returned %+v, want %+v", reloadedMatches, matches)
+	}
+
+	// a store configured for brute-force scoring does not take the index of the snapshot
+	bruteForce, err := RAG.OpenLocalStoreWithHNSW(path, "", nil)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	bruteForcePath := filepath.Join(t.TempDir(), "brute-force.json")
+	if err := bruteForce.SaveTo(bruteForcePath); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	data, err := os.ReadFile(bruteForcePath)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	var saved map[string]json.RawMessage
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if _, ok := saved["hnsw"]; ok {
+		t.Errorf("expected the brute-force store to keep its configured search")
+	}
+}
+
+// BenchmarkHNSWSearch compares search latency and recall@10 against brute force for a few parameter sets
+// run with: go test ./RAG -run '^$' -bench HNSW
+func BenchmarkHNSWSearch(b *testing.B) {
+	vectors := randomVectors(10000, 64, 8)
+	queries := randomVectors(100, 64, 9)
+
+	for _, config := range []RAG.HNSWConfig{
+		{M: 8, EfConstruction: 100, EfSearch: 32},
+		{M: 16, EfConstruction: 200, EfSearch: 64},
+		{M: 16, EfConstruction: 200, EfSearch: 128},
+		{M: 32, EfConstruction: 400, EfSearch: 128},
+	} {
+		name := fmt.Sprintf("M=%d/efC=%d/efS=%d", config.M, config.EfConstruction, config.EfSearch)
+		index := buildIndex(config, vectors)
+		indexRecall := recall(index, vectors, nil, queries, 10)
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				index.Search(queries[i%len(queries)], 10)
+			}
+			b.ReportMetric(indexRecall, "recall@10")
+		})
+	}
+
+	b.Run("brute-force", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			bruteForceTopK(vectors, nil, queries[i%len(queries)], 10)
+		}
+	})
+}
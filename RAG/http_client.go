@@ -0,0 +1,97 @@
+package RAG
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const DEFAULT_HTTP_TIMEOUT = 120 * time.Second
+
+// HTTPStatusError is returned by the HTTP based providers when the server answers with a non 2xx status
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("request to %s failed with HTTP %d: %s", e.URL, e.StatusCode, e.Body)
+}
+
+// chatMessage is a single message of the OpenAI and Ollama chat APIs
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatMessages converts the conversation turns and the new prompt to chat API messages
+func chatMessages(history []ChatTurn, prompt string) []chatMessage {
+	messages := make([]chatMessage, 0, len(history)+1)
+	for _, turn := range history {
+		role := "user"
+		if turn.Role == ROLE_MODEL {
+			role = "assistant"
+		}
+		messages = append(messages, chatMessage{Role: role, Content: turn.Content})
+	}
+	return append(messages, chatMessage{Role: "user", Content: prompt})
+}
+
+// postJSON sends body as JSON to url and returns the response once the status was checked
+// the caller must close the response body
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body any) (*http.Response, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: DEFAULT_HTTP_TIMEOUT}
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		defer response.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return nil, &HTTPStatusError{URL: url, StatusCode: response.StatusCode, Body: strings.TrimSpace(string(message))}
+	}
+	return response, nil
+}
+
+// postStream is postJSON for streamed responses, the default client has no timeout because
+// DEFAULT_HTTP_TIMEOUT would also cut off long answers, the deadline of ctx bounds the stream instead
+func postStream(ctx context.Context, client *http.Client, url string, headers map[string]string, body any) (*http.Response, error) {
+	if client == nil {
+		client = &http.Client{}
+	}
+	return postJSON(ctx, client, url, headers, body)
+}
+
+// doJSON posts body to url and decodes the JSON response into out
+func doJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body any, out any) error {
+	response, err := postJSON(ctx, client, url, headers, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response from %s: %w", url, err)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package RAG_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+// newOpenAIServer stands in for an OpenAI compatible server
+func newOpenAIServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "missing api key", http.StatusUnauthorized)
+			return
+		}
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		switch r.URL.Path {
+		case "/v1/chat/completions":
+			messages := body["messages"].([]any)
+			prompt := messages[len(messages)-1].(map[string]any)["content"].(string)
+			json.NewEncoder(w).Encode(map[string]any{
+				"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": "echo: " + prompt}}},
+			})
+		case "/v1/embeddings":
+			json.NewEncoder(w).Encode(map[string]any{
+				"data": []any{map[string]any{"index": 0, "embedding": []float32{0.1, 0.2, 0.3}}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// newOllamaServer stands in for an Ollama server
+func newOllamaServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		switch r.URL.Path {
+		case "/api/chat":
+			if body["stream"] != false {
+				t.Errorf("expected a non streaming request, got %v", body["stream"])
+			}
+			messages := body["messages"].([]any)
+			prompt := messages[len(messages)-1].(map[string]any)["content"].(string)
+			json.NewEncoder(w).Encode(map[string]any{
+				"message": map[string]any{"role": "assistant", "content": "echo: " + prompt},
+				"done":    true,
+			})
+		case "/api/embed":
+			embeddings := [][]float32{}
+			for range body["input"].([]any) {
+				embeddings = append(embeddings, []float32{1, 0, 0})
+			}
+			json.NewEncoder(w).Encode(map[string]any{"embeddings": embeddings})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestOpenAIProviders(t *testing.T) {
+	server := newOpenAIServer(t)
+	defer server.Close()
+
+	llm := &RAG.OpenAILLM{BaseURL: server.URL + "/v1", APIKey: "secret", Model: "gpt-test"}
+	text, err := llm.Generate(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if text != "echo: hello" {
+		t.Errorf("unexpected response: %q", text)
+	}
+
+	embedder := &RAG.OpenAIEmbedder{BaseURL: server.URL + "/v1/", APIKey: "secret", Model: "embed-test"}
+	embedding, err := embedder.Embed(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("embed failed: %v", err)
+	}
+	if len(embedding) != 3 {
+		t.Errorf("unexpected embedding: %v", embedding)
+	}
+
+	unauthorized := &RAG.OpenAILLM{BaseURL: server.URL + "/v1", Model: "gpt-test"}
+	_, err = unauthorized.Generate(context.Background(), "hello")
+	var statusErr *RAG.HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected an HTTP 401 error, got %v", err)
+	}
+}
+
+func TestOpenAIEmbedBatchIndexes(t *testing.T) {
+	var indexes []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := []any{}
+		for _, index := range indexes {
+			data = append(data, map[string]any{"index": index, "embedding": []float32{float32(index)}})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	defer server.Close()
+	embedder := &RAG.OpenAIEmbedder{BaseURL: server.URL, Model: "embed-test"}
+	texts := []string{"a", "b", "c"}
+
+	// the embeddings are placed by their index, whatever their order
+	indexes = []int{2, 0, 1}
+	embeddings, err := embedder.EmbedBatch(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("embed failed: %v", err)
+	}
+	for i, embedding := range embeddings {
+		if embedding[0] != float32(i) {
+			t.Errorf("expected embedding %d in place, got %v", i, embeddings)
+		}
+	}
+
+	for _, invalid := range [][]int{{0, 0, 1}, {0, 1, 3}, {0, -1, 2}} {
+		indexes = invalid
+		if _, err := embedder.EmbedBatch(context.Background(), texts); err == nil {
+			t.Errorf("expected an error for the indexes %v", invalid)
+		}
+	}
+}
+
+func TestOllamaProviders(t *testing.T) {
+	server := newOllamaServer(t)
+	defer server.Close()
+
+	llm := &RAG.OllamaLLM{BaseURL: server.URL, Model: "llama-test"}
+	text, err := llm.Generate(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	if text != "echo: hello" {
+		t.Errorf("unexpected response: %q", text)
+	}
+
+	embedder := &RAG.OllamaEmbedder{BaseURL: server.URL, Model: "embed-test"}
+	embedding, err := embedder.Embed(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("embed failed: %v", err)
+	}
+	if len(embedding) != 3 || embedding[0] != 1 {
+		t.Errorf("unexpected embedding: %v", embedding)
+	}
+}
+
+func TestGetRAGWithOllamaAndLocalStore(t *testing.T) {
+	server := newOllamaServer(t)
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "vectors.json")
+	store, err := RAG.NewLocalStore(RAG.METRIC_COSINE)
+	if err != nil {
+		t.Fatalf("failed to create local store: %v", err)
+	}
+	store.Upsert(context.Background(), "database-articles", []RAG.VectorRecord{
+		{ID: "1", Values: []float32{1, 0, 0}, Metadata: map[string]any{"content": "indexes", "source_url": "https://example.com"}},
+	})
+	if err := store.SaveTo(path); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	rag := RAG.GetRAG(&RAG.RAGConfig{
+		LLMProvider:          RAG.PROVIDER_OLLAMA,
+		EmbeddingProvider:    RAG.PROVIDER_OLLAMA,
+		OllamaBaseURL:        server.URL,
+		OllamaModel:          "llama-test",
+		OllamaEmbeddingModel: "embed-test",
+		VectorStoreProvider:  RAG.VECTOR_STORE_LOCAL,
+		LocalStorePath:       path,
+	})
+
+	response, err := rag.QueryChat("how do indexes work?")
+	if err != nil {
+		t.Fatalf("QueryChat failed: %v", err)
+	}
+	if len(response.Sources) != 1 || response.Sources[0] != "https://example.com" {
+		t.Errorf("unexpected sources: %v", response.Sources)
+	}
+}
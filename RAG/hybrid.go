@@ -0,0 +1,113 @@
+package RAG
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	// RRF_K dampens the reciprocal rank fusion so that the first ranks of one list do not dominate the other
+	RRF_K = 60
+	// KEYWORD_REINDEX_BATCH_SIZE is the number of vectors fetched together to rebuild the keyword index
+	KEYWORD_REINDEX_BATCH_SIZE = 100
+)
+
+// FuseRRF merges the vector and keyword matches with reciprocal rank fusion
+// every match scores (1-keywordWeight)/(RRF_K+vector rank) + keywordWeight/(RRF_K+keyword rank),
+// the score of the returned matches is the fused score
+func FuseRRF(vector []VectorMatch, keyword []VectorMatch, keywordWeight float64) []VectorMatch {
+	scores := make(map[string]float64)
+	fused := make(map[string]VectorMatch)
+	rank := func(matches []VectorMatch, weight float64) {
+		for index, match := range matches {
+			scores[match.ID] += weight / float64(RRF_K+index+1)
+			if _, ok := fused[match.ID]; !ok {
+				fused[match.ID] = match
+			}
+		}
+	}
+	// the vector matches go first so that their metadata is kept
+	rank(vector, 1-keywordWeight)
+	rank(keyword, keywordWeight)
+
+	matches := make([]VectorMatch, 0, len(fused))
+	for id, match := range fused {
+		match.Score = float32(scores[id])
+		matches = append(matches, match)
+	}
+	sortMatches(matches)
+	return matches
+}
+
+// keywordWeight returns the weight of the keyword matches in the namespace, looked up as requested first
+// and as stored second, zero means the namespace is searched by vector only
+func (r *RAGEngine) keywordWeight(requested string, namespace string) float64 {
+	if r.Keywords == nil {
+		return 0
+	}
+	if weight, ok := r.KeywordWeights[requested]; ok {
+		return weight
+	}
+	return r.KeywordWeights[namespace]
+}
+
+// hybridMatches fuses the vector matches with the keyword matches of the query
+// the keyword matches are held to the same metadata filter as the vector matches
+func (r *RAGEngine) hybridMatches(namespace string, query string, matches []VectorMatch, topK int, weight float64, filter MetadataFilter) []VectorMatch {
+	startTime := time.Now()
+	var keywordMatches []VectorMatch
+	if len(filter) == 0 {
+		keywordMatches = r.Keywords.Search(namespace, query, topK)
+	} else {
+		for _, match := range r.Keywords.Search(namespace, query, 0) {
+			if filter.Matches(match.Metadata) {
+				keywordMatches = append(keywordMatches, match)
+			}
+		}
+		keywordMatches = keywordMatches[:min(topK, len(keywordMatches))]
+	}
+	if len(keywordMatches) == 0 {
+		return matches
+	}
+	fused := FuseRRF(matches, keywordMatches, weight)
+	if len(fused) > topK {
+		fused = fused[:topK]
+	}
+	log.Printf("INFO: fusing %d vector and %d keyword matches took ==> %f seconds", len(matches), len(keywordMatches), time.Since(startTime).Seconds())
+	return fused
+}
+
+// reindexKeywords rebuilds the keyword index of the namespace from the content stored with its vectors,
+// it is used after the vectors were written around the engine, by an import or a migration
+func (r *RAGEngine) reindexKeywords(ctx context.Context, namespace string) error {
+	if r.Keywords == nil {
+		return nil
+	}
+	lister, listOK := r.Store.(VectorLister)
+	fetcher, fetchOK := r.Store.(VectorFetcher)
+	if !listOK || !fetchOK {
+		return fmt.Errorf("%w: the vector store cannot list and fetch vectors", ErrUnsupported)
+	}
+	ids, err := lister.ListIDs(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	r.Keywords.DeleteNamespace(namespace)
+	for start := 0; start < len(ids); start += KEYWORD_REINDEX_BATCH_SIZE {
+		fetchCtx, cancel := withStageTimeout(ctx, r.Timeouts.Query)
+		stored, err := fetcher.Fetch(fetchCtx, namespace, ids[start:min(start+KEYWORD_REINDEX_BATCH_SIZE, len(ids))])
+		cancel()
+		if err != nil {
+			return err
+		}
+		records := make([]VectorRecord, 0, len(stored))
+		for id, record := range stored {
+			records = append(records, VectorRecord{ID: id, Metadata: record.Metadata})
+		}
+		r.Keywords.Add(namespace, records)
+	}
+	log.Printf("INFO: Indexed the keywords of %d vectors of %s", r.Keywords.Len(namespace), namespace)
+	return nil
+}
@@ -0,0 +1,140 @@
+package RAG_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+func TestKeywordIndexBM25(t *testing.T) {
+	index := RAG.NewKeywordIndex()
+	index.Add("database-articles", []RAG.VectorRecord{
+		{ID: "stats", Metadata: map[string]any{"content": "Enable pg_stat_statements to track the slow queries"}},
+		{ID: "brin", Metadata: map[string]any{"content": "BRIN indexes are small and fit large append-only tables"}},
+		{ID: "btree", Metadata: map[string]any{"content": "A btree index is the default index, an index speeds up queries"}},
+		{ID: "empty", Metadata: map[string]any{"source_url": "https://example.com/empty"}},
+	})
+	if index.Len("database-articles") != 3 {
+		t.Fatalf("expected 3 indexed documents, got %d", index.Len("database-articles"))
+	}
+
+	matches := index.Search("database-articles", "is pg_stat_statements enabled?", 5)
+	if len(matches) == 0 || matches[0].ID != "stats" || matches[0].MetadataString("content") == "" {
+		t.Fatalf("expected the exact token to match, got %+v", matches)
+	}
+	// the rarer term weighs more than the common one
+	matches = index.Search("database-articles", "brin queries", 5)
+	if len(matches) != 3 || matches[0].ID != "brin" {
+		t.Errorf("expected brin first, got %+v", matches)
+	}
+	if matches := index.Search("schemas-json", "brin", 5); len(matches) != 0 {
+		t.Errorf("expected the namespaces to be separate, got %+v", matches)
+	}
+
+	// a record written again replaces its terms
+	index.Add("database-articles", []RAG.VectorRecord{{ID: "brin", Metadata: map[string]any{"content": "block range indexes"}}})
+	if matches := index.Search("database-articles", "brin", 5); len(matches) != 0 {
+		t.Errorf("expected the old terms to be gone, got %+v", matches)
+	}
+}
+
+func TestKeywordIndexConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keywords.json")
+	first, _ := RAG.OpenKeywordIndex(path)
+	second, _ := RAG.OpenKeywordIndex(path)
+	record := func(id string) []RAG.VectorRecord {
+		return []RAG.VectorRecord{{ID: id, Metadata: map[string]any{"content": "content of " + id}}}
+	}
+
+	first.Add("database-articles", record("a"))
+	if err := first.Save(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	// the second writer has an unsaved change when the first one saves again
+	second.Add("schemas-json", record("b"))
+	first.Add("database-articles", record("c"))
+	if err := first.Save(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if err := second.Save(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	reopened, _ := RAG.OpenKeywordIndex(path)
+	if reopened.Len("database-articles") != 2 || reopened.Len("schemas-json") != 1 {
+		t.Errorf("expected the writes of both processes, got %d and %d documents", reopened.Len("database-articles"), reopened.Len("schemas-json"))
+	}
+}
+
+func TestFuseRRF(t *testing.T) {
+	vector := []RAG.VectorMatch{{ID: "a", Score: 0.9}, {ID: "b", Score: 0.8}, {ID: "c", Score: 0.7}}
+	keyword := []RAG.VectorMatch{{ID: "c", Score: 12}, {ID: "d", Score: 3}}
+
+	fused := RAG.FuseRRF(vector, keyword, 0.5)
+	if len(fused) != 4 || fused[0].ID != "c" {
+		t.Fatalf("expected the match found by both to come first, got %+v", fused)
+	}
+	// without keyword weight the vector order is kept
+	fused = RAG.FuseRRF(vector, keyword, 0)
+	if fused[0].ID != "a" || fused[1].ID != "b" || fused[2].ID != "c" {
+		t.Errorf("expected the vector order, got %+v", fused)
+	}
+}
+
+func TestHybridMatch(t *testing.T) {
+	store, _ := RAG.NewLocalStore(RAG.METRIC_COSINE)
+	path := filepath.Join(t.TempDir(), "keywords.json")
+	keywords, err := RAG.OpenKeywordIndex(path)
+	if err != nil {
+		t.Fatalf("failed to open the keyword index: %v", err)
+	}
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, store, &fakeLLM{})
+	engine.Keywords = keywords
+	engine.KeywordWeights = map[string]float64{"database-articles": 0.7}
+
+	_, err = engine.Ingest(context.Background(), "database-articles", []RAG.Document{
+		{SourceURL: "https://example.com/stats", Content: "Enable pg_stat_statements to track the slow queries"},
+		{SourceURL: "https://example.com/brin", Content: "BRIN indexes are small and fit large append-only tables"},
+		{SourceURL: "https://example.com/btree", Content: "A btree index is the default index in a database"},
+	})
+	if err != nil {
+		t.Fatalf("ingest failed: %v", err)
+	}
+
+	matches, err := engine.MatchContext(context.Background(), "database-articles", "what does pg_stat_statements do", 1)
+	if err != nil || len(matches) == 0 || matches[0].MetadataString("source_url") != "https://example.com/stats" {
+		t.Fatalf("expected the keyword match first, got %+v, %v", matches, err)
+	}
+
+	// another process reads the index that was built on ingestion
+	reopened, _ := RAG.OpenKeywordIndex(path)
+	if reopened.Len("database-articles") != 3 {
+		t.Errorf("expected the saved index to hold 3 documents, got %d", reopened.Len("database-articles"))
+	}
+
+	if err := engine.DeleteNamespace(context.Background(), "database-articles"); err != nil {
+		t.Fatalf("failed to delete the namespace: %v", err)
+	}
+	if keywords.Len("database-articles") != 0 {
+		t.Errorf("expected the keywords of the deleted namespace to be gone")
+	}
+}
+
+func TestKeywordWeightsConfig(t *testing.T) {
+	t.Setenv("RAG_KEYWORD_WEIGHTS", "database-articles=0.3, schemas-json=0.5")
+	config, err := RAG.LoadConfigFromEnv()
+	if err != nil {
+		t.Fatalf("LoadConfigFromEnv failed: %v", err)
+	}
+	if config.KeywordWeights["database-articles"] != 0.3 || config.KeywordWeights["schemas-json"] != 0.5 {
+		t.Errorf("unexpected keyword weights: %v", config.KeywordWeights)
+	}
+	for _, value := range []string{"database-articles", "database-articles=2", "=0.5"} {
+		t.Setenv("RAG_KEYWORD_WEIGHTS", value)
+		if _, err := RAG.LoadConfigFromEnv(); err == nil {
+			t.Errorf("expected an error for %q", value)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package RAG
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// IndexStats describes a vector index and the namespaces in it
+type IndexStats struct {
+	Name             string           `json:"name"`
+	Dimension        int              `json:"dimension"`
+	Metric           string           `json:"metric"`
+	Host             string           `json:"host,omitempty"`
+	Status           string           `json:"status,omitempty"`
+	TotalVectorCount int              `json:"total_vector_count"`
+	Namespaces       []NamespaceStats `json:"namespaces"`
+	// Aliases are the namespace aliases of the engine
+	Aliases map[string]NamespaceAlias `json:"aliases,omitempty"`
+}
+
+// NamespaceStats is the number of vectors in a namespace
+type NamespaceStats struct {
+	Name        string `json:"name"`
+	VectorCount int    `json:"vector_count"`
+}
+
+// StatsReporter is implemented by the vector stores that can describe their index
+type StatsReporter interface {
+	Stats(ctx context.Context) (IndexStats, error)
+}
+
+// NamespaceDeleter is implemented by the vector stores that can drop a whole namespace
+type NamespaceDeleter interface {
+	DeleteNamespace(ctx context.Context, namespace string) error
+}
+
+// VectorLister is implemented by the vector stores that can enumerate the ids of a namespace
+type VectorLister interface {
+	ListIDs(ctx context.Context, namespace string) ([]string, error)
+}
+
+// Namespace returns the stats of a single namespace, a missing namespace has no vectors
+func (s IndexStats) Namespace(name string) NamespaceStats {
+	for _, namespace := range s.Namespaces {
+		if namespace.Name == name {
+			return namespace
+		}
+	}
+	return NamespaceStats{Name: name}
+}
+
+// sortNamespaces orders the namespaces by name
+func sortNamespaces(namespaces []NamespaceStats) {
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Name < namespaces[j].Name
+	})
+}
+
+// IndexStats describes the vector store of the engine
+func (r *RAGEngine) IndexStats(ctx context.Context) (IndexStats, error) {
+	reporter, ok := r.Store.(StatsReporter)
+	if !ok {
+		return IndexStats{}, fmt.Errorf("%w: the vector store cannot describe its index", ErrUnsupported)
+	}
+	ctx, cancel := withStageTimeout(ctx, r.Timeouts.Query)
+	defer cancel()
+	stats, err := reporter.Stats(ctx)
+	if err != nil {
+		return stats, err
+	}
+	if aliases := r.Aliases.All(); len(aliases) > 0 {
+		stats.Aliases = aliases
+	}
+	return stats, nil
+}
+
+// DeleteNamespace drops every vector of the namespace
+// a namespace that an alias points to is still read and cannot be deleted
+func (r *RAGEngine) DeleteNamespace(ctx context.Context, namespace string) error {
+	deleter, ok := r.Store.(NamespaceDeleter)
+	if !ok {
+		return fmt.Errorf("%w: the vector store cannot delete namespaces", ErrUnsupported)
+	}
+	if aliases := r.Aliases.Referencing(namespace); len(aliases) > 0 {
+		return fmt.Errorf("%w: %s is read through the aliases %v", ErrNamespaceInUse, namespace, aliases)
+	}
+	ctx, cancel := withStageTimeout(ctx, r.Timeouts.Upsert)
+	defer cancel()
+	if err := deleter.DeleteNamespace(ctx, namespace); err != nil {
+		log.Printf("ERROR: Failed to delete namespace %s: %v", namespace, err)
+		return err
+	}
+	log.Printf("INFO: Deleted namespace %s", namespace)
+	r.invalidateResponses(namespace)
+	r.Keywords.DeleteNamespace(namespace)
+	return r.persist()
+}
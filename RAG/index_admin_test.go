@@ -0,0 +1,49 @@
+package RAG_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+func TestLocalStoreStats(t *testing.T) {
+	store := newTestLocalStore(t, RAG.METRIC_COSINE)
+	err := store.Upsert(context.Background(), "schemas-json", []RAG.VectorRecord{
+		{ID: "gym", Values: []float32{0, 0, 1}},
+	})
+	if err != nil {
+		t.Fatalf("failed to upsert vectors: %v", err)
+	}
+
+	stats, err := store.Stats(context.Background())
+	if err != nil {
+		t.Fatalf("failed to describe the store: %v", err)
+	}
+	if stats.Dimension != 3 || stats.TotalVectorCount != 4 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	expected := []RAG.NamespaceStats{{Name: "database-articles", VectorCount: 3}, {Name: "schemas-json", VectorCount: 1}}
+	if !reflect.DeepEqual(stats.Namespaces, expected) {
+		t.Errorf("expected namespaces %v, got %v", expected, stats.Namespaces)
+	}
+	if stats.Namespace("missing").VectorCount != 0 {
+		t.Errorf("a missing namespace should have no vectors")
+	}
+}
+
+func TestIndexAdminUnsupported(t *testing.T) {
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, &fakeStore{}, &fakeLLM{})
+	if _, err := engine.IndexStats(context.Background()); !errors.Is(err, RAG.ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported from IndexStats, got %v", err)
+	}
+	if err := engine.DeleteNamespace(context.Background(), "database-articles"); !errors.Is(err, RAG.ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported from DeleteNamespace, got %v", err)
+	}
+	if _, _, err := engine.ExportNamespace(context.Background(), "database-articles", &bytes.Buffer{}, RAG.SnapshotOptions{}); !errors.Is(err, RAG.ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported from ExportNamespace, got %v", err)
+	}
+}
@@ -0,0 +1,468 @@
+package RAG
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// DEFAULT_EMBED_BATCH_SIZE is large enough for EmbedBatch to spread a batch over several concurrent requests
+	DEFAULT_EMBED_BATCH_SIZE = 256
+	// the largest document FetchDocuments reads
+	MAX_DOCUMENT_SIZE = 10 << 20
+
+	CONTENT_TYPE_TEXT     = "text/plain"
+	CONTENT_TYPE_MARKDOWN = "text/markdown"
+	CONTENT_TYPE_HTML     = "text/html"
+	CONTENT_TYPE_JSON     = "application/json"
+	CONTENT_TYPE_SQL      = "application/sql"
+)
+
+// the file extensions LoadDirectory reads and their content types
+var documentExtensions = map[string]string{
+	".txt":      CONTENT_TYPE_TEXT,
+	".md":       CONTENT_TYPE_MARKDOWN,
+	".markdown": CONTENT_TYPE_MARKDOWN,
+	".html":     CONTENT_TYPE_HTML,
+	".htm":      CONTENT_TYPE_HTML,
+	".json":     CONTENT_TYPE_JSON,
+	".sql":      CONTENT_TYPE_SQL,
+}
+
+// Document is a piece of the knowledge base before it is split into chunks
+// SourceURL is stored as the source_url metadata that QueryChat cites and QueryAgent fetches
+type Document struct {
+	SourceURL   string
+	Content     string
+	ContentType string
+	// Metadata is copied to every chunk of the document
+	Metadata map[string]any
+}
+
+// IngestResult counts what an ingestion did
+type IngestResult struct {
+	Documents int
+	Chunks    int
+	// Upserted is the number of chunks that were embedded and written
+	Upserted int
+	// Skipped is the number of chunks that were already stored with the same content
+	Skipped int
+	// Removed is the number of stored chunks of the documents that are not in the documents anymore
+	Removed int
+}
+
+// Ingestor loads documents into a vector store namespace
+// every chunk is stored under a hash of its source and content so ingesting the same documents again is idempotent
+type Ingestor struct {
+	Embedder Embedder
+	Store    VectorWriter
+	// Chunker splits the documents, defaults to a MarkdownChunker
+	Chunker Chunker
+	// BatchSize is the number of chunks embedded and upserted together, defaults to DEFAULT_EMBED_BATCH_SIZE
+	BatchSize int
+	// Force embeds and writes the chunks that are already stored
+	Force bool
+	// Timeouts bounds every embedding batch and every upsert
+	Timeouts StageTimeouts
+	// Keywords indexes the content of the chunks for the keyword search, including the chunks already stored
+	Keywords *KeywordIndex
+}
+
+// NewIngestor creates an ingestor with the default chunker
+func NewIngestor(embedder Embedder, store VectorWriter) *Ingestor {
+	return &Ingestor{
+		Embedder:  embedder,
+		Store:     store,
+		Chunker:   &MarkdownChunker{},
+		BatchSize: DEFAULT_EMBED_BATCH_SIZE,
+	}
+}
+
+// Ingest chunks, embeds and upserts the documents into the namespace
+func (i *Ingestor) Ingest(ctx context.Context, namespace string, documents []Document) (IngestResult, error) {
+	result := IngestResult{Documents: len(documents)}
+
+	chunker := i.Chunker
+	if chunker == nil {
+		chunker = &MarkdownChunker{}
+	}
+	batchSize := i.BatchSize
+	if batchSize <= 0 {
+		batchSize = DEFAULT_EMBED_BATCH_SIZE
+	}
+
+	// chunk the documents, the same chunk appearing twice is only stored once
+	startTime := time.Now()
+	records := []VectorRecord{}
+	seen := make(map[string]bool)
+	for _, document := range documents {
+		for _, chunk := range chunker.Chunk(document) {
+			if strings.TrimSpace(chunk.Content) == "" {
+				continue
+			}
+			id := ChunkID(document.SourceURL, chunk.Content)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			records = append(records, VectorRecord{ID: id, Metadata: chunkMetadata(document, chunk)})
+		}
+	}
+	result.Chunks = len(records)
+	log.Printf("INFO: Chunking %d documents into %d chunks took %f seconds", len(documents), len(records), time.Since(startTime).Seconds())
+
+	// skip the chunks that are already stored
+	if fetcher, ok := i.Store.(VectorFetcher); ok && !i.Force && len(records) > 0 {
+		existing, err := i.fetchExisting(ctx, fetcher, namespace, records)
+		if err != nil {
+			return result, err
+		}
+		pending := []VectorRecord{}
+		stored := []VectorRecord{}
+		for _, record := range records {
+			if existing[record.ID] {
+				stored = append(stored, record)
+			} else {
+				pending = append(pending, record)
+			}
+		}
+		// a keyword index created after the chunks were stored catches up
+		i.Keywords.Add(namespace, stored)
+		result.Skipped = len(records) - len(pending)
+		records = pending
+	}
+
+	// an edited document gets new chunk ids, remove the chunks of its previous content
+	removed, err := i.removeStale(ctx, namespace, documents, seen)
+	if err != nil {
+		return result, err
+	}
+	result.Removed = removed
+
+	for start := 0; start < len(records); start += batchSize {
+		batch := records[start:min(start+batchSize, len(records))]
+		if err := i.upsertBatch(ctx, namespace, batch); err != nil {
+			return result, err
+		}
+		i.Keywords.Add(namespace, batch)
+		result.Upserted += len(batch)
+		log.Printf("INFO: Ingested %d/%d chunks into namespace %s", result.Upserted, len(records), namespace)
+	}
+	return result, nil
+}
+
+// fetchExisting returns the ids of the records that are already stored
+func (i *Ingestor) fetchExisting(ctx context.Context, fetcher VectorFetcher, namespace string, records []VectorRecord) (map[string]bool, error) {
+	ids := make([]string, len(records))
+	for index, record := range records {
+		ids[index] = record.ID
+	}
+	ctx, cancel := withStageTimeout(ctx, i.Timeouts.Query)
+	defer cancel()
+	stored, err := fetcher.Fetch(ctx, namespace, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the stored chunks: %w", err)
+	}
+	existing := make(map[string]bool, len(stored))
+	for id := range stored {
+		existing[id] = true
+	}
+	return existing, nil
+}
+
+// removeStale deletes the stored chunks of the sources of the documents that are not in the new chunk set
+// it needs a store that can list and fetch its records to find the source of the stored chunks
+func (i *Ingestor) removeStale(ctx context.Context, namespace string, documents []Document, chunkIDs map[string]bool) (int, error) {
+	sources := make(map[string]bool, len(documents))
+	for _, document := range documents {
+		if document.SourceURL != "" {
+			sources[document.SourceURL] = true
+		}
+	}
+	if len(sources) == 0 {
+		return 0, nil
+	}
+	lister, listOK := i.Store.(VectorLister)
+	fetcher, fetchOK := i.Store.(VectorFetcher)
+	if !listOK || !fetchOK {
+		log.Printf("WARNING: The vector store cannot list its records, the previous chunks of the documents are kept")
+		return 0, nil
+	}
+
+	listCtx, cancel := withStageTimeout(ctx, i.Timeouts.Query)
+	defer cancel()
+	ids, err := lister.ListIDs(listCtx, namespace)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list the stored chunks: %w", err)
+	}
+	candidates := []string{}
+	for _, id := range ids {
+		if !chunkIDs[id] {
+			candidates = append(candidates, id)
+		}
+	}
+	if len(candidates) == 0 {
+		return 0, nil
+	}
+	stored, err := fetcher.Fetch(listCtx, namespace, candidates)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch the stored chunks: %w", err)
+	}
+	stale := []string{}
+	for _, id := range candidates {
+		if source, _ := stored[id].Metadata["source_url"].(string); sources[source] {
+			stale = append(stale, id)
+		}
+	}
+	if len(stale) == 0 {
+		return 0, nil
+	}
+
+	deleteCtx, cancel := withStageTimeout(ctx, i.Timeouts.Upsert)
+	defer cancel()
+	if err := i.Store.Delete(deleteCtx, namespace, stale); err != nil {
+		return 0, fmt.Errorf("failed to delete the previous chunks: %w", err)
+	}
+	i.Keywords.Remove(namespace, stale)
+	log.Printf("INFO: Removed %d previous chunks from namespace %s", len(stale), namespace)
+	return len(stale), nil
+}
+
+// upsertBatch embeds the content of the records and writes them
+func (i *Ingestor) upsertBatch(ctx context.Context, namespace string, batch []VectorRecord) error {
+	texts := make([]string, len(batch))
+	for index, record := range batch {
+		texts[index] = record.Metadata["content"].(string)
+	}
+
+	embedCtx, cancel := withStageTimeout(ctx, i.Timeouts.Embed)
+	embeddings, err := embedTexts(embedCtx, i.Embedder, texts)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("failed to embed chunks: %w", err)
+	}
+	for index := range batch {
+		batch[index].Values = embeddings[index]
+	}
+
+	upsertCtx, cancel := withStageTimeout(ctx, i.Timeouts.Upsert)
+	defer cancel()
+	if err := i.Store.Upsert(upsertCtx, namespace, batch); err != nil {
+		return fmt.Errorf("failed to upsert chunks: %w", err)
+	}
+	return nil
+}
+
+// embedTexts embeds the texts in a single request when the embedder supports it
+func embedTexts(ctx context.Context, embedder Embedder, texts []string) ([][]float32, error) {
+	if batcher, ok := embedder.(BatchEmbedder); ok {
+		return batcher.EmbedBatch(ctx, texts)
+	}
+	embeddings := make([][]float32, len(texts))
+	for index, text := range texts {
+		embedding, err := embedder.Embed(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		embeddings[index] = embedding
+	}
+	return embeddings, nil
+}
+
+// ChunkID returns the content hash a chunk is stored under
+func ChunkID(sourceURL string, content string) string {
+	hash := sha256.Sum256([]byte(sourceURL + "\x00" + content))
+	return hex.EncodeToString(hash[:16])
+}
+
+// chunkMetadata merges the document and chunk metadata with the fields the queries read
+func chunkMetadata(document Document, chunk Chunk) map[string]any {
+	metadata := make(map[string]any, len(document.Metadata)+len(chunk.Metadata)+3)
+	maps.Copy(metadata, document.Metadata)
+	maps.Copy(metadata, chunk.Metadata)
+	metadata["content"] = chunk.Content
+	metadata["chunk_index"] = chunk.Index
+	if document.SourceURL != "" {
+		metadata["source_url"] = document.SourceURL
+	}
+	return metadata
+}
+
+// LoadDirectory reads the documents under root with a known extension
+// the source of every document is its path relative to root, joined to baseURL when it is set
+func LoadDirectory(root string, baseURL string) ([]Document, error) {
+	documents := []Document{}
+	err := filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if filePath != root && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		contentType, ok := documentExtensions[strings.ToLower(filepath.Ext(filePath))]
+		if !ok {
+			return nil
+		}
+
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		source := filepath.ToSlash(relative)
+		if baseURL != "" {
+			source = strings.TrimSuffix(baseURL, "/") + "/" + source
+		}
+		documents = append(documents, Document{SourceURL: source, Content: string(content), ContentType: contentType})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load documents from %s: %w", root, err)
+	}
+	log.Printf("INFO: Loaded %d documents from %s", len(documents), root)
+	return documents, nil
+}
+
+// FetchDocuments downloads the documents at the given urls
+// every request is bounded by timeout, zero means DEFAULT_FETCH_REQUEST_TIMEOUT
+func FetchDocuments(ctx context.Context, urls []string, timeout time.Duration) ([]Document, error) {
+	if timeout <= 0 {
+		timeout = DEFAULT_FETCH_REQUEST_TIMEOUT
+	}
+	client := &http.Client{Timeout: timeout}
+
+	documents := make([]Document, 0, len(urls))
+	for _, documentURL := range urls {
+		document, err := fetchDocument(ctx, client, documentURL)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+	log.Printf("INFO: Fetched %d documents", len(documents))
+	return documents, nil
+}
+
+func fetchDocument(ctx context.Context, client *http.Client, documentURL string) (Document, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, documentURL, nil)
+	if err != nil {
+		return Document{}, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return Document{}, fmt.Errorf("failed to fetch %s: %w", documentURL, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return Document{}, &HTTPStatusError{URL: documentURL, StatusCode: response.StatusCode}
+	}
+	content, err := io.ReadAll(io.LimitReader(response.Body, MAX_DOCUMENT_SIZE))
+	if err != nil {
+		return Document{}, fmt.Errorf("failed to read %s: %w", documentURL, err)
+	}
+	return Document{SourceURL: documentURL, Content: string(content), ContentType: documentContentType(documentURL, response.Header.Get("Content-Type"))}, nil
+}
+
+// documentContentType prefers the extension of the url over a generic content type header
+func documentContentType(documentURL string, header string) string {
+	if parsed, err := url.Parse(documentURL); err == nil {
+		if contentType, ok := documentExtensions[strings.ToLower(path.Ext(parsed.Path))]; ok {
+			return contentType
+		}
+	}
+	if mediaType, _, err := mime.ParseMediaType(header); err == nil {
+		return mediaType
+	}
+	return CONTENT_TYPE_TEXT
+}
+
+// writer returns the store of the engine when it can be written to
+func (r *RAGEngine) writer() (VectorWriter, error) {
+	writer, ok := r.Store.(VectorWriter)
+	if !ok {
+		return nil, fmt.Errorf("%w: the vector store is read-only", ErrUnsupported)
+	}
+	return writer, nil
+}
+
+// persist saves a local store that was opened from a snapshot file
+func (r *RAGEngine) persist() error {
+	if store, ok := r.Store.(*LocalStore); ok && store.path != "" {
+		if err := store.Save(); err != nil {
+			return err
+		}
+	}
+	return r.Keywords.Save()
+}
+
+func (r *RAGEngine) Upsert(namespace string, records []VectorRecord) error {
+	return r.UpsertContext(context.Background(), namespace, records)
+}
+
+func (r *RAGEngine) UpsertContext(ctx context.Context, namespace string, records []VectorRecord) error {
+	writer, err := r.writer()
+	if err != nil {
+		return err
+	}
+
+	namespace = r.resolveNamespace(namespace)
+	startTime := time.Now()
+	upsertCtx, cancel := withStageTimeout(ctx, r.Timeouts.Upsert)
+	defer cancel()
+	if err := writer.Upsert(upsertCtx, namespace, records); err != nil {
+		log.Printf("ERROR: Failed to upsert %d vectors: %v", len(records), err)
+		return err
+	}
+	r.invalidateResponses(namespace)
+	r.Keywords.Add(namespace, records)
+	log.Printf("INFO: Upserting %d vectors took %f seconds", len(records), time.Since(startTime).Seconds())
+	return r.persist()
+}
+
+func (r *RAGEngine) Ingest(ctx context.Context, namespace string, documents []Document) (IngestResult, error) {
+	writer, err := r.writer()
+	if err != nil {
+		return IngestResult{}, err
+	}
+
+	namespace = r.resolveNamespace(namespace)
+	startTime := time.Now()
+	ingestor := NewIngestor(r.Embedder, writer)
+	ingestor.Timeouts = r.Timeouts
+	ingestor.Keywords = r.Keywords
+	result, err := ingestor.Ingest(ctx, namespace, documents)
+	if result.Upserted > 0 || result.Removed > 0 {
+		// the cached responses may cite the content that changed
+		r.invalidateResponses(namespace)
+		// keep what was written even when a later batch failed
+		if persistErr := r.persist(); persistErr != nil && err == nil {
+			err = persistErr
+		}
+	}
+	if err != nil {
+		log.Printf("ERROR: Ingestion into namespace %s failed: %v", namespace, err)
+		return result, err
+	}
+	log.Printf("INFO: Ingestion took %f seconds, %d chunks upserted, %d already stored, %d removed", time.Since(startTime).Seconds(), result.Upserted, result.Skipped, result.Removed)
+	return result, nil
+}
@@ -0,0 +1,275 @@
+package RAG_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+// batchEmbedder records the size of every batch it embeds
+type batchEmbedder struct {
+	fakeEmbedder
+	batches []int
+}
+
+func (b *batchEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	b.batches = append(b.batches, len(texts))
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embeddings[i], _ = b.fakeEmbedder.Embed(ctx, text)
+	}
+	return embeddings, nil
+}
+
+func TestTextChunker(t *testing.T) {
+	paragraphs := []string{}
+	for i := 0; i < 20; i++ {
+		paragraphs = append(paragraphs, fmt.Sprintf("paragraph %d %s", i, strings.Repeat("word ", 15)))
+	}
+	chunker := &RAG.TextChunker{Size: 300, Overlap: 50}
+	chunks := chunker.Chunk(RAG.Document{Content: strings.Join(paragraphs, "\n\n")})
+
+	if len(chunks) < 5 {
+		t.Fatalf("expected the document to be split, got %d chunks", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if chunk.Index != i || len(chunk.Content) > 302 {
+			t.Errorf("chunk %d is invalid: index %d, %d characters", i, chunk.Index, len(chunk.Content))
+		}
+		if i > 0 {
+			previous := chunks[i-1].Content
+			tail := previous[len(previous)-20:]
+			if !strings.Contains(chunk.Content, tail) {
+				t.Errorf("chunk %d does not overlap the previous one", i)
+			}
+		}
+	}
+	if !strings.Contains(chunks[len(chunks)-1].Content, "paragraph 19") {
+		t.Errorf("the last paragraph is missing")
+	}
+
+	long := (&RAG.TextChunker{Size: 100, Overlap: -1}).Chunk(RAG.Document{Content: strings.Repeat("x", 250)})
+	if len(long) != 3 {
+		t.Errorf("expected a long word to be cut into 3 chunks, got %d", len(long))
+	}
+}
+
+func TestIngestorIsIdempotent(t *testing.T) {
+	store, err := RAG.NewLocalStore(RAG.METRIC_COSINE)
+	if err != nil {
+		t.Fatalf("failed to create local store: %v", err)
+	}
+	embedder := &batchEmbedder{}
+	ingestor := RAG.NewIngestor(embedder, store)
+	ingestor.BatchSize = 2
+
+	documents := []RAG.Document{
+		{SourceURL: "https://example.com/indexes", Content: "btree indexes\n\nbrin indexes\n\ngin indexes"},
+		{SourceURL: "https://example.com/vacuum", Content: "vacuum reclaims storage", Metadata: map[string]any{"title": "Vacuum"}},
+	}
+	ingestor.Chunker = &RAG.TextChunker{Size: 24, Overlap: -1}
+
+	result, err := ingestor.Ingest(context.Background(), "database-articles", documents)
+	if err != nil {
+		t.Fatalf("ingest failed: %v", err)
+	}
+	if result.Documents != 2 || result.Chunks != 4 || result.Upserted != 4 || result.Skipped != 0 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if fmt.Sprint(embedder.batches) != "[2 2]" {
+		t.Errorf("expected two batches of two, got %v", embedder.batches)
+	}
+
+	matches, err := store.Query(context.Background(), RAG.VectorQuery{Namespace: "database-articles", Vector: []float32{1, 2, 1}, TopK: 10})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	for _, match := range matches {
+		if match.MetadataString("content") == "" || match.MetadataString("source_url") == "" {
+			t.Errorf("chunk %s misses the content or source_url metadata: %v", match.ID, match.Metadata)
+		}
+		if match.ID == RAG.ChunkID("https://example.com/vacuum", "vacuum reclaims storage") && match.MetadataString("title") != "Vacuum" {
+			t.Errorf("the document metadata was not copied: %v", match.Metadata)
+		}
+	}
+
+	// a second run only writes the chunk that changed
+	documents[1].Content = "vacuum full"
+	result, err = ingestor.Ingest(context.Background(), "database-articles", documents)
+	if err != nil {
+		t.Fatalf("second ingest failed: %v", err)
+	}
+	if result.Upserted != 1 || result.Skipped != 3 {
+		t.Errorf("expected only the changed chunk to be written, got %+v", result)
+	}
+}
+
+func TestIngestorRemovesEditedChunks(t *testing.T) {
+	store := newTestLocalStore(t, RAG.METRIC_COSINE)
+	ingestor := RAG.NewIngestor(&batchEmbedder{}, store)
+	ingestor.Chunker = &RAG.TextChunker{Size: 64, Overlap: -1}
+	keywords := RAG.NewKeywordIndex()
+	ingestor.Keywords = keywords
+
+	documents := []RAG.Document{
+		{SourceURL: "https://example.com/vacuum", Content: "vacuum reclaims storage"},
+		{SourceURL: "https://example.com/indexes", Content: "btree indexes"},
+	}
+	if _, err := ingestor.Ingest(context.Background(), "database-articles", documents); err != nil {
+		t.Fatalf("ingest failed: %v", err)
+	}
+
+	// only the edited document is ingested again
+	edited := []RAG.Document{{SourceURL: "https://example.com/vacuum", Content: "vacuum full rewrites the table"}}
+	result, err := ingestor.Ingest(context.Background(), "database-articles", edited)
+	if err != nil {
+		t.Fatalf("second ingest failed: %v", err)
+	}
+	if result.Upserted != 1 || result.Removed != 1 {
+		t.Errorf("expected the new chunk to replace the old one, got %+v", result)
+	}
+
+	oldID := RAG.ChunkID("https://example.com/vacuum", "vacuum reclaims storage")
+	stored, err := store.Fetch(context.Background(), "database-articles", []string{
+		oldID,
+		RAG.ChunkID("https://example.com/vacuum", "vacuum full rewrites the table"),
+		RAG.ChunkID("https://example.com/indexes", "btree indexes"),
+	})
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if _, ok := stored[oldID]; ok {
+		t.Errorf("the chunk of the previous content is still stored")
+	}
+	if len(stored) != 2 {
+		t.Errorf("expected the new chunk and the other document to be stored, got %d records", len(stored))
+	}
+	for _, match := range keywords.Search("database-articles", "reclaims storage", 10) {
+		if match.ID == oldID {
+			t.Errorf("the keyword index still has the previous chunk")
+		}
+	}
+}
+
+func TestEngineIngestPersistsLocalStore(t *testing.T) {
+	server := newOllamaServer(t)
+	defer server.Close()
+
+	config := localConfig(t, server.URL, []RAG.VectorRecord{{ID: "seed", Values: []float32{1, 0, 0}}})
+	model, err := RAG.NewRAG(context.Background(), config)
+	if err != nil {
+		t.Fatalf("NewRAG failed: %v", err)
+	}
+	defer model.Close()
+	writer, ok := model.(RAG.IndexWriter)
+	if !ok {
+		t.Fatal("expected the engine to be an IndexWriter")
+	}
+
+	result, err := writer.Ingest(context.Background(), "database-articles", []RAG.Document{
+		{SourceURL: "https://example.com/a", Content: "partial indexes"},
+	})
+	if err != nil || result.Upserted != 1 {
+		t.Fatalf("ingest failed: %v %+v", err, result)
+	}
+	if err := writer.Upsert("schemas-json", []RAG.VectorRecord{{ID: "gym", Values: []float32{0, 1, 0}}}); err != nil {
+		t.Fatalf("upsert failed: %v", err)
+	}
+
+	reopened, err := RAG.OpenLocalStore(config.LocalStorePath, RAG.METRIC_COSINE)
+	if err != nil {
+		t.Fatalf("failed to reopen the store: %v", err)
+	}
+	records, _ := reopened.Fetch(context.Background(), "database-articles", []string{RAG.ChunkID("https://example.com/a", "partial indexes")})
+	if len(records) != 1 {
+		t.Errorf("the ingested chunk was not saved")
+	}
+	records, _ = reopened.Fetch(context.Background(), "schemas-json", []string{"gym"})
+	if len(records) != 1 {
+		t.Errorf("the upserted vector was not saved")
+	}
+}
+
+func TestEngineUpsertReadOnlyStore(t *testing.T) {
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, &fakeStore{}, &fakeLLM{})
+	if err := engine.Upsert("namespace", nil); !errors.Is(err, RAG.ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestLoadDocuments(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"guides/indexes.md":  "# Indexes",
+		"schemas/gym.json":   "{}",
+		"notes.bin":          "ignored",
+		".git/config":        "ignored",
+		"guides/tuning.html": "<p>tuning</p>",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	documents, err := RAG.LoadDirectory(root, "https://docs.example.com/")
+	if err != nil {
+		t.Fatalf("LoadDirectory failed: %v", err)
+	}
+	sources := map[string]string{}
+	for _, document := range documents {
+		sources[document.SourceURL] = document.ContentType
+	}
+	if len(sources) != 3 || sources["https://docs.example.com/guides/indexes.md"] != RAG.CONTENT_TYPE_MARKDOWN || sources["https://docs.example.com/guides/tuning.html"] != RAG.CONTENT_TYPE_HTML {
+		t.Errorf("unexpected documents: %v", sources)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, "<h1>article</h1>")
+	}))
+	defer server.Close()
+
+	fetched, err := RAG.FetchDocuments(context.Background(), []string{server.URL + "/article", server.URL + "/schema.json"}, 0)
+	if err != nil {
+		t.Fatalf("FetchDocuments failed: %v", err)
+	}
+	if fetched[0].ContentType != RAG.CONTENT_TYPE_HTML || fetched[1].ContentType != RAG.CONTENT_TYPE_JSON || fetched[0].Content != "<h1>article</h1>" {
+		t.Errorf("unexpected documents: %+v", fetched)
+	}
+	var statusErr *RAG.HTTPStatusError
+	if _, err := RAG.FetchDocuments(context.Background(), []string{server.URL + "/missing"}, 0); !errors.As(err, &statusErr) {
+		t.Errorf("expected an HTTP error, got %v", err)
+	}
+}
+
+func TestOpenAIEmbedBatchKeepsOrder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the embeddings are returned out of order
+		fmt.Fprint(w, `{"data": [{"index": 1, "embedding": [2]}, {"index": 0, "embedding": [1]}]}`)
+	}))
+	defer server.Close()
+
+	embedder := &RAG.OpenAIEmbedder{BaseURL: server.URL, Model: "embed-test"}
+	embeddings, err := embedder.EmbedBatch(context.Background(), []string{"first", "second"})
+	if err != nil {
+		t.Fatalf("EmbedBatch failed: %v", err)
+	}
+	if embeddings[0][0] != 1 || embeddings[1][0] != 2 {
+		t.Errorf("embeddings are out of order: %v", embeddings)
+	}
+}
@@ -0,0 +1,345 @@
+package RAG
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	// BM25_K1 saturates the term frequency, BM25_B normalizes it by the length of the document
+	BM25_K1 = 1.2
+	BM25_B  = 0.75
+)
+
+// KeywordIndex is a BM25 index over the content metadata of the vectors of every namespace
+// it finds the exact tokens an embedding blurs, like pg_stat_statements, BRIN or an error code
+// the index is saved to a JSON file and reloaded when another process changed it, a nil index holds nothing
+// the namespaces changed since the last save are kept on reload, the others are taken from the file
+type KeywordIndex struct {
+	path string
+
+	mu         sync.RWMutex
+	modTime    time.Time
+	size       int64
+	namespaces map[string]*keywordNamespace
+	// dirty holds the namespaces changed since the index was last saved
+	dirty map[string]bool
+}
+
+type keywordNamespace struct {
+	documents map[string]*keywordDocument
+	// postings maps every term to the documents it appears in and its frequency there
+	postings    map[string]map[string]int
+	totalLength int
+}
+
+type keywordDocument struct {
+	terms    map[string]int
+	length   int
+	metadata map[string]any
+}
+
+// NewKeywordIndex creates an index that only lives in memory
+func NewKeywordIndex() *KeywordIndex {
+	return &KeywordIndex{namespaces: make(map[string]*keywordNamespace), dirty: make(map[string]bool)}
+}
+
+// OpenKeywordIndex loads the index saved at path, a missing file means an empty index
+func OpenKeywordIndex(path string) (*KeywordIndex, error) {
+	index := NewKeywordIndex()
+	index.path = path
+	if err := index.reload(); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// Persistent reports whether the index is saved to a file
+func (k *KeywordIndex) Persistent() bool {
+	return k != nil && k.path != ""
+}
+
+// Add indexes the content metadata of the records, a record without content is removed from the index
+func (k *KeywordIndex) Add(namespace string, records []VectorRecord) {
+	if k == nil || len(records) == 0 {
+		return
+	}
+	k.refresh()
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.dirty[namespace] = true
+	ns := k.namespaceLocked(namespace)
+	for _, record := range records {
+		ns.remove(record.ID)
+		content, _ := record.Metadata["content"].(string)
+		if strings.TrimSpace(content) == "" {
+			continue
+		}
+		ns.add(record.ID, content, maps.Clone(record.Metadata))
+	}
+}
+
+// Remove drops the documents from the index
+func (k *KeywordIndex) Remove(namespace string, ids []string) {
+	if k == nil {
+		return
+	}
+	k.refresh()
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if ns, ok := k.namespaces[namespace]; ok {
+		k.dirty[namespace] = true
+		for _, id := range ids {
+			ns.remove(id)
+		}
+	}
+}
+
+// DeleteNamespace drops every document of the namespace
+func (k *KeywordIndex) DeleteNamespace(namespace string) {
+	if k == nil {
+		return
+	}
+	k.refresh()
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.dirty[namespace] = true
+	delete(k.namespaces, namespace)
+}
+
+// Len returns the number of documents indexed in the namespace
+func (k *KeywordIndex) Len(namespace string) int {
+	if k == nil {
+		return 0
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if ns, ok := k.namespaces[namespace]; ok {
+		return len(ns.documents)
+	}
+	return 0
+}
+
+// Search returns the topK documents of the namespace with the best BM25 score for the query
+func (k *KeywordIndex) Search(namespace string, query string, topK int) []VectorMatch {
+	if k == nil {
+		return nil
+	}
+	k.refresh()
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	ns, ok := k.namespaces[namespace]
+	if !ok || len(ns.documents) == 0 {
+		return nil
+	}
+
+	documents := float64(len(ns.documents))
+	averageLength := float64(ns.totalLength) / documents
+	scores := make(map[string]float64)
+	for term := range tokenSet(query) {
+		postings := ns.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		frequency := float64(len(postings))
+		idf := math.Log(1 + (documents-frequency+0.5)/(frequency+0.5))
+		for id, count := range postings {
+			tf := float64(count)
+			length := float64(ns.documents[id].length)
+			scores[id] += idf * tf * (BM25_K1 + 1) / (tf + BM25_K1*(1-BM25_B+BM25_B*length/averageLength))
+		}
+	}
+
+	matches := make([]VectorMatch, 0, len(scores))
+	for id, score := range scores {
+		matches = append(matches, VectorMatch{ID: id, Score: float32(score), Metadata: maps.Clone(ns.documents[id].metadata)})
+	}
+	sortMatches(matches)
+	if topK > 0 && len(matches) > topK {
+		matches = matches[:topK]
+	}
+	return matches
+}
+
+// Save writes the index to its file, an index without a file is not saved
+// the namespaces another process saved in the meantime are reloaded first so they are kept
+func (k *KeywordIndex) Save() error {
+	if !k.Persistent() {
+		return nil
+	}
+	if err := k.reload(); err != nil {
+		return err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	// only the metadata is saved, the terms are tokenized again when the index is loaded
+	saved := make(map[string]map[string]map[string]any, len(k.namespaces))
+	for name, ns := range k.namespaces {
+		documents := make(map[string]map[string]any, len(ns.documents))
+		for id, document := range ns.documents {
+			documents[id] = document.metadata
+		}
+		saved[name] = documents
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(k.path), filepath.Base(k.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), k.path); err != nil {
+		return err
+	}
+	if info, err := os.Stat(k.path); err == nil {
+		k.modTime, k.size = info.ModTime(), info.Size()
+	}
+	clear(k.dirty)
+	return nil
+}
+
+// refresh reloads the index and keeps the one in memory when that fails
+func (k *KeywordIndex) refresh() {
+	if err := k.reload(); err != nil {
+		log.Printf("WARNING: Failed to reload the keyword index, using the previous one: %v", err)
+	}
+}
+
+// reload reads the file again when it changed since it was last read or saved
+// the namespaces with unsaved changes are kept as they are
+func (k *KeywordIndex) reload() error {
+	if k.path == "" {
+		return nil
+	}
+	info, err := os.Stat(k.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	k.mu.RLock()
+	// the size catches the writes that fall within the resolution of the modification time
+	current := info.ModTime().Equal(k.modTime) && info.Size() == k.size
+	k.mu.RUnlock()
+	if current {
+		return nil
+	}
+
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return err
+	}
+	saved := make(map[string]map[string]map[string]any)
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("failed to decode the keyword index %s: %w", k.path, err)
+	}
+	namespaces := make(map[string]*keywordNamespace, len(saved))
+	for name, documents := range saved {
+		ns := newKeywordNamespace()
+		for id, metadata := range documents {
+			content, _ := metadata["content"].(string)
+			ns.add(id, content, metadata)
+		}
+		namespaces[name] = ns
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	// the unsaved changes win over the file
+	for name := range k.dirty {
+		if ns, ok := k.namespaces[name]; ok {
+			namespaces[name] = ns
+		} else {
+			delete(namespaces, name)
+		}
+	}
+	k.namespaces = namespaces
+	k.modTime, k.size = info.ModTime(), info.Size()
+	return nil
+}
+
+func (k *KeywordIndex) namespaceLocked(namespace string) *keywordNamespace {
+	ns, ok := k.namespaces[namespace]
+	if !ok {
+		ns = newKeywordNamespace()
+		k.namespaces[namespace] = ns
+	}
+	return ns
+}
+
+func newKeywordNamespace() *keywordNamespace {
+	return &keywordNamespace{
+		documents: make(map[string]*keywordDocument),
+		postings:  make(map[string]map[string]int),
+	}
+}
+
+func (ns *keywordNamespace) add(id string, content string, metadata map[string]any) {
+	document := &keywordDocument{terms: make(map[string]int), metadata: metadata}
+	for _, token := range tokenize(content) {
+		document.terms[token]++
+		document.length++
+	}
+	for term, count := range document.terms {
+		if ns.postings[term] == nil {
+			ns.postings[term] = make(map[string]int)
+		}
+		ns.postings[term][id] = count
+	}
+	ns.documents[id] = document
+	ns.totalLength += document.length
+}
+
+func (ns *keywordNamespace) remove(id string) {
+	document, ok := ns.documents[id]
+	if !ok {
+		return
+	}
+	for term := range document.terms {
+		delete(ns.postings[term], id)
+		if len(ns.postings[term]) == 0 {
+			delete(ns.postings, term)
+		}
+	}
+	ns.totalLength -= document.length
+	delete(ns.documents, id)
+}
+
+// tokenize lowercases the text and splits it on everything but letters, digits and underscores
+// so that identifiers like pg_stat_statements stay a single token
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+}
+
+func tokenSet(text string) map[string]bool {
+	set := make(map[string]bool)
+	for _, token := range tokenize(text) {
+		set[token] = true
+	}
+	return set
+}
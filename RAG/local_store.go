@@ -0,0 +1,512 @@
+package RAG
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+)
+
+const (
+	METRIC_COSINE      = "cosine"
+	METRIC_DOT_PRODUCT = "dotproduct"
+
+	LOCAL_SNAPSHOT_VERSION = 1
+)
+
+// LocalStore is an in-process VectorStore that keeps namespaced vectors in memory
+// and can persist them to a snapshot file on disk
+type LocalStore struct {
+	mu         sync.RWMutex
+	metric     string
+	path       string
+	hnsw       *HNSWConfig
+	namespaces map[string]*localNamespace
+	// metricSet is false when the metric is the default one, a snapshot may then bring its own
+	metricSet bool
+	// hnswSet is false when the search was not configured, a snapshot may then bring its own
+	hnswSet bool
+}
+
+type localNamespace struct {
+	dimension int
+	records   map[string]*localRecord
+	// index is the optional ANN index, nil means brute-force scoring
+	index *HNSWIndex
+}
+
+type localRecord struct {
+	VectorRecord
+	norm float32
+}
+
+// localSnapshot is the on-disk format of a LocalStore
+type localSnapshot struct {
+	Version    int                       `json:"version"`
+	Metric     string                    `json:"metric"`
+	Namespaces map[string][]VectorRecord `json:"namespaces"`
+	HNSW       *HNSWConfig               `json:"hnsw,omitempty"`
+	Graphs     map[string]HNSWSnapshot   `json:"graphs,omitempty"`
+}
+
+// NewLocalStore creates an empty in-memory store using the given similarity metric
+func NewLocalStore(metric string) (*LocalStore, error) {
+	metricSet := metric != ""
+	if metric == "" {
+		metric = METRIC_COSINE
+	}
+	if metric != METRIC_COSINE && metric != METRIC_DOT_PRODUCT {
+		return nil, fmt.Errorf("unsupported metric: %s", metric)
+	}
+	return &LocalStore{
+		metric:     metric,
+		metricSet:  metricSet,
+		namespaces: make(map[string]*localNamespace),
+	}, nil
+}
+
+// OpenLocalStore creates a store backed by the snapshot file at path
+// the snapshot is loaded when the file exists and Save writes back to it,
+// a snapshot written with another metric than the given one is an ErrInvalidConfig error
+func OpenLocalStore(path string, metric string) (*LocalStore, error) {
+	store, err := NewLocalStore(metric)
+	if err != nil {
+		return nil, err
+	}
+	store.path = path
+	if err := store.Load(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return store, nil
+}
+
+// OpenLocalStoreWithHNSW is OpenLocalStore with a configured search, nil is brute-force scoring
+// the HNSW setting of the snapshot is ignored and its graphs are only restored when they were built with the same config
+func OpenLocalStoreWithHNSW(path string, metric string, hnsw *HNSWConfig) (*LocalStore, error) {
+	store, err := NewLocalStore(metric)
+	if err != nil {
+		return nil, err
+	}
+	store.path = path
+	store.hnswSet = true
+	if hnsw != nil {
+		config := hnsw.withDefaults()
+		store.hnsw = &config
+	}
+	if err := store.Load(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return store, nil
+}
+
+// EnableHNSW switches the store from brute-force scoring to HNSW approximate search
+// the index of every existing namespace is built right away
+func (s *LocalStore) EnableHNSW(config HNSWConfig) {
+	config = config.withDefaults()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hnswSet = true
+	if s.hnsw != nil && *s.hnsw == config {
+		return
+	}
+	s.hnsw = &config
+	for _, ns := range s.namespaces {
+		s.buildIndex(ns)
+	}
+}
+
+// buildIndex creates the HNSW index of the namespace from its records
+func (s *LocalStore) buildIndex(ns *localNamespace) {
+	ns.index = NewHNSWIndex(*s.hnsw, s.metric)
+	ids := make([]string, 0, len(ns.records))
+	for id := range ns.records {
+		ids = append(ids, id)
+	}
+	// insert in a stable order so that the same records always build the same graph
+	sort.Strings(ids)
+	for _, id := range ids {
+		ns.index.Insert(id, ns.records[id].Values)
+	}
+}
+
+// Upsert inserts or replaces the vectors in the namespace
+func (s *LocalStore) Upsert(ctx context.Context, namespace string, vectors []VectorRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.upsertLocked(namespace, vectors)
+}
+
+func (s *LocalStore) upsertLocked(namespace string, vectors []VectorRecord) error {
+	ns, ok := s.namespaces[namespace]
+	if !ok {
+		ns = &localNamespace{records: make(map[string]*localRecord)}
+		if s.hnsw != nil {
+			ns.index = NewHNSWIndex(*s.hnsw, s.metric)
+		}
+	}
+	for _, vector := range vectors {
+		if vector.ID == "" {
+			return errors.New("vector id is required")
+		}
+		if len(vector.Values) == 0 {
+			return fmt.Errorf("vector %s has no values", vector.ID)
+		}
+		if ns.dimension == 0 {
+			ns.dimension = len(vector.Values)
+		}
+		if len(vector.Values) != ns.dimension {
+			return fmt.Errorf("vector %s has dimension %d but namespace %s has dimension %d", vector.ID, len(vector.Values), namespace, ns.dimension)
+		}
+	}
+	for _, vector := range vectors {
+		ns.records[vector.ID] = &localRecord{
+			VectorRecord: VectorRecord{
+				ID:       vector.ID,
+				Values:   append([]float32(nil), vector.Values...),
+				Metadata: vector.Metadata,
+			},
+			norm: vectorNorm(vector.Values),
+		}
+		if ns.index != nil {
+			ns.index.Insert(vector.ID, vector.Values)
+		}
+	}
+	s.namespaces[namespace] = ns
+	return nil
+}
+
+// Fetch returns the records with the given ids
+func (s *LocalStore) Fetch(ctx context.Context, namespace string, ids []string) (map[string]VectorRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make(map[string]VectorRecord, len(ids))
+	ns, ok := s.namespaces[namespace]
+	if !ok {
+		return records, nil
+	}
+	for _, id := range ids {
+		if record, ok := ns.records[id]; ok {
+			records[id] = record.VectorRecord
+		}
+	}
+	return records, nil
+}
+
+// ListIDs implements the VectorLister interface
+func (s *LocalStore) ListIDs(ctx context.Context, namespace string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := []string{}
+	if ns, ok := s.namespaces[namespace]; ok {
+		for id := range ns.records {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Stats implements the StatsReporter interface, the name of the index is the snapshot path
+func (s *LocalStore) Stats(ctx context.Context) (IndexStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := IndexStats{Name: s.path, Metric: s.metric, Status: "Ready", Namespaces: []NamespaceStats{}}
+	for name, ns := range s.namespaces {
+		stats.Dimension = ns.dimension
+		stats.TotalVectorCount += len(ns.records)
+		stats.Namespaces = append(stats.Namespaces, NamespaceStats{Name: name, VectorCount: len(ns.records)})
+	}
+	sortNamespaces(stats.Namespaces)
+	return stats, nil
+}
+
+// Delete implements the VectorWriter interface
+func (s *LocalStore) Delete(ctx context.Context, namespace string, ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ns, ok := s.namespaces[namespace]
+	if !ok {
+		return nil
+	}
+	for _, id := range ids {
+		delete(ns.records, id)
+		if ns.index != nil {
+			ns.index.Delete(id)
+		}
+	}
+	return nil
+}
+
+// DeleteNamespace removes the namespace and all of its vectors
+func (s *LocalStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.namespaces, namespace)
+	return nil
+}
+
+// Query returns the topK vectors of the namespace most similar to the query vector
+// it searches the HNSW index when enabled and scores every vector otherwise
+func (s *LocalStore) Query(ctx context.Context, query VectorQuery) ([]VectorMatch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ns, ok := s.namespaces[query.Namespace]
+	if !ok || query.TopK <= 0 {
+		return []VectorMatch{}, nil
+	}
+	if len(query.Vector) != ns.dimension {
+		return nil, fmt.Errorf("query vector has dimension %d but namespace %s has dimension %d", len(query.Vector), query.Namespace, ns.dimension)
+	}
+
+	if len(query.Filter) > 0 {
+		if err := query.Filter.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	queryNorm := vectorNorm(query.Vector)
+	// the approximate index cannot skip the filtered vectors, a filtered query scans them all
+	if ns.index != nil && len(query.Filter) == 0 {
+		results := ns.index.Search(query.Vector, query.TopK)
+		matches := make([]VectorMatch, 0, len(results))
+		for _, result := range results {
+			record := ns.records[result.ID]
+			matches = append(matches, s.match(query, queryNorm, record))
+		}
+		sortMatches(matches)
+		return cloneValues(matches), nil
+	}
+
+	matches := make([]VectorMatch, 0, len(ns.records))
+	for _, record := range ns.records {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if len(query.Filter) > 0 && !query.Filter.Matches(record.Metadata) {
+			continue
+		}
+		matches = append(matches, s.match(query, queryNorm, record))
+	}
+	sortMatches(matches)
+	if len(matches) > query.TopK {
+		matches = matches[:query.TopK]
+	}
+	return cloneValues(matches), nil
+}
+
+// cloneValues copies the values of the returned matches so that a caller cannot change the stored vectors
+func cloneValues(matches []VectorMatch) []VectorMatch {
+	for index := range matches {
+		if matches[index].Values != nil {
+			matches[index].Values = slices.Clone(matches[index].Values)
+		}
+	}
+	return matches
+}
+
+// match scores a stored record for the query
+func (s *LocalStore) match(query VectorQuery, queryNorm float32, record *localRecord) VectorMatch {
+	match := VectorMatch{
+		ID:       record.ID,
+		Score:    s.score(query.Vector, queryNorm, record),
+		Metadata: record.Metadata,
+	}
+	if query.IncludeValues {
+		// shared until the matches are cut to the topK, see cloneValues
+		match.Values = record.Values
+	}
+	return match
+}
+
+// score computes the similarity between the query and a stored record
+func (s *LocalStore) score(query []float32, queryNorm float32, record *localRecord) float32 {
+	dot := dotProduct(query, record.Values)
+	if s.metric == METRIC_DOT_PRODUCT {
+		return dot
+	}
+	if queryNorm == 0 || record.norm == 0 {
+		return 0
+	}
+	return dot / (queryNorm * record.norm)
+}
+
+// Dimension returns the dimension shared by all the namespaces, 0 when the store is empty
+func (s *LocalStore) Dimension(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	dimension := 0
+	for name, ns := range s.namespaces {
+		if dimension != 0 && ns.dimension != dimension {
+			return 0, fmt.Errorf("%w: namespace %s has dimension %d but other namespaces have %d", ErrDimensionMismatch, name, ns.dimension, dimension)
+		}
+		dimension = ns.dimension
+	}
+	return dimension, nil
+}
+
+// Save writes a snapshot of the store to the path it was opened with
+func (s *LocalStore) Save() error {
+	if s.path == "" {
+		return errors.New("local store was not opened with a snapshot path")
+	}
+	return s.SaveTo(s.path)
+}
+
+// SaveTo writes a snapshot of the store to path
+// the snapshot is written to a temporary file first so a crash never leaves a partial file
+func (s *LocalStore) SaveTo(path string) error {
+	s.mu.RLock()
+	snapshot := localSnapshot{
+		Version:    LOCAL_SNAPSHOT_VERSION,
+		Metric:     s.metric,
+		Namespaces: make(map[string][]VectorRecord, len(s.namespaces)),
+		HNSW:       s.hnsw,
+	}
+	for name, ns := range s.namespaces {
+		if ns.index != nil {
+			if snapshot.Graphs == nil {
+				snapshot.Graphs = make(map[string]HNSWSnapshot)
+			}
+			snapshot.Graphs[name] = ns.index.Snapshot()
+		}
+		records := make([]VectorRecord, 0, len(ns.records))
+		for _, record := range ns.records {
+			records = append(records, record.VectorRecord)
+		}
+		sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+		snapshot.Namespaces[name] = records
+	}
+	s.mu.RUnlock()
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	// the temporary file is private, the snapshot keeps the mode of the file it replaces
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load replaces the content of the store with the snapshot at path
+func (s *LocalStore) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var snapshot localSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to decode snapshot %s: %w", path, err)
+	}
+	if snapshot.Version != LOCAL_SNAPSHOT_VERSION {
+		return fmt.Errorf("unsupported snapshot version %d in %s", snapshot.Version, path)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	metric := s.metric
+	if snapshot.Metric != "" && snapshot.Metric != s.metric {
+		// the scores of the stored vectors depend on the metric so a configured one is never switched
+		if s.metricSet {
+			return fmt.Errorf("%w: snapshot %s uses the %s metric but the store is configured with %s", ErrInvalidConfig, path, snapshot.Metric, s.metric)
+		}
+		if snapshot.Metric != METRIC_COSINE && snapshot.Metric != METRIC_DOT_PRODUCT {
+			return fmt.Errorf("unsupported metric %s in %s", snapshot.Metric, path)
+		}
+		metric = snapshot.Metric
+	}
+	// a configured search is kept, the snapshot only brings its own when the store has none
+	hnsw := s.hnsw
+	if !s.hnswSet {
+		hnsw = snapshot.HNSW
+	}
+
+	// the new state is built aside and only replaces the current one when the whole snapshot loaded
+	// the records are loaded first without an index, the graphs are restored afterwards
+	loaded := &LocalStore{metric: metric, namespaces: make(map[string]*localNamespace, len(snapshot.Namespaces))}
+	for name, records := range snapshot.Namespaces {
+		if err := loaded.upsertLocked(name, records); err != nil {
+			return fmt.Errorf("failed to load snapshot %s: %w", path, err)
+		}
+	}
+	loaded.hnsw = hnsw
+	if hnsw != nil {
+		for name, ns := range loaded.namespaces {
+			graph, ok := snapshot.Graphs[name]
+			if !ok || snapshot.HNSW == nil || *snapshot.HNSW != *hnsw {
+				loaded.buildIndex(ns)
+				continue
+			}
+			index, err := RestoreHNSWIndex(graph, func(id string) ([]float32, bool) {
+				record, ok := ns.records[id]
+				if !ok {
+					return nil, false
+				}
+				return record.Values, true
+			})
+			if err != nil || index.Len() != len(ns.records) {
+				// a graph that does not match its records is rebuilt instead of failing the load
+				log.Printf("WARNING: rebuilding the HNSW index of namespace %s from its records", name)
+				loaded.buildIndex(ns)
+				continue
+			}
+			ns.index = index
+		}
+	}
+
+	s.metric = loaded.metric
+	s.hnsw = loaded.hnsw
+	s.namespaces = loaded.namespaces
+	return nil
+}
+
+// sortMatches orders matches by descending score and breaks ties by id
+func sortMatches(matches []VectorMatch) {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ID < matches[j].ID
+	})
+}
+
+func dotProduct(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func vectorNorm(v []float32) float32 {
+	return float32(math.Sqrt(float64(dotProduct(v, v))))
+}
@@ -0,0 +1,177 @@
+package RAG_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+func newTestLocalStore(t *testing.T, metric string) *RAG.LocalStore {
+	t.Helper()
+	store, err := RAG.NewLocalStore(metric)
+	if err != nil {
+		t.Fatalf("failed to create local store: %v", err)
+	}
+	err = store.Upsert(context.Background(), "database-articles", []RAG.VectorRecord{
+		{ID: "x", Values: []float32{1, 0, 0}, Metadata: map[string]any{"content": "x axis"}},
+		{ID: "y", Values: []float32{0, 2, 0}, Metadata: map[string]any{"content": "y axis"}},
+		{ID: "xy", Values: []float32{1, 1, 0}, Metadata: map[string]any{"content": "diagonal"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to upsert vectors: %v", err)
+	}
+	return store
+}
+
+func TestLocalStoreCosineQuery(t *testing.T) {
+	store := newTestLocalStore(t, RAG.METRIC_COSINE)
+
+	matches, err := store.Query(context.Background(), RAG.VectorQuery{
+		Namespace: "database-articles",
+		Vector:    []float32{1, 0.1, 0},
+		TopK:      2,
+	})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(matches) != 2 || matches[0].ID != "x" || matches[1].ID != "xy" {
+		t.Fatalf("unexpected matches: %+v", matches)
+	}
+	if matches[0].MetadataString("content") != "x axis" {
+		t.Errorf("metadata was not returned: %+v", matches[0].Metadata)
+	}
+}
+
+func TestLocalStoreDotProductQuery(t *testing.T) {
+	store := newTestLocalStore(t, RAG.METRIC_DOT_PRODUCT)
+
+	matches, err := store.Query(context.Background(), RAG.VectorQuery{
+		Namespace: "database-articles",
+		Vector:    []float32{0, 1, 0},
+		TopK:      1,
+	})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(matches) != 1 || matches[0].ID != "y" || matches[0].Score != 2 {
+		t.Fatalf("unexpected matches: %+v", matches)
+	}
+}
+
+func TestLocalStoreRejectsDimensionMismatch(t *testing.T) {
+	store := newTestLocalStore(t, RAG.METRIC_COSINE)
+
+	err := store.Upsert(context.Background(), "database-articles", []RAG.VectorRecord{
+		{ID: "z", Values: []float32{1, 2}},
+	})
+	if err == nil {
+		t.Fatal("expected an error when upserting a vector with the wrong dimension")
+	}
+	if _, err := store.Query(context.Background(), RAG.VectorQuery{Namespace: "database-articles", Vector: []float32{1}, TopK: 1}); err == nil {
+		t.Fatal("expected an error when querying with the wrong dimension")
+	}
+}
+
+func TestLocalStoreSnapshotRoundTrip(t *testing.T) {
+	store := newTestLocalStore(t, RAG.METRIC_COSINE)
+	if err := store.Delete(context.Background(), "database-articles", []string{"y"}); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "vectors.json")
+	if err := store.SaveTo(path); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	loaded, err := RAG.OpenLocalStore(path, "")
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	matches, err := loaded.Query(context.Background(), RAG.VectorQuery{
+		Namespace: "database-articles",
+		Vector:    []float32{0, 1, 0},
+		TopK:      10,
+	})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(matches) != 2 || matches[0].ID != "xy" {
+		t.Fatalf("unexpected matches after reload: %+v", matches)
+	}
+}
+
+func TestLocalStoreSnapshotMetric(t *testing.T) {
+	store := newTestLocalStore(t, RAG.METRIC_DOT_PRODUCT)
+	path := filepath.Join(t.TempDir(), "vectors.json")
+	if err := store.SaveTo(path); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	if _, err := RAG.OpenLocalStore(path, RAG.METRIC_COSINE); !errors.Is(err, RAG.ErrInvalidConfig) {
+		t.Errorf("expected a metric mismatch to be an invalid config, got %v", err)
+	}
+	// without a configured metric the one of the snapshot is used
+	loaded, err := RAG.OpenLocalStore(path, "")
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	stats, err := loaded.Stats(context.Background())
+	if err != nil || stats.Metric != RAG.METRIC_DOT_PRODUCT {
+		t.Errorf("expected the snapshot metric, got %+v %v", stats, err)
+	}
+}
+
+func TestOpenLocalStoreWithoutSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.json")
+	store, err := RAG.OpenLocalStore(path, RAG.METRIC_COSINE)
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if err := store.Save(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+}
+
+func TestLocalStoreLoadKeepsStateOnError(t *testing.T) {
+	store := newTestLocalStore(t, RAG.METRIC_COSINE)
+	path := filepath.Join(t.TempDir(), "vectors.json")
+	snapshot := `{"version": 1, "metric": "cosine", "namespaces": {"database-articles": [` +
+		`{"id": "a", "values": [1, 0, 0]}, {"id": "b", "values": [1, 0]}]}}`
+	if err := os.WriteFile(path, []byte(snapshot), 0644); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+
+	if err := store.Load(path); err == nil {
+		t.Fatal("expected a snapshot with mixed dimensions to fail")
+	}
+	ids, err := store.ListIDs(context.Background(), "database-articles")
+	if err != nil || len(ids) != 3 {
+		t.Errorf("expected the failed load to keep the 3 vectors, got %v %v", ids, err)
+	}
+}
+
+func TestLocalStoreSaveToMode(t *testing.T) {
+	store := newTestLocalStore(t, RAG.METRIC_COSINE)
+	path := filepath.Join(t.TempDir(), "vectors.json")
+	if err := store.SaveTo(path); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0644 {
+		t.Fatalf("expected a new snapshot to be readable by others, got %v %v", info.Mode(), err)
+	}
+
+	// an existing snapshot keeps its mode
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatalf("chmod failed: %v", err)
+	}
+	if err := store.SaveTo(path); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the snapshot to keep its mode, got %v %v", info.Mode(), err)
+	}
+}
@@ -0,0 +1,331 @@
+package RAG
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	DEFAULT_CHUNK_TOKENS         = 400
+	DEFAULT_CHUNK_OVERLAP_TOKENS = 50
+	BREADCRUMB_SEPARATOR         = " > "
+)
+
+var headingPattern = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+
+// MarkdownChunker splits markdown and HTML documents on their heading structure
+// every chunk stays within one section and carries the headings above it as the breadcrumb metadata,
+// fenced code blocks are never split so SQL examples stay whole even when they exceed the chunk size
+type MarkdownChunker struct {
+	// MaxTokens is the size of a chunk, defaults to DEFAULT_CHUNK_TOKENS
+	MaxTokens int
+	// OverlapTokens is the size of the text repeated from the previous chunk of the same section,
+	// defaults to DEFAULT_CHUNK_OVERLAP_TOKENS, a negative value disables it
+	OverlapTokens int
+}
+
+// markdownBlock is a paragraph, a heading or a fenced code block
+type markdownBlock struct {
+	text    string
+	heading int
+	code    bool
+}
+
+func (c *MarkdownChunker) Chunk(document Document) []Chunk {
+	maxTokens := c.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = DEFAULT_CHUNK_TOKENS
+	}
+	overlap := c.OverlapTokens
+	if overlap == 0 {
+		overlap = DEFAULT_CHUNK_OVERLAP_TOKENS
+	}
+	if overlap < 0 || overlap >= maxTokens {
+		overlap = 0
+	}
+
+	content := document.Content
+	if document.ContentType == CONTENT_TYPE_HTML {
+		content = htmlToMarkdown(content)
+	}
+
+	chunks := []Chunk{}
+	headings := make([]string, 6)
+	section := []markdownBlock{}
+	breadcrumb := ""
+
+	flush := func() {
+		// a heading directly followed by a sub heading has no content of its own
+		if len(section) == 1 && section[0].heading > 0 {
+			section = section[:0]
+			return
+		}
+		for _, text := range packBlocks(section, maxTokens, overlap) {
+			chunk := Chunk{Content: text, Index: len(chunks)}
+			if breadcrumb != "" {
+				chunk.Metadata = map[string]any{"breadcrumb": breadcrumb}
+			}
+			chunks = append(chunks, chunk)
+		}
+		section = section[:0]
+	}
+
+	for _, block := range parseMarkdownBlocks(content) {
+		if block.heading > 0 {
+			flush()
+			headings[block.heading-1] = headingPattern.FindStringSubmatch(block.text)[2]
+			clear(headings[block.heading:])
+			breadcrumb = joinBreadcrumb(headings[:block.heading])
+		}
+		section = append(section, block)
+	}
+	flush()
+	return chunks
+}
+
+// parseMarkdownBlocks splits markdown into headings, paragraphs and fenced code blocks
+// the fences are found line by line so that ~~~ fences and the indented fences of list items are kept whole,
+// a fence that is never closed runs to the end of the document
+func parseMarkdownBlocks(content string) []markdownBlock {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	blocks := []markdownBlock{}
+	text := []string{}
+	code := []string{}
+	var fence byte
+	fenceLength := 0
+	for _, line := range strings.Split(content, "\n") {
+		if fence == 0 {
+			if char, length, _ := markdownFence(line); char != 0 {
+				blocks = append(blocks, parseTextBlocks(strings.Join(text, "\n"))...)
+				text = text[:0]
+				fence, fenceLength = char, length
+				code = append(code[:0], line)
+			} else {
+				text = append(text, line)
+			}
+			continue
+		}
+		code = append(code, line)
+		// a closing fence uses the same character, is at least as long and has no info string
+		if char, length, info := markdownFence(line); char == fence && length >= fenceLength && info == "" {
+			blocks = append(blocks, markdownBlock{text: strings.Join(code, "\n"), code: true})
+			fence = 0
+		}
+	}
+	if fence != 0 {
+		blocks = append(blocks, markdownBlock{text: strings.TrimRight(strings.Join(code, "\n"), "\n"), code: true})
+	}
+	return append(blocks, parseTextBlocks(strings.Join(text, "\n"))...)
+}
+
+// markdownFence returns the character, the length and the info string of a code fence line,
+// the character is 0 when the line is not a fence
+func markdownFence(line string) (byte, int, string) {
+	trimmed := strings.TrimLeft(line, " \t")
+	if len(trimmed) < 3 || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return 0, 0, ""
+	}
+	length := 0
+	for length < len(trimmed) && trimmed[length] == trimmed[0] {
+		length++
+	}
+	info := strings.TrimSpace(trimmed[length:])
+	// a backtick in the info string makes the line inline code
+	if length < 3 || (trimmed[0] == '`' && strings.Contains(info, "`")) {
+		return 0, 0, ""
+	}
+	return trimmed[0], length, info
+}
+
+// parseTextBlocks splits markdown without code blocks into headings and paragraphs
+func parseTextBlocks(text string) []markdownBlock {
+	blocks := []markdownBlock{}
+	paragraph := []string{}
+	flush := func() {
+		if joined := strings.TrimSpace(strings.Join(paragraph, "\n")); joined != "" {
+			blocks = append(blocks, markdownBlock{text: joined})
+		}
+		paragraph = paragraph[:0]
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if match := headingPattern.FindStringSubmatch(trimmed); match != nil {
+			flush()
+			blocks = append(blocks, markdownBlock{text: trimmed, heading: len(match[1])})
+			continue
+		}
+		if trimmed == "" {
+			flush()
+			continue
+		}
+		paragraph = append(paragraph, line)
+	}
+	flush()
+	return blocks
+}
+
+// packBlocks joins the blocks of a section into chunks of at most maxTokens
+// the blocks at the end of a chunk that fit in overlap tokens are repeated at the start of the next one
+func packBlocks(blocks []markdownBlock, maxTokens int, overlap int) []string {
+	// paragraphs larger than a chunk are split on whitespace, code blocks are kept whole
+	pieces := []markdownBlock{}
+	for _, block := range blocks {
+		if block.code || estimateTokens(block.text) <= maxTokens {
+			pieces = append(pieces, block)
+			continue
+		}
+		for _, part := range splitParagraphs(block.text, (maxTokens-overlap)*4) {
+			pieces = append(pieces, markdownBlock{text: part})
+		}
+	}
+
+	texts := []string{}
+	current := []markdownBlock{}
+	tokens := 0
+	// pending is set while current has blocks that are not part of a chunk yet
+	pending := false
+	emit := func() {
+		parts := make([]string, len(current))
+		for i, block := range current {
+			parts[i] = block.text
+		}
+		texts = append(texts, strings.Join(parts, "\n\n"))
+
+		// keep the trailing text blocks that fit in the overlap, never the whole chunk
+		keep := len(current)
+		kept := 0
+		for keep > 1 && !current[keep-1].code && kept+estimateTokens(current[keep-1].text) <= overlap {
+			kept += estimateTokens(current[keep-1].text)
+			keep--
+		}
+		current = append([]markdownBlock(nil), current[keep:]...)
+		tokens = kept
+		pending = false
+	}
+
+	for _, piece := range pieces {
+		pieceTokens := estimateTokens(piece.text)
+		if pending && tokens+pieceTokens > maxTokens {
+			emit()
+			// the overlap would make this piece exceed the chunk
+			if tokens+pieceTokens > maxTokens {
+				current = current[:0]
+				tokens = 0
+			}
+		}
+		current = append(current, piece)
+		tokens += pieceTokens
+		pending = true
+	}
+	if pending {
+		emit()
+	}
+	return texts
+}
+
+func joinBreadcrumb(headings []string) string {
+	parts := []string{}
+	for _, heading := range headings {
+		if heading != "" {
+			parts = append(parts, heading)
+		}
+	}
+	return strings.Join(parts, BREADCRUMB_SEPARATOR)
+}
+
+// the HTML elements that never carry article content
+var skippedHTMLElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "nav": true, "footer": true, "head": true, "svg": true, "form": true,
+}
+
+// the HTML elements that end a paragraph
+var blockHTMLElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true, "li": true, "tr": true,
+	"blockquote": true, "table": true, "ul": true, "ol": true, "dl": true, "dt": true, "dd": true, "br": true,
+}
+
+// htmlToMarkdown keeps the headings, paragraphs and code blocks of an HTML page as markdown
+func htmlToMarkdown(content string) string {
+	root, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return content
+	}
+
+	var out strings.Builder
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			out.WriteString(strings.Join(strings.Fields(node.Data), " "))
+			if strings.HasSuffix(node.Data, " ") || strings.HasSuffix(node.Data, "\n") {
+				out.WriteString(" ")
+			}
+			return
+		}
+		if node.Type == html.ElementNode {
+			name := node.Data
+			switch {
+			case skippedHTMLElements[name]:
+				return
+			case len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6':
+				out.WriteString("\n\n" + strings.Repeat("#", int(name[1]-'0')) + " " + strings.Join(strings.Fields(htmlText(node)), " ") + "\n\n")
+				return
+			case name == "pre":
+				out.WriteString("\n\n```" + codeLanguage(node) + "\n" + strings.Trim(htmlText(node), "\n") + "\n```\n\n")
+				return
+			case name == "code":
+				out.WriteString("`" + htmlText(node) + "`")
+				return
+			case blockHTMLElements[name]:
+				out.WriteString("\n\n")
+				defer out.WriteString("\n\n")
+			}
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(root)
+	return out.String()
+}
+
+// htmlText returns the raw text below an HTML node
+func htmlText(node *html.Node) string {
+	var out strings.Builder
+	var walk func(node *html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.TextNode {
+			out.WriteString(node.Data)
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(node)
+	return out.String()
+}
+
+// codeLanguage reads the language-* or lang-* class of a pre element or its code child
+func codeLanguage(node *html.Node) string {
+	for current := node; current != nil; current = current.FirstChild {
+		for _, attribute := range current.Attr {
+			if attribute.Key != "class" {
+				continue
+			}
+			for _, class := range strings.Fields(attribute.Val) {
+				for _, prefix := range []string{"language-", "lang-"} {
+					if language, ok := strings.CutPrefix(class, prefix); ok {
+						return strings.ToLower(language)
+					}
+				}
+			}
+		}
+		if current.FirstChild != nil && current.FirstChild.Type != html.ElementNode {
+			break
+		}
+	}
+	return ""
+}
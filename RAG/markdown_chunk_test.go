@@ -0,0 +1,127 @@
+package RAG_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+func TestMarkdownChunkerSplitsOnHeadings(t *testing.T) {
+	content := "# Indexes\n\nIndexes speed up reads.\n\n## B-tree\n\nThe default index type.\n\n## GIN\n\nFor arrays and jsonb.\n\n# Vacuum\n\nReclaims storage."
+	chunks := (&RAG.MarkdownChunker{}).Chunk(RAG.Document{Content: content, ContentType: RAG.CONTENT_TYPE_MARKDOWN})
+
+	expected := []struct {
+		breadcrumb string
+		content    string
+	}{
+		{"Indexes", "# Indexes\n\nIndexes speed up reads."},
+		{"Indexes > B-tree", "## B-tree\n\nThe default index type."},
+		{"Indexes > GIN", "## GIN\n\nFor arrays and jsonb."},
+		{"Vacuum", "# Vacuum\n\nReclaims storage."},
+	}
+	if len(chunks) != len(expected) {
+		t.Fatalf("expected %d chunks, got %+v", len(expected), chunks)
+	}
+	for i, chunk := range chunks {
+		if chunk.Content != expected[i].content || chunk.Metadata["breadcrumb"] != expected[i].breadcrumb || chunk.Index != i {
+			t.Errorf("chunk %d: got %q under %v", i, chunk.Content, chunk.Metadata["breadcrumb"])
+		}
+	}
+}
+
+func TestMarkdownChunkerKeepsCodeBlocks(t *testing.T) {
+	query := "```sql\nSELECT *\n\nFROM orders\n\nWHERE total > 100;\n```"
+	paragraphs := []string{"## Filtering"}
+	for i := 0; i < 6; i++ {
+		paragraphs = append(paragraphs, strings.Repeat("filter rows ", 8))
+		if i == 3 {
+			paragraphs = append(paragraphs, query)
+		}
+	}
+	chunker := &RAG.MarkdownChunker{MaxTokens: 60, OverlapTokens: 25}
+	chunks := chunker.Chunk(RAG.Document{Content: strings.Join(paragraphs, "\n\n")})
+
+	if len(chunks) < 3 {
+		t.Fatalf("expected the section to be split, got %d chunks", len(chunks))
+	}
+	found := 0
+	for i, chunk := range chunks {
+		if strings.Contains(chunk.Content, "SELECT") {
+			found++
+			if !strings.Contains(chunk.Content, query) {
+				t.Errorf("the code block was split: %q", chunk.Content)
+			}
+		}
+		if strings.Contains(chunk.Content, "```") && strings.Count(chunk.Content, "```")%2 != 0 {
+			t.Errorf("chunk %d has an unbalanced fence", i)
+		}
+		if chunk.Metadata["breadcrumb"] != "Filtering" {
+			t.Errorf("chunk %d lost its breadcrumb: %v", i, chunk.Metadata)
+		}
+		if i > 0 && !strings.HasPrefix(chunk.Content, strings.Repeat("filter rows ", 8)[:20]) && !strings.HasPrefix(chunk.Content, "```") {
+			t.Errorf("chunk %d does not start with the overlap: %q", i, chunk.Content)
+		}
+	}
+	if found != 1 {
+		t.Errorf("the code block must appear in exactly one chunk, found %d", found)
+	}
+}
+
+func TestMarkdownChunkerFenceStyles(t *testing.T) {
+	tilde := "~~~sql\n# not a heading\n\nSELECT 1;\n\n```\nstill code\n~~~"
+	indented := "   ```sql\n   CREATE INDEX ON orders (total);\n\n   ANALYZE orders;\n   ```"
+	filler := strings.Repeat("filter rows ", 8)
+	content := strings.Join([]string{"## Fences", filler, tilde, filler, "1. create the index", indented, filler}, "\n\n")
+	chunks := (&RAG.MarkdownChunker{MaxTokens: 40, OverlapTokens: -1}).Chunk(RAG.Document{Content: content})
+
+	for _, block := range []string{tilde, indented} {
+		found := 0
+		for _, chunk := range chunks {
+			if strings.Contains(chunk.Content, block) {
+				found++
+			}
+		}
+		if found != 1 {
+			t.Errorf("expected the code block to be whole in exactly one chunk, found %d in %+v", found, chunks)
+		}
+	}
+	for i, chunk := range chunks {
+		if chunk.Metadata["breadcrumb"] != "Fences" {
+			t.Errorf("chunk %d has the breadcrumb %v, a line inside a fence is not a heading", i, chunk.Metadata["breadcrumb"])
+		}
+	}
+
+	// a fence that is never closed keeps the rest of the document as code
+	chunks = (&RAG.MarkdownChunker{}).Chunk(RAG.Document{Content: "intro\n\n~~~\nSELECT 1;\n\n# SELECT 2;\n"})
+	if len(chunks) != 1 || chunks[0].Content != "intro\n\n~~~\nSELECT 1;\n\n# SELECT 2;" || chunks[0].Metadata != nil {
+		t.Errorf("unexpected chunks of an unclosed fence: %+v", chunks)
+	}
+}
+
+func TestMarkdownChunkerHTML(t *testing.T) {
+	page := `<html><head><title>ignored</title><script>var x = 1;</script></head><body>
+<nav>menu</nav>
+<h1>Partitioning</h1>
+<p>Split large tables.</p>
+<h2>Range</h2>
+<p>Use <code>PARTITION BY RANGE</code> for dates.</p>
+<pre><code class="language-sql">CREATE TABLE logs (at date)
+  PARTITION BY RANGE (at);</code></pre>
+</body></html>`
+	chunks := (&RAG.MarkdownChunker{}).Chunk(RAG.Document{Content: page, ContentType: RAG.CONTENT_TYPE_HTML})
+
+	if len(chunks) != 2 {
+		t.Fatalf("expected a chunk per section, got %+v", chunks)
+	}
+	if chunks[0].Content != "# Partitioning\n\nSplit large tables." {
+		t.Errorf("unexpected first chunk: %q", chunks[0].Content)
+	}
+	second := chunks[1].Content
+	if chunks[1].Metadata["breadcrumb"] != "Partitioning > Range" || !strings.Contains(second, "```sql\nCREATE TABLE logs (at date)\n  PARTITION BY RANGE (at);\n```") {
+		t.Errorf("unexpected second chunk: %q", second)
+	}
+	if strings.Contains(second, "menu") || strings.Contains(second, "var x") {
+		t.Errorf("navigation and scripts must be dropped: %q", second)
+	}
+}
@@ -0,0 +1,346 @@
+package RAG
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DEFAULT_MIGRATION_SAMPLE_SIZE is the number of re-embedded vectors whose recall is checked
+	DEFAULT_MIGRATION_SAMPLE_SIZE = 20
+	// DEFAULT_MIGRATION_MIN_RECALL is the share of the samples that must find themselves in the shadow namespace
+	DEFAULT_MIGRATION_MIN_RECALL = 0.9
+	// DEFAULT_MIGRATION_VERIFY_TIMEOUT bounds the wait for the shadow namespace to show every vector
+	DEFAULT_MIGRATION_VERIFY_TIMEOUT = 30 * time.Second
+)
+
+// Migration re-embeds a namespace with a new embedding model
+// the stored content is embedded again into a shadow namespace, the shadow is verified
+// and the alias the readers resolve is switched to it, the old namespace is kept for a rollback
+type Migration struct {
+	Embedder Embedder
+	// EmbeddingModel names the model of the Embedder, it is recorded in the alias
+	EmbeddingModel string
+	Store          VectorStore
+	Aliases        *NamespaceAliases
+	// Target is the shadow namespace, defaults to ShadowNamespace of the migrated namespace
+	Target string
+
+	// BatchSize is the number of vectors embedded and upserted together, defaults to DEFAULT_EMBED_BATCH_SIZE
+	BatchSize int
+	// SampleSize defaults to DEFAULT_MIGRATION_SAMPLE_SIZE
+	SampleSize int
+	// MinRecall defaults to DEFAULT_MIGRATION_MIN_RECALL
+	MinRecall float64
+	// VerifyTimeout defaults to DEFAULT_MIGRATION_VERIFY_TIMEOUT
+	VerifyTimeout time.Duration
+	// Timeouts bounds every embedding batch, upsert and query
+	Timeouts StageTimeouts
+}
+
+// MigrationResult describes a finished migration
+type MigrationResult struct {
+	Namespace string  `json:"namespace"`
+	Source    string  `json:"source"`
+	Target    string  `json:"target"`
+	Vectors   int     `json:"vectors"`
+	Dimension int     `json:"dimension"`
+	Recall    float64 `json:"recall"`
+	Switched  bool    `json:"switched"`
+}
+
+// NewMigration creates a migration with the default verification settings
+func NewMigration(embedder Embedder, store VectorStore, aliases *NamespaceAliases) *Migration {
+	return &Migration{
+		Embedder:      embedder,
+		Store:         store,
+		Aliases:       aliases,
+		BatchSize:     DEFAULT_EMBED_BATCH_SIZE,
+		SampleSize:    DEFAULT_MIGRATION_SAMPLE_SIZE,
+		MinRecall:     DEFAULT_MIGRATION_MIN_RECALL,
+		VerifyTimeout: DEFAULT_MIGRATION_VERIFY_TIMEOUT,
+	}
+}
+
+// ShadowNamespace names the namespace a migration of namespace writes to
+func ShadowNamespace(namespace string, now time.Time) string {
+	return namespace + "--" + now.UTC().Format("20060102T150405")
+}
+
+// Run migrates the namespace, the alias is only switched when the shadow namespace holds
+// every vector and enough of the samples find themselves, otherwise ErrMigrationVerification is returned
+func (m *Migration) Run(ctx context.Context, namespace string) (MigrationResult, error) {
+	result := MigrationResult{Namespace: namespace, Source: m.Aliases.Resolve(namespace), Target: m.Target}
+	if result.Target == "" {
+		result.Target = ShadowNamespace(namespace, time.Now())
+	}
+
+	if m.Aliases == nil {
+		return result, fmt.Errorf("%w: the migration needs namespace aliases to switch", ErrInvalidConfig)
+	}
+	lister, ok := m.Store.(VectorLister)
+	if !ok {
+		return result, fmt.Errorf("%w: the vector store cannot list vectors", ErrUnsupported)
+	}
+	fetcher, ok := m.Store.(VectorFetcher)
+	if !ok {
+		return result, fmt.Errorf("%w: the vector store cannot fetch vectors", ErrUnsupported)
+	}
+	writer, ok := m.Store.(VectorWriter)
+	if !ok {
+		return result, fmt.Errorf("%w: the vector store is read-only", ErrUnsupported)
+	}
+
+	ids, err := lister.ListIDs(ctx, result.Source)
+	if err != nil {
+		return result, fmt.Errorf("failed to list the vectors of %s: %w", result.Source, err)
+	}
+	if len(ids) == 0 {
+		return result, fmt.Errorf("namespace %s has no vectors to migrate", result.Source)
+	}
+	sort.Strings(ids)
+	// the counts are only meaningful in a namespace of its own
+	existing, err := lister.ListIDs(ctx, result.Target)
+	if err != nil {
+		return result, fmt.Errorf("failed to list the vectors of %s: %w", result.Target, err)
+	}
+	if len(existing) > 0 || result.Target == result.Source {
+		return result, fmt.Errorf("%w: the shadow namespace %s is not empty", ErrNamespaceInUse, result.Target)
+	}
+	log.Printf("INFO: Migrating %d vectors from %s to %s", len(ids), result.Source, result.Target)
+
+	samples := sampleIDs(ids, m.sampleSize())
+	sampleVectors := make(map[string][]float32, len(samples))
+	batchSize := m.BatchSize
+	if batchSize <= 0 {
+		batchSize = DEFAULT_EMBED_BATCH_SIZE
+	}
+
+	startTime := time.Now()
+	for start := 0; start < len(ids); start += batchSize {
+		batch, err := m.reembedBatch(ctx, fetcher, result.Source, ids[start:min(start+batchSize, len(ids))])
+		if err != nil {
+			return result, err
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		if result.Dimension == 0 {
+			// nothing is written yet when the new model does not fit the index
+			result.Dimension = len(batch[0].Values)
+			if err := m.checkDimension(ctx, result.Dimension); err != nil {
+				return result, err
+			}
+		}
+
+		upsertCtx, cancel := withStageTimeout(ctx, m.Timeouts.Upsert)
+		err = writer.Upsert(upsertCtx, result.Target, batch)
+		cancel()
+		if err != nil {
+			return result, fmt.Errorf("failed to upsert into %s: %w", result.Target, err)
+		}
+		for _, record := range batch {
+			if samples[record.ID] {
+				sampleVectors[record.ID] = record.Values
+			}
+		}
+		result.Vectors += len(batch)
+		log.Printf("INFO: Re-embedded %d/%d vectors", result.Vectors, len(ids))
+	}
+	log.Printf("INFO: Re-embedding %d vectors took %f seconds", result.Vectors, time.Since(startTime).Seconds())
+
+	if err := m.verifyCount(ctx, lister, result.Target, result.Vectors); err != nil {
+		return result, err
+	}
+	result.Recall, err = m.recall(ctx, result.Target, sampleVectors)
+	if err != nil {
+		return result, err
+	}
+	if result.Recall < m.minRecall() {
+		return result, fmt.Errorf("%w: the recall of %s is %.2f, below %.2f", ErrMigrationVerification, result.Target, result.Recall, m.minRecall())
+	}
+
+	err = m.Aliases.Set(namespace, NamespaceAlias{
+		Namespace:      result.Target,
+		EmbeddingModel: m.EmbeddingModel,
+		Dimension:      result.Dimension,
+		Previous:       result.Source,
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed to switch %s to %s: %w", namespace, result.Target, err)
+	}
+	result.Switched = true
+	log.Printf("INFO: Switched namespace %s from %s to %s, recall %.2f", namespace, result.Source, result.Target, result.Recall)
+	return result, nil
+}
+
+// reembedBatch fetches the vectors and embeds their content again, the metadata is kept as is
+func (m *Migration) reembedBatch(ctx context.Context, fetcher VectorFetcher, namespace string, ids []string) ([]VectorRecord, error) {
+	fetchCtx, cancel := withStageTimeout(ctx, m.Timeouts.Query)
+	stored, err := fetcher.Fetch(fetchCtx, namespace, ids)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the vectors of %s: %w", namespace, err)
+	}
+
+	batch := []VectorRecord{}
+	texts := []string{}
+	for _, id := range ids {
+		record, ok := stored[id]
+		if !ok {
+			// deleted while migrating
+			continue
+		}
+		content, ok := record.Metadata["content"].(string)
+		if !ok || strings.TrimSpace(content) == "" {
+			return nil, fmt.Errorf("vector %s of %s has no content metadata to embed", id, namespace)
+		}
+		batch = append(batch, record)
+		texts = append(texts, content)
+	}
+	if len(batch) == 0 {
+		return nil, nil
+	}
+
+	embedCtx, cancel := withStageTimeout(ctx, m.Timeouts.Embed)
+	embeddings, err := embedTexts(embedCtx, m.Embedder, texts)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed the content: %w", err)
+	}
+	for index := range batch {
+		batch[index].Values = embeddings[index]
+	}
+	return batch, nil
+}
+
+// checkDimension compares the dimension of the new model with the one of the index
+func (m *Migration) checkDimension(ctx context.Context, dimension int) error {
+	reporter, ok := m.Store.(DimensionReporter)
+	if !ok {
+		return nil
+	}
+	indexDimension, err := reporter.Dimension(ctx)
+	if err != nil {
+		return err
+	}
+	if indexDimension != 0 && indexDimension != dimension {
+		return &DimensionMismatchError{Embedding: dimension, Index: indexDimension}
+	}
+	return nil
+}
+
+// verifyCount waits for the shadow namespace to list every vector, stores like pinecone are eventually consistent
+func (m *Migration) verifyCount(ctx context.Context, lister VectorLister, namespace string, expected int) error {
+	timeout := m.VerifyTimeout
+	if timeout <= 0 {
+		timeout = DEFAULT_MIGRATION_VERIFY_TIMEOUT
+	}
+	deadline := time.Now().Add(timeout)
+	wait := 100 * time.Millisecond
+	for {
+		ids, err := lister.ListIDs(ctx, namespace)
+		if err != nil {
+			return fmt.Errorf("failed to list the vectors of %s: %w", namespace, err)
+		}
+		if len(ids) == expected {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %s has %d vectors, expected %d", ErrMigrationVerification, namespace, len(ids), expected)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, 2*time.Second)
+	}
+}
+
+// recall queries the shadow namespace with the samples and returns the share that found themselves
+func (m *Migration) recall(ctx context.Context, namespace string, samples map[string][]float32) (float64, error) {
+	if len(samples) == 0 {
+		return 1, nil
+	}
+	found := 0
+	for id, vector := range samples {
+		queryCtx, cancel := withStageTimeout(ctx, m.Timeouts.Query)
+		matches, err := m.Store.Query(queryCtx, VectorQuery{Namespace: namespace, Vector: vector, TopK: DEFAULT_TOP_K})
+		cancel()
+		if err != nil {
+			return 0, fmt.Errorf("failed to query %s: %w", namespace, err)
+		}
+		for _, match := range matches {
+			if match.ID == id {
+				found++
+				break
+			}
+		}
+	}
+	return float64(found) / float64(len(samples)), nil
+}
+
+func (m *Migration) sampleSize() int {
+	if m.SampleSize <= 0 {
+		return DEFAULT_MIGRATION_SAMPLE_SIZE
+	}
+	return m.SampleSize
+}
+
+func (m *Migration) minRecall() float64 {
+	if m.MinRecall <= 0 {
+		return DEFAULT_MIGRATION_MIN_RECALL
+	}
+	return m.MinRecall
+}
+
+// sampleIDs spreads size samples evenly over the sorted ids
+func sampleIDs(ids []string, size int) map[string]bool {
+	samples := make(map[string]bool, size)
+	if size >= len(ids) {
+		for _, id := range ids {
+			samples[id] = true
+		}
+		return samples
+	}
+	for index := 0; index < size; index++ {
+		samples[ids[index*len(ids)/size]] = true
+	}
+	return samples
+}
+
+// MigrateNamespace re-embeds the namespace with the embedding model of the engine, see Migration
+func (r *RAGEngine) MigrateNamespace(ctx context.Context, namespace string) (MigrationResult, error) {
+	if r.Aliases == nil {
+		r.Aliases = NewNamespaceAliases()
+	}
+	if !r.Aliases.Persistent() {
+		log.Printf("WARNING: The namespace aliases are not saved, only this process will read the migrated namespace")
+	}
+
+	migration := NewMigration(r.Embedder, r.Store, r.Aliases)
+	migration.EmbeddingModel = r.EmbeddingModel
+	migration.Timeouts = r.Timeouts
+	result, err := migration.Run(ctx, namespace)
+	if result.Vectors > 0 {
+		if keywordErr := r.reindexKeywords(ctx, result.Target); keywordErr != nil {
+			log.Printf("WARNING: Failed to index the keywords of %s: %v", result.Target, keywordErr)
+		}
+		// keep the shadow namespace even when the verification failed so that it can be inspected
+		if persistErr := r.persist(); persistErr != nil && err == nil {
+			err = persistErr
+		}
+	}
+	if err != nil {
+		log.Printf("ERROR: Migrating namespace %s failed: %v", namespace, err)
+		return result, err
+	}
+	// the readers moved to the target, the responses built from the source are not read anymore
+	r.invalidateResponses(result.Source)
+	return result, nil
+}
@@ -0,0 +1,111 @@
+package RAG_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+// constantEmbedder embeds every text to the same vector
+type constantEmbedder struct {
+	vector []float32
+}
+
+func (c *constantEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	return c.vector, nil
+}
+
+func TestMigrateNamespaceSwitchesReaders(t *testing.T) {
+	store := newTestLocalStore(t, RAG.METRIC_COSINE)
+	aliasesPath := filepath.Join(t.TempDir(), "aliases.json")
+	aliases, err := RAG.OpenNamespaceAliases(aliasesPath)
+	if err != nil {
+		t.Fatalf("failed to open the aliases: %v", err)
+	}
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, store, &fakeLLM{})
+	engine.Aliases = aliases
+	engine.EmbeddingModel = "fake/v2"
+
+	result, err := engine.MigrateNamespace(context.Background(), "database-articles")
+	if err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if !result.Switched || result.Vectors != 3 || result.Recall != 1 || result.Source != "database-articles" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	// another process reading the same file sees the switch
+	reader, _ := RAG.OpenNamespaceAliases(aliasesPath)
+	alias, ok := reader.Get("database-articles")
+	if !ok || alias.Namespace != result.Target || alias.EmbeddingModel != "fake/v2" || alias.Previous != "database-articles" {
+		t.Fatalf("unexpected alias: %+v", alias)
+	}
+
+	// the metadata is kept and the vectors come from the new model
+	records, _ := store.Fetch(context.Background(), result.Target, []string{"x"})
+	if records["x"].Metadata["content"] != "x axis" || fmt.Sprint(records["x"].Values) != "[2 1 2]" {
+		t.Errorf("unexpected migrated vector: %+v", records["x"])
+	}
+
+	// the previous vectors can go, the ones the readers use cannot
+	if err := engine.DeleteNamespace(context.Background(), result.Target); !errors.Is(err, RAG.ErrNamespaceInUse) {
+		t.Errorf("expected ErrNamespaceInUse, got %v", err)
+	}
+	if err := engine.DeleteNamespace(context.Background(), "database-articles"); err != nil {
+		t.Fatalf("failed to delete the previous namespace: %v", err)
+	}
+	matches, err := engine.MatchContext(context.Background(), "database-articles", "x axis", 1)
+	if err != nil || len(matches) != 3 {
+		t.Errorf("expected the readers to query %s, got %v, %v", result.Target, matches, err)
+	}
+}
+
+func TestMigrateNamespaceVerification(t *testing.T) {
+	store, _ := RAG.NewLocalStore(RAG.METRIC_COSINE)
+	records := []RAG.VectorRecord{}
+	for index := 0; index < 10; index++ {
+		records = append(records, RAG.VectorRecord{
+			ID:       fmt.Sprintf("doc-%d", index),
+			Values:   []float32{1, float32(index), 0},
+			Metadata: map[string]any{"content": fmt.Sprintf("document %d", index)},
+		})
+	}
+	store.Upsert(context.Background(), "database-articles", records)
+
+	// every text gets the same vector so most of the samples cannot find themselves
+	aliases := RAG.NewNamespaceAliases()
+	migration := RAG.NewMigration(&constantEmbedder{vector: []float32{1, 1, 1}}, store, aliases)
+	migration.Target = "database-articles-shadow"
+	result, err := migration.Run(context.Background(), "database-articles")
+	if !errors.Is(err, RAG.ErrMigrationVerification) {
+		t.Fatalf("expected ErrMigrationVerification, got %v", err)
+	}
+	if result.Switched || aliases.Resolve("database-articles") != "database-articles" {
+		t.Errorf("a failed verification must not switch the readers")
+	}
+
+	if _, err := migration.Run(context.Background(), "database-articles"); !errors.Is(err, RAG.ErrNamespaceInUse) {
+		t.Errorf("expected the filled shadow namespace to be refused, got %v", err)
+	}
+
+	migration = RAG.NewMigration(&constantEmbedder{vector: []float32{1, 1, 1, 1}}, store, aliases)
+	migration.Target = "database-articles-wide"
+	result, err = migration.Run(context.Background(), "database-articles")
+	if !errors.Is(err, RAG.ErrDimensionMismatch) {
+		t.Fatalf("expected ErrDimensionMismatch, got %v", err)
+	}
+	if ids, _ := store.ListIDs(context.Background(), result.Target); len(ids) != 0 {
+		t.Errorf("nothing should be written with a mismatched dimension, got %d vectors", len(ids))
+	}
+
+	store.Upsert(context.Background(), "database-articles", []RAG.VectorRecord{{ID: "bare", Values: []float32{0, 0, 1}}})
+	migration = RAG.NewMigration(&fakeEmbedder{}, store, aliases)
+	migration.Target = "database-articles-bare"
+	if _, err := migration.Run(context.Background(), "database-articles"); err == nil {
+		t.Errorf("expected an error for a vector without content")
+	}
+}
@@ -0,0 +1,212 @@
+package RAG
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// NamespaceAlias points a namespace the readers ask for to the namespace that holds its vectors
+type NamespaceAlias struct {
+	Namespace string `json:"namespace"`
+	// EmbeddingModel and Dimension describe the vectors of the namespace
+	EmbeddingModel string `json:"embedding_model,omitempty"`
+	Dimension      int    `json:"dimension,omitempty"`
+	// Previous is the namespace the alias pointed to before, it is kept for a rollback
+	Previous  string    `json:"previous,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NamespaceAliases maps namespaces to the namespaces that hold their vectors
+// a re-embedding migration fills a shadow namespace and switches the alias once it is verified,
+// the aliases are saved to a JSON file and reloaded when it changes so that every reader sees the switch
+type NamespaceAliases struct {
+	path string
+
+	mu      sync.RWMutex
+	modTime time.Time
+	aliases map[string]NamespaceAlias
+}
+
+// NewNamespaceAliases creates aliases that only live in memory
+func NewNamespaceAliases() *NamespaceAliases {
+	return &NamespaceAliases{aliases: make(map[string]NamespaceAlias)}
+}
+
+// OpenNamespaceAliases loads the aliases saved at path, a missing file means no aliases
+func OpenNamespaceAliases(path string) (*NamespaceAliases, error) {
+	aliases := NewNamespaceAliases()
+	aliases.path = path
+	if err := aliases.reload(); err != nil {
+		return nil, err
+	}
+	return aliases, nil
+}
+
+// Persistent reports whether the aliases are saved to a file
+func (a *NamespaceAliases) Persistent() bool {
+	return a != nil && a.path != ""
+}
+
+// Resolve returns the namespace that holds the vectors of namespace
+func (a *NamespaceAliases) Resolve(namespace string) string {
+	if alias, ok := a.Get(namespace); ok {
+		return alias.Namespace
+	}
+	return namespace
+}
+
+// Get returns the alias of namespace
+func (a *NamespaceAliases) Get(namespace string) (NamespaceAlias, bool) {
+	if a == nil {
+		return NamespaceAlias{}, false
+	}
+	if err := a.reload(); err != nil {
+		log.Printf("WARNING: Failed to reload the namespace aliases, using the previous ones: %v", err)
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	alias, ok := a.aliases[namespace]
+	return alias, ok
+}
+
+// All returns a copy of the aliases
+func (a *NamespaceAliases) All() map[string]NamespaceAlias {
+	all := make(map[string]NamespaceAlias)
+	if a == nil {
+		return all
+	}
+	if err := a.reload(); err != nil {
+		log.Printf("WARNING: Failed to reload the namespace aliases, using the previous ones: %v", err)
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for name, alias := range a.aliases {
+		all[name] = alias
+	}
+	return all
+}
+
+// Referencing returns the aliases pointing to namespace, sorted by name
+func (a *NamespaceAliases) Referencing(namespace string) []string {
+	names := []string{}
+	for name, alias := range a.All() {
+		if alias.Namespace == namespace {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Set points namespace to alias.Namespace and saves the aliases
+func (a *NamespaceAliases) Set(namespace string, alias NamespaceAlias) error {
+	if alias.UpdatedAt.IsZero() {
+		alias.UpdatedAt = time.Now().UTC()
+	}
+	// keep the aliases another process saved in the meantime
+	if err := a.reload(); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.aliases[namespace] = alias
+	return a.saveLocked()
+}
+
+// reload reads the file again when it changed since it was last read
+func (a *NamespaceAliases) reload() error {
+	if a.path == "" {
+		return nil
+	}
+	info, err := os.Stat(a.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	a.mu.RLock()
+	current := info.ModTime().Equal(a.modTime)
+	a.mu.RUnlock()
+	if current {
+		return nil
+	}
+
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return err
+	}
+	aliases := make(map[string]NamespaceAlias)
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return fmt.Errorf("failed to decode the namespace aliases %s: %w", a.path, err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.aliases = aliases
+	a.modTime = info.ModTime()
+	return nil
+}
+
+// saveLocked writes the aliases to a temporary file first so a reader never sees a partial file
+func (a *NamespaceAliases) saveLocked() error {
+	if a.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(a.aliases, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(a.path), filepath.Base(a.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), a.path); err != nil {
+		return err
+	}
+	if info, err := os.Stat(a.path); err == nil {
+		a.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// resolveNamespace returns the namespace that holds the vectors of namespace
+func (r *RAGEngine) resolveNamespace(namespace string) string {
+	alias, ok := r.Aliases.Get(namespace)
+	if !ok {
+		return namespace
+	}
+	if alias.EmbeddingModel != "" && r.EmbeddingModel != "" && alias.EmbeddingModel != r.EmbeddingModel {
+		log.Printf("WARNING: Namespace %s was embedded with %s but the engine embeds with %s", namespace, alias.EmbeddingModel, r.EmbeddingModel)
+	}
+	return alias.Namespace
+}
+
+// checkAliases warns at startup about the namespaces that were embedded with another model than the engine's
+func (r *RAGEngine) checkAliases(dimension int) {
+	for name, alias := range r.Aliases.All() {
+		if alias.EmbeddingModel != "" && r.EmbeddingModel != "" && alias.EmbeddingModel != r.EmbeddingModel {
+			log.Printf("WARNING: Namespace %s was embedded with %s but the engine embeds with %s, migrate it before querying", name, alias.EmbeddingModel, r.EmbeddingModel)
+		}
+		if alias.Dimension != 0 && alias.Dimension != dimension {
+			log.Printf("WARNING: Namespace %s has %d dimensions but the embedding model produces %d", name, alias.Dimension, dimension)
+		}
+	}
+}
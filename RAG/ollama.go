@@ -0,0 +1,153 @@
+package RAG
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const DEFAULT_OLLAMA_BASE_URL = "http://localhost:11434"
+
+// OllamaLLM implements the LLM interface using the Ollama /api/chat API
+type OllamaLLM struct {
+	BaseURL    string
+	Model      string
+	HTTPClient *http.Client
+}
+
+// OllamaEmbedder implements the Embedder interface using the Ollama /api/embed API
+type OllamaEmbedder struct {
+	BaseURL    string
+	Model      string
+	HTTPClient *http.Client
+}
+
+type ollamaChatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+	// Format is the JSON schema of the structured outputs
+	Format *JSONSchema `json:"format,omitempty"`
+}
+
+type ollamaChatResponse struct {
+	Message chatMessage `json:"message"`
+	Done    bool        `json:"done"`
+	// Error is set by a stream that failed after it started
+	Error string `json:"error,omitempty"`
+}
+
+type ollamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type ollamaEmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+func (o *OllamaLLM) Generate(ctx context.Context, prompt string) (string, error) {
+	return o.GenerateChat(ctx, nil, prompt)
+}
+
+// GenerateChat implements the ChatLLM interface by sending the history as chat messages
+func (o *OllamaLLM) GenerateChat(ctx context.Context, history []ChatTurn, prompt string) (string, error) {
+	var response ollamaChatResponse
+	err := doJSON(ctx, o.HTTPClient, ollamaURL(o.BaseURL, "/api/chat"), nil, ollamaChatRequest{
+		Model:    o.Model,
+		Messages: chatMessages(history, prompt),
+		Stream:   false,
+	}, &response)
+	if err != nil {
+		return "", err
+	}
+	return response.Message.Content, nil
+}
+
+// GenerateJSON implements the StructuredLLM interface with the structured outputs of /api/chat
+func (o *OllamaLLM) GenerateJSON(ctx context.Context, prompt string, schema *JSONSchema) (string, error) {
+	var response ollamaChatResponse
+	err := doJSON(ctx, o.HTTPClient, ollamaURL(o.BaseURL, "/api/chat"), nil, ollamaChatRequest{
+		Model:    o.Model,
+		Messages: chatMessages(nil, prompt),
+		Stream:   false,
+		Format:   schema,
+	}, &response)
+	if err != nil {
+		return "", err
+	}
+	return response.Message.Content, nil
+}
+
+// GenerateStream implements the StreamingLLM interface by reading the newline delimited JSON chunks of /api/chat
+func (o *OllamaLLM) GenerateStream(ctx context.Context, prompt string, onDelta func(string) error) error {
+	return o.GenerateChatStream(ctx, nil, prompt, onDelta)
+}
+
+// GenerateChatStream implements the StreamingChatLLM interface
+func (o *OllamaLLM) GenerateChatStream(ctx context.Context, history []ChatTurn, prompt string, onDelta func(string) error) error {
+	url := ollamaURL(o.BaseURL, "/api/chat")
+	response, err := postStream(ctx, o.HTTPClient, url, nil, ollamaChatRequest{
+		Model:    o.Model,
+		Messages: chatMessages(history, prompt),
+		Stream:   true,
+	})
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	decoder := json.NewDecoder(response.Body)
+	for {
+		var chunk ollamaChatResponse
+		if err := decoder.Decode(&chunk); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to decode stream chunk from %s: %w", url, err)
+		}
+		if chunk.Error != "" {
+			return &ProviderError{Provider: PROVIDER_OLLAMA, Kind: ErrModelUnreachable, Err: errors.New(chunk.Error)}
+		}
+		if err := onDelta(chunk.Message.Content); err != nil {
+			return err
+		}
+		if chunk.Done {
+			return nil
+		}
+	}
+}
+
+func (o *OllamaEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	embeddings, err := o.EmbedBatch(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// EmbedBatch implements the BatchEmbedder interface, all the texts are sent in a single request
+func (o *OllamaEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	var response ollamaEmbedResponse
+	err := doJSON(ctx, o.HTTPClient, ollamaURL(o.BaseURL, "/api/embed"), nil, ollamaEmbedRequest{
+		Model: o.Model,
+		Input: texts,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("model returned %d embeddings for %d texts", len(response.Embeddings), len(texts))
+	}
+	return response.Embeddings, nil
+}
+
+func ollamaURL(baseURL string, path string) string {
+	if baseURL == "" {
+		baseURL = DEFAULT_OLLAMA_BASE_URL
+	}
+	return strings.TrimSuffix(baseURL, "/") + path
+}
@@ -0,0 +1,205 @@
+package RAG
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const DEFAULT_OPENAI_BASE_URL = "https://api.openai.com/v1"
+
+// OpenAILLM implements the LLM interface using an OpenAI compatible /v1/chat/completions API
+// it works with OpenAI itself and with self hosted servers such as vLLM or llama.cpp
+type OpenAILLM struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	HTTPClient *http.Client
+}
+
+// OpenAIEmbedder implements the Embedder interface using an OpenAI compatible /v1/embeddings API
+type OpenAIEmbedder struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	HTTPClient *http.Client
+}
+
+type openAIChatRequest struct {
+	Model          string                `json:"model"`
+	Messages       []chatMessage         `json:"messages"`
+	Stream         bool                  `json:"stream,omitempty"`
+	ResponseFormat *openAIResponseFormat `json:"response_format,omitempty"`
+}
+
+// openAIResponseFormat selects the structured outputs of the chat completion
+type openAIResponseFormat struct {
+	Type       string `json:"type"`
+	JSONSchema struct {
+		Name   string      `json:"name"`
+		Schema *JSONSchema `json:"schema"`
+	} `json:"json_schema"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+// openAIChatChunk is a single server-sent event of a streamed chat completion
+type openAIChatChunk struct {
+	Choices []struct {
+		Delta chatMessage `json:"delta"`
+	} `json:"choices"`
+}
+
+type openAIEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type openAIEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (o *OpenAILLM) Generate(ctx context.Context, prompt string) (string, error) {
+	return o.GenerateChat(ctx, nil, prompt)
+}
+
+// GenerateChat implements the ChatLLM interface by sending the history as chat messages
+func (o *OpenAILLM) GenerateChat(ctx context.Context, history []ChatTurn, prompt string) (string, error) {
+	var response openAIChatResponse
+	err := doJSON(ctx, o.HTTPClient, openAIURL(o.BaseURL, "/chat/completions"), openAIHeaders(o.APIKey), openAIChatRequest{
+		Model:    o.Model,
+		Messages: chatMessages(history, prompt),
+	}, &response)
+	if err != nil {
+		return "", err
+	}
+	if len(response.Choices) == 0 {
+		return "", errors.New("model returned no choices")
+	}
+	return response.Choices[0].Message.Content, nil
+}
+
+// GenerateJSON implements the StructuredLLM interface with a json_schema response format
+func (o *OpenAILLM) GenerateJSON(ctx context.Context, prompt string, schema *JSONSchema) (string, error) {
+	format := &openAIResponseFormat{Type: "json_schema"}
+	format.JSONSchema.Name = "response"
+	format.JSONSchema.Schema = schema
+	var response openAIChatResponse
+	err := doJSON(ctx, o.HTTPClient, openAIURL(o.BaseURL, "/chat/completions"), openAIHeaders(o.APIKey), openAIChatRequest{
+		Model:          o.Model,
+		Messages:       chatMessages(nil, prompt),
+		ResponseFormat: format,
+	}, &response)
+	if err != nil {
+		return "", err
+	}
+	if len(response.Choices) == 0 {
+		return "", errors.New("model returned no choices")
+	}
+	return response.Choices[0].Message.Content, nil
+}
+
+// GenerateStream implements the StreamingLLM interface by reading the server-sent events of the chat completion
+func (o *OpenAILLM) GenerateStream(ctx context.Context, prompt string, onDelta func(string) error) error {
+	return o.GenerateChatStream(ctx, nil, prompt, onDelta)
+}
+
+// GenerateChatStream implements the StreamingChatLLM interface
+func (o *OpenAILLM) GenerateChatStream(ctx context.Context, history []ChatTurn, prompt string, onDelta func(string) error) error {
+	url := openAIURL(o.BaseURL, "/chat/completions")
+	response, err := postStream(ctx, o.HTTPClient, url, openAIHeaders(o.APIKey), openAIChatRequest{
+		Model:    o.Model,
+		Messages: chatMessages(history, prompt),
+		Stream:   true,
+	})
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	scanner := bufio.NewScanner(response.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return nil
+		}
+		var chunk openAIChatChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to decode stream event from %s: %w", url, err)
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		if err := onDelta(chunk.Choices[0].Delta.Content); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (o *OpenAIEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	embeddings, err := o.EmbedBatch(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// EmbedBatch implements the BatchEmbedder interface, all the texts are sent in a single request
+func (o *OpenAIEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	var response openAIEmbeddingResponse
+	err := doJSON(ctx, o.HTTPClient, openAIURL(o.BaseURL, "/embeddings"), openAIHeaders(o.APIKey), openAIEmbeddingRequest{
+		Model: o.Model,
+		Input: texts,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+	if len(response.Data) != len(texts) {
+		return nil, fmt.Errorf("model returned %d embeddings for %d texts", len(response.Data), len(texts))
+	}
+	// the embeddings carry the index of their input, every input must get exactly one
+	embeddings := make([][]float32, len(texts))
+	seen := make([]bool, len(texts))
+	for _, data := range response.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, fmt.Errorf("model returned an embedding for index %d of %d texts", data.Index, len(texts))
+		}
+		if seen[data.Index] {
+			return nil, fmt.Errorf("model returned two embeddings for index %d", data.Index)
+		}
+		seen[data.Index] = true
+		embeddings[data.Index] = data.Embedding
+	}
+	return embeddings, nil
+}
+
+func openAIURL(baseURL string, path string) string {
+	if baseURL == "" {
+		baseURL = DEFAULT_OPENAI_BASE_URL
+	}
+	return strings.TrimSuffix(baseURL, "/") + path
+}
+
+func openAIHeaders(apiKey string) map[string]string {
+	if apiKey == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + apiKey}
+}
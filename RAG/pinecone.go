@@ -0,0 +1,317 @@
+package RAG
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/pinecone-io/go-pinecone/v4/pinecone"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// PineconeStore implements the VectorStore interface on top of a Pinecone index
+type PineconeStore struct {
+	Client    *pinecone.Client
+	IndexConn *pinecone.IndexConnection
+	IndexName string
+	IndexHost string
+}
+
+// newPineconeStore connects to the Pinecone index described by the config
+func newPineconeStore(ctx context.Context, config *RAGConfig) (*PineconeStore, error) {
+	if config.PineconeAPIKey == "" {
+		return nil, &ProviderError{Provider: VECTOR_STORE_PINECONE, Kind: ErrMissingAPIKey}
+	}
+
+	// Initialize Pinecone client
+	pineconeClient, err := pinecone.NewClient(pinecone.NewClientParams{
+		ApiKey: config.PineconeAPIKey,
+	})
+	if err != nil {
+		return nil, &ProviderError{Provider: VECTOR_STORE_PINECONE, Kind: ErrInvalidConfig, Err: err}
+	}
+
+	// Get index name from environment variable or use default
+	if config.PineconeIndexName == "" {
+		config.PineconeIndexName = "knowledge-index" // default index name
+		log.Printf("Using default index name: %s\n", config.PineconeIndexName)
+	}
+
+	// Get index host from environment variable
+	if config.PineconeIndexHost == "" {
+		// Alternatively, you can describe the index to get the host
+		idx, err := pineconeClient.DescribeIndex(ctx, config.PineconeIndexName)
+		if err != nil {
+			return nil, pineconeError(err)
+		}
+		config.PineconeIndexHost = idx.Host
+		log.Printf("Retrieved index host: %s\n", config.PineconeIndexHost)
+		if idx.Dimension != nil {
+			log.Printf("Index dimension: %d\n", *idx.Dimension)
+		}
+	}
+
+	// Connect to the index without specifying a namespace (will be set in Match function)
+	indexConn, err := pineconeClient.Index(pinecone.NewIndexConnParams{
+		Host: config.PineconeIndexHost,
+	})
+	if err != nil {
+		return nil, &ProviderError{Provider: VECTOR_STORE_PINECONE, Kind: ErrVectorStoreUnreachable, Err: err}
+	}
+
+	if !config.Lazy {
+		// check the index stats
+		_, err = indexConn.DescribeIndexStats(ctx) // this would take some time to complete handshake and stuff XD
+		if err != nil {
+			indexConn.Close()
+			return nil, pineconeError(err)
+		}
+	}
+
+	return &PineconeStore{
+		Client:    pineconeClient,
+		IndexConn: indexConn,
+		IndexName: config.PineconeIndexName,
+		IndexHost: config.PineconeIndexHost,
+	}, nil
+}
+
+// pineconeError classifies a pinecone error into one of the package errors
+func pineconeError(err error) error {
+	var pineconeErr *pinecone.PineconeError
+	if errors.As(err, &pineconeErr) && pineconeErr.Code == http.StatusNotFound {
+		return &ProviderError{Provider: VECTOR_STORE_PINECONE, Kind: ErrIndexNotFound, Err: err}
+	}
+	return &ProviderError{Provider: VECTOR_STORE_PINECONE, Kind: ErrVectorStoreUnreachable, Err: err}
+}
+
+// Dimension returns the dimension of the vectors stored in the index
+func (s *PineconeStore) Dimension(ctx context.Context) (int, error) {
+	idx, err := s.Client.DescribeIndex(ctx, s.IndexName)
+	if err != nil {
+		return 0, pineconeError(err)
+	}
+	if idx.Dimension == nil {
+		return 0, nil
+	}
+	return int(*idx.Dimension), nil
+}
+
+// Close closes the connection to the index
+func (s *PineconeStore) Close() error {
+	return s.IndexConn.Close()
+}
+
+func (s *PineconeStore) Query(ctx context.Context, query VectorQuery) ([]VectorMatch, error) {
+	// Create a connection with the specified namespace
+	indexConn := s.IndexConn.WithNamespace(query.Namespace)
+
+	request := &pinecone.QueryByVectorValuesRequest{
+		Vector:          query.Vector,
+		TopK:            uint32(query.TopK),
+		IncludeMetadata: true,
+		IncludeValues:   query.IncludeValues,
+	}
+	if len(query.Filter) > 0 {
+		filter, err := pineconeFilter(query.Filter)
+		if err != nil {
+			return nil, err
+		}
+		request.MetadataFilter = filter
+	}
+	results, err := indexConn.QueryByVectorValues(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]VectorMatch, 0, len(results.Matches))
+	for _, match := range results.Matches {
+		if match == nil || match.Vector == nil {
+			continue
+		}
+		matches = append(matches, pineconeMatch(match))
+	}
+	return matches, nil
+}
+
+// pinecone limits the size of a single upsert and fetch request
+const PINECONE_BATCH_SIZE = 100
+
+// Upsert implements the VectorWriter interface, the records are sent in batches
+func (s *PineconeStore) Upsert(ctx context.Context, namespace string, records []VectorRecord) error {
+	indexConn := s.IndexConn.WithNamespace(namespace)
+
+	for start := 0; start < len(records); start += PINECONE_BATCH_SIZE {
+		batch := records[start:min(start+PINECONE_BATCH_SIZE, len(records))]
+		vectors := make([]*pinecone.Vector, 0, len(batch))
+		for _, record := range batch {
+			metadata, err := structpb.NewStruct(record.Metadata)
+			if err != nil {
+				return fmt.Errorf("invalid metadata for vector %s: %w", record.ID, err)
+			}
+			values := record.Values
+			vectors = append(vectors, &pinecone.Vector{Id: record.ID, Values: &values, Metadata: metadata})
+		}
+		if _, err := indexConn.UpsertVectors(ctx, vectors); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fetch implements the VectorFetcher interface
+func (s *PineconeStore) Fetch(ctx context.Context, namespace string, ids []string) (map[string]VectorRecord, error) {
+	indexConn := s.IndexConn.WithNamespace(namespace)
+
+	records := make(map[string]VectorRecord, len(ids))
+	for start := 0; start < len(ids); start += PINECONE_BATCH_SIZE {
+		res, err := indexConn.FetchVectors(ctx, ids[start:min(start+PINECONE_BATCH_SIZE, len(ids))])
+		if err != nil {
+			return nil, err
+		}
+		for id, vector := range res.Vectors {
+			if vector == nil {
+				continue
+			}
+			records[id] = pineconeRecord(vector)
+		}
+	}
+	return records, nil
+}
+
+// pineconeRecord converts a pinecone vector into a VectorRecord
+func pineconeRecord(vector *pinecone.Vector) VectorRecord {
+	record := VectorRecord{ID: vector.Id}
+	if vector.Values != nil {
+		record.Values = *vector.Values
+	}
+	if vector.Metadata != nil {
+		record.Metadata = vector.Metadata.AsMap()
+	}
+	return record
+}
+
+// pineconeMatch converts a pinecone scored vector into a VectorMatch
+func pineconeMatch(match *pinecone.ScoredVector) VectorMatch {
+	result := VectorMatch{
+		ID:    match.Vector.Id,
+		Score: match.Score,
+	}
+	if match.Vector.Values != nil {
+		result.Values = *match.Vector.Values
+	}
+	if match.Vector.Metadata != nil {
+		result.Metadata = match.Vector.Metadata.AsMap()
+	}
+	return result
+}
+
+// Stats implements the StatsReporter interface with DescribeIndex and DescribeIndexStats
+func (s *PineconeStore) Stats(ctx context.Context) (IndexStats, error) {
+	idx, err := s.Client.DescribeIndex(ctx, s.IndexName)
+	if err != nil {
+		return IndexStats{}, pineconeError(err)
+	}
+	stats, err := s.IndexConn.DescribeIndexStats(ctx)
+	if err != nil {
+		return IndexStats{}, pineconeError(err)
+	}
+
+	result := IndexStats{
+		Name:             idx.Name,
+		Metric:           string(idx.Metric),
+		Host:             idx.Host,
+		TotalVectorCount: int(stats.TotalVectorCount),
+		Namespaces:       []NamespaceStats{},
+	}
+	if idx.Dimension != nil {
+		result.Dimension = int(*idx.Dimension)
+	}
+	if idx.Status != nil {
+		result.Status = string(idx.Status.State)
+	}
+	for name, summary := range stats.Namespaces {
+		if summary == nil {
+			continue
+		}
+		result.Namespaces = append(result.Namespaces, NamespaceStats{Name: name, VectorCount: int(summary.VectorCount)})
+	}
+	sortNamespaces(result.Namespaces)
+	return result, nil
+}
+
+// Delete implements the VectorWriter interface
+func (s *PineconeStore) Delete(ctx context.Context, namespace string, ids []string) error {
+	indexConn := s.IndexConn.WithNamespace(namespace)
+
+	for start := 0; start < len(ids); start += PINECONE_BATCH_SIZE {
+		if err := indexConn.DeleteVectorsById(ctx, ids[start:min(start+PINECONE_BATCH_SIZE, len(ids))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteNamespace implements the NamespaceDeleter interface
+func (s *PineconeStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	return s.IndexConn.DeleteNamespace(ctx, namespace)
+}
+
+// ListIDs implements the VectorLister interface by paging through ListVectors
+func (s *PineconeStore) ListIDs(ctx context.Context, namespace string) ([]string, error) {
+	indexConn := s.IndexConn.WithNamespace(namespace)
+
+	ids := []string{}
+	limit := uint32(PINECONE_BATCH_SIZE)
+	var token *string
+	for {
+		res, err := indexConn.ListVectors(ctx, &pinecone.ListVectorsRequest{Limit: &limit, PaginationToken: token})
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range res.VectorIds {
+			if id != nil {
+				ids = append(ids, *id)
+			}
+		}
+		if res.NextPaginationToken == nil || *res.NextPaginationToken == "" {
+			return ids, nil
+		}
+		token = res.NextPaginationToken
+	}
+}
+
+// checkIndexStats logs the statistics of the Pinecone index
+func (s *PineconeStore) checkIndexStats(namespace string) error {
+	log.Printf("=== CHECKING INDEX STATISTICS ===")
+
+	stats, err := s.Stats(context.Background())
+	if err != nil {
+		log.Printf("ERROR: Failed to get index stats: %v", err)
+		return err
+	}
+
+	log.Printf("Index name: %s", stats.Name)
+	log.Printf("Index dimension: %d", stats.Dimension)
+	log.Printf("Index metric: %s", stats.Metric)
+	log.Printf("Index host: %s", stats.Host)
+	log.Printf("Index status: %s", stats.Status)
+	log.Printf("Total vector count: %d", stats.TotalVectorCount)
+
+	log.Printf("Available namespaces:")
+	for _, ns := range stats.Namespaces {
+		log.Printf("  Namespace '%s': %d vectors", ns.Name, ns.VectorCount)
+	}
+
+	// Check if our specific namespace exists
+	if ns := stats.Namespace(namespace); ns.VectorCount > 0 {
+		log.Printf("Target namespace '%s' has %d vectors", namespace, ns.VectorCount)
+	} else {
+		log.Printf("WARNING: Target namespace '%s' does not exist in index!", namespace)
+	}
+
+	log.Printf("=== END INDEX STATISTICS ===")
+	return nil
+}
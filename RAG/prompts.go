@@ -31,66 +31,62 @@ const (
 	resources:
 	%s
 	
-	CURRENT DATABASE SCHEMA (is SQL code):
+	CURRENT DATABASE SCHEMA:
 	%s
 	
-	The schema format that response should be in along side with the sql DDL statements please be accurite and do not add any extra fields:
+	Answer with a single JSON object and nothing else, do not wrap it in a markdown block:
+	- "analysis": the analysis of the current schema structure and of its existing design issues
+	- "schema_changes": every table that is created or changed, as it is after the change, with all of its columns, constraints and indexes
+	- "dropped_tables": the names of the tables of the current schema that are dropped, they are not in "schema_changes"
+	- "ddl": the DDL statements that turn the current schema into the new one, one statement per element, in execution order, written for PostgreSQL
+	- "risks": the potential risks or considerations of the modification
+	- "rationale": how the changes improve the system design
+	- "response": the whole answer for the user in markdown with clear sections, it includes the analysis, the SQL and the risks
+	
+	A table of "schema_changes" has this format, be accurate and do not add any extra fields:
 	{
-		[
+		"TableName": "",
+		"Columns": [
+			{
+				"TableName": "",
+				"ColumnName": "",
+				"DataType": "",
+				"IsNullable": true/false,
+				"ColumnDefault": null,
+				"CharacterMaximumLength": null,
+				"NumericPrecision": null,
+				"NumericScale": null,
+				"OrdinalPosition": 0,
+				"Comment": ""
+			}
+		],
+		"Constraints": [
 			{
 				"TableName": "",
-				"Columns": [
-					{
-						"CharacterMaximumLength": null,
-						"ColumnDefault": "",
-						"ColumnName": "",
-						"DataType": "",
-						"IsNullable": true/false,
-						"NumericPrecision": null,
-						"NumericScale": null,
-						"OrdinalPosition": 0
-						"TableName": ""
-					}
-				],
-				"Constraints": [
-					{
-						"CheckClause": "",
-						"ColumnName": "",
-						"ConstraintName": "",
-						"ConstraintType": "",
-						"ForeignColumnName": "",
-						"ForeignTableName": "",
-						"OrdinalPosition": 0,
-						"TableName": ""
-					}
-				],
-				"Indexes": [
-					{
-						"ColumnName": "",
-						"IndexName": "",
-						"IndexType": "",
-						"IsPrimary": true/false
-						"IsUnique": true/false
-						"TableName": ""
-					}
-				]
+				"ConstraintName": "",
+				"ConstraintType": "",
+				"ColumnName": null,
+				"ForeignTableName": null,
+				"ForeignColumnName": null,
+				"CheckClause": null,
+				"OrdinalPosition": null
 			}
-		]
+		],
+		"Indexes": [
+			{
+				"TableName": "",
+				"IndexName": "",
+				"ColumnName": "",
+				"IsUnique": true/false,
+				"IndexType": "",
+				"IsPrimary": true/false,
+				"IsIncluded": true/false,
+				"Predicate": ""
+			}
+		],
+		"Comment": ""
 	}
-
-	Your response should include:
-	- Analysis of the current schema structure
-	- Identification of any existing design issues and solve them
-	- Specific SQL DDL statements to implement the requested changes
-	- Explanation of how the changes improve the system design
-	- Any potential risks or considerations for the modification
-	
-	Format your response with clear sections and provide executable SQL when applicable.
-	The final schema changes should be the only json code in the response do not add any comments in the code and should be in the json format provided above and in a json markdown block.
-	also add a section with the DDL statements to implement the changes based on old schema(provided above in json format) and new schema(your response) this block would be an SQL block (you will write it for postgresql but the block need to be in a normal sql block).
-	
-	The schema DDL should be the only sql code in the response
-	with are the DDL statements written in sql but for PostgreSQL that is very important.
+	An index has a row per column, "IsIncluded" marks the columns of its INCLUDE list and "Predicate" is the WHERE of a partial index on every row, keep them as they are in the current schema
 	
 	USER REQUEST:
 	%s
@@ -109,6 +105,17 @@ const (
 	
 		`
 
+	AGENT_REPAIR_PROMPT_TEMPLATE = `%s
+
+	YOUR PREVIOUS ANSWER:
+	%s
+
+	YOUR PREVIOUS ANSWER IS INVALID:
+	%s
+
+	Answer again with the corrected JSON object only, fix every problem listed above and keep what was already valid.
+	`
+
 	REPORT_PROMPT_TEMPLATE = `
 	You are a System analyst. Your task is to analyze the database schema and the analytics of the database including the disk usage, cpu usage, memory usage, etc.
 	
@@ -144,4 +151,45 @@ const (
 	The final report should be in a markdown format
 	you should focus more on the business side so no need to be too technical and you should be very concise and to the point
 	`
+
+	CONDENSE_QUESTION_PROMPT_TEMPLATE = `
+	Given the following conversation between a user and a database assistant and a follow up question, rewrite the follow up question into a standalone question that can be understood without the conversation.
+	Replace pronouns and references like "it", "that" or "this table" with what they refer to.
+	If the follow up question is already standalone return it unchanged.
+
+	CONVERSATION:
+	%s
+
+	FOLLOW UP QUESTION:
+	%s
+
+	Respond with the standalone question only, without any explanation or formatting.
+	`
+
+	RERANK_PROMPT_TEMPLATE = `
+	You are ranking the passages retrieved to answer a question about databases.
+	Rate how relevant every passage is to the question from 0, unrelated, to 10, it answers the question directly.
+	A passage that only shares words with the question but is about something else is not relevant.
+
+	QUESTION:
+	%s
+
+	PASSAGES:
+	%s
+
+	Respond with a JSON array of the %d ratings in the order of the passages only, for example [7, 0, 3], without any explanation or formatting.
+	`
+
+	SUMMARIZE_HISTORY_PROMPT_TEMPLATE = `
+	Summarize the following conversation between a user and a database assistant.
+	Keep the databases, tables, columns, SQL and decisions that were discussed so that the conversation can be continued from the summary.
+
+	PREVIOUS SUMMARY:
+	%s
+
+	CONVERSATION:
+	%s
+
+	Respond with the summary only, in a few short paragraphs.
+	`
 )
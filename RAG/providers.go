@@ -0,0 +1,127 @@
+package RAG
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Embedder turns a piece of text into a dense vector
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// VectorStore stores vectors in namespaces and searches them by similarity
+type VectorStore interface {
+	Query(ctx context.Context, query VectorQuery) ([]VectorMatch, error)
+}
+
+// BatchEmbedder is implemented by the embedders that can embed many texts in a single request
+// the embeddings are returned in the order of the texts
+type BatchEmbedder interface {
+	EmbedBatch(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// VectorWriter is implemented by the vector stores that can be written to
+// records with an existing id are replaced and deleting an id that does not exist is not an error
+type VectorWriter interface {
+	Upsert(ctx context.Context, namespace string, records []VectorRecord) error
+	Delete(ctx context.Context, namespace string, ids []string) error
+}
+
+// VectorFetcher is implemented by the vector stores that can fetch records by id
+// ids that do not exist are missing from the result
+type VectorFetcher interface {
+	Fetch(ctx context.Context, namespace string, ids []string) (map[string]VectorRecord, error)
+}
+
+// DimensionReporter is implemented by the vector stores that know the dimension of their vectors
+// NewRAG uses it to check that the embedding model matches the index
+type DimensionReporter interface {
+	Dimension(ctx context.Context) (int, error)
+}
+
+// LLM generates text for a prompt
+type LLM interface {
+	Generate(ctx context.Context, prompt string) (string, error)
+}
+
+// StreamingLLM is implemented by the LLMs that can emit the response while it is generated
+// onDelta is called with every new piece of text, returning an error from it stops the generation
+type StreamingLLM interface {
+	GenerateStream(ctx context.Context, prompt string, onDelta func(string) error) error
+}
+
+const (
+	ROLE_USER  = "user"
+	ROLE_MODEL = "model"
+)
+
+// ChatTurn is a single message of a conversation, Role is ROLE_USER or ROLE_MODEL
+type ChatTurn struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Reranker scores how relevant every passage is to the query, a higher score is more relevant
+// the scores are returned in the order of the passages, it is implemented by LLMReranker and by cross-encoders
+type Reranker interface {
+	Rerank(ctx context.Context, query string, passages []string) ([]float64, error)
+}
+
+// StructuredLLM is implemented by the LLMs with a JSON mode, the response is a single JSON value
+// that follows the schema instead of free text
+type StructuredLLM interface {
+	GenerateJSON(ctx context.Context, prompt string, schema *JSONSchema) (string, error)
+}
+
+// ChatLLM is implemented by the LLMs that accept the previous turns of a conversation as chat history
+// LLMs without it get the history rendered into the prompt
+type ChatLLM interface {
+	GenerateChat(ctx context.Context, history []ChatTurn, prompt string) (string, error)
+}
+
+// StreamingChatLLM is the streaming variant of ChatLLM
+type StreamingChatLLM interface {
+	GenerateChatStream(ctx context.Context, history []ChatTurn, prompt string, onDelta func(string) error) error
+}
+
+// VectorQuery describes a similarity search against a VectorStore
+type VectorQuery struct {
+	Namespace string
+	Vector    []float32
+	TopK      int
+	// IncludeValues returns the vector values of the matches
+	IncludeValues bool
+	// Filter restricts the matches by their metadata, nil matches every vector
+	Filter MetadataFilter
+}
+
+// VectorRecord is a vector with its id and metadata as it is stored in a VectorStore
+type VectorRecord struct {
+	ID       string         `json:"id"`
+	Values   []float32      `json:"values"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// VectorMatch is a provider neutral scored vector returned by a VectorStore
+type VectorMatch struct {
+	ID       string         `json:"id"`
+	Score    float32        `json:"score"`
+	Values   []float32      `json:"values,omitempty"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// MetadataString returns the metadata field as a trimmed string
+// it returns an empty string when the field does not exist
+func (m VectorMatch) MetadataString(key string) string {
+	value, ok := m.Metadata[key]
+	if !ok || value == nil {
+		return ""
+	}
+	text, ok := value.(string)
+	if !ok {
+		text = fmt.Sprint(value)
+	}
+	return strings.Trim(text, "\"\n \t")
+}
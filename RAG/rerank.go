@@ -0,0 +1,185 @@
+package RAG
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	RERANKER_LLM           = "llm"
+	RERANKER_CROSS_ENCODER = "cross-encoder"
+
+	// RERANK_PASSAGE_LIMIT is the number of characters of every passage the LLM reranker reads
+	RERANK_PASSAGE_LIMIT = 2000
+)
+
+// LLMReranker asks the generative model to rate the passages, the scores are between 0 and 1
+type LLMReranker struct {
+	LLM LLM
+}
+
+func (l *LLMReranker) Rerank(ctx context.Context, query string, passages []string) ([]float64, error) {
+	if len(passages) == 0 {
+		return nil, nil
+	}
+	var numbered strings.Builder
+	for index, passage := range passages {
+		if len(passage) > RERANK_PASSAGE_LIMIT {
+			passage = passage[:RERANK_PASSAGE_LIMIT]
+		}
+		fmt.Fprintf(&numbered, "[%d]\n%s\n\n", index+1, strings.TrimSpace(passage))
+	}
+	responseText, err := l.LLM.Generate(ctx, fmt.Sprintf(RERANK_PROMPT_TEMPLATE, query, numbered.String(), len(passages)))
+	if err != nil {
+		return nil, err
+	}
+
+	// the model may wrap the array in a code block or a sentence
+	start := strings.Index(responseText, "[")
+	end := strings.LastIndex(responseText, "]")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("the reranker response has no ratings: %q", responseText)
+	}
+	var ratings []float64
+	if err := json.Unmarshal([]byte(responseText[start:end+1]), &ratings); err != nil {
+		return nil, fmt.Errorf("failed to decode the reranker ratings: %w", err)
+	}
+	if len(ratings) != len(passages) {
+		return nil, fmt.Errorf("the reranker rated %d passages out of %d", len(ratings), len(passages))
+	}
+	scores := make([]float64, len(ratings))
+	for index, rating := range ratings {
+		scores[index] = min(max(rating, 0), 10) / 10
+	}
+	return scores, nil
+}
+
+// CrossEncoderReranker scores the passages with a cross-encoder served over the /rerank API
+// of Hugging Face text-embeddings-inference
+type CrossEncoderReranker struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+type crossEncoderRequest struct {
+	Query string   `json:"query"`
+	Texts []string `json:"texts"`
+}
+
+type crossEncoderScore struct {
+	Index int     `json:"index"`
+	Score float64 `json:"score"`
+}
+
+func (c *CrossEncoderReranker) Rerank(ctx context.Context, query string, passages []string) ([]float64, error) {
+	if len(passages) == 0 {
+		return nil, nil
+	}
+	var response []crossEncoderScore
+	url := strings.TrimSuffix(c.BaseURL, "/") + "/rerank"
+	if err := doJSON(ctx, c.HTTPClient, url, nil, crossEncoderRequest{Query: query, Texts: passages}, &response); err != nil {
+		return nil, err
+	}
+	scores := make([]float64, len(passages))
+	scored := make([]bool, len(passages))
+	for _, item := range response {
+		if item.Index < 0 || item.Index >= len(passages) {
+			return nil, fmt.Errorf("the cross-encoder scored an unknown passage %d", item.Index)
+		}
+		scores[item.Index] = item.Score
+		scored[item.Index] = true
+	}
+	for index, ok := range scored {
+		if !ok {
+			return nil, fmt.Errorf("the cross-encoder did not score passage %d", index)
+		}
+	}
+	return scores, nil
+}
+
+// newReranker creates the reranker selected by the config, nil when reranking is disabled
+func newReranker(config *RAGConfig, llm LLM) (Reranker, error) {
+	switch config.Reranker {
+	case "":
+		return nil, nil
+	case RERANKER_LLM:
+		return &LLMReranker{LLM: llm}, nil
+	case RERANKER_CROSS_ENCODER:
+		if config.RerankerURL == "" {
+			return nil, fmt.Errorf("%w: the cross-encoder reranker needs RAG_RERANKER_URL", ErrInvalidConfig)
+		}
+		return &CrossEncoderReranker{BaseURL: config.RerankerURL}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown reranker: %s", ErrInvalidConfig, config.Reranker)
+	}
+}
+
+// rerank scores the matches against the query, drops the ones below RerankMinScore and keeps the topK best
+// the score of the returned matches is the reranker score, the retrieval order is kept when the reranker fails
+func (r *RAGEngine) rerank(ctx context.Context, query string, matches []VectorMatch, topK int) []VectorMatch {
+	if len(matches) == 0 {
+		return matches
+	}
+	ctx, cancel := withStageTimeout(ctx, r.Timeouts.Rerank)
+	defer cancel()
+
+	passages := make([]string, len(matches))
+	for index, match := range matches {
+		passages[index] = matchPassage(match)
+	}
+	startTime := time.Now()
+	scores, err := r.Reranker.Rerank(ctx, query, passages)
+	if err == nil && len(scores) != len(matches) {
+		err = fmt.Errorf("the reranker returned %d scores for %d passages", len(scores), len(matches))
+	}
+	if err != nil {
+		log.Printf("WARNING: Reranking failed, keeping the retrieval order: %v", err)
+		return matches[:min(topK, len(matches))]
+	}
+	log.Printf("INFO: reranking %d matches took ==> %f seconds", len(matches), time.Since(startTime).Seconds())
+
+	order := make([]int, len(matches))
+	for index := range order {
+		order[index] = index
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+	reranked := make([]VectorMatch, 0, topK)
+	for rank, index := range order {
+		match := matches[index]
+		kept := rank < topK && scores[index] >= r.RerankMinScore
+		// the scores are logged for the evaluation of the retrieval
+		log.Printf("INFO: rerank %d: %s score %.3f, retrieval score %.3f, kept %t", rank+1, match.ID, scores[index], match.Score, kept)
+		if kept {
+			match.Score = float32(scores[index])
+			reranked = append(reranked, match)
+		}
+	}
+	return reranked
+}
+
+// matchPassage is the text of the match the reranker reads, the content or else the other metadata
+func matchPassage(match VectorMatch) string {
+	if content := match.MetadataString("content"); content != "" {
+		return content
+	}
+	keys := make([]string, 0, len(match.Metadata))
+	for key := range match.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	lines := []string{}
+	for _, key := range keys {
+		if value := match.MetadataString(key); value != "" {
+			lines = append(lines, key+": "+value)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
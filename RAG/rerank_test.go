@@ -0,0 +1,105 @@
+package RAG_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+// lengthReranker scores the shorter passages higher
+type lengthReranker struct {
+	err error
+}
+
+func (l *lengthReranker) Rerank(ctx context.Context, query string, passages []string) ([]float64, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	scores := make([]float64, len(passages))
+	for index, passage := range passages {
+		scores[index] = 1 - float64(len(passage))/10
+	}
+	return scores, nil
+}
+
+func TestMatchRerank(t *testing.T) {
+	store := newTestLocalStore(t, RAG.METRIC_COSINE)
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, store, &fakeLLM{})
+	engine.Reranker = &lengthReranker{}
+
+	// the vectors rank "diagonal" first, the reranker prefers "x axis" and "y axis"
+	matches, err := engine.MatchContext(context.Background(), "database-articles", "x axis", 2)
+	if err != nil {
+		t.Fatalf("MatchContext failed: %v", err)
+	}
+	if len(matches) != 2 || matches[0].ID != "x" || matches[1].ID != "y" || matches[0].Score != 0.4 {
+		t.Fatalf("expected the reranked top 2, got %+v", matches)
+	}
+
+	// the weak matches do not reach the prompt
+	engine.RerankMinScore = 0.3
+	matches, _ = engine.MatchContext(context.Background(), "database-articles", "x axis", 3)
+	if len(matches) != 2 {
+		t.Errorf("expected only the matches above the minimum score, got %+v", matches)
+	}
+
+	// a failing reranker keeps the retrieval order
+	engine.Reranker = &lengthReranker{err: errors.New("reranker unavailable")}
+	matches, err = engine.MatchContext(context.Background(), "database-articles", "x axis", 1)
+	if err != nil || len(matches) != 1 || matches[0].ID != "xy" {
+		t.Errorf("expected the best vector match, got %+v, %v", matches, err)
+	}
+}
+
+func TestLLMReranker(t *testing.T) {
+	llm := &fakeLLM{response: "```json\n[2, 9, 12]\n```"}
+	reranker := &RAG.LLMReranker{LLM: llm}
+	scores, err := reranker.Rerank(context.Background(), "what is a brin index?", []string{"btree", "brin", "gin"})
+	if err != nil {
+		t.Fatalf("Rerank failed: %v", err)
+	}
+	if !reflect.DeepEqual(scores, []float64{0.2, 0.9, 1}) {
+		t.Errorf("unexpected scores: %v", scores)
+	}
+	if !strings.Contains(llm.prompts[0], "[2]\nbrin") || !strings.Contains(llm.prompts[0], "what is a brin index?") {
+		t.Errorf("the prompt does not list the passages: %s", llm.prompts[0])
+	}
+
+	llm.response = "[5]"
+	if _, err := reranker.Rerank(context.Background(), "query", []string{"a", "b"}); err == nil {
+		t.Errorf("expected an error when a passage is not rated")
+	}
+}
+
+func TestCrossEncoderReranker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rerank" {
+			http.NotFound(w, r)
+			return
+		}
+		var request struct {
+			Query string   `json:"query"`
+			Texts []string `json:"texts"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		// the scores come back sorted by score, not in the order of the texts
+		json.NewEncoder(w).Encode([]map[string]any{{"index": 1, "score": 0.9}, {"index": 0, "score": 0.1}})
+	}))
+	defer server.Close()
+
+	reranker := &RAG.CrossEncoderReranker{BaseURL: server.URL + "/"}
+	scores, err := reranker.Rerank(context.Background(), "brin", []string{"btree", "brin"})
+	if err != nil || !reflect.DeepEqual(scores, []float64{0.1, 0.9}) {
+		t.Errorf("unexpected scores: %v, %v", scores, err)
+	}
+	if _, err := reranker.Rerank(context.Background(), "brin", []string{"btree", "brin", "gin"}); err == nil {
+		t.Errorf("expected an error when a passage is not scored")
+	}
+}
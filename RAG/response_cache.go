@@ -0,0 +1,158 @@
+package RAG
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// DEFAULT_RESPONSE_CACHE_THRESHOLD is the cosine similarity a query needs to reuse the response of a cached one
+	DEFAULT_RESPONSE_CACHE_THRESHOLD = 0.95
+	DEFAULT_RESPONSE_CACHE_TTL       = 24 * time.Hour
+	// DEFAULT_RESPONSE_CACHE_SIZE is the number of responses kept per namespace
+	DEFAULT_RESPONSE_CACHE_SIZE = 1000
+)
+
+// ResponseCacheConfig tunes the semantic response cache of the chat queries
+type ResponseCacheConfig struct {
+	// Threshold is the cosine similarity between the query embeddings above which a response is reused
+	Threshold float64 `json:"threshold"`
+	// TTL is how long a response is reused
+	TTL time.Duration `json:"ttl"`
+	// MaxEntries bounds the responses of every namespace, the oldest ones go first
+	MaxEntries int `json:"max_entries"`
+}
+
+func (c ResponseCacheConfig) withDefaults() ResponseCacheConfig {
+	if c.Threshold <= 0 {
+		c.Threshold = DEFAULT_RESPONSE_CACHE_THRESHOLD
+	}
+	if c.TTL <= 0 {
+		c.TTL = DEFAULT_RESPONSE_CACHE_TTL
+	}
+	if c.MaxEntries <= 0 {
+		c.MaxEntries = DEFAULT_RESPONSE_CACHE_SIZE
+	}
+	return c
+}
+
+// ResponseCache keeps the chat responses of every namespace with the embedding of their query
+// so that near-identical questions are answered without retrieval and generation
+type ResponseCache struct {
+	config ResponseCacheConfig
+
+	mu         sync.Mutex
+	namespaces map[string][]*cachedResponse
+}
+
+type cachedResponse struct {
+	query     string
+	embedding []float32
+	norm      float32
+	response  ChatbotResponse
+	createdAt time.Time
+}
+
+// NewResponseCache creates an empty cache, the zero values of the config are replaced by the defaults
+func NewResponseCache(config ResponseCacheConfig) *ResponseCache {
+	return &ResponseCache{
+		config:     config.withDefaults(),
+		namespaces: make(map[string][]*cachedResponse),
+	}
+}
+
+// Config returns the config of the cache with its defaults applied
+func (c *ResponseCache) Config() ResponseCacheConfig {
+	return c.config
+}
+
+// Lookup returns the response of the most similar cached query of the namespace
+// along with its similarity, false when no fresh response is similar enough
+func (c *ResponseCache) Lookup(namespace string, embedding []float32) (ChatbotResponse, float64, bool) {
+	norm := vectorNorm(embedding)
+	if norm == 0 {
+		return ChatbotResponse{}, 0, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expireLocked(namespace)
+	var best *cachedResponse
+	bestScore := 0.0
+	for _, entry := range c.namespaces[namespace] {
+		if len(entry.embedding) != len(embedding) || entry.norm == 0 {
+			continue
+		}
+		score := float64(dotProduct(embedding, entry.embedding) / (norm * entry.norm))
+		if score > bestScore {
+			best, bestScore = entry, score
+		}
+	}
+	if best == nil || bestScore < c.config.Threshold {
+		return ChatbotResponse{}, bestScore, false
+	}
+	response := best.response
+	response.Sources = slices.Clone(response.Sources)
+	return response, bestScore, true
+}
+
+// Store caches the response to the query of the namespace
+func (c *ResponseCache) Store(namespace string, query string, embedding []float32, response ChatbotResponse) {
+	entry := &cachedResponse{
+		query:     query,
+		embedding: slices.Clone(embedding),
+		norm:      vectorNorm(embedding),
+		response:  response,
+		createdAt: time.Now(),
+	}
+	entry.response.Sources = slices.Clone(response.Sources)
+	entry.response.FromCache = false
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expireLocked(namespace)
+	entries := append(c.namespaces[namespace], entry)
+	if len(entries) > c.config.MaxEntries {
+		entries = slices.Delete(entries, 0, len(entries)-c.config.MaxEntries)
+	}
+	c.namespaces[namespace] = entries
+}
+
+// Invalidate drops the responses of the namespace, they were built from content that changed
+func (c *ResponseCache) Invalidate(namespace string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.namespaces, namespace)
+}
+
+// Len returns the number of fresh responses cached for the namespace
+func (c *ResponseCache) Len(namespace string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expireLocked(namespace)
+	return len(c.namespaces[namespace])
+}
+
+// expireLocked drops the responses older than the TTL, the entries are kept in the order they were stored
+func (c *ResponseCache) expireLocked(namespace string) {
+	entries := c.namespaces[namespace]
+	cutoff := time.Now().Add(-c.config.TTL)
+	expired := 0
+	for expired < len(entries) && entries[expired].createdAt.Before(cutoff) {
+		expired++
+	}
+	if expired == len(entries) {
+		delete(c.namespaces, namespace)
+		return
+	}
+	c.namespaces[namespace] = entries[expired:]
+}
+
+// invalidateResponses drops the cached chat responses of a namespace whose vectors changed
+func (r *RAGEngine) invalidateResponses(namespace string) {
+	if r.ResponseCache == nil {
+		return
+	}
+	r.ResponseCache.Invalidate(namespace)
+}
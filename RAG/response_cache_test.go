@@ -0,0 +1,97 @@
+package RAG_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+func TestQueryChatResponseCache(t *testing.T) {
+	store := newTestLocalStore(t, RAG.METRIC_COSINE)
+	llm := &fakeLLM{response: "add an index"}
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, store, llm)
+	engine.ResponseCache = RAG.NewResponseCache(RAG.ResponseCacheConfig{Threshold: 0.99})
+
+	first, err := engine.QueryChat("how do I add an index?")
+	if err != nil || first.FromCache {
+		t.Fatalf("expected a generated response, got %+v, %v", first, err)
+	}
+	// the same question worded a little differently is answered from the cache
+	second, err := engine.QueryChat("How do I add an index")
+	if err != nil || !second.FromCache || second.ResponseText != "add an index" {
+		t.Fatalf("expected a cached response, got %+v, %v", second, err)
+	}
+	if len(llm.prompts) != 1 {
+		t.Errorf("expected a single generation, got %d", len(llm.prompts))
+	}
+
+	// a different question is below the threshold
+	if response, _ := engine.QueryChat("eeee"); response.FromCache {
+		t.Errorf("expected a different question to miss the cache")
+	}
+
+	// writing to the namespace invalidates its responses
+	engine.Upsert("database-articles", []RAG.VectorRecord{{ID: "z", Values: []float32{0, 0, 1}, Metadata: map[string]any{"content": "z axis"}}})
+	if engine.ResponseCache.Len("database-articles") != 0 {
+		t.Fatalf("expected the upsert to invalidate the cached responses")
+	}
+	if response, _ := engine.QueryChat("how do I add an index?"); response.FromCache {
+		t.Errorf("expected the response to be generated again after the upsert")
+	}
+
+	engine.Ingest(context.Background(), "database-articles", []RAG.Document{{SourceURL: "https://example.com/new", Content: "use a partial index"}})
+	if engine.ResponseCache.Len("database-articles") != 0 {
+		t.Errorf("expected the ingestion to invalidate the cached responses")
+	}
+}
+
+func TestResponseCacheTTL(t *testing.T) {
+	cache := RAG.NewResponseCache(RAG.ResponseCacheConfig{TTL: 20 * time.Millisecond, MaxEntries: 2})
+	response := RAG.ChatbotResponse{ResponseText: "use CREATE INDEX", Sources: []string{"https://example.com/a"}}
+	cache.Store("database-articles", "add an index", []float32{1, 0}, response)
+
+	cached, similarity, ok := cache.Lookup("database-articles", []float32{2, 0})
+	if !ok || similarity < 0.99 || cached.ResponseText != response.ResponseText {
+		t.Fatalf("expected a cache hit, got %+v, %f, %v", cached, similarity, ok)
+	}
+	// the namespaces are cached separately
+	if _, _, ok := cache.Lookup("schemas-json", []float32{1, 0}); ok {
+		t.Errorf("expected another namespace to miss the cache")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, _, ok := cache.Lookup("database-articles", []float32{1, 0}); ok {
+		t.Errorf("expected the expired response to miss the cache")
+	}
+
+	// the oldest responses go first when a namespace is full
+	for _, query := range []string{"a", "b", "c"} {
+		cache.Store("database-articles", query, []float32{1, float32(len(query))}, response)
+	}
+	if cache.Len("database-articles") != 2 {
+		t.Errorf("expected 2 cached responses, got %d", cache.Len("database-articles"))
+	}
+}
+
+func TestResponseCacheConfig(t *testing.T) {
+	t.Setenv("RAG_RESPONSE_CACHE", "true")
+	t.Setenv("RAG_RESPONSE_CACHE_THRESHOLD", "0.9")
+	t.Setenv("RAG_RESPONSE_CACHE_TTL", "1h")
+	config, err := RAG.LoadConfigFromEnv()
+	if err != nil {
+		t.Fatalf("LoadConfigFromEnv failed: %v", err)
+	}
+	if config.ResponseCache == nil || config.ResponseCache.Threshold != 0.9 || config.ResponseCache.TTL != time.Hour {
+		t.Errorf("unexpected response cache config: %+v", config.ResponseCache)
+	}
+	t.Setenv("RAG_RESPONSE_CACHE_THRESHOLD", "1.5")
+	if _, err := RAG.LoadConfigFromEnv(); err == nil {
+		t.Errorf("expected an error for a threshold above 1")
+	}
+	t.Setenv("RAG_RESPONSE_CACHE", "")
+	if config, _ := RAG.LoadConfigFromEnv(); config.ResponseCache != nil {
+		t.Errorf("the response cache should be opt-in")
+	}
+}
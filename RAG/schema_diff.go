@@ -0,0 +1,804 @@
+package RAG
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// the actions of the schema changes
+const (
+	CHANGE_ADD    = "add"
+	CHANGE_DROP   = "drop"
+	CHANGE_ALTER  = "alter"
+	CHANGE_RENAME = "rename"
+)
+
+// the fields of a column that an alter changes
+const (
+	COLUMN_TYPE        = "type"
+	COLUMN_NULLABILITY = "nullability"
+	COLUMN_DEFAULT     = "default"
+)
+
+// SchemaConstraint is a constraint with all of its columns, a Table has a ConstraintInfo row per column
+type SchemaConstraint struct {
+	Name           string   `json:"name"`
+	Type           string   `json:"type"`
+	Columns        []string `json:"columns"`
+	ForeignTable   string   `json:"foreign_table,omitempty"`
+	ForeignColumns []string `json:"foreign_columns,omitempty"`
+	Check          string   `json:"check,omitempty"`
+}
+
+// SchemaIndex is an index with all of its columns, a Table has an IndexInfo row per column
+type SchemaIndex struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+	Type    string   `json:"type"`
+	Include []string `json:"include,omitempty"`
+	Where   string   `json:"where,omitempty"`
+}
+
+// TableChange is a table that is added, dropped or renamed, Old is nil when it is added and New when it is dropped
+type TableChange struct {
+	Action string `json:"action"`
+	Table  string `json:"table"`
+	Old    *Table `json:"old,omitempty"`
+	New    *Table `json:"new,omitempty"`
+}
+
+// ColumnChange is a column that is added, dropped, renamed or altered, Fields lists what an alter changes
+type ColumnChange struct {
+	Action string       `json:"action"`
+	Table  string       `json:"table"`
+	Column string       `json:"column"`
+	Old    *TableColumn `json:"old,omitempty"`
+	New    *TableColumn `json:"new,omitempty"`
+	Fields []string     `json:"fields,omitempty"`
+}
+
+// ConstraintChange is a constraint that is added, dropped or altered
+type ConstraintChange struct {
+	Action     string            `json:"action"`
+	Table      string            `json:"table"`
+	Constraint string            `json:"constraint"`
+	Old        *SchemaConstraint `json:"old,omitempty"`
+	New        *SchemaConstraint `json:"new,omitempty"`
+}
+
+// IndexChange is an index that is added, dropped or altered
+type IndexChange struct {
+	Action string       `json:"action"`
+	Table  string       `json:"table"`
+	Index  string       `json:"index"`
+	Old    *SchemaIndex `json:"old,omitempty"`
+	New    *SchemaIndex `json:"new,omitempty"`
+}
+
+// SchemaDiff lists the changes between two schemas, the changes of the columns, constraints and
+// indexes only cover the tables both schemas have
+type SchemaDiff struct {
+	Tables      []TableChange      `json:"tables"`
+	Columns     []ColumnChange     `json:"columns"`
+	Constraints []ConstraintChange `json:"constraints"`
+	Indexes     []IndexChange      `json:"indexes"`
+}
+
+// Empty reports whether the schemas are the same
+func (d SchemaDiff) Empty() bool {
+	return len(d.Tables) == 0 && len(d.Columns) == 0 && len(d.Constraints) == 0 && len(d.Indexes) == 0
+}
+
+// Describe lists the changes for the users, one line per change
+func (d SchemaDiff) Describe() []string {
+	lines := []string{}
+	for _, change := range d.Tables {
+		if change.Action == CHANGE_RENAME {
+			lines = append(lines, fmt.Sprintf("rename table %s to %s", change.Old.TableName, change.Table))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s table %s", change.Action, change.Table))
+	}
+	for _, change := range d.Columns {
+		line := fmt.Sprintf("%s column %s.%s", change.Action, change.Table, change.Column)
+		switch change.Action {
+		case CHANGE_RENAME:
+			line = fmt.Sprintf("rename column %s.%s to %s", change.Table, change.Old.ColumnName, change.Column)
+		case CHANGE_ADD:
+			line += " " + describeColumn(*change.New)
+		case CHANGE_ALTER:
+			details := []string{}
+			for _, field := range change.Fields {
+				switch field {
+				case COLUMN_TYPE:
+					details = append(details, fmt.Sprintf("type %s to %s", columnType(*change.Old), columnType(*change.New)))
+				case COLUMN_NULLABILITY:
+					details = append(details, fmt.Sprintf("nullable %t to %t", change.Old.IsNullable, change.New.IsNullable))
+				case COLUMN_DEFAULT:
+					details = append(details, fmt.Sprintf("default %s to %s", describeDefault(change.Old), describeDefault(change.New)))
+				}
+			}
+			line += ": " + strings.Join(details, ", ")
+		}
+		lines = append(lines, line)
+	}
+	for _, change := range d.Constraints {
+		definition := change.New
+		if definition == nil {
+			definition = change.Old
+		}
+		lines = append(lines, fmt.Sprintf("%s constraint %s on %s: %s (%s)", change.Action, change.Constraint, change.Table, definition.Type, strings.Join(definition.Columns, ", ")))
+	}
+	for _, change := range d.Indexes {
+		definition := change.New
+		if definition == nil {
+			definition = change.Old
+		}
+		line := fmt.Sprintf("%s index %s on %s (%s)", change.Action, change.Index, change.Table, strings.Join(definition.Columns, ", "))
+		if definition.Where != "" {
+			line += " where " + definition.Where
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func describeColumn(column TableColumn) string {
+	description := columnType(column)
+	if !column.IsNullable {
+		description += " not null"
+	}
+	if columnDefault(column) != "" {
+		description += " default " + columnDefault(column)
+	}
+	return description
+}
+
+func describeDefault(column *TableColumn) string {
+	if value := columnDefault(*column); value != "" {
+		return value
+	}
+	return "none"
+}
+
+// DiffSchemas compares two schemas, the names are compared case insensitively like PostgreSQL
+// does for unquoted identifiers and the changes are sorted by table, then in the order of the tables
+// a dropped table and an added one with the same columns are a rename, and so are a dropped column and
+// an added one of the same table with the same definition, when they are the only ones that match
+func DiffSchemas(old []Table, new []Table) SchemaDiff {
+	diff := SchemaDiff{
+		Tables:      []TableChange{},
+		Columns:     []ColumnChange{},
+		Constraints: []ConstraintChange{},
+		Indexes:     []IndexChange{},
+	}
+	oldTables := tablesByName(old)
+	newTables := tablesByName(new)
+	names := make([]string, 0, len(oldTables)+len(newTables))
+	for name := range oldTables {
+		names = append(names, name)
+	}
+	for name := range newTables {
+		if _, ok := oldTables[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	renamed := renamedTables(oldTables, newTables)
+	targets := make(map[string]bool, len(renamed))
+	for _, target := range renamed {
+		targets[target] = true
+	}
+
+	kept := []*Table{}
+	columnRenames := make(map[string]map[string]string)
+	for _, name := range names {
+		oldTable, inOld := oldTables[name]
+		newTable, inNew := newTables[name]
+		if target, ok := renamed[name]; ok {
+			newTable, inNew = newTables[target], true
+			diff.Tables = append(diff.Tables, TableChange{Action: CHANGE_RENAME, Table: newTable.TableName, Old: oldTable, New: newTable})
+		}
+		switch {
+		case targets[name] && !inOld:
+		case !inOld:
+			diff.Tables = append(diff.Tables, TableChange{Action: CHANGE_ADD, Table: newTable.TableName, New: newTable})
+		case !inNew:
+			diff.Tables = append(diff.Tables, TableChange{Action: CHANGE_DROP, Table: oldTable.TableName, Old: oldTable})
+		default:
+			for _, change := range diffColumns(*oldTable, *newTable) {
+				diff.Columns = append(diff.Columns, change)
+				if change.Action == CHANGE_RENAME {
+					key := identifierKey(newTable.TableName)
+					if columnRenames[key] == nil {
+						columnRenames[key] = make(map[string]string)
+					}
+					columnRenames[key][identifierKey(change.Old.ColumnName)] = change.Column
+				}
+			}
+			kept = append(kept, newTable)
+		}
+	}
+
+	// the constraints and indexes follow the renames in PostgreSQL, they are compared to the old schema
+	// as it is once the tables and columns are renamed
+	tableRenames := make(map[string]string, len(renamed))
+	for name, target := range renamed {
+		tableRenames[name] = newTables[target].TableName
+	}
+	old = renameSchema(old, tableRenames, columnRenames)
+	oldTables = tablesByName(old)
+	for _, newTable := range kept {
+		oldTable := oldTables[identifierKey(newTable.TableName)]
+		diff.Constraints = append(diff.Constraints, diffConstraints(*oldTable, *newTable)...)
+		diff.Indexes = append(diff.Indexes, diffIndexes(*oldTable, *newTable)...)
+	}
+	diff.Constraints = append(diff.Constraints, dependentForeignKeys(diff, old, newTables)...)
+	return diff
+}
+
+// renameSchema copies the tables with the renamed tables and columns, the tables are keyed by their old name
+// and the columns by the new name of their table and their old name
+func renameSchema(tables []Table, tableRenames map[string]string, columnRenames map[string]map[string]string) []Table {
+	if len(tableRenames) == 0 && len(columnRenames) == 0 {
+		return tables
+	}
+	tableName := func(name string) string {
+		if renamed, ok := tableRenames[identifierKey(name)]; ok {
+			return renamed
+		}
+		return name
+	}
+	columnName := func(table string, name string) string {
+		if renamed, ok := columnRenames[identifierKey(table)][identifierKey(name)]; ok {
+			return renamed
+		}
+		return name
+	}
+	renamed := make([]Table, len(tables))
+	for position, table := range tables {
+		table.TableName = tableName(table.TableName)
+		table.Columns = slices.Clone(table.Columns)
+		for index := range table.Columns {
+			table.Columns[index].TableName = table.TableName
+			table.Columns[index].ColumnName = columnName(table.TableName, table.Columns[index].ColumnName)
+		}
+		table.Constraints = slices.Clone(table.Constraints)
+		for index := range table.Constraints {
+			constraint := &table.Constraints[index]
+			constraint.TableName = table.TableName
+			if constraint.ColumnName != nil {
+				constraint.ColumnName = ptrTo(columnName(table.TableName, *constraint.ColumnName))
+			}
+			if constraint.ForeignTableName != nil {
+				constraint.ForeignTableName = ptrTo(tableName(*constraint.ForeignTableName))
+				if constraint.ForeignColumnName != nil {
+					constraint.ForeignColumnName = ptrTo(columnName(*constraint.ForeignTableName, *constraint.ForeignColumnName))
+				}
+			}
+		}
+		table.Indexes = slices.Clone(table.Indexes)
+		for index := range table.Indexes {
+			table.Indexes[index].TableName = table.TableName
+			table.Indexes[index].ColumnName = columnName(table.TableName, table.Indexes[index].ColumnName)
+		}
+		renamed[position] = table
+	}
+	return renamed
+}
+
+func ptrTo[T any](value T) *T {
+	return &value
+}
+
+// renamedTables pairs the dropped tables with the added tables that have the same columns,
+// a table that matches more than one other is not paired, the keys are the names of the old tables
+func renamedTables(oldTables map[string]*Table, newTables map[string]*Table) map[string]string {
+	dropped := make(map[string][]string)
+	for name, table := range oldTables {
+		if _, ok := newTables[name]; !ok && len(table.Columns) > 0 {
+			dropped[tableSignature(*table)] = append(dropped[tableSignature(*table)], name)
+		}
+	}
+	added := make(map[string][]string)
+	for name, table := range newTables {
+		if _, ok := oldTables[name]; !ok && len(table.Columns) > 0 {
+			added[tableSignature(*table)] = append(added[tableSignature(*table)], name)
+		}
+	}
+	renamed := make(map[string]string)
+	for signature, names := range dropped {
+		if len(names) == 1 && len(added[signature]) == 1 {
+			renamed[names[0]] = added[signature][0]
+		}
+	}
+	return renamed
+}
+
+// tableSignature lists the columns of the table with their definitions in their ordinal order
+func tableSignature(table Table) string {
+	columns := []string{}
+	for _, index := range sortedColumns(table.Columns) {
+		columns = append(columns, identifierKey(table.Columns[index].ColumnName)+" "+describeColumn(table.Columns[index]))
+	}
+	return strings.Join(columns, ", ")
+}
+
+// dependentForeignKeys are the foreign keys PostgreSQL needs to drop before a key they reference is dropped
+// or altered, or before the table they reference is dropped, the ones of a kept table are added again
+// when the new schema still has the key they reference
+func dependentForeignKeys(diff SchemaDiff, old []Table, newTables map[string]*Table) []ConstraintChange {
+	type key struct {
+		primary bool
+		columns []string
+	}
+	keys := make(map[string][]key)
+	changed := make(map[string]bool)
+	for _, change := range diff.Constraints {
+		changed[identifierKey(change.Table)+"."+identifierKey(change.Constraint)] = true
+		if change.Action != CHANGE_ADD && (change.Old.Type == "PRIMARY KEY" || change.Old.Type == "UNIQUE") {
+			keys[identifierKey(change.Table)] = append(keys[identifierKey(change.Table)], key{change.Old.Type == "PRIMARY KEY", identifierKeys(change.Old.Columns)})
+		}
+	}
+	dropped := make(map[string]bool)
+	for _, change := range diff.Tables {
+		if change.Action == CHANGE_DROP {
+			dropped[identifierKey(change.Table)] = true
+		}
+	}
+	// a foreign key without columns references the primary key
+	references := func(constraint SchemaConstraint, key key) bool {
+		if len(constraint.ForeignColumns) == 0 {
+			return key.primary
+		}
+		return slices.Equal(identifierKeys(constraint.ForeignColumns), key.columns)
+	}
+
+	changes := []ConstraintChange{}
+	for _, table := range old {
+		name := identifierKey(table.TableName)
+		newTable, kept := newTables[name]
+		for _, constraint := range TableConstraints(table) {
+			if !isForeignKey(&constraint) || changed[name+"."+identifierKey(constraint.Name)] {
+				continue
+			}
+			foreign := identifierKey(constraint.ForeignTable)
+			dependent := kept && dropped[foreign]
+			for _, key := range keys[foreign] {
+				dependent = dependent || references(constraint, key)
+			}
+			if !dependent {
+				continue
+			}
+			constraint := constraint
+			change := ConstraintChange{Action: CHANGE_DROP, Table: table.TableName, Constraint: constraint.Name, Old: &constraint}
+			if referenced, ok := newTables[foreign]; kept && ok {
+				for _, candidate := range TableConstraints(*referenced) {
+					again := findConstraint(TableConstraints(*newTable), constraint)
+					if again != nil && (candidate.Type == "PRIMARY KEY" || candidate.Type == "UNIQUE") &&
+						references(*again, key{candidate.Type == "PRIMARY KEY", identifierKeys(candidate.Columns)}) {
+						change.Action, change.New = CHANGE_ALTER, again
+						break
+					}
+				}
+			}
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// tablesByName indexes the tables by their lower case name, the last one wins
+func tablesByName(tables []Table) map[string]*Table {
+	byName := make(map[string]*Table, len(tables))
+	for index := range tables {
+		byName[identifierKey(tables[index].TableName)] = &tables[index]
+	}
+	return byName
+}
+
+// identifierKey is the name PostgreSQL compares, unquoted identifiers are folded to lower case
+// and a schema qualified name is compared part by part
+func identifierKey(name string) string {
+	name = strings.TrimSpace(name)
+	if parts := splitQualified(name); len(parts) > 1 {
+		return strings.Join(identifierKeys(parts), ".")
+	}
+	if unquoted, ok := strings.CutPrefix(name, `"`); ok {
+		if unquoted, ok = strings.CutSuffix(unquoted, `"`); ok {
+			return strings.ReplaceAll(unquoted, `""`, `"`)
+		}
+	}
+	return strings.ToLower(name)
+}
+
+func diffColumns(old Table, new Table) []ColumnChange {
+	changes := []ColumnChange{}
+	oldColumns := make(map[string]*TableColumn, len(old.Columns))
+	for index := range old.Columns {
+		oldColumns[identifierKey(old.Columns[index].ColumnName)] = &old.Columns[index]
+	}
+	newColumns := make(map[string]bool, len(new.Columns))
+	for index := range new.Columns {
+		newColumns[identifierKey(new.Columns[index].ColumnName)] = true
+	}
+	renamed := renamedColumns(old, new, oldColumns, newColumns)
+	for _, index := range sortedColumns(new.Columns) {
+		column := &new.Columns[index]
+		key := identifierKey(column.ColumnName)
+		previous, ok := oldColumns[key]
+		if rename, isRename := renamed[key]; isRename {
+			changes = append(changes, ColumnChange{Action: CHANGE_RENAME, Table: new.TableName, Column: column.ColumnName, Old: rename, New: column})
+			continue
+		}
+		if !ok {
+			changes = append(changes, ColumnChange{Action: CHANGE_ADD, Table: new.TableName, Column: column.ColumnName, New: column})
+			continue
+		}
+		fields := []string{}
+		if columnType(*previous) != columnType(*column) {
+			fields = append(fields, COLUMN_TYPE)
+		}
+		if previous.IsNullable != column.IsNullable {
+			fields = append(fields, COLUMN_NULLABILITY)
+		}
+		if columnDefault(*previous) != columnDefault(*column) {
+			fields = append(fields, COLUMN_DEFAULT)
+		}
+		if len(fields) > 0 {
+			changes = append(changes, ColumnChange{Action: CHANGE_ALTER, Table: new.TableName, Column: column.ColumnName, Old: previous, New: column, Fields: fields})
+		}
+	}
+	sources := make(map[*TableColumn]bool, len(renamed))
+	for _, column := range renamed {
+		sources[column] = true
+	}
+	for _, index := range sortedColumns(old.Columns) {
+		column := &old.Columns[index]
+		if !newColumns[identifierKey(column.ColumnName)] && !sources[column] {
+			changes = append(changes, ColumnChange{Action: CHANGE_DROP, Table: new.TableName, Column: column.ColumnName, Old: column})
+		}
+	}
+	return changes
+}
+
+// renamedColumns pairs the dropped columns with the added columns that have the same definition,
+// a column that matches more than one other is not paired, the keys are the names of the new columns
+func renamedColumns(old Table, new Table, oldColumns map[string]*TableColumn, newColumns map[string]bool) map[string]*TableColumn {
+	dropped := make(map[string][]*TableColumn)
+	for index := range old.Columns {
+		column := &old.Columns[index]
+		if !newColumns[identifierKey(column.ColumnName)] {
+			dropped[describeColumn(*column)] = append(dropped[describeColumn(*column)], column)
+		}
+	}
+	added := make(map[string][]string)
+	for _, column := range new.Columns {
+		if key := identifierKey(column.ColumnName); oldColumns[key] == nil {
+			added[describeColumn(column)] = append(added[describeColumn(column)], key)
+		}
+	}
+	renamed := make(map[string]*TableColumn)
+	for definition, columns := range dropped {
+		if len(columns) == 1 && len(added[definition]) == 1 {
+			renamed[added[definition][0]] = columns[0]
+		}
+	}
+	return renamed
+}
+
+// sortedColumns returns the indexes of the columns in their ordinal order
+func sortedColumns(columns []TableColumn) []int {
+	order := make([]int, len(columns))
+	for index := range order {
+		order[index] = index
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return columns[order[i]].OrdinalPosition < columns[order[j]].OrdinalPosition
+	})
+	return order
+}
+
+func diffConstraints(old Table, new Table) []ConstraintChange {
+	changes := []ConstraintChange{}
+	oldConstraints := TableConstraints(old)
+	newConstraints := TableConstraints(new)
+	for index := range newConstraints {
+		constraint := &newConstraints[index]
+		previous := findConstraint(oldConstraints, *constraint)
+		switch {
+		case previous == nil:
+			changes = append(changes, ConstraintChange{Action: CHANGE_ADD, Table: new.TableName, Constraint: constraint.Name, New: constraint})
+		case !sameConstraint(*previous, *constraint):
+			changes = append(changes, ConstraintChange{Action: CHANGE_ALTER, Table: new.TableName, Constraint: constraint.Name, Old: previous, New: constraint})
+		}
+	}
+	for index := range oldConstraints {
+		constraint := &oldConstraints[index]
+		if findConstraint(newConstraints, *constraint) == nil {
+			changes = append(changes, ConstraintChange{Action: CHANGE_DROP, Table: new.TableName, Constraint: constraint.Name, Old: constraint})
+		}
+	}
+	return changes
+}
+
+// findConstraint finds the constraint by name, the unnamed ones by their definition
+func findConstraint(constraints []SchemaConstraint, target SchemaConstraint) *SchemaConstraint {
+	for index := range constraints {
+		constraint := &constraints[index]
+		if target.Name != "" && identifierKey(constraint.Name) == identifierKey(target.Name) {
+			return constraint
+		}
+		if target.Name == "" && constraint.Name == "" && sameConstraint(*constraint, target) {
+			return constraint
+		}
+	}
+	return nil
+}
+
+func sameConstraint(a SchemaConstraint, b SchemaConstraint) bool {
+	return a.Type == b.Type &&
+		slices.Equal(identifierKeys(a.Columns), identifierKeys(b.Columns)) &&
+		identifierKey(a.ForeignTable) == identifierKey(b.ForeignTable) &&
+		slices.Equal(identifierKeys(a.ForeignColumns), identifierKeys(b.ForeignColumns)) &&
+		normalizeExpression(a.Check) == normalizeExpression(b.Check)
+}
+
+func diffIndexes(old Table, new Table) []IndexChange {
+	changes := []IndexChange{}
+	oldIndexes := TableIndexes(old)
+	newIndexes := TableIndexes(new)
+	for index := range newIndexes {
+		definition := &newIndexes[index]
+		previous := findIndex(oldIndexes, definition.Name)
+		switch {
+		case previous == nil:
+			changes = append(changes, IndexChange{Action: CHANGE_ADD, Table: new.TableName, Index: definition.Name, New: definition})
+		case !sameIndex(*previous, *definition):
+			changes = append(changes, IndexChange{Action: CHANGE_ALTER, Table: new.TableName, Index: definition.Name, Old: previous, New: definition})
+		}
+	}
+	for index := range oldIndexes {
+		definition := &oldIndexes[index]
+		if findIndex(newIndexes, definition.Name) == nil {
+			changes = append(changes, IndexChange{Action: CHANGE_DROP, Table: new.TableName, Index: definition.Name, Old: definition})
+		}
+	}
+	return changes
+}
+
+func findIndex(indexes []SchemaIndex, name string) *SchemaIndex {
+	for index := range indexes {
+		if identifierKey(indexes[index].Name) == identifierKey(name) {
+			return &indexes[index]
+		}
+	}
+	return nil
+}
+
+func sameIndex(a SchemaIndex, b SchemaIndex) bool {
+	return a.Unique == b.Unique && a.Type == b.Type && a.Where == b.Where &&
+		slices.Equal(identifierKeys(a.Columns), identifierKeys(b.Columns)) && slices.Equal(identifierKeys(a.Include), identifierKeys(b.Include))
+}
+
+// splitQualified splits a name on the dots that are not quoted
+func splitQualified(name string) []string {
+	parts := []string{}
+	quoted := false
+	start := 0
+	for index, char := range name {
+		switch {
+		case char == '"':
+			quoted = !quoted
+		case char == '.' && !quoted:
+			parts = append(parts, name[start:index])
+			start = index + 1
+		}
+	}
+	return append(parts, name[start:])
+}
+
+func identifierKeys(names []string) []string {
+	keys := make([]string, len(names))
+	for index, name := range names {
+		keys[index] = identifierKey(name)
+	}
+	return keys
+}
+
+// notNullCheck matches the NOT NULL checks information_schema lists as constraints, the columns already have them
+var notNullCheck = regexp.MustCompile(`(?i)^\(?\s*"?[\w$]+"?\s+IS\s+NOT\s+NULL\s*\)?$`)
+
+// TableConstraints groups the constraint rows of the table by constraint, in the order of their first row
+// and with the columns in their ordinal order, the NOT NULL checks are left out since they are part of the columns
+// the rows without a name are one constraint while they follow each other with the next ordinal position
+func TableConstraints(table Table) []SchemaConstraint {
+	type constraintColumn struct {
+		column   string
+		foreign  string
+		position int
+	}
+	constraints := []SchemaConstraint{}
+	columns := [][]constraintColumn{}
+	positions := make(map[string]int)
+	unnamed, ordinal := -1, 0
+	for _, row := range table.Constraints {
+		check := ""
+		if row.CheckClause != nil {
+			check = strings.TrimSpace(*row.CheckClause)
+		}
+		constraintType := strings.Join(strings.Fields(strings.ToUpper(row.ConstraintType)), " ")
+		if constraintType == "CHECK" && notNullCheck.MatchString(check) {
+			continue
+		}
+		foreignTable := ""
+		if row.ForeignTableName != nil {
+			foreignTable = *row.ForeignTableName
+		}
+		key := identifierKey(row.ConstraintName)
+		position, ok := positions[key]
+		if key == "" {
+			previous := unnamed
+			ok = previous >= 0 && row.OrdinalPosition != nil && *row.OrdinalPosition == ordinal+1 &&
+				constraints[previous].Type == constraintType && constraints[previous].Check == check &&
+				identifierKey(constraints[previous].ForeignTable) == identifierKey(foreignTable)
+			position = previous
+		}
+		if !ok {
+			position = len(constraints)
+			if key != "" {
+				positions[key] = position
+			}
+			constraints = append(constraints, SchemaConstraint{Name: row.ConstraintName, Type: constraintType, Check: check})
+			columns = append(columns, nil)
+		}
+		unnamed, ordinal = -1, 0
+		if key == "" {
+			unnamed = position
+			if row.OrdinalPosition != nil {
+				ordinal = *row.OrdinalPosition
+			}
+		}
+		if foreignTable != "" {
+			constraints[position].ForeignTable = foreignTable
+		}
+		if row.ColumnName == nil || *row.ColumnName == "" {
+			continue
+		}
+		column := constraintColumn{column: *row.ColumnName, position: len(columns[position])}
+		if row.OrdinalPosition != nil {
+			column.position = *row.OrdinalPosition
+		}
+		if row.ForeignColumnName != nil {
+			column.foreign = *row.ForeignColumnName
+		}
+		columns[position] = append(columns[position], column)
+	}
+
+	for position := range constraints {
+		sort.SliceStable(columns[position], func(i, j int) bool {
+			return columns[position][i].position < columns[position][j].position
+		})
+		constraint := &constraints[position]
+		for _, column := range columns[position] {
+			// information_schema repeats a column once per referenced column of a composite foreign key
+			if !slices.Contains(constraint.Columns, column.column) {
+				constraint.Columns = append(constraint.Columns, column.column)
+			}
+			if column.foreign != "" && !slices.Contains(constraint.ForeignColumns, column.foreign) {
+				constraint.ForeignColumns = append(constraint.ForeignColumns, column.foreign)
+			}
+		}
+	}
+	return constraints
+}
+
+// TableIndexes groups the index rows of the table by index, in the order of their first row
+// the indexes of the primary key and of the unique constraints are left out since the constraints create them
+func TableIndexes(table Table) []SchemaIndex {
+	constraints := make(map[string]bool)
+	for _, constraint := range table.Constraints {
+		constraints[identifierKey(constraint.ConstraintName)] = true
+	}
+	indexes := []SchemaIndex{}
+	positions := make(map[string]int)
+	for _, row := range table.Indexes {
+		key := identifierKey(row.IndexName)
+		if row.IsPrimary || constraints[key] {
+			continue
+		}
+		position, ok := positions[key]
+		if !ok {
+			position = len(indexes)
+			positions[key] = position
+			indexType := strings.ToLower(strings.TrimSpace(row.IndexType))
+			if indexType == "" {
+				indexType = "btree"
+			}
+			indexes = append(indexes, SchemaIndex{Name: row.IndexName, Unique: row.IsUnique, Type: indexType, Where: normalizeExpression(row.Predicate)})
+		}
+		switch {
+		case row.ColumnName == "":
+		case row.IsIncluded:
+			indexes[position].Include = append(indexes[position].Include, row.ColumnName)
+		default:
+			indexes[position].Columns = append(indexes[position].Columns, row.ColumnName)
+		}
+	}
+	return indexes
+}
+
+// typeAliases maps the short names of the PostgreSQL types to the names information_schema uses
+var typeAliases = map[string]string{
+	"int":         "integer",
+	"int4":        "integer",
+	"int2":        "smallint",
+	"int8":        "bigint",
+	"serial":      "integer",
+	"serial4":     "integer",
+	"bigserial":   "bigint",
+	"serial8":     "bigint",
+	"smallserial": "smallint",
+	"serial2":     "smallint",
+	"float4":      "real",
+	"float8":      "double precision",
+	"float":       "double precision",
+	"bool":        "boolean",
+	"varchar":     "character varying",
+	"char":        "character",
+	"decimal":     "numeric",
+	"timestamp":   "timestamp without time zone",
+	"timestamptz": "timestamp with time zone",
+	"time":        "time without time zone",
+	"timetz":      "time with time zone",
+}
+
+// typeModifier splits a type like varchar(255) into its name and its modifier
+var typeModifier = regexp.MustCompile(`^([^(]+?)\s*(\(.*\))?(\[\])?$`)
+
+// columnType is the normalized type of the column, with the length or the precision information_schema reports apart
+func columnType(column TableColumn) string {
+	dataType := strings.Join(strings.Fields(strings.ToLower(column.DataType)), " ")
+	parts := typeModifier.FindStringSubmatch(dataType)
+	if parts == nil {
+		return dataType
+	}
+	name, modifier, array := parts[1], strings.ReplaceAll(parts[2], " ", ""), parts[3]
+	if alias, ok := typeAliases[name]; ok {
+		name = alias
+	}
+	if modifier == "" {
+		switch {
+		case column.CharacterMaximumLength != nil && (name == "character varying" || name == "character" || name == "bit" || name == "bit varying"):
+			modifier = fmt.Sprintf("(%d)", *column.CharacterMaximumLength)
+		case column.NumericPrecision != nil && name == "numeric":
+			if column.NumericScale != nil && *column.NumericScale != 0 {
+				modifier = fmt.Sprintf("(%d,%d)", *column.NumericPrecision, *column.NumericScale)
+			} else {
+				modifier = fmt.Sprintf("(%d)", *column.NumericPrecision)
+			}
+		}
+	}
+	return name + modifier + array
+}
+
+// columnDefault is the default expression of the column, empty when it has none
+func columnDefault(column TableColumn) string {
+	if column.ColumnDefault == nil {
+		return ""
+	}
+	value := normalizeExpression(*column.ColumnDefault)
+	if strings.EqualFold(value, "null") {
+		return ""
+	}
+	return value
+}
+
+// normalizeExpression collapses the whitespace of an expression
+func normalizeExpression(expression string) string {
+	return strings.Join(strings.Fields(expression), " ")
+}
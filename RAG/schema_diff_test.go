@@ -0,0 +1,125 @@
+package RAG_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+func ptr[T any](value T) *T {
+	return &value
+}
+
+// gymSchema is a members table with a primary key, a unique email and an index on the name
+// and a visits table with a foreign key to members
+func gymSchema() []RAG.Table {
+	return []RAG.Table{
+		{
+			TableName: "members",
+			Columns: []RAG.TableColumn{
+				{TableName: "members", ColumnName: "id", DataType: "integer", IsNullable: false, ColumnDefault: ptr("nextval('members_id_seq'::regclass)"), OrdinalPosition: 1},
+				{TableName: "members", ColumnName: "email", DataType: "character varying", IsNullable: false, CharacterMaximumLength: ptr(100), OrdinalPosition: 2},
+				{TableName: "members", ColumnName: "name", DataType: "text", IsNullable: true, OrdinalPosition: 3},
+			},
+			Constraints: []RAG.ConstraintInfo{
+				{TableName: "members", ConstraintName: "members_pkey", ConstraintType: "PRIMARY KEY", ColumnName: ptr("id"), OrdinalPosition: ptr(1)},
+				{TableName: "members", ConstraintName: "members_email_key", ConstraintType: "UNIQUE", ColumnName: ptr("email"), OrdinalPosition: ptr(1)},
+				{TableName: "members", ConstraintName: "2200_16386_1_not_null", ConstraintType: "CHECK", CheckClause: ptr("id IS NOT NULL")},
+			},
+			Indexes: []RAG.IndexInfo{
+				{TableName: "members", IndexName: "members_pkey", ColumnName: "id", IsUnique: true, IndexType: "btree", IsPrimary: true},
+				{TableName: "members", IndexName: "members_email_key", ColumnName: "email", IsUnique: true, IndexType: "btree"},
+				{TableName: "members", IndexName: "members_name_idx", ColumnName: "name", IndexType: "btree"},
+			},
+		},
+		{
+			TableName: "visits",
+			Columns: []RAG.TableColumn{
+				{TableName: "visits", ColumnName: "member_id", DataType: "integer", OrdinalPosition: 1},
+				{TableName: "visits", ColumnName: "visited_at", DataType: "timestamp with time zone", ColumnDefault: ptr("now()"), OrdinalPosition: 2},
+			},
+			Constraints: []RAG.ConstraintInfo{
+				{TableName: "visits", ConstraintName: "visits_member_id_fkey", ConstraintType: "FOREIGN KEY", ColumnName: ptr("member_id"), ForeignTableName: ptr("members"), ForeignColumnName: ptr("id"), OrdinalPosition: ptr(1)},
+			},
+		},
+	}
+}
+
+func TestDiffSchemasSame(t *testing.T) {
+	old := gymSchema()
+	new := gymSchema()
+	// the aliases, the case of the names and the length written in the type are the same schema
+	new[0].TableName = "Members"
+	new[0].Columns[1].DataType = "VARCHAR(100)"
+	new[0].Columns[1].CharacterMaximumLength = nil
+	new[1].Columns[1].DataType = "timestamptz"
+	new[0].Constraints = new[0].Constraints[:2]
+
+	if diff := RAG.DiffSchemas(old, new); !diff.Empty() {
+		t.Errorf("expected no changes, got %v", diff.Describe())
+	}
+}
+
+func TestDiffSchemas(t *testing.T) {
+	old := gymSchema()
+	new := gymSchema()
+	members := &new[0]
+	members.Columns[1].CharacterMaximumLength = ptr(255)
+	members.Columns[2].IsNullable = false
+	members.Columns[2].ColumnDefault = ptr("'unknown'::text")
+	members.Columns = append(members.Columns, RAG.TableColumn{TableName: "members", ColumnName: "phone", DataType: "text", IsNullable: true, OrdinalPosition: 4})
+	members.Indexes = members.Indexes[:2]
+	members.Indexes = append(members.Indexes, RAG.IndexInfo{TableName: "members", IndexName: "members_phone_idx", ColumnName: "phone", IndexType: "hash"})
+	visits := &new[1]
+	visits.Columns = visits.Columns[:1]
+	visits.Constraints[0].ForeignColumnName = ptr("email")
+	new = append(new, RAG.Table{TableName: "gyms", Columns: []RAG.TableColumn{{TableName: "gyms", ColumnName: "id", DataType: "serial"}}})
+	old = append(old, RAG.Table{TableName: "trainers"})
+
+	diff := RAG.DiffSchemas(old, new)
+	expected := []string{
+		"add table gyms",
+		"drop table trainers",
+		"alter column members.email: type character varying(100) to character varying(255)",
+		"alter column members.name: nullable true to false, default none to 'unknown'::text",
+		"add column members.phone text",
+		"drop column visits.visited_at",
+		"alter constraint visits_member_id_fkey on visits: FOREIGN KEY (member_id)",
+		"add index members_phone_idx on members (phone)",
+		"drop index members_name_idx on members (name)",
+	}
+	if lines := diff.Describe(); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("unexpected changes:\n%q\nexpected:\n%q", lines, expected)
+	}
+	if change := diff.Columns[1]; !reflect.DeepEqual(change.Fields, []string{RAG.COLUMN_NULLABILITY, RAG.COLUMN_DEFAULT}) || change.Old.IsNullable != true {
+		t.Errorf("unexpected column change: %+v", change)
+	}
+	if change := diff.Constraints[0]; change.Old.ForeignColumns[0] != "id" || change.New.ForeignColumns[0] != "email" {
+		t.Errorf("unexpected constraint change: %+v", change)
+	}
+}
+
+func TestTableConstraintsComposite(t *testing.T) {
+	// information_schema lists a composite foreign key once per pair of columns, not in order
+	table := RAG.Table{TableName: "bookings", Constraints: []RAG.ConstraintInfo{
+		{ConstraintName: "bookings_slot_fkey", ConstraintType: "foreign key", ColumnName: ptr("slot_day"), ForeignTableName: ptr("slots"), ForeignColumnName: ptr("day"), OrdinalPosition: ptr(2)},
+		{ConstraintName: "bookings_slot_fkey", ConstraintType: "foreign key", ColumnName: ptr("gym_id"), ForeignTableName: ptr("slots"), ForeignColumnName: ptr("gym_id"), OrdinalPosition: ptr(1)},
+		{ConstraintName: "bookings_check", ConstraintType: "CHECK", CheckClause: ptr("(ends_at > starts_at)")},
+		// the rows without a name are grouped while their ordinal positions follow each other
+		{ConstraintType: "UNIQUE", ColumnName: ptr("gym_id"), OrdinalPosition: ptr(1)},
+		{ConstraintType: "UNIQUE", ColumnName: ptr("starts_at"), OrdinalPosition: ptr(2)},
+		{ConstraintType: "UNIQUE", ColumnName: ptr("code"), OrdinalPosition: ptr(1)},
+		{ConstraintType: "FOREIGN KEY", ColumnName: ptr("slot_day"), ForeignTableName: ptr("days"), ForeignColumnName: ptr("day"), OrdinalPosition: ptr(2)},
+	}}
+	expected := []RAG.SchemaConstraint{
+		{Name: "bookings_slot_fkey", Type: "FOREIGN KEY", Columns: []string{"gym_id", "slot_day"}, ForeignTable: "slots", ForeignColumns: []string{"gym_id", "day"}},
+		{Name: "bookings_check", Type: "CHECK", Check: "(ends_at > starts_at)"},
+		{Type: "UNIQUE", Columns: []string{"gym_id", "starts_at"}},
+		{Type: "UNIQUE", Columns: []string{"code"}},
+		{Type: "FOREIGN KEY", Columns: []string{"slot_day"}, ForeignTable: "days", ForeignColumns: []string{"day"}},
+	}
+	if constraints := RAG.TableConstraints(table); !reflect.DeepEqual(constraints, expected) {
+		t.Errorf("unexpected constraints: %+v", constraints)
+	}
+}
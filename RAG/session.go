@@ -0,0 +1,225 @@
+package RAG
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_HISTORY_TOKEN_BUDGET = 2000
+	// the latest turns are always sent verbatim, older ones get summarized
+	HISTORY_KEEP_TURNS = 4
+)
+
+// ChatSession is a multi-turn conversation with the chatbot
+// follow-up questions are rewritten into standalone retrieval queries and
+// the previous turns are sent to the model as chat history
+type ChatSession struct {
+	engine *RAGEngine
+
+	// Namespace is searched for the context of every question, defaults to DEFAULT_CHAT_NAMESPACE
+	Namespace string
+	// TopK is the number of matches used as context, defaults to DEFAULT_TOP_K
+	TopK int
+	// Filter scopes the context of every question by the metadata of the articles, nil uses every article
+	Filter MetadataFilter
+
+	// HistoryTokenBudget bounds the estimated size of the history sent to the model,
+	// older turns are summarized once it is exceeded, defaults to DEFAULT_HISTORY_TOKEN_BUDGET
+	HistoryTokenBudget int
+
+	mu      sync.Mutex
+	summary string
+	turns   []ChatTurn
+}
+
+// NewChatSession starts a new conversation
+func (r *RAGEngine) NewChatSession() *ChatSession {
+	return &ChatSession{
+		engine:             r,
+		Namespace:          DEFAULT_CHAT_NAMESPACE,
+		TopK:               DEFAULT_TOP_K,
+		HistoryTokenBudget: DEFAULT_HISTORY_TOKEN_BUDGET,
+	}
+}
+
+// History returns the history that is sent to the model with the next question
+// the summary of the older turns comes first when there is one
+func (s *ChatSession) History() []ChatTurn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := []ChatTurn{}
+	if s.summary != "" {
+		history = append(history,
+			ChatTurn{Role: ROLE_USER, Content: "Summary of our earlier conversation:\n" + s.summary},
+			ChatTurn{Role: ROLE_MODEL, Content: "Understood, I will continue from this summary."},
+		)
+	}
+	return append(history, s.turns...)
+}
+
+// Reset forgets the conversation
+func (s *ChatSession) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summary = ""
+	s.turns = nil
+}
+
+// Query answers the next question of the conversation
+func (s *ChatSession) Query(ctx context.Context, query string) (ChatbotResponse, error) {
+	history, prompt, sources, err := s.prepare(ctx, query)
+	if err != nil {
+		return ChatbotResponse{}, err
+	}
+	if prompt == "" {
+		return ChatbotResponse{ResponseText: CHAT_FAIL_RESPONSE}, nil
+	}
+
+	startTime := time.Now()
+	responseText, err := s.engine.generateChat(ctx, history, prompt)
+	if err != nil {
+		log.Printf("ERROR: Failed to generate response: %v", err)
+		return ChatbotResponse{}, err
+	}
+	log.Printf("INFO: Response generation took %f seconds", time.Since(startTime).Seconds())
+
+	if responseText == "" {
+		log.Printf("WARNING: Generated response is empty, using fallback response")
+		return ChatbotResponse{ResponseText: CHAT_FAIL_RESPONSE, Sources: sources}, nil
+	}
+	s.record(query, responseText)
+	return ChatbotResponse{ResponseText: responseText, Sources: sources}, nil
+}
+
+// QueryStream answers the next question of the conversation as a stream, see QueryChatStream
+// the turn is only added to the history when the whole response was generated
+func (s *ChatSession) QueryStream(ctx context.Context, query string) (<-chan ChatStreamEvent, error) {
+	history, prompt, sources, err := s.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return s.engine.streamResponse(ctx, history, prompt, sources, func(response string) {
+		s.record(query, response)
+	}), nil
+}
+
+// prepare trims the history and builds the prompt of the next question
+func (s *ChatSession) prepare(ctx context.Context, query string) ([]ChatTurn, string, []string, error) {
+	s.trim(ctx)
+	history := s.History()
+
+	retrievalQuery := s.standaloneQuery(ctx, history, query)
+	namespace := s.Namespace
+	if namespace == "" {
+		namespace = DEFAULT_CHAT_NAMESPACE
+	}
+	topK := s.TopK
+	if topK <= 0 {
+		topK = DEFAULT_TOP_K
+	}
+	prompt, sources, err := s.engine.chatPrompt(ctx, namespace, topK, retrievalQuery, query, s.Filter)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return history, prompt, sources, nil
+}
+
+// standaloneQuery rewrites a follow-up question into a query that can be matched without the history
+// it falls back to the question itself when the rewrite fails
+func (s *ChatSession) standaloneQuery(ctx context.Context, history []ChatTurn, query string) string {
+	if len(history) == 0 {
+		return query
+	}
+
+	startTime := time.Now()
+	rewritten, err := s.engine.generate(ctx, fmt.Sprintf(CONDENSE_QUESTION_PROMPT_TEMPLATE, formatHistory(history), query))
+	if err != nil {
+		log.Printf("WARNING: Failed to rewrite the follow-up question, using it as is: %v", err)
+		return query
+	}
+	rewritten = strings.Trim(rewritten, "\"\n \t")
+	if rewritten == "" {
+		return query
+	}
+	log.Printf("INFO: Question rewriting took %f seconds, retrieval query: %s", time.Since(startTime).Seconds(), rewritten)
+	return rewritten
+}
+
+// record adds a question and its answer to the history
+func (s *ChatSession) record(query string, response string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.turns = append(s.turns,
+		ChatTurn{Role: ROLE_USER, Content: query},
+		ChatTurn{Role: ROLE_MODEL, Content: response},
+	)
+}
+
+// trim keeps the history within the token budget
+// the turns before the latest HISTORY_KEEP_TURNS are folded into the summary,
+// when summarizing fails the oldest turns are dropped instead
+// the lock is not held while the summary is generated so the session stays usable meanwhile
+func (s *ChatSession) trim(ctx context.Context) {
+	s.mu.Lock()
+	budget := s.HistoryTokenBudget
+	if budget <= 0 {
+		budget = DEFAULT_HISTORY_TOKEN_BUDGET
+	}
+	if s.historyTokens() <= budget {
+		s.mu.Unlock()
+		return
+	}
+	var older []ChatTurn
+	if len(s.turns) > HISTORY_KEEP_TURNS {
+		older = append(older, s.turns[:len(s.turns)-HISTORY_KEEP_TURNS]...)
+	}
+	previous := s.summary
+	s.mu.Unlock()
+
+	var summary string
+	if len(older) > 0 {
+		startTime := time.Now()
+		var err error
+		summary, err = s.engine.generate(ctx, fmt.Sprintf(SUMMARIZE_HISTORY_PROMPT_TEMPLATE, previous, formatHistory(older)))
+		summary = strings.TrimSpace(summary)
+		if err == nil && summary != "" {
+			log.Printf("INFO: Summarizing %d turns took %f seconds", len(older), time.Since(startTime).Seconds())
+		} else {
+			log.Printf("WARNING: Failed to summarize the conversation, dropping the oldest turns: %v", err)
+			summary = ""
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// the summary is only used when the summarized turns are still the oldest ones,
+	// the session may have been reset or trimmed by another question meanwhile
+	if summary != "" && s.summary == previous && len(s.turns) >= len(older) && slices.Equal(s.turns[:len(older)], older) {
+		s.summary = summary
+		s.turns = append([]ChatTurn(nil), s.turns[len(older):]...)
+	}
+
+	// drop whole exchanges until the history fits, the last one is always kept
+	for s.historyTokens() > budget && len(s.turns) > 2 {
+		s.turns = s.turns[2:]
+	}
+	if s.historyTokens() > budget && s.summary != "" {
+		s.summary = ""
+	}
+}
+
+// historyTokens estimates the size of the summary and the turns
+func (s *ChatSession) historyTokens() int {
+	tokens := estimateTokens(s.summary)
+	for _, turn := range s.turns {
+		tokens += estimateTokens(turn.Content)
+	}
+	return tokens
+}
@@ -0,0 +1,216 @@
+package RAG_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+// recordingEmbedder records the texts it embeds
+type recordingEmbedder struct {
+	fakeEmbedder
+	texts []string
+}
+
+func (r *recordingEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	r.texts = append(r.texts, text)
+	return r.fakeEmbedder.Embed(ctx, text)
+}
+
+// fakeChatLLM answers the rewrite and summary prompts and records the history of every chat call
+type fakeChatLLM struct {
+	fakeLLM
+	histories [][]RAG.ChatTurn
+}
+
+func (f *fakeChatLLM) Generate(ctx context.Context, prompt string) (string, error) {
+	f.prompts = append(f.prompts, prompt)
+	switch {
+	case strings.Contains(prompt, "standalone question"):
+		return "how do I index the orders table?", nil
+	case strings.Contains(prompt, "Summarize the following conversation"):
+		return "the user asked about the orders table", nil
+	}
+	return f.response, nil
+}
+
+func (f *fakeChatLLM) GenerateChat(ctx context.Context, history []RAG.ChatTurn, prompt string) (string, error) {
+	f.histories = append(f.histories, history)
+	return f.response, nil
+}
+
+func newSessionEngine(llm RAG.LLM) (*RAG.RAGEngine, *recordingEmbedder) {
+	store := &fakeStore{matches: []RAG.VectorMatch{
+		{ID: "1", Score: 0.9, Metadata: map[string]any{"content": "use CREATE INDEX", "source_url": "https://example.com/a"}},
+	}}
+	embedder := &recordingEmbedder{}
+	return RAG.NewRAGEngine(embedder, store, llm), embedder
+}
+
+func TestChatSessionRewritesFollowUps(t *testing.T) {
+	llm := &fakeChatLLM{fakeLLM: fakeLLM{response: "an answer"}}
+	engine, embedder := newSessionEngine(llm)
+	session := engine.NewChatSession()
+
+	if _, err := session.Query(context.Background(), "what is the orders table?"); err != nil {
+		t.Fatalf("first query failed: %v", err)
+	}
+	// without a history the question is neither rewritten nor sent as a chat
+	if len(llm.prompts) != 1 || len(llm.histories) != 0 || strings.Contains(llm.prompts[0], "standalone question") {
+		t.Fatalf("unexpected calls for the first question: %d prompts, %d chats", len(llm.prompts), len(llm.histories))
+	}
+
+	response, err := session.Query(context.Background(), "and how do I index that?")
+	if err != nil {
+		t.Fatalf("follow-up query failed: %v", err)
+	}
+	if response.ResponseText != "an answer" || len(response.Sources) != 1 {
+		t.Errorf("unexpected response: %+v", response)
+	}
+	if embedder.texts[1] != "how do I index the orders table?" {
+		t.Errorf("expected the rewritten question to be matched, got %q", embedder.texts[1])
+	}
+	history := llm.histories[0]
+	if len(history) != 2 || history[0].Role != RAG.ROLE_USER || history[0].Content != "what is the orders table?" || history[1].Role != RAG.ROLE_MODEL {
+		t.Errorf("unexpected history: %+v", history)
+	}
+	if len(session.History()) != 4 {
+		t.Errorf("expected two recorded exchanges, got %+v", session.History())
+	}
+
+	session.Reset()
+	if len(session.History()) != 0 {
+		t.Errorf("reset did not clear the history")
+	}
+}
+
+func TestChatSessionSummarizesHistory(t *testing.T) {
+	llm := &fakeChatLLM{fakeLLM: fakeLLM{response: strings.Repeat("long answer ", 20)}}
+	engine, _ := newSessionEngine(llm)
+	session := engine.NewChatSession()
+	session.HistoryTokenBudget = 150
+
+	for _, question := range []string{"first", "second", "third", "fourth"} {
+		if _, err := session.Query(context.Background(), question); err != nil {
+			t.Fatalf("query failed: %v", err)
+		}
+	}
+
+	// the history sent with the last question
+	history := llm.histories[len(llm.histories)-1]
+	if !strings.Contains(history[0].Content, "the user asked about the orders table") {
+		t.Fatalf("expected the older turns to be summarized, got %+v", history)
+	}
+	// the summary pair and the latest kept turns
+	if len(history) > 2+RAG.HISTORY_KEEP_TURNS {
+		t.Errorf("history was not trimmed: %d turns", len(history))
+	}
+	if last := history[len(history)-2]; last.Content != "third" {
+		t.Errorf("the latest exchange must be kept, got %+v", last)
+	}
+}
+
+// summarizingLLM calls onSummary while it generates the summary of the history
+type summarizingLLM struct {
+	fakeChatLLM
+	onSummary func()
+}
+
+func (f *summarizingLLM) Generate(ctx context.Context, prompt string) (string, error) {
+	if strings.Contains(prompt, "Summarize the following conversation") {
+		f.onSummary()
+	}
+	return f.fakeChatLLM.Generate(ctx, prompt)
+}
+
+func TestChatSessionUnlockedWhileSummarizing(t *testing.T) {
+	llm := &summarizingLLM{fakeChatLLM: fakeChatLLM{fakeLLM: fakeLLM{response: strings.Repeat("long answer ", 20)}}}
+	engine, _ := newSessionEngine(llm)
+	session := engine.NewChatSession()
+	session.HistoryTokenBudget = 150
+
+	summarized := false
+	llm.onSummary = func() {
+		summarized = true
+		done := make(chan struct{})
+		go func() {
+			session.History()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("the session stays locked while the summary is generated")
+		}
+	}
+	for _, question := range []string{"first", "second", "third", "fourth"} {
+		if _, err := session.Query(context.Background(), question); err != nil {
+			t.Fatalf("query failed: %v", err)
+		}
+	}
+	if !summarized {
+		t.Fatal("expected the history to be summarized")
+	}
+	if history := session.History(); !strings.Contains(history[0].Content, "the user asked about the orders table") {
+		t.Errorf("expected the summary to be kept, got %+v", history)
+	}
+}
+
+func TestChatSessionWithoutChatLLM(t *testing.T) {
+	llm := &fakeStreamingLLM{fakeLLM: fakeLLM{response: "streamed answer"}}
+	engine, _ := newSessionEngine(llm)
+	session := engine.NewChatSession()
+
+	for _, question := range []string{"what is the orders table?", "and its indexes?"} {
+		events, err := session.QueryStream(context.Background(), question)
+		if err != nil {
+			t.Fatalf("QueryStream failed: %v", err)
+		}
+		if text, _ := collectStream(events); text != "streamed answer" {
+			t.Errorf("unexpected response: %q", text)
+		}
+	}
+	// the LLM cannot take a chat history so it is rendered into the prompt
+	last := llm.prompts[len(llm.prompts)-1]
+	if !strings.Contains(last, "User: what is the orders table?") || !strings.Contains(last, "Assistant: streamed answer") {
+		t.Errorf("the history is missing from the prompt: %q", last)
+	}
+	if len(session.History()) != 4 {
+		t.Errorf("expected the streamed turns to be recorded, got %+v", session.History())
+	}
+}
+
+func TestOpenAIGenerateChatSendsHistory(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []map[string]string `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		roles := []string{}
+		for _, message := range body.Messages {
+			roles = append(roles, message["role"])
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": strings.Join(roles, ",")}}},
+		})
+	}))
+	defer server.Close()
+
+	llm := &RAG.OpenAILLM{BaseURL: server.URL, Model: "gpt-test"}
+	text, err := llm.GenerateChat(context.Background(), []RAG.ChatTurn{
+		{Role: RAG.ROLE_USER, Content: "hi"},
+		{Role: RAG.ROLE_MODEL, Content: "hello"},
+	}, "next")
+	if err != nil {
+		t.Fatalf("GenerateChat failed: %v", err)
+	}
+	if text != "user,assistant,user" {
+		t.Errorf("unexpected message roles: %s", text)
+	}
+}
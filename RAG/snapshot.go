@@ -0,0 +1,306 @@
+package RAG
+
+import (
+	"bufio"
+	"cmp"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+)
+
+const (
+	SNAPSHOT_FORMAT = "rag-vector-snapshot"
+	// SNAPSHOT_VERSION is bumped whenever the layout of the snapshot changes
+	SNAPSHOT_VERSION = 1
+)
+
+// SnapshotHeader is the first line of a vector snapshot, the vectors follow as one JSON line each
+type SnapshotHeader struct {
+	Format         string    `json:"format"`
+	Version        int       `json:"version"`
+	Namespace      string    `json:"namespace"`
+	EmbeddingModel string    `json:"embedding_model,omitempty"`
+	Dimension      int       `json:"dimension"`
+	Metric         string    `json:"metric,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// SnapshotOptions configures ExportNamespace and ImportNamespace
+type SnapshotOptions struct {
+	// EmbeddingModel is recorded in the header on export,
+	// on import it must match the model of the header when both are known
+	EmbeddingModel string
+	// Gzip compresses the export, imports detect compressed snapshots by themselves
+	Gzip bool
+}
+
+// ExportNamespace writes every vector of the namespace as a versioned snapshot
+// the store must implement VectorLister and VectorFetcher, it returns the header and the number of vectors written
+func ExportNamespace(ctx context.Context, store VectorStore, namespace string, w io.Writer, options SnapshotOptions) (SnapshotHeader, int, error) {
+	header := SnapshotHeader{
+		Format:         SNAPSHOT_FORMAT,
+		Version:        SNAPSHOT_VERSION,
+		Namespace:      namespace,
+		EmbeddingModel: options.EmbeddingModel,
+		CreatedAt:      time.Now().UTC(),
+	}
+	lister, ok := store.(VectorLister)
+	if !ok {
+		return header, 0, fmt.Errorf("%w: the vector store cannot list vectors", ErrUnsupported)
+	}
+	fetcher, ok := store.(VectorFetcher)
+	if !ok {
+		return header, 0, fmt.Errorf("%w: the vector store cannot fetch vectors", ErrUnsupported)
+	}
+	if reporter, ok := store.(StatsReporter); ok {
+		if stats, err := reporter.Stats(ctx); err == nil {
+			header.Metric = stats.Metric
+			header.Dimension = stats.Dimension
+		}
+	}
+
+	ids, err := lister.ListIDs(ctx, namespace)
+	if err != nil {
+		return header, 0, fmt.Errorf("failed to list the vectors of %s: %w", namespace, err)
+	}
+	sort.Strings(ids)
+
+	var compressed *gzip.Writer
+	if options.Gzip {
+		compressed = gzip.NewWriter(w)
+		defer compressed.Close()
+		w = compressed
+	}
+	encoder := json.NewEncoder(w)
+
+	// the header is written once the dimension of the stored vectors is known
+	headerWritten := false
+	writeHeader := func() error {
+		if headerWritten {
+			return nil
+		}
+		headerWritten = true
+		return encoder.Encode(header)
+	}
+
+	written := 0
+	for start := 0; start < len(ids); start += PINECONE_BATCH_SIZE {
+		batch := ids[start:min(start+PINECONE_BATCH_SIZE, len(ids))]
+		records, err := fetcher.Fetch(ctx, namespace, batch)
+		if err != nil {
+			return header, written, fmt.Errorf("failed to fetch the vectors of %s: %w", namespace, err)
+		}
+		for _, id := range batch {
+			record, ok := records[id]
+			if !ok {
+				// deleted while exporting
+				continue
+			}
+			if !headerWritten {
+				header.Dimension = len(record.Values)
+			}
+			if len(record.Values) != header.Dimension {
+				return header, written, fmt.Errorf("%w: vector %s has %d dimensions but the namespace has %d", ErrDimensionMismatch, id, len(record.Values), header.Dimension)
+			}
+			if err := writeHeader(); err != nil {
+				return header, written, err
+			}
+			if err := encoder.Encode(record); err != nil {
+				return header, written, err
+			}
+			written++
+		}
+	}
+	if err := writeHeader(); err != nil {
+		return header, written, err
+	}
+	if compressed != nil {
+		if err := compressed.Close(); err != nil {
+			return header, written, err
+		}
+	}
+	return header, written, nil
+}
+
+// ImportNamespace upserts the vectors of a snapshot written by ExportNamespace into the namespace,
+// an empty namespace restores the namespace recorded in the snapshot
+// the import fails before writing anything when the snapshot was made with another embedding model
+// or dimension than the store holds, it returns the header and the number of vectors read
+func ImportNamespace(ctx context.Context, store VectorStore, namespace string, r io.Reader, options SnapshotOptions) (SnapshotHeader, int, error) {
+	writer, ok := store.(VectorWriter)
+	if !ok {
+		return SnapshotHeader{}, 0, fmt.Errorf("%w: the vector store is read-only", ErrUnsupported)
+	}
+
+	r, err := decompressSnapshot(r)
+	if err != nil {
+		return SnapshotHeader{}, 0, err
+	}
+	scanner := bufio.NewScanner(r)
+	// a line holds a whole vector with its content
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+
+	header, line, err := readSnapshotHeader(scanner)
+	if err != nil {
+		return header, 0, err
+	}
+	if namespace == "" {
+		namespace = header.Namespace
+	}
+	if err := checkSnapshot(ctx, store, header, options); err != nil {
+		return header, 0, err
+	}
+
+	batch := []VectorRecord{}
+	imported := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := writer.Upsert(ctx, namespace, batch); err != nil {
+			return fmt.Errorf("failed to upsert the vectors: %w", err)
+		}
+		imported += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record VectorRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return header, imported, fmt.Errorf("%w: invalid vector on line %d: %v", ErrInvalidSnapshot, line, err)
+		}
+		if len(record.Values) != header.Dimension {
+			return header, imported, fmt.Errorf("%w: vector %s on line %d has %d dimensions but the snapshot has %d", ErrInvalidSnapshot, record.ID, line, len(record.Values), header.Dimension)
+		}
+		batch = append(batch, record)
+		if len(batch) == PINECONE_BATCH_SIZE {
+			if err := flush(); err != nil {
+				return header, imported, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return header, imported, err
+	}
+	return header, imported, flush()
+}
+
+// decompressSnapshot unwraps gzip snapshots, they are recognized by their magic number
+func decompressSnapshot(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		compressed, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+		return compressed, nil
+	}
+	return buffered, nil
+}
+
+// readSnapshotHeader reads the header line and checks that this version can read the snapshot
+func readSnapshotHeader(scanner *bufio.Scanner) (SnapshotHeader, int, error) {
+	var header SnapshotHeader
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+			return header, line, fmt.Errorf("%w: invalid header: %v", ErrInvalidSnapshot, err)
+		}
+		if header.Format != SNAPSHOT_FORMAT {
+			return header, line, fmt.Errorf("%w: missing %s header", ErrInvalidSnapshot, SNAPSHOT_FORMAT)
+		}
+		if header.Version < 1 || header.Version > SNAPSHOT_VERSION {
+			return header, line, fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, header.Version)
+		}
+		return header, line, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return header, line, err
+	}
+	return header, line, fmt.Errorf("%w: the snapshot is empty", ErrInvalidSnapshot)
+}
+
+// checkSnapshot makes sure the vectors of the snapshot can be queried next to the ones of the store
+func checkSnapshot(ctx context.Context, store VectorStore, header SnapshotHeader, options SnapshotOptions) error {
+	if options.EmbeddingModel != "" && header.EmbeddingModel != "" && options.EmbeddingModel != header.EmbeddingModel {
+		return fmt.Errorf("%w: the snapshot was embedded with %s but the index uses %s", ErrSnapshotMismatch, header.EmbeddingModel, options.EmbeddingModel)
+	}
+	reporter, ok := store.(DimensionReporter)
+	if !ok {
+		return nil
+	}
+	dimension, err := reporter.Dimension(ctx)
+	if err != nil {
+		return err
+	}
+	// an empty store takes any dimension
+	if dimension != 0 && dimension != header.Dimension {
+		return fmt.Errorf("%w: %w: the snapshot has %d dimensions but the index has %d", ErrSnapshotMismatch, ErrDimensionMismatch, header.Dimension, dimension)
+	}
+	return nil
+}
+
+// ExportNamespace writes a snapshot of the namespace to w, see ExportNamespace
+// the embedding model of the engine is recorded unless the options name another one
+func (r *RAGEngine) ExportNamespace(ctx context.Context, namespace string, w io.Writer, options SnapshotOptions) (SnapshotHeader, int, error) {
+	if options.EmbeddingModel == "" {
+		options.EmbeddingModel = r.EmbeddingModel
+	}
+	namespace = r.resolveNamespace(namespace)
+	startTime := time.Now()
+	header, exported, err := ExportNamespace(ctx, r.Store, namespace, w, options)
+	if err != nil {
+		return header, exported, err
+	}
+	log.Printf("INFO: Exporting %d vectors from %s took %f seconds", exported, namespace, time.Since(startTime).Seconds())
+	return header, exported, nil
+}
+
+// ImportNamespace upserts the vectors of the snapshot read from rd into the namespace, see ImportNamespace
+// the snapshot must have been made with the embedding model of the engine unless the options name another one
+func (r *RAGEngine) ImportNamespace(ctx context.Context, namespace string, rd io.Reader, options SnapshotOptions) (SnapshotHeader, int, error) {
+	if options.EmbeddingModel == "" {
+		options.EmbeddingModel = r.EmbeddingModel
+	}
+	if namespace != "" {
+		namespace = r.resolveNamespace(namespace)
+	}
+	startTime := time.Now()
+	header, imported, err := ImportNamespace(ctx, r.Store, namespace, rd, options)
+	if imported > 0 {
+		r.invalidateResponses(cmp.Or(namespace, header.Namespace))
+		if keywordErr := r.reindexKeywords(ctx, cmp.Or(namespace, header.Namespace)); keywordErr != nil {
+			log.Printf("WARNING: Failed to index the keywords of the imported vectors: %v", keywordErr)
+		}
+		// keep what was written even when a later batch failed
+		if persistErr := r.persist(); persistErr != nil && err == nil {
+			err = persistErr
+		}
+	}
+	if err != nil {
+		return header, imported, err
+	}
+	if namespace == "" {
+		namespace = header.Namespace
+	}
+	log.Printf("INFO: Importing %d vectors into %s took %f seconds", imported, namespace, time.Since(startTime).Seconds())
+	return header, imported, nil
+}
@@ -0,0 +1,93 @@
+package RAG_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+func exportTestNamespace(t *testing.T, options RAG.SnapshotOptions) (*RAG.LocalStore, *bytes.Buffer) {
+	t.Helper()
+	source := newTestLocalStore(t, RAG.METRIC_COSINE)
+	var buffer bytes.Buffer
+	header, exported, err := RAG.ExportNamespace(context.Background(), source, "database-articles", &buffer, options)
+	if err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	if exported != 3 || header.Dimension != 3 || header.Metric != RAG.METRIC_COSINE {
+		t.Fatalf("unexpected export: %d vectors, header %+v", exported, header)
+	}
+	return source, &buffer
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		source, buffer := exportTestNamespace(t, RAG.SnapshotOptions{EmbeddingModel: "ollama/nomic-embed-text", Gzip: compressed})
+		if !compressed {
+			firstLine := strings.SplitN(buffer.String(), "\n", 2)[0]
+			if !strings.Contains(firstLine, `"format":"rag-vector-snapshot"`) || !strings.Contains(firstLine, `"embedding_model":"ollama/nomic-embed-text"`) {
+				t.Errorf("unexpected header: %s", firstLine)
+			}
+		}
+
+		target, _ := RAG.NewLocalStore(RAG.METRIC_COSINE)
+		header, imported, err := RAG.ImportNamespace(context.Background(), target, "", buffer, RAG.SnapshotOptions{EmbeddingModel: "ollama/nomic-embed-text"})
+		if err != nil {
+			t.Fatalf("failed to import the snapshot (gzip %v): %v", compressed, err)
+		}
+		if imported != 3 || header.Namespace != "database-articles" {
+			t.Errorf("expected 3 vectors of database-articles, got %d of %s", imported, header.Namespace)
+		}
+
+		ids := []string{"x", "y", "xy"}
+		want, _ := source.Fetch(context.Background(), "database-articles", ids)
+		got, _ := target.Fetch(context.Background(), "database-articles", ids)
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("the imported vectors differ:\nwant %v\ngot  %v", want, got)
+		}
+	}
+}
+
+func TestSnapshotImportMismatch(t *testing.T) {
+	_, buffer := exportTestNamespace(t, RAG.SnapshotOptions{EmbeddingModel: "gemini/text-embedding-004"})
+	snapshot := buffer.Bytes()
+
+	target, _ := RAG.NewLocalStore(RAG.METRIC_COSINE)
+	_, _, err := RAG.ImportNamespace(context.Background(), target, "copy", bytes.NewReader(snapshot), RAG.SnapshotOptions{EmbeddingModel: "openai/text-embedding-3-small"})
+	if !errors.Is(err, RAG.ErrSnapshotMismatch) {
+		t.Errorf("expected ErrSnapshotMismatch for another embedding model, got %v", err)
+	}
+
+	err = target.Upsert(context.Background(), "other", []RAG.VectorRecord{{ID: "wide", Values: []float32{1, 0, 0, 0}}})
+	if err != nil {
+		t.Fatalf("failed to upsert vectors: %v", err)
+	}
+	_, imported, err := RAG.ImportNamespace(context.Background(), target, "copy", bytes.NewReader(snapshot), RAG.SnapshotOptions{})
+	if !errors.Is(err, RAG.ErrSnapshotMismatch) || !errors.Is(err, RAG.ErrDimensionMismatch) {
+		t.Errorf("expected a dimension mismatch, got %v", err)
+	}
+	if imported != 0 {
+		t.Errorf("nothing should be imported into a mismatched index, got %d vectors", imported)
+	}
+}
+
+func TestSnapshotImportInvalid(t *testing.T) {
+	target, _ := RAG.NewLocalStore(RAG.METRIC_COSINE)
+	snapshots := map[string]string{
+		"headerless":  `{"id":"x","values":[1,0,0]}` + "\n",
+		"new version": `{"format":"rag-vector-snapshot","version":99,"dimension":3}` + "\n",
+		"empty":       "",
+		"wrong size":  `{"format":"rag-vector-snapshot","version":1,"namespace":"a","dimension":3}` + "\n" + `{"id":"x","values":[1,0]}` + "\n",
+	}
+	for name, snapshot := range snapshots {
+		_, _, err := RAG.ImportNamespace(context.Background(), target, "", strings.NewReader(snapshot), RAG.SnapshotOptions{})
+		if !errors.Is(err, RAG.ErrInvalidSnapshot) {
+			t.Errorf("%s: expected ErrInvalidSnapshot, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package RAG
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// QueryChatStream answers a chat query like QueryChatContext but sends the response text
+// as it is generated, the last event has Done set and carries the sources or the error
+// retrieval errors are returned directly, the channel is closed after the last event
+func (r *RAGEngine) QueryChatStream(ctx context.Context, query string) (<-chan ChatStreamEvent, error) {
+	request, err := r.prepareChat(ctx, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	if request.cached != nil {
+		// a cached response is sent whole
+		events, send := eventStream(ctx)
+		go func() {
+			defer close(events)
+			if send(ChatStreamEvent{Delta: request.cached.ResponseText}) == nil {
+				send(ChatStreamEvent{Sources: request.cached.Sources, Done: true, FromCache: true})
+			}
+		}()
+		return events, nil
+	}
+	return r.streamResponse(ctx, nil, request.prompt, request.sources, func(response string) {
+		r.cacheResponse(request, query, ChatbotResponse{ResponseText: response, Sources: request.sources})
+	}), nil
+}
+
+// eventStream creates the channel of a stream and the function its producer sends with
+// send gives up when ctx is done so the producer never blocks on a caller that stopped listening
+func eventStream(ctx context.Context) (chan ChatStreamEvent, func(ChatStreamEvent) error) {
+	events := make(chan ChatStreamEvent)
+	send := func(event ChatStreamEvent) error {
+		select {
+		case events <- event:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return events, send
+}
+
+// streamResponse streams the response to the prompt in a new goroutine
+// onComplete is called with the whole response text once it was generated successfully
+func (r *RAGEngine) streamResponse(ctx context.Context, history []ChatTurn, prompt string, sources []string, onComplete func(string)) <-chan ChatStreamEvent {
+	events, send := eventStream(ctx)
+
+	go func() {
+		defer close(events)
+
+		if prompt == "" {
+			if send(ChatStreamEvent{Delta: CHAT_FAIL_RESPONSE}) == nil {
+				send(ChatStreamEvent{Done: true})
+			}
+			return
+		}
+
+		startTime := time.Now()
+		var response strings.Builder
+		err := r.generateStream(ctx, history, prompt, func(delta string) error {
+			if delta == "" {
+				return nil
+			}
+			response.WriteString(delta)
+			return send(ChatStreamEvent{Delta: delta})
+		})
+		if err != nil {
+			log.Printf("ERROR: Failed to stream response: %v", err)
+			send(ChatStreamEvent{Done: true, Err: err})
+			return
+		}
+		log.Printf("INFO: Response streaming took %f seconds", time.Since(startTime).Seconds())
+
+		if response.Len() == 0 {
+			log.Printf("WARNING: Generated response is empty, using fallback response")
+			if send(ChatStreamEvent{Delta: CHAT_FAIL_RESPONSE}) != nil {
+				return
+			}
+		} else if onComplete != nil {
+			onComplete(response.String())
+		}
+		send(ChatStreamEvent{Sources: sources, Done: true})
+	}()
+	return events
+}
+
+// generateStream streams the LLM response under the generation timeout
+// LLMs that cannot stream send the whole response as a single delta
+func (r *RAGEngine) generateStream(ctx context.Context, history []ChatTurn, prompt string, onDelta func(string) error) error {
+	ctx, cancel := withStageTimeout(ctx, r.Timeouts.Generate)
+	defer cancel()
+
+	if len(history) > 0 {
+		if streaming, ok := r.LLM.(StreamingChatLLM); ok {
+			return streaming.GenerateChatStream(ctx, history, prompt, onDelta)
+		}
+		if chat, ok := r.LLM.(ChatLLM); ok {
+			text, err := chat.GenerateChat(ctx, history, prompt)
+			if err != nil {
+				return err
+			}
+			return onDelta(text)
+		}
+		prompt = historyPrompt(history, prompt)
+	}
+	if streaming, ok := r.LLM.(StreamingLLM); ok {
+		return streaming.GenerateStream(ctx, prompt, onDelta)
+	}
+	text, err := r.LLM.Generate(ctx, prompt)
+	if err != nil {
+		return err
+	}
+	return onDelta(text)
+}
+
+// generateChat runs the LLM with the conversation history under the generation timeout
+func (r *RAGEngine) generateChat(ctx context.Context, history []ChatTurn, prompt string) (string, error) {
+	if len(history) == 0 {
+		return r.generate(ctx, prompt)
+	}
+	chat, ok := r.LLM.(ChatLLM)
+	if !ok {
+		return r.generate(ctx, historyPrompt(history, prompt))
+	}
+	ctx, cancel := withStageTimeout(ctx, r.Timeouts.Generate)
+	defer cancel()
+	return chat.GenerateChat(ctx, history, prompt)
+}
+
+// historyPrompt renders the conversation into the prompt for the LLMs without chat support
+func historyPrompt(history []ChatTurn, prompt string) string {
+	if len(history) == 0 {
+		return prompt
+	}
+	return fmt.Sprintf("CONVERSATION SO FAR:\n%s\n%s", formatHistory(history), prompt)
+}
+
+// formatHistory renders the turns as a plain text transcript
+func formatHistory(history []ChatTurn) string {
+	var transcript strings.Builder
+	for _, turn := range history {
+		speaker := "User"
+		if turn.Role == ROLE_MODEL {
+			speaker = "Assistant"
+		}
+		fmt.Fprintf(&transcript, "%s: %s\n", speaker, turn.Content)
+	}
+	return transcript.String()
+}
@@ -0,0 +1,232 @@
+package RAG_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+// fakeStreamingLLM streams its response word by word
+type fakeStreamingLLM struct {
+	fakeLLM
+	// block waits for the context after the first delta
+	block bool
+}
+
+func (f *fakeStreamingLLM) GenerateStream(ctx context.Context, prompt string, onDelta func(string) error) error {
+	f.prompts = append(f.prompts, prompt)
+	for i, word := range strings.SplitAfter(f.response, " ") {
+		if err := onDelta(word); err != nil {
+			return err
+		}
+		if f.block && i == 0 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// collectStream reads all the events of a stream
+func collectStream(events <-chan RAG.ChatStreamEvent) (string, []RAG.ChatStreamEvent) {
+	text := ""
+	all := []RAG.ChatStreamEvent{}
+	for event := range events {
+		text += event.Delta
+		all = append(all, event)
+	}
+	return text, all
+}
+
+func TestQueryChatStream(t *testing.T) {
+	store := &fakeStore{matches: []RAG.VectorMatch{
+		{ID: "1", Score: 0.9, Metadata: map[string]any{"content": "use CREATE INDEX", "source_url": "https://example.com/a"}},
+		{ID: "2", Score: 0.8, Metadata: map[string]any{"content": "brin for large tables", "source_url": "https://example.com/a"}},
+	}}
+	llm := &fakeStreamingLLM{fakeLLM: fakeLLM{response: "add an index"}}
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, store, llm)
+
+	events, err := engine.QueryChatStream(context.Background(), "how do I add an index?")
+	if err != nil {
+		t.Fatalf("QueryChatStream failed: %v", err)
+	}
+	text, all := collectStream(events)
+	if text != "add an index" {
+		t.Errorf("unexpected response text: %q", text)
+	}
+	if len(all) != 4 {
+		t.Errorf("expected 3 deltas and a final event, got %+v", all)
+	}
+	last := all[len(all)-1]
+	if !last.Done || last.Err != nil || len(last.Sources) != 1 || last.Sources[0] != "https://example.com/a" {
+		t.Errorf("unexpected final event: %+v", last)
+	}
+}
+
+func TestQueryChatStreamFallsBackToGenerate(t *testing.T) {
+	store := &fakeStore{matches: []RAG.VectorMatch{{ID: "1", Metadata: map[string]any{"content": "content"}}}}
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, store, &fakeLLM{response: "whole answer"})
+
+	events, err := engine.QueryChatStream(context.Background(), "question")
+	if err != nil {
+		t.Fatalf("QueryChatStream failed: %v", err)
+	}
+	if text, all := collectStream(events); text != "whole answer" || len(all) != 2 {
+		t.Errorf("expected a single delta, got %+v", all)
+	}
+
+	engine = RAG.NewRAGEngine(&fakeEmbedder{}, &fakeStore{}, &fakeLLM{})
+	events, err = engine.QueryChatStream(context.Background(), "question")
+	if err != nil {
+		t.Fatalf("QueryChatStream failed: %v", err)
+	}
+	if text, _ := collectStream(events); text != RAG.CHAT_FAIL_RESPONSE {
+		t.Errorf("expected the fallback response without matches, got %q", text)
+	}
+}
+
+func TestQueryChatStreamResponseCache(t *testing.T) {
+	store := newTestLocalStore(t, RAG.METRIC_COSINE)
+	llm := &fakeStreamingLLM{fakeLLM: fakeLLM{response: "add an index"}}
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, store, llm)
+	engine.ResponseCache = RAG.NewResponseCache(RAG.ResponseCacheConfig{Threshold: 0.99})
+
+	events, err := engine.QueryChatStream(context.Background(), "how do I add an index?")
+	if err != nil {
+		t.Fatalf("QueryChatStream failed: %v", err)
+	}
+	if text, all := collectStream(events); text != "add an index" || all[len(all)-1].FromCache {
+		t.Fatalf("expected a generated response, got %+v", all)
+	}
+
+	// the streamed response is cached for both the streams and QueryChat
+	events, err = engine.QueryChatStream(context.Background(), "How do I add an index")
+	if err != nil {
+		t.Fatalf("QueryChatStream failed: %v", err)
+	}
+	text, all := collectStream(events)
+	if last := all[len(all)-1]; text != "add an index" || !last.Done || !last.FromCache {
+		t.Errorf("expected a cached response, got %+v", all)
+	}
+	if response, err := engine.QueryChat("how do I add an index"); err != nil || !response.FromCache {
+		t.Errorf("expected QueryChat to reuse the streamed response, got %+v, %v", response, err)
+	}
+	if len(llm.prompts) != 1 {
+		t.Errorf("expected a single generation, got %d", len(llm.prompts))
+	}
+}
+
+func TestQueryChatStreamCancellation(t *testing.T) {
+	store := &fakeStore{matches: []RAG.VectorMatch{{ID: "1", Metadata: map[string]any{"content": "content"}}}}
+	llm := &fakeStreamingLLM{fakeLLM: fakeLLM{response: "never finished"}, block: true}
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, store, llm)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := engine.QueryChatStream(ctx, "question")
+	if err != nil {
+		t.Fatalf("QueryChatStream failed: %v", err)
+	}
+	first := <-events
+	if first.Delta != "never " {
+		t.Fatalf("unexpected first event: %+v", first)
+	}
+	cancel()
+	// the channel must be closed without a successful final event
+	for event := range events {
+		if event.Done && event.Err == nil {
+			t.Errorf("expected the stream to stop, got %+v", event)
+		}
+	}
+}
+
+func TestOpenAIGenerateStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["stream"] != true {
+			t.Errorf("expected a streaming request, got %v", body["stream"])
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, word := range []string{"hello", " world"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", word)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	llm := &RAG.OpenAILLM{BaseURL: server.URL, Model: "gpt-test"}
+	deltas := []string{}
+	err := llm.GenerateStream(context.Background(), "hi", func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GenerateStream failed: %v", err)
+	}
+	if strings.Join(deltas, "|") != "hello| world" {
+		t.Errorf("unexpected deltas: %q", deltas)
+	}
+}
+
+func TestOllamaGenerateStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["stream"] != true {
+			t.Errorf("expected a streaming request, got %v", body["stream"])
+		}
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"hello"},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":" world"},"done":false}`)
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true}`)
+	}))
+	defer server.Close()
+
+	llm := &RAG.OllamaLLM{BaseURL: server.URL, Model: "llama-test"}
+	stop := errors.New("stop")
+	deltas := []string{}
+	err := llm.GenerateStream(context.Background(), "hi", func(delta string) error {
+		deltas = append(deltas, delta)
+		return stop
+	})
+	if !errors.Is(err, stop) || len(deltas) != 1 {
+		t.Fatalf("expected the callback error to stop the stream, got %v after %q", err, deltas)
+	}
+
+	deltas = deltas[:0]
+	err = llm.GenerateStream(context.Background(), "hi", func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil || strings.Join(deltas, "") != "hello world" {
+		t.Errorf("unexpected stream result: %v %q", err, deltas)
+	}
+}
+
+func TestOllamaGenerateStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":"hello"},"done":false}`)
+		fmt.Fprintln(w, `{"error":"model runner has unexpectedly stopped"}`)
+	}))
+	defer server.Close()
+
+	llm := &RAG.OllamaLLM{BaseURL: server.URL, Model: "llama-test"}
+	deltas := []string{}
+	err := llm.GenerateStream(context.Background(), "hi", func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	var providerErr *RAG.ProviderError
+	if !errors.As(err, &providerErr) || providerErr.Provider != RAG.PROVIDER_OLLAMA || !errors.Is(err, RAG.ErrModelUnreachable) {
+		t.Fatalf("expected an ollama provider error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "unexpectedly stopped") || len(deltas) != 1 {
+		t.Errorf("unexpected stream result: %v %q", err, deltas)
+	}
+}
@@ -0,0 +1,410 @@
+package RAG
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// DEFAULT_AGENT_REPAIR_ATTEMPTS is how many times the agent is asked to correct an invalid output
+const DEFAULT_AGENT_REPAIR_ATTEMPTS = 2
+
+// the types of a JSONSchema
+const (
+	JSON_STRING  = "string"
+	JSON_INTEGER = "integer"
+	JSON_NUMBER  = "number"
+	JSON_BOOLEAN = "boolean"
+	JSON_ARRAY   = "array"
+	JSON_OBJECT  = "object"
+)
+
+// JSONSchema describes the JSON object a StructuredLLM returns
+// it is the subset of JSON Schema that Gemini, OpenAI and Ollama all understand
+type JSONSchema struct {
+	Type        string
+	Description string
+	Nullable    bool
+	Properties  map[string]*JSONSchema
+	// Required lists the properties in the order the model should write them
+	Required []string
+	Items    *JSONSchema
+}
+
+// MarshalJSON writes the schema as JSON Schema, a nullable type is a list with "null"
+func (s *JSONSchema) MarshalJSON() ([]byte, error) {
+	schema := map[string]any{"type": s.Type}
+	if s.Nullable {
+		schema["type"] = []string{s.Type, "null"}
+	}
+	if s.Description != "" {
+		schema["description"] = s.Description
+	}
+	if s.Type == JSON_OBJECT {
+		schema["properties"] = s.Properties
+		schema["required"] = s.Required
+		schema["additionalProperties"] = false
+	}
+	if s.Items != nil {
+		schema["items"] = s.Items
+	}
+	return json.Marshal(schema)
+}
+
+// gemini converts the schema to the response schema of a Gemini model
+func (s *JSONSchema) gemini() *genai.Schema {
+	if s == nil {
+		return nil
+	}
+	schema := &genai.Schema{
+		Description: s.Description,
+		Nullable:    s.Nullable,
+		Required:    s.Required,
+		Items:       s.Items.gemini(),
+	}
+	switch s.Type {
+	case JSON_STRING:
+		schema.Type = genai.TypeString
+	case JSON_INTEGER:
+		schema.Type = genai.TypeInteger
+	case JSON_NUMBER:
+		schema.Type = genai.TypeNumber
+	case JSON_BOOLEAN:
+		schema.Type = genai.TypeBoolean
+	case JSON_ARRAY:
+		schema.Type = genai.TypeArray
+	case JSON_OBJECT:
+		schema.Type = genai.TypeObject
+	}
+	if len(s.Properties) > 0 {
+		schema.Properties = make(map[string]*genai.Schema, len(s.Properties))
+		for name, property := range s.Properties {
+			schema.Properties[name] = property.gemini()
+		}
+	}
+	return schema
+}
+
+// objectSchema creates an object schema where every property is required, in the given order
+func objectSchema(description string, names []string, properties ...*JSONSchema) *JSONSchema {
+	schema := &JSONSchema{Type: JSON_OBJECT, Description: description, Properties: make(map[string]*JSONSchema, len(names)), Required: names}
+	for index, name := range names {
+		schema.Properties[name] = properties[index]
+	}
+	return schema
+}
+
+func arraySchema(description string, items *JSONSchema) *JSONSchema {
+	return &JSONSchema{Type: JSON_ARRAY, Description: description, Items: items}
+}
+
+func stringSchema(description string) *JSONSchema {
+	return &JSONSchema{Type: JSON_STRING, Description: description}
+}
+
+func nullable(schema *JSONSchema) *JSONSchema {
+	schema.Nullable = true
+	return schema
+}
+
+// tableSchema describes a Table with the JSON names of its fields
+func tableSchema() *JSONSchema {
+	column := objectSchema("", []string{
+		"TableName", "ColumnName", "DataType", "IsNullable", "ColumnDefault",
+		"CharacterMaximumLength", "NumericPrecision", "NumericScale", "OrdinalPosition", "Comment",
+	},
+		stringSchema(""),
+		stringSchema(""),
+		stringSchema("the PostgreSQL data type"),
+		&JSONSchema{Type: JSON_BOOLEAN},
+		nullable(stringSchema("the default expression")),
+		&JSONSchema{Type: JSON_INTEGER, Nullable: true},
+		&JSONSchema{Type: JSON_INTEGER, Nullable: true},
+		&JSONSchema{Type: JSON_INTEGER, Nullable: true},
+		&JSONSchema{Type: JSON_INTEGER},
+		stringSchema("the comment of the column, empty when it has none"),
+	)
+	constraint := objectSchema("", []string{
+		"TableName", "ConstraintName", "ConstraintType", "ColumnName",
+		"ForeignTableName", "ForeignColumnName", "CheckClause", "OrdinalPosition",
+	},
+		stringSchema(""),
+		stringSchema(""),
+		stringSchema("PRIMARY KEY, FOREIGN KEY, UNIQUE or CHECK"),
+		nullable(stringSchema("")),
+		nullable(stringSchema("")),
+		nullable(stringSchema("")),
+		nullable(stringSchema("")),
+		&JSONSchema{Type: JSON_INTEGER, Nullable: true},
+	)
+	index := objectSchema("", []string{"TableName", "IndexName", "ColumnName", "IsUnique", "IndexType", "IsPrimary", "IsIncluded", "Predicate"},
+		stringSchema(""),
+		stringSchema(""),
+		stringSchema(""),
+		&JSONSchema{Type: JSON_BOOLEAN},
+		stringSchema("btree, hash, gin, gist or brin"),
+		&JSONSchema{Type: JSON_BOOLEAN},
+		&JSONSchema{Type: JSON_BOOLEAN, Description: "the column is in the INCLUDE list of the index, not one of its keys"},
+		stringSchema("the WHERE predicate of a partial index, the same on every row of the index, empty for the other indexes"),
+	)
+	return objectSchema("a table of the new schema with all of its columns, constraints and indexes",
+		[]string{"TableName", "Columns", "Constraints", "Indexes", "Comment"},
+		stringSchema(""),
+		arraySchema("", column),
+		arraySchema("", constraint),
+		arraySchema("", index),
+		stringSchema("the comment of the table, empty when it has none"),
+	)
+}
+
+// agentOutput is the JSON object the agent model returns
+type agentOutput struct {
+	Analysis      string   `json:"analysis"`
+	SchemaChanges []Table  `json:"schema_changes"`
+	DroppedTables []string `json:"dropped_tables"`
+	DDL           []string `json:"ddl"`
+	Risks         []string `json:"risks"`
+	Rationale     string   `json:"rationale"`
+	Response      string   `json:"response"`
+
+	// statements is the DDL generated from the diff of the schema changes, changes describes the diff
+	statements []string
+	changes    []string
+}
+
+// agentOutputSchema is the response schema of the agent, it matches agentOutput
+func agentOutputSchema() *JSONSchema {
+	return objectSchema("", []string{"analysis", "schema_changes", "dropped_tables", "ddl", "risks", "rationale", "response"},
+		stringSchema("the analysis of the current schema and its design issues"),
+		arraySchema("the tables that are created or changed, as they are after the change", tableSchema()),
+		arraySchema("the names of the tables of the current schema that are dropped", stringSchema("")),
+		arraySchema("the PostgreSQL DDL statements that turn the current schema into the new one, in execution order", stringSchema("")),
+		arraySchema("the potential risks and considerations of the change", stringSchema("")),
+		stringSchema("how the changes improve the system design"),
+		stringSchema("the whole answer for the user in markdown"),
+	)
+}
+
+// readSchema reads the current schema the agent is given, a JSON list of tables or PostgreSQL DDL like
+// a pg_dump, it is not known when it is in another format
+func readSchema(schema string) ([]Table, bool) {
+	schema = strings.TrimSpace(schema)
+	if schema == "" {
+		return []Table{}, true
+	}
+	var tables []Table
+	if strings.HasPrefix(schema, "[") && json.Unmarshal([]byte(schema), &tables) == nil {
+		return tables, true
+	}
+	tables, err := ParseDDL(schema)
+	if err != nil {
+		log.Printf("WARNING: The current schema is not valid DDL: %v", err)
+		return nil, false
+	}
+	// a text without any table is not DDL
+	if len(tables) == 0 {
+		return nil, false
+	}
+	return tables, true
+}
+
+// parseAgentOutput decodes the JSON object of the agent and lists what is wrong with it, unknown fields,
+// wrong types, trailing data, a missing response, foreign keys to tables that exist nowhere and schema changes
+// that cannot be turned into DDL, current is the current schema or nil when it is not known
+// the problems are sent back to the model to repair its output
+func parseAgentOutput(text string, currentSchema string, current []Table) (*agentOutput, []string) {
+	text = strings.TrimSpace(text)
+	// the LLMs without a JSON mode may still fence the object
+	if fenced, ok := strings.CutPrefix(text, "```json"); ok {
+		if fenced, ok = strings.CutSuffix(fenced, "```"); ok {
+			text = strings.TrimSpace(fenced)
+		}
+	}
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.DisallowUnknownFields()
+	var output agentOutput
+	if err := decoder.Decode(&output); err != nil {
+		return nil, []string{err.Error()}
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, []string{"unexpected data after the JSON object, answer with a single object"}
+	}
+
+	problems := []string{}
+	if strings.TrimSpace(output.Response) == "" {
+		problems = append(problems, `the "response" is empty`)
+	}
+	if current == nil && len(output.SchemaChanges) > 0 && strings.TrimSpace(agentDDL(output.DDL)) == "" {
+		problems = append(problems, `the "ddl" statements of the schema changes are missing`)
+	}
+	tables := make(map[string]bool)
+	for index, table := range output.SchemaChanges {
+		name := identifierKey(table.TableName)
+		switch {
+		case name == "":
+			problems = append(problems, fmt.Sprintf("schema change %d has no TableName", index))
+		case tables[name]:
+			problems = append(problems, fmt.Sprintf("the table %s is in the schema changes more than once", table.TableName))
+		}
+		tables[name] = true
+	}
+	dropped := make(map[string]bool, len(output.DroppedTables))
+	currentTables := tablesByName(current)
+	for _, name := range output.DroppedTables {
+		key := identifierKey(name)
+		switch {
+		case tables[key]:
+			problems = append(problems, fmt.Sprintf("the table %s is both dropped and in the schema changes", name))
+		case current != nil && currentTables[key] == nil:
+			problems = append(problems, fmt.Sprintf("the dropped table %s is not in the current schema", name))
+		}
+		dropped[key] = true
+	}
+	// a table that is kept as it is cannot reference a dropped table
+	changed := make(map[string]bool, len(output.SchemaChanges))
+	for _, table := range output.SchemaChanges {
+		changed[identifierKey(table.TableName)] = true
+	}
+	for _, table := range current {
+		if dropped[identifierKey(table.TableName)] || changed[identifierKey(table.TableName)] {
+			continue
+		}
+		for _, constraint := range TableConstraints(table) {
+			if isForeignKey(&constraint) && dropped[identifierKey(constraint.ForeignTable)] {
+				problems = append(problems, fmt.Sprintf("the table %s references the dropped table %s with %s, it must be in the schema changes without that foreign key",
+					table.TableName, constraint.ForeignTable, constraint.Name))
+			}
+		}
+	}
+	lowerSchema := strings.ToLower(currentSchema)
+	for _, table := range current {
+		if !dropped[identifierKey(table.TableName)] {
+			tables[identifierKey(table.TableName)] = true
+		}
+	}
+	for _, table := range output.SchemaChanges {
+		for _, constraint := range table.Constraints {
+			if constraint.ForeignTableName == nil || *constraint.ForeignTableName == "" {
+				continue
+			}
+			foreign := identifierKey(*constraint.ForeignTableName)
+			if !tables[foreign] && (current != nil || dropped[foreign] || !strings.Contains(lowerSchema, strings.ToLower(foreign))) {
+				problems = append(problems, fmt.Sprintf("the constraint %s of %s references the table %s that is neither in the schema changes nor in the current schema",
+					constraint.ConstraintName, table.TableName, *constraint.ForeignTableName))
+			}
+		}
+	}
+	if current != nil && len(problems) == 0 {
+		// the whole schemas are compared so the foreign keys of the tables that are kept are known
+		diff := DiffSchemas(current, appliedSchema(current, output.SchemaChanges, output.DroppedTables))
+		statements, err := GenerateDDL(diff)
+		if err != nil {
+			return &output, []string{fmt.Sprintf("the schema changes cannot be turned into DDL: %v", err)}
+		}
+		output.statements = statements
+		output.changes = diff.Describe()
+	}
+	return &output, problems
+}
+
+// appliedSchema is the current schema after the changes, the changed tables replace the current ones
+// and the dropped tables are left out
+func appliedSchema(current []Table, changes []Table, dropped []string) []Table {
+	changed := tablesByName(changes)
+	left := make(map[string]bool, len(dropped))
+	for _, name := range dropped {
+		left[identifierKey(name)] = true
+	}
+	tables := []Table{}
+	for _, table := range current {
+		key := identifierKey(table.TableName)
+		switch {
+		case left[key]:
+		case changed[key] != nil:
+			tables = append(tables, *changed[key])
+			delete(changed, key)
+		default:
+			tables = append(tables, table)
+		}
+	}
+	for _, table := range changes {
+		if changed[identifierKey(table.TableName)] != nil {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+// AgentAttempt records a generation of the agent output, an invalid one keeps its output and its problems
+type AgentAttempt struct {
+	Attempt int      `json:"attempt"`
+	Valid   bool     `json:"valid"`
+	Errors  []string `json:"errors,omitempty"`
+	Output  string   `json:"output,omitempty"`
+	Seconds float64  `json:"seconds"`
+}
+
+// generateAgentOutput generates the agent output and asks the model to correct it up to AgentRepairAttempts times
+// while it is invalid, the attempts are returned in order
+// current is the schema read from currentSchema, nil when it is not known
+func (r *RAGEngine) generateAgentOutput(ctx context.Context, prompt string, currentSchema string, current []Table) (*agentOutput, []AgentAttempt, error) {
+	repairs := r.AgentRepairAttempts
+	if repairs == 0 {
+		repairs = DEFAULT_AGENT_REPAIR_ATTEMPTS
+	}
+	attempts := []AgentAttempt{}
+	request := prompt
+	for attempt := 1; ; attempt++ {
+		startTime := time.Now()
+		text, err := r.generateJSON(ctx, request, agentOutputSchema())
+		if err != nil {
+			return nil, attempts, err
+		}
+		output, problems := parseAgentOutput(text, currentSchema, current)
+		record := AgentAttempt{Attempt: attempt, Valid: len(problems) == 0, Seconds: time.Since(startTime).Seconds()}
+		if record.Valid {
+			return output, append(attempts, record), nil
+		}
+		record.Errors = problems
+		record.Output = text
+		attempts = append(attempts, record)
+		log.Printf("WARNING: agent attempt %d is invalid: %s", attempt, strings.Join(problems, "; "))
+		if attempt > repairs {
+			return nil, attempts, &AgentOutputError{Attempts: attempts}
+		}
+		request = fmt.Sprintf(AGENT_REPAIR_PROMPT_TEMPLATE, prompt, text, "- "+strings.Join(problems, "\n- "))
+	}
+}
+
+// agentDDL joins the DDL statements into a script, every statement ends with a semicolon, the comments are kept as they are
+func agentDDL(statements []string) string {
+	script := make([]string, 0, len(statements))
+	for _, statement := range statements {
+		statement = strings.TrimSpace(statement)
+		if statement == "" {
+			continue
+		}
+		if !strings.HasSuffix(statement, ";") && !strings.HasPrefix(statement, "--") {
+			statement += ";"
+		}
+		script = append(script, statement)
+	}
+	return strings.Join(script, "\n\n")
+}
+
+// generateJSON asks the LLM for a JSON object that follows the schema, in the JSON mode of the LLM when it has one
+func (r *RAGEngine) generateJSON(ctx context.Context, prompt string, schema *JSONSchema) (string, error) {
+	structured, ok := r.LLM.(StructuredLLM)
+	if !ok {
+		return r.generate(ctx, prompt)
+	}
+	ctx, cancel := withStageTimeout(ctx, r.Timeouts.Generate)
+	defer cancel()
+	return structured.GenerateJSON(ctx, prompt, schema)
+}
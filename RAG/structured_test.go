@@ -0,0 +1,204 @@
+package RAG_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+// structuredLLM records the schemas it was asked to follow
+type structuredLLM struct {
+	fakeLLM
+	schemas []*RAG.JSONSchema
+}
+
+func (s *structuredLLM) GenerateJSON(ctx context.Context, prompt string, schema *RAG.JSONSchema) (string, error) {
+	s.schemas = append(s.schemas, schema)
+	return s.Generate(ctx, prompt)
+}
+
+const agentJSON = `{
+	"analysis": "the members table has no email",
+	"schema_changes": [{"TableName": "members", "Columns": [{"TableName": "members", "ColumnName": "email", "DataType": "text", "IsNullable": false, "ColumnDefault": null, "CharacterMaximumLength": null, "NumericPrecision": null, "NumericScale": null, "OrdinalPosition": 2}], "Constraints": [], "Indexes": []}],
+	"ddl": ["ALTER TABLE members ADD COLUMN email text NOT NULL", "CREATE UNIQUE INDEX members_email_key ON members (email);"],
+	"risks": ["the existing rows need an email"],
+	"rationale": "members log in with their email",
+	"response": "## Analysis\nadd an email"
+}`
+
+func TestQueryAgentStructuredOutput(t *testing.T) {
+	store := &fakeStore{}
+	llm := &structuredLLM{fakeLLM: fakeLLM{response: agentJSON}}
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, store, llm)
+
+	// a schema that is not a list of tables nor DDL keeps the DDL of the model
+	response, err := engine.QueryAgent("", "the members table has a serial id", "members log in with an email", 1)
+	if err != nil {
+		t.Fatalf("QueryAgent failed: %v", err)
+	}
+	if len(llm.schemas) != 1 || llm.schemas[0].Type != RAG.JSON_OBJECT {
+		t.Fatalf("expected the JSON mode with the agent schema, got %+v", llm.schemas)
+	}
+	if response.Response != "## Analysis\nadd an email" || response.Analysis != "the members table has no email" {
+		t.Errorf("unexpected response: %+v", response)
+	}
+	if len(response.SchemaChanges) != 1 || response.SchemaChanges[0].Columns[0].ColumnName != "email" {
+		t.Errorf("unexpected schema changes: %+v", response.SchemaChanges)
+	}
+	expectedDDL := "ALTER TABLE members ADD COLUMN email text NOT NULL;\n\nCREATE UNIQUE INDEX members_email_key ON members (email);"
+	if response.SchemaDDL != expectedDDL || len(response.DDLStatements) != 2 {
+		t.Errorf("unexpected schema DDL: %q", response.SchemaDDL)
+	}
+	if !reflect.DeepEqual(response.Risks, []string{"the existing rows need an email"}) {
+		t.Errorf("unexpected risks: %v", response.Risks)
+	}
+}
+
+func TestQueryAgentInvalidOutput(t *testing.T) {
+	tests := map[string]string{
+		// the old markdown format used to panic
+		"markdown":      "analysis without any code block",
+		"unknown field": strings.Replace(agentJSON, `"rationale"`, `"reasoning"`, 1),
+		"two objects":   agentJSON + "\n" + agentJSON,
+		"no response":   strings.Replace(agentJSON, `"## Analysis\nadd an email"`, `""`, 1),
+		"no table name": strings.Replace(agentJSON, `"TableName": "members", "Columns"`, `"TableName": "", "Columns"`, 1),
+	}
+	for name, output := range tests {
+		engine := RAG.NewRAGEngine(&fakeEmbedder{}, &fakeStore{}, &fakeLLM{response: output})
+		if _, err := engine.QueryAgent("", "", "request", 1); !errors.Is(err, RAG.ErrInvalidAgentOutput) {
+			t.Errorf("%s: expected an invalid agent output error, got %v", name, err)
+		}
+	}
+
+	// a fenced object from an LLM without a JSON mode is accepted
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, &fakeStore{}, &fakeLLM{response: "```json\n" + agentJSON + "\n```"})
+	if _, err := engine.QueryAgent("", "", "request", 1); err != nil {
+		t.Errorf("expected the fenced object to decode, got %v", err)
+	}
+}
+
+func TestJSONSchemaRequests(t *testing.T) {
+	schema := &RAG.JSONSchema{
+		Type:       RAG.JSON_OBJECT,
+		Properties: map[string]*RAG.JSONSchema{"name": {Type: RAG.JSON_STRING, Nullable: true}},
+		Required:   []string{"name"},
+	}
+
+	var requests []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, body)
+		message := map[string]any{"role": "assistant", "content": `{"name": null}`}
+		json.NewEncoder(w).Encode(map[string]any{"choices": []any{map[string]any{"message": message}}, "message": message, "done": true})
+	}))
+	defer server.Close()
+
+	openAI := &RAG.OpenAILLM{BaseURL: server.URL, Model: "gpt"}
+	if text, err := openAI.GenerateJSON(context.Background(), "prompt", schema); err != nil || text != `{"name": null}` {
+		t.Fatalf("unexpected OpenAI response: %q, %v", text, err)
+	}
+	ollama := &RAG.OllamaLLM{BaseURL: server.URL, Model: "llama"}
+	if text, err := ollama.GenerateJSON(context.Background(), "prompt", schema); err != nil || text != `{"name": null}` {
+		t.Fatalf("unexpected Ollama response: %q, %v", text, err)
+	}
+
+	expected := map[string]any{
+		"type":                 "object",
+		"properties":           map[string]any{"name": map[string]any{"type": []any{"string", "null"}}},
+		"required":             []any{"name"},
+		"additionalProperties": false,
+	}
+	format := requests[0]["response_format"].(map[string]any)
+	if format["type"] != "json_schema" || !reflect.DeepEqual(format["json_schema"].(map[string]any)["schema"], expected) {
+		t.Errorf("unexpected OpenAI response format: %v", format)
+	}
+	if !reflect.DeepEqual(requests[1]["format"], expected) {
+		t.Errorf("unexpected Ollama format: %v", requests[1]["format"])
+	}
+}
+
+// sequenceLLM returns its responses in order, the last one repeats
+type sequenceLLM struct {
+	responses []string
+	prompts   []string
+}
+
+func (s *sequenceLLM) Generate(ctx context.Context, prompt string) (string, error) {
+	s.prompts = append(s.prompts, prompt)
+	return s.responses[min(len(s.prompts), len(s.responses))-1], nil
+}
+
+func TestQueryAgentRepair(t *testing.T) {
+	wrongType := strings.Replace(agentJSON, `"IsNullable": false`, `"IsNullable": "no"`, 1)
+	llm := &sequenceLLM{responses: []string{wrongType, agentJSON}}
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, &fakeStore{}, llm)
+
+	response, err := engine.QueryAgent("", "", "members log in with an email", 1)
+	if err != nil {
+		t.Fatalf("QueryAgent failed: %v", err)
+	}
+	if len(llm.prompts) != 2 || len(response.Attempts) != 2 {
+		t.Fatalf("expected a single repair, got %d prompts and %+v", len(llm.prompts), response.Attempts)
+	}
+	first, second := response.Attempts[0], response.Attempts[1]
+	if first.Valid || first.Output != wrongType || !strings.Contains(first.Errors[0], "IsNullable") || !second.Valid || second.Output != "" {
+		t.Errorf("unexpected attempts: %+v", response.Attempts)
+	}
+	// the repair prompt has the original request, the previous output and the errors
+	repair := llm.prompts[1]
+	if !strings.HasPrefix(repair, llm.prompts[0]) || !strings.Contains(repair, `"IsNullable": "no"`) || !strings.Contains(repair, first.Errors[0]) {
+		t.Errorf("unexpected repair prompt: %s", repair)
+	}
+}
+
+func TestQueryAgentQuotedForeignTable(t *testing.T) {
+	current := `[{"TableName": "\"Gyms\"", "Columns": [{"ColumnName": "id", "DataType": "integer"}], "Constraints": [{"ConstraintName": "Gyms_pkey", "ConstraintType": "PRIMARY KEY", "ColumnName": "id"}], "Indexes": []}]`
+	reference := func(table string) string {
+		return strings.Replace(agentJSON, `"Constraints": []`, `"Constraints": [{"TableName": "members", "ConstraintName": "members_gym_fkey", "ConstraintType": "FOREIGN KEY", "ColumnName": "email", "ForeignTableName": "`+table+`", "ForeignColumnName": "id", "CheckClause": null, "OrdinalPosition": 1}]`, 1)
+	}
+	// the quoted name is the table of the current schema, the unquoted one is another table
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, &fakeStore{}, &fakeLLM{response: reference(`\"Gyms\"`)})
+	if _, err := engine.QueryAgent("", current, "request", 1); err != nil {
+		t.Errorf("expected the quoted foreign table to be found, got %v", err)
+	}
+	engine = RAG.NewRAGEngine(&fakeEmbedder{}, &fakeStore{}, &fakeLLM{response: reference("gyms")})
+	engine.AgentRepairAttempts = -1
+	if _, err := engine.QueryAgent("", current, "request", 1); !errors.Is(err, RAG.ErrInvalidAgentOutput) || !strings.Contains(err.Error(), "gyms") {
+		t.Errorf("expected the unquoted foreign table to be missing, got %v", err)
+	}
+}
+
+func TestQueryAgentRepairLimit(t *testing.T) {
+	// the foreign table exists nowhere and the DDL is missing
+	invalid := strings.Replace(agentJSON, `"Constraints": []`, `"Constraints": [{"TableName": "members", "ConstraintName": "members_gym_fkey", "ConstraintType": "FOREIGN KEY", "ColumnName": "gym_id", "ForeignTableName": "gyms", "ForeignColumnName": "id", "CheckClause": null, "OrdinalPosition": 1}]`, 1)
+	invalid = strings.Replace(invalid, `"ddl": ["ALTER TABLE members ADD COLUMN email text NOT NULL", "CREATE UNIQUE INDEX members_email_key ON members (email);"]`, `"ddl": []`, 1)
+	llm := &sequenceLLM{responses: []string{invalid}}
+	engine := RAG.NewRAGEngine(&fakeEmbedder{}, &fakeStore{}, llm)
+
+	_, err := engine.QueryAgent("", "the members table has a serial id", "request", 1)
+	var outputErr *RAG.AgentOutputError
+	if !errors.As(err, &outputErr) || !errors.Is(err, RAG.ErrInvalidAgentOutput) {
+		t.Fatalf("expected an agent output error, got %v", err)
+	}
+	if len(llm.prompts) != RAG.DEFAULT_AGENT_REPAIR_ATTEMPTS+1 || len(outputErr.Attempts) != len(llm.prompts) {
+		t.Errorf("expected %d attempts, got %d", RAG.DEFAULT_AGENT_REPAIR_ATTEMPTS+1, len(llm.prompts))
+	}
+	if errs := outputErr.Attempts[0].Errors; len(errs) != 2 || !strings.Contains(errs[0], "ddl") || !strings.Contains(errs[1], "gyms") {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+
+	// without repairs the first invalid output fails
+	llm.prompts = nil
+	engine.AgentRepairAttempts = -1
+	if _, err := engine.QueryAgent("", "the gyms table has a serial id", "request", 1); !errors.Is(err, RAG.ErrInvalidAgentOutput) || len(llm.prompts) != 1 {
+		t.Errorf("expected a single attempt, got %d prompts and %v", len(llm.prompts), err)
+	}
+}
@@ -51,6 +51,19 @@ type Analytic struct {
 type ChatbotResponse struct {
 	ResponseText string   `json:"response_text"`
 	Sources      []string `json:"sources"`
+	// FromCache is set when the response of a similar earlier query was reused
+	FromCache bool `json:"from_cache"`
+}
+
+// ChatStreamEvent is a single event of a streamed chat response
+// the text arrives as deltas, the last event has Done set and carries the sources or the error
+type ChatStreamEvent struct {
+	Delta   string   `json:"delta,omitempty"`
+	Sources []string `json:"sources,omitempty"`
+	Done    bool     `json:"done"`
+	Err     error    `json:"-"`
+	// FromCache is set on the last event of a response that was answered from the response cache
+	FromCache bool `json:"from_cache,omitempty"`
 }
 
 // TableColumn represents a database column with its properties
@@ -64,6 +77,7 @@ type TableColumn struct {
 	NumericPrecision       *int    `db:"numeric_precision" json:"NumericPrecision"`
 	NumericScale           *int    `db:"numeric_scale" json:"NumericScale"`
 	OrdinalPosition        int     `db:"ordinal_position" json:"OrdinalPosition"`
+	Comment                string  `db:"comment" json:"Comment,omitempty"`
 }
 
 // ConstraintInfo represents database constraints
@@ -86,6 +100,8 @@ type IndexInfo struct {
 	IsUnique   bool   `db:"is_unique" json:"IsUnique"`
 	IndexType  string `db:"index_type" json:"IndexType"`
 	IsPrimary  bool   `db:"is_primary" json:"IsPrimary"`
+	IsIncluded bool   `db:"is_included" json:"IsIncluded,omitempty"`
+	Predicate  string `db:"predicate" json:"Predicate,omitempty"`
 }
 
 type Table struct {
@@ -93,4 +109,5 @@ type Table struct {
 	Columns     []TableColumn    `db:"columns" json:"Columns"`
 	Constraints []ConstraintInfo `db:"constraints" json:"Constraints"`
 	Indexes     []IndexInfo      `db:"indexes" json:"Indexes"`
+	Comment     string           `db:"comment" json:"Comment,omitempty"`
 }
\ No newline at end of file
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+// runAgent asks the agent for schema changes
+func runAgent(ctx context.Context, args []string) error {
+	flags, opts := newFlagSet("agent", RAG.DEFAULT_AGENT_NAMESPACE)
+	schemaFile := flags.String("schema", "", "a file with the current database schema, a pg_dump --schema-only or a JSON list of tables")
+	topK := topKFlag(flags)
+	filter := filterFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	request := strings.Join(flags.Args(), " ")
+	if request == "" {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		request = strings.TrimSpace(string(input))
+	}
+	if request == "" {
+		return errors.New("the agent needs a request")
+	}
+	schema, err := readOptionalFile(*schemaFile)
+	if err != nil {
+		return err
+	}
+
+	ragModel, err := newModel(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer ragModel.Close()
+
+	response, err := ragModel.QueryAgentFiltered(ctx, opts.namespace, schema, request, *topK, *filter)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(response)
+	}
+
+	fmt.Println(response.Response)
+	if len(response.Changes) > 0 {
+		fmt.Println()
+		fmt.Println("Changes:")
+		fmt.Println("--------")
+		for _, change := range response.Changes {
+			fmt.Println("- " + change)
+		}
+	}
+	if response.SchemaDDL != "" {
+		fmt.Println()
+		fmt.Println("Schema DDL:")
+		fmt.Println("-----------")
+		fmt.Println(response.SchemaDDL)
+	}
+	return nil
+}
+
+// runReport writes a report on the database analytics
+func runReport(ctx context.Context, args []string) error {
+	flags, opts := newFlagSetWithoutNamespace("report")
+	schemaFile := flags.String("schema", "", "a file with the current database schema")
+	analyticsFile := flags.String("analytics", "", "a file with the analytics of the database, required")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *analyticsFile == "" {
+		return errors.New("--analytics is required")
+	}
+
+	analytics, err := readOptionalFile(*analyticsFile)
+	if err != nil {
+		return err
+	}
+	schema, err := readOptionalFile(*schemaFile)
+	if err != nil {
+		return err
+	}
+
+	ragModel, err := newModel(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer ragModel.Close()
+
+	report, err := ragModel.ReportContext(ctx, analytics, schema)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(map[string]string{"report": report})
+	}
+	fmt.Println(report)
+	return nil
+}
+
+// readOptionalFile returns the content of the file, an empty path means no content
+func readOptionalFile(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+// runChat is the interactive chat, every answer is streamed unless --json is set
+func runChat(ctx context.Context, args []string) error {
+	flags, opts := newFlagSet("chat", RAG.DEFAULT_CHAT_NAMESPACE)
+	topK := topKFlag(flags)
+	filter := filterFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ragModel, err := newModel(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer ragModel.Close()
+
+	// one conversation per run so that follow-up questions keep their context
+	session := ragModel.NewChatSession()
+	session.Namespace = opts.namespace
+	session.TopK = *topK
+	session.Filter = *filter
+
+	if !opts.json {
+		fmt.Println("Database Chatbot CLI")
+		fmt.Println("====================")
+		fmt.Println("Type your database-related questions, 'reset' to start a new conversation or 'exit' to quit.")
+		fmt.Printf("Using namespace: %s\n\n", opts.namespace)
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		if !opts.json {
+			fmt.Print("> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+
+		userInput := strings.TrimSpace(scanner.Text())
+		switch strings.ToLower(userInput) {
+		case "":
+			continue
+		case "exit":
+			if !opts.json {
+				fmt.Println("Goodbye!")
+			}
+			return nil
+		case "reset":
+			session.Reset()
+			if !opts.json {
+				fmt.Println("Started a new conversation.")
+				fmt.Println()
+			}
+			continue
+		}
+
+		if opts.json {
+			response, err := session.Query(ctx, userInput)
+			if err != nil {
+				printJSON(map[string]string{"error": err.Error()})
+				continue
+			}
+			printJSON(response)
+			continue
+		}
+		streamAnswer(ctx, session, userInput)
+	}
+	return scanner.Err()
+}
+
+// streamAnswer prints the response as it is generated, Ctrl+C stops the current answer
+func streamAnswer(ctx context.Context, session *RAG.ChatSession, userInput string) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	events, err := session.QueryStream(ctx, userInput)
+	if err != nil {
+		fmt.Printf("Error: %v\n\n", err)
+		return
+	}
+
+	// Display the response
+	fmt.Println("\nResponse:")
+	fmt.Println("---------")
+	var sources []string
+	for event := range events {
+		if event.Err != nil {
+			fmt.Printf("\nError: %v\n", event.Err)
+		}
+		fmt.Print(event.Delta)
+		if event.Done {
+			sources = event.Sources
+		}
+	}
+	if ctx.Err() != nil {
+		fmt.Print("\n[interrupted]")
+	}
+	fmt.Println()
+	fmt.Println()
+
+	// Display sources if available
+	if len(sources) > 0 {
+		fmt.Println("Sources:")
+		fmt.Println("--------")
+		for i, source := range sources {
+			fmt.Printf("%d. %s\n", i+1, source)
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Database-Hosting-Services/AI-Agent/RAG"
+)
+
+// runIngest loads a directory, a file with one url per line or a single url into a namespace
+func runIngest(ctx context.Context, args []string) error {
+	flags, opts := newFlagSet("ingest", RAG.DEFAULT_CHAT_NAMESPACE)
+	baseURL := flags.String("base-url", "", "the url the files of a directory are published under, used as their source_url")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: chatbot ingest [flags] <dir|url-list|url>")
+	}
+
+	documents, err := loadDocuments(ctx, flags.Arg(0), *baseURL)
+	if err != nil {
+		return err
+	}
+
+	ragModel, err := newIndexModel(ctx, false)
+	if err != nil {
+		return err
+	}
+	defer ragModel.Close()
+
+	result, err := ragModel.Ingest(ctx, opts.namespace, documents)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(result)
+	}
+	fmt.Printf("Ingested %d documents into %s: %d chunks, %d upserted, %d already stored\n",
+		result.Documents, opts.namespace, result.Chunks, result.Upserted, result.Skipped)
+	return nil
+}
+
+// loadDocuments reads the documents of an ingest source
+func loadDocuments(ctx context.Context, source string, baseURL string) ([]RAG.Document, error) {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return RAG.FetchDocuments(ctx, []string{source}, 0)
+	}
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return RAG.LoadDirectory(source, baseURL)
+	}
+
+	urls, err := readURLList(source)
+	if err != nil {
+		return nil, err
+	}
+	return RAG.FetchDocuments(ctx, urls, 0)
+}
+
+// readURLList reads one url per line, empty lines and lines starting with # are skipped
+func readURLList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	urls := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
+}
+
+// runNamespaces shows the index and its namespaces
+func runNamespaces(ctx context.Context, args []string) error {
+	flags, opts := newFlagSetWithoutNamespace("namespaces")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ragModel, err := newIndexModel(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer ragModel.Close()
+
+	stats, err := ragModel.IndexStats(ctx)
+	if err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(stats)
+	}
+
+	fmt.Printf("Index:      %s\n", stats.Name)
+	if stats.Host != "" {
+		fmt.Printf("Host:       %s\n", stats.Host)
+	}
+	if stats.Status != "" {
+		fmt.Printf("Status:     %s\n", stats.Status)
+	}
+	fmt.Printf("Dimension:  %d\n", stats.Dimension)
+	fmt.Printf("Metric:     %s\n", stats.Metric)
+	fmt.Printf("Vectors:    %d\n\n", stats.TotalVectorCount)
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "NAMESPACE\tVECTORS")
+	for _, namespace := range stats.Namespaces {
+		name := namespace.Name
+		if name == "" {
+			name = "(default)"
+		}
+		fmt.Fprintf(table, "%s\t%d\n", name, namespace.VectorCount)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	if len(stats.Aliases) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(stats.Aliases))
+	for name := range stats.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Println()
+	fmt.Fprintln(table, "ALIAS\tNAMESPACE\tEMBEDDING MODEL\tPREVIOUS")
+	for _, name := range names {
+		alias := stats.Aliases[name]
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", name, alias.Namespace, alias.EmbeddingModel, alias.Previous)
+	}
+	return table.Flush()
+}
+
+// runDeleteNamespace deletes a namespace after a confirmation
+func runDeleteNamespace(ctx context.Context, args []string) error {
+	flags, opts := newFlagSet("delete-namespace", "")
+	yes := flags.Bool("yes", false, "do not ask for a confirmation")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	namespace := opts.namespace
+	if flags.NArg() == 1 {
+		namespace = flags.Arg(0)
+	}
+	if namespace == "" || flags.NArg() > 1 {
+		return errors.New("usage: chatbot delete-namespace [--yes] <namespace>")
+	}
+
+	if !*yes {
+		fmt.Printf("Delete every vector of namespace %q? Type the namespace to confirm: ", namespace)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(answer) != namespace {
+			return errors.New("deletion canceled")
+		}
+	}
+
+	ragModel, err := newIndexModel(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer ragModel.Close()
+
+	if err := ragModel.DeleteNamespace(ctx, namespace); err != nil {
+		return err
+	}
+	if opts.json {
+		return printJSON(map[string]string{"deleted": namespace})
+	}
+	fmt.Printf("Deleted namespace %s\n", namespace)
+	return nil
+}
+
+// runExport writes a snapshot of a namespace to a file or stdout
+func runExport(ctx context.Context, args []string) error {
+	flags, opts := newFlagSet("export", RAG.DEFAULT_CHAT_NAMESPACE)
+	output := flags.String("out", "-", "the file to write, - for stdout")
+	compress := flags.Bool("gzip", false, "compress the snapshot, implied by an --out file ending with .gz")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	options := RAG.SnapshotOptions{Gzip: *compress || strings.HasSuffix(*output, ".gz")}
+
+	ragModel, err := newIndexModel(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer ragModel.Close()
+
+	var w io.Writer = os.Stdout
+	var file *os.File
+	if *output != "-" {
+		// the snapshot is written next to the output and renamed once complete
+		// so that a failed export never leaves a truncated file behind
+		file, err = os.CreateTemp(filepath.Dir(*output), filepath.Base(*output)+".tmp-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(file.Name())
+		defer file.Close()
+		// the temporary file is private, the export keeps the mode of the file it replaces
+		mode := os.FileMode(0644)
+		if info, err := os.Stat(*output); err == nil {
+			mode = info.Mode().Perm()
+		}
+		if err := file.Chmod(mode); err != nil {
+			return err
+		}
+		w = file
+	}
+
+	header, exported, err := ragModel.ExportNamespace(ctx, opts.namespace, w, options)
+	if err != nil {
+		return err
+	}
+	if file != nil {
+		if err := file.Close(); err != nil {
+			return err
+		}
+		if err := os.Rename(file.Name(), *output); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d vectors of %d dimensions from %s\n", exported, header.Dimension, opts.namespace)
+	return nil
+}
+
+// runImport upserts the vectors of a snapshot into a namespace
+func runImport(ctx context.Context, args []string) error {
+	// without --namespace the snapshot is restored into the namespace it was exported from
+	flags, opts := newFlagSet("import", "")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: chatbot import [flags] <file|->")
+	}
+
+	var r io.Reader = os.Stdin
+	if flags.Arg(0) != "-" {
+		file, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	ragModel, err := newIndexModel(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer ragModel.Close()
+
+	header, imported, err := ragModel.ImportNamespace(ctx, opts.namespace, r, RAG.SnapshotOptions{})
+	if err != nil {
+		return err
+	}
+	namespace := opts.namespace
+	if namespace == "" {
+		namespace = header.Namespace
+	}
+	if opts.json {
+		return printJSON(map[string]any{"namespace": namespace, "imported": imported, "snapshot": header})
+	}
+	fmt.Printf("Imported %d vectors into %s\n", imported, namespace)
+	return nil
+}
+
+// runMigrate re-embeds a namespace with the configured embedding model and switches its readers to the result
+func runMigrate(ctx context.Context, args []string) error {
+	flags, opts := newFlagSet("migrate", RAG.DEFAULT_CHAT_NAMESPACE)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if os.Getenv("RAG_NAMESPACE_ALIASES") == "" {
+		return errors.New("RAG_NAMESPACE_ALIASES must name the aliases file the readers load, otherwise they never see the migrated namespace")
+	}
+
+	// the index may still hold the vectors of the previous model, the migration checks the dimension itself
+	ragModel, err := newIndexModel(ctx, true)
+	if err != nil {
+		return err
+	}
+	defer ragModel.Close()
+
+	result, err := ragModel.MigrateNamespace(ctx, opts.namespace)
+	if err != nil {
+		if result.Vectors > 0 {
+			fmt.Fprintf(os.Stderr, "The re-embedded vectors were kept in %s\n", result.Target)
+		}
+		return err
+	}
+	if opts.json {
+		return printJSON(result)
+	}
+	fmt.Printf("Migrated %d vectors of %s from %s to %s, recall %.2f\n", result.Vectors, result.Namespace, result.Source, result.Target, result.Recall)
+	fmt.Printf("The previous vectors are kept in %s, delete them with 'chatbot delete-namespace %s' once the new ones are fine\n", result.Source, result.Source)
+	return nil
+}
@@ -1,82 +1,160 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
 	"os"
 	"strings"
 
 	"github.com/Database-Hosting-Services/AI-Agent/RAG"
 )
 
+const usage = `Database AI agent CLI
+
+Usage:
+  chatbot [command] [flags] [arguments]
+
+Commands:
+  chat                          interactive chat with the knowledge base (default)
+  agent [request]               suggest schema changes for a request, read from stdin when omitted
+  report                        write a report from --schema and --analytics files
+  ingest <dir|url-list|url>     chunk, embed and upsert documents into a namespace
+  namespaces                    show the index and the vector count of every namespace
+  delete-namespace <namespace>  delete every vector of a namespace
+  export                        write a snapshot of a namespace as JSON lines, gzip with --gzip
+  import <file>                 upsert the vectors of a snapshot into a namespace
+  migrate                       re-embed a namespace with the configured embedding model
+
+Common flags:
+  --namespace  the namespace to use, report and namespaces do not use one
+  --json       print machine readable JSON
+
+Context flags of chat and agent:
+  --topk       the number of matches used as context
+  --filter     only use the documents whose metadata matches
+
+Run 'chatbot <command> --help' for the flags of a command.
+`
+
+// command runs a subcommand with its arguments
+type command func(ctx context.Context, args []string) error
+
+var commands = map[string]command{
+	"chat":             runChat,
+	"agent":            runAgent,
+	"report":           runReport,
+	"ingest":           runIngest,
+	"namespaces":       runNamespaces,
+	"delete-namespace": runDeleteNamespace,
+	"export":           runExport,
+	"import":           runImport,
+	"migrate":          runMigrate,
+}
+
 func main() {
-	fmt.Println("Database Chatbot CLI")
-	fmt.Println("====================")
-	fmt.Println("Type your database-related questions or 'exit' to quit.")
-	fmt.Println("Using the fixed namespace: database-articles")
-	fmt.Println()
-
-	// Create RAG configuration from environment variables
-	config := &RAG.RAGConfig{
-		GeminiAPIKey:         os.Getenv("GEMINI_API_KEY"),
-		GeminiModel:          os.Getenv("GEMINI_MODEL"),
-		GeminiEmbeddingModel: os.Getenv("GEMINI_EMBEDDING_MODEL"),
-		PineconeAPIKey:       os.Getenv("PINECONE_API_KEY"),
-		PineconeIndexName:    os.Getenv("PINECONE_INDEX_NAME"),
-		PineconeIndexHost:    os.Getenv("PINECONE_INDEX_HOST"),
+	args := os.Args[1:]
+	if len(args) > 0 && (args[0] == "help" || args[0] == "-h" || args[0] == "--help") {
+		fmt.Print(usage)
+		return
+	}
+	// without a command the chat runs, as it always did
+	name := "chat"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
 
-	// Use the production RAG model, not the test version
-	ragModel := RAG.GetRAG(config)
-	if ragModel == nil {
-		log.Fatal("Failed to initialize RAG model")
+	run, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n%s", name, usage)
+		os.Exit(2)
+	}
+	if err := run(context.Background(), args); err != nil {
+		if err == flag.ErrHelp {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
+}
 
-	scanner := bufio.NewScanner(os.Stdin)
-	// Hard-code the namespace to "database-articles" only
-	const namespace = "database-articles"
-	const topK = 3
+// options are the flags shared by the commands
+type options struct {
+	namespace string
+	json      bool
+}
 
-	fmt.Printf("Using fixed namespace: %s\n\n", namespace)
+// newFlagSet creates the flags of a command with the common ones
+func newFlagSet(name string, defaultNamespace string) (*flag.FlagSet, *options) {
+	flags, opts := newFlagSetWithoutNamespace(name)
+	flags.StringVar(&opts.namespace, "namespace", defaultNamespace, "the namespace to use")
+	return flags, opts
+}
 
-	for {
-		fmt.Print("> ")
-		if !scanner.Scan() {
-			break
-		}
+// newFlagSetWithoutNamespace creates the flags of a command that does not work on a namespace
+func newFlagSetWithoutNamespace(name string) (*flag.FlagSet, *options) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	opts := &options{}
+	flags.BoolVar(&opts.json, "json", false, "print machine readable JSON")
+	return flags, opts
+}
 
-		userInput := scanner.Text()
-		if strings.ToLower(userInput) == "exit" {
-			fmt.Println("Goodbye!")
-			break
-		}
+// topKFlag adds the --topk flag of the commands that retrieve context
+func topKFlag(flags *flag.FlagSet) *int {
+	return flags.Int("topk", RAG.DEFAULT_TOP_K, "the number of matches used as context")
+}
 
+// filterFlag adds the --filter flag of the commands that retrieve context
+func filterFlag(flags *flag.FlagSet) *RAG.MetadataFilter {
+	filter := new(RAG.MetadataFilter)
+	flags.Func("filter", `only use the documents whose metadata matches, e.g. "postgres_version >= 16 and doc_type = 'reference'"`, func(expression string) error {
+		parsed, err := RAG.ParseMetadataFilter(expression)
+		*filter = parsed
+		return err
+	})
+	return filter
+}
 
-		var response RAG.ChatbotResponse
-		var err error
+// newModel creates the RAG model from the environment
+// lazy skips the warm-up calls for the commands that do not use the models
+func newModel(ctx context.Context, lazy bool) (RAG.RAGmodel, error) {
+	config, err := RAG.LoadConfigFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	config.Lazy = config.Lazy || lazy
 
-		response, err = ragModel.QueryChat(userInput)
+	model, err := RAG.NewRAG(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize RAG model: %w", err)
+	}
+	return model, nil
+}
 
-		if err != nil {
-			fmt.Printf("Error: %v\n\n", err)
-			continue
-		}
+// indexModel is the RAG model of the index commands, they write to and manage the vector index
+type indexModel interface {
+	RAG.RAGmodel
+	RAG.IndexWriter
+	RAG.IndexAdmin
+}
 
-		// Display the response
-		fmt.Println("\nResponse:")
-		fmt.Println("---------")
-		fmt.Println(response.ResponseText)
-		fmt.Println()
-
-		// Display sources if available
-		if len(response.Sources) > 0 {
-			fmt.Println("Sources:")
-			fmt.Println("--------")
-			for i, source := range response.Sources {
-				fmt.Printf("%d. %s\n", i+1, source)
-			}
-			fmt.Println()
-		}
+// newIndexModel creates the RAG model of the index commands from the environment
+func newIndexModel(ctx context.Context, lazy bool) (indexModel, error) {
+	model, err := newModel(ctx, lazy)
+	if err != nil {
+		return nil, err
 	}
+	indexed, ok := model.(indexModel)
+	if !ok {
+		model.Close()
+		return nil, fmt.Errorf("%w: the RAG model cannot manage its vector index", RAG.ErrUnsupported)
+	}
+	return indexed, nil
+}
+
+func printJSON(value any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
 }